@@ -0,0 +1,132 @@
+package peek
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResultCache(t *testing.T) {
+	cache := jsonpath.NewResultCache(0)
+	doc := cty.Value(sampleDoc)
+
+	first, _, err := cache.Eval("$..C", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, paths, err := cache.Eval("$..C", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 4 || len(second) != 4 || len(paths) != 4 {
+		t.Fatalf("unexpected result sizes %d %d %d", len(first), len(second), len(paths))
+	}
+	if cache.Len() != 1 {
+		t.Fatal("expected a single cached entry, got", cache.Len())
+	}
+
+	other := cty.ObjectVal(map[string]cty.Value{"C": cty.NumberIntVal(1)})
+	if vals, _, _ := cache.Eval("$..C", other); len(vals) != 1 {
+		t.Fatal("cache returned a result for the wrong document", vals)
+	}
+	if cache.Len() != 2 {
+		t.Fatal("expected two cached entries, got", cache.Len())
+	}
+
+	cache.Invalidate(doc)
+	if cache.Len() != 1 {
+		t.Fatal("Invalidate() should only drop entries of the given doc, got", cache.Len())
+	}
+
+	if _, _, err := cache.Eval(`$["]`, doc); err == nil {
+		t.Fatal("invalid path should fail")
+	}
+
+	// the least recently used results make room for new ones
+	small := jsonpath.NewResultCache(2)
+	small.Eval("$.A", doc)
+	small.Eval("$.B", doc)
+	small.Eval("$.A", doc)
+	small.Eval("$.C", doc)
+	if small.Len() != 2 {
+		t.Fatal("expected the cache to keep 2 entries, got", small.Len())
+	}
+	small.Invalidate(doc)
+	if small.Len() != 0 {
+		t.Fatal("expected $.A and $.C to be the cached entries, got", small.Len())
+	}
+	small.Eval("$.B", doc)
+	small.Eval("$.B", other)
+	small.Eval("$.C", doc)
+	small.Invalidate(other)
+	if small.Len() != 1 {
+		t.Fatal("expected the first $.B result to be evicted, got", small.Len())
+	}
+}
+
+func TestDocumentCache(t *testing.T) {
+	cache := jsonpath.NewResultCache(0)
+	doc := jsonpath.NewDocument(cty.Value(sampleDoc), jsonpath.WithCache(cache))
+	for i := 0; i < 2; i++ {
+		if vals, _, err := doc.Eval("$..C"); err != nil || len(vals) != 4 {
+			t.Fatal(vals, err)
+		}
+	}
+	if cache.Len() != 1 {
+		t.Fatal("expected a single cached entry, got", cache.Len())
+	}
+	if err := doc.Set("$.C", cty.NumberIntVal(1)); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 0 {
+		t.Fatal("Set should drop the results of the replaced snapshot, got", cache.Len())
+	}
+	if vals, _, _ := doc.Eval("$.C"); len(vals) != 1 || !vals[0].RawEquals(cty.NumberIntVal(1)) {
+		t.Fatal("unexpected result after Set", vals)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	p := jsonpath.MustNewPath("$.items[?(@.n > 1)].n", jsonpath.WithMemoizedFilters())
+	doc := func(k int) cty.Value {
+		items := []cty.Value{}
+		for i := 0; i < 4; i++ {
+			items = append(items, cty.ObjectVal(map[string]cty.Value{"n": cty.NumberIntVal(int64(i * k))}))
+		}
+		return cty.ObjectVal(map[string]cty.Value{"items": cty.TupleVal(items)})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := jsonpath.NewEvalContext()
+			for k := 1; k <= 3; k++ {
+				// twice per document, the second time reusing its marks
+				for i := 0; i < 2; i++ {
+					vals, paths, err := p.Eval(doc(k), jsonpath.WithEvalContext(ctx))
+					if err != nil {
+						errs <- err
+						return
+					}
+					want := map[int]int{1: 2, 2: 3, 3: 3}[k]
+					if len(vals) != want || len(paths) != want || !paths[0].Equals(cty.GetAttrPath("items").IndexInt(4-want).GetAttr("n")) {
+						errs <- fmt.Errorf("document %d: unexpected results %#v %#v", k, vals, paths)
+						return
+					}
+				}
+			}
+			ctx.Reset()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
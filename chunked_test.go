@@ -0,0 +1,108 @@
+package peek
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+func TestEvalChunked(t *testing.T) {
+	for _, expr := range []string{"$", "$.A[*]", "$.*.Type[*]", "$..C", "$.F.Type[4:6][*]", "$.store.book[*].title"} {
+		for _, doc := range []cty.Value{cty.Value(sampleDoc), storeExample.Value} {
+			p, err := jsonpath.NewPath(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, _, err := p.Eval(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := []cty.Value{}
+			err = p.EvalChunked(doc, jsonpath.EvalOptions{ChunkSize: 2}, func(vals []cty.Value, paths []cty.Path) error {
+				if len(vals) > 2 {
+					t.Errorf("%s: batch of %d exceeds the chunk size", expr, len(vals))
+				}
+				actual = append(actual, vals...)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exp, _ := ctyjson.SimpleJSONValue{Value: cty.TupleVal(expected)}.MarshalJSON()
+			act, _ := ctyjson.SimpleJSONValue{Value: cty.TupleVal(actual)}.MarshalJSON()
+			if string(exp) != string(act) {
+				t.Errorf("%s: chunked result differs\nexpected: %s\nactual: %s", expr, exp, act)
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	p, _ := jsonpath.NewPath("$.A[*]")
+	batches := 0
+	err := p.EvalChunked(cty.Value(sampleDoc), jsonpath.EvalOptions{ChunkSize: 1}, func(vals []cty.Value, paths []cty.Path) error {
+		batches++
+		return stop
+	})
+	if err != stop || batches != 1 {
+		t.Fatal("emit error should stop the evaluation", err, batches)
+	}
+}
+
+func TestEvalChunkedContainers(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"n": cty.NullVal(cty.List(cty.String)),
+		"u": cty.UnknownVal(cty.List(cty.String)),
+		"s": cty.SetVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"l": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	})
+	for expr, want := range map[string]int{"$.n.*": 0, "$.u.*": 0, "$.s.*": 0, "$.l.*": 2, "$.*.*": 2} {
+		p := jsonpath.MustNewPath(expr)
+		expected, _, err := p.Eval(doc)
+		if err != nil || len(expected) != want {
+			t.Fatalf("%s: expected %d results, got %v, %v", expr, want, expected, err)
+		}
+		got := 0
+		err = p.EvalChunked(doc, jsonpath.EvalOptions{ChunkSize: 1}, func(vals []cty.Value, paths []cty.Path) error {
+			if len(vals) != len(paths) {
+				t.Errorf("%s: %d values with %d paths", expr, len(vals), len(paths))
+			}
+			got += len(vals)
+			return nil
+		})
+		if err != nil || got != want {
+			t.Errorf("%s: expected %d chunked results, got %d, %v", expr, want, got, err)
+		}
+	}
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	p, _ := jsonpath.NewPath("$.store.book[*].title")
+	if _, _, err := p.EvalWithOptions(storeExample.Value, jsonpath.EvalOptions{MaxResultBytes: 10000}); err != nil {
+		t.Fatal("generous budget shouldn't fail:", err)
+	}
+
+	for _, opts := range []jsonpath.EvalOptions{
+		{MaxResultBytes: 50},
+		{MaxResultBytes: 50, ChunkSize: 1},
+	} {
+		_, _, err := p.EvalWithOptions(storeExample.Value, opts)
+		var budgetErr *jsonpath.BudgetError
+		if !errors.As(err, &budgetErr) {
+			t.Fatalf("expected a BudgetError, got %v", err)
+		}
+		if budgetErr.Limit != 50 || budgetErr.Estimated <= 50 || !errors.Is(err, jsonpath.ErrBudgetExceeded) || errors.Is(err, jsonpath.ErrOverflow) {
+			t.Fatal("unexpected budget error", budgetErr)
+		}
+	}
+
+	// only the results count, not the subtrees visited to find them
+	isbns, _, err := jsonpath.MustNewPath("$..isbn").Eval(storeExample.Value, jsonpath.WithMaxResultBytes(50))
+	if err != nil || len(isbns) != 2 {
+		t.Errorf("small results of a large document should fit, got %v, %v", isbns, err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package conformance runs JSONPath test corpora against the jsonpath
+// package and reports, per query, whether it matches the expected result.
+//
+// Corpora use the layout of the json-path-comparison project
+// (https://github.com/cburgmer/json-path-comparison) regression suite,
+// written as JSON: a list of queries, each with a selector, a document and
+// the consensus of the implementations compared there.
+//
+//	{"queries": [
+//	  {"id": "array_index", "selector": "$[2]", "document": [1, 2, 3], "consensus": [3]},
+//	  {"id": "wildcard", "selector": "$.*", "document": {"a": 1, "b": 2}, "consensus": [1, 2], "ordered": false},
+//	  {"id": "single_equals", "selector": "$[?(@.a=1)]", "document": [], "consensus": "NOT_SUPPORTED"}
+//	]}
+//
+// A query without a consensus is reported but not judged. The package ships
+// a subset of that suite, see Builtin.
+package conformance
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// NotSupported is the consensus of queries every engine should reject.
+const NotSupported = "NOT_SUPPORTED"
+
+// Corpus is a list of queries with their expected results.
+type Corpus struct {
+	Queries []Query `json:"queries"`
+}
+
+// Query is one entry of a Corpus.
+type Query struct {
+	ID       string          `json:"id"`
+	Selector string          `json:"selector"`
+	Document json.RawMessage `json:"document"`
+	// Consensus is the expected list of matches, the string NotSupported,
+	// or absent when there is none.
+	Consensus json.RawMessage `json:"consensus,omitempty"`
+	// Ordered is false when the matches may come in any order.
+	Ordered *bool `json:"ordered,omitempty"`
+}
+
+//go:embed corpus.json
+var builtin []byte
+
+// Builtin returns the corpus shipped with the package: a subset of the
+// json-path-comparison regression suite.
+func Builtin() *Corpus {
+	c, err := Load(bytes.NewReader(builtin))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load reads a corpus in JSON form.
+func Load(r io.Reader) (*Corpus, error) {
+	var c Corpus
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("conformance: %w", err)
+	}
+	return &c, nil
+}
+
+// LoadFile is Load reading the file at path.
+func LoadFile(path string) (*Corpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Status is the outcome of a query.
+type Status string
+
+const (
+	// Pass means the matches equal the consensus, or the query was
+	// rejected as the consensus requires.
+	Pass Status = "pass"
+	// Fail means the matches differ from the consensus, or a query the
+	// consensus rejects was accepted.
+	Fail Status = "fail"
+	// Error means the query failed although the consensus has matches.
+	Error Status = "error"
+	// NoConsensus means there is nothing to compare with.
+	NoConsensus Status = "no consensus"
+)
+
+// Result is the outcome of one query.
+type Result struct {
+	ID       string
+	Selector string
+	Status   Status
+	// Got holds the matches as JSON, nil if the evaluation failed.
+	Got []json.RawMessage
+	Err error
+}
+
+// Evaluator evaluates selector against doc.
+type Evaluator func(doc cty.Value, selector string) ([]cty.Value, error)
+
+// Eval is the Evaluator of the jsonpath package with default options.
+func Eval(doc cty.Value, selector string) ([]cty.Value, error) {
+	p, err := jsonpath.NewPath(selector)
+	if err != nil {
+		return nil, err
+	}
+	vals, _, err := p.Eval(doc)
+	return vals, err
+}
+
+// Run evaluates every query of c with Eval.
+func Run(c *Corpus) *Report {
+	return RunWith(c, Eval)
+}
+
+// RunWith evaluates every query of c with eval. Panics are recovered and
+// reported as errors.
+func RunWith(c *Corpus, eval Evaluator) *Report {
+	report := &Report{}
+	for _, q := range c.Queries {
+		report.Results = append(report.Results, runQuery(q, eval))
+	}
+	return report
+}
+
+func runQuery(q Query, eval Evaluator) (res Result) {
+	res = Result{ID: q.ID, Selector: q.Selector}
+	defer func() {
+		if r := recover(); r != nil {
+			res.Got = nil
+			res.Err = fmt.Errorf("panic: %v", r)
+			res.Status = judgeError(q)
+		}
+	}()
+
+	doc, err := jsonpath.DecodeJSONStrict(q.Document)
+	if err != nil {
+		res.Err = fmt.Errorf("invalid document: %w", err)
+		res.Status = Error
+		return res
+	}
+	vals, err := eval(doc, q.Selector)
+	if err != nil {
+		res.Err = err
+		res.Status = judgeError(q)
+		return res
+	}
+	res.Got, err = marshalAll(vals)
+	if err != nil {
+		res.Err = err
+		res.Status = Error
+		return res
+	}
+	res.Status = judge(q, res.Got)
+	return res
+}
+
+func judgeError(q Query) Status {
+	switch {
+	case len(q.Consensus) == 0:
+		return NoConsensus
+	case isNotSupported(q.Consensus):
+		return Pass
+	}
+	return Error
+}
+
+func judge(q Query, got []json.RawMessage) Status {
+	switch {
+	case len(q.Consensus) == 0:
+		return NoConsensus
+	case isNotSupported(q.Consensus):
+		return Fail
+	}
+	var expected []json.RawMessage
+	if err := json.Unmarshal(q.Consensus, &expected); err != nil {
+		return Fail
+	}
+	if len(expected) != len(got) {
+		return Fail
+	}
+	want, have := canonical(expected), canonical(got)
+	if q.Ordered != nil && !*q.Ordered {
+		sort.Strings(want)
+		sort.Strings(have)
+	}
+	if reflect.DeepEqual(want, have) {
+		return Pass
+	}
+	return Fail
+}
+
+func isNotSupported(consensus json.RawMessage) bool {
+	var s string
+	return json.Unmarshal(consensus, &s) == nil && s == NotSupported
+}
+
+// canonical re-encodes JSON values so equal values compare equal as
+// strings: object keys are sorted and numbers normalized.
+func canonical(vals []json.RawMessage) []string {
+	out := make([]string, len(vals))
+	for i, raw := range vals {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			out[i] = string(raw)
+			continue
+		}
+		b, _ := json.Marshal(v)
+		out[i] = string(b)
+	}
+	return out
+}
+
+func marshalAll(vals []cty.Value) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, len(vals))
+	for i, v := range vals {
+		v, _ = v.UnmarkDeep()
+		b, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, err
+		}
+		out[i] = b
+	}
+	return out, nil
+}
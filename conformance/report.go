@@ -0,0 +1,62 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Report collects the results of a run, in corpus order.
+type Report struct {
+	Results []Result
+}
+
+// Count returns how many queries ended with status.
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Statuses maps query ids to their status, e.g. to compare two runs.
+func (r *Report) Statuses() map[string]Status {
+	out := make(map[string]Status, len(r.Results))
+	for _, res := range r.Results {
+		out[res.ID] = res.Status
+	}
+	return out
+}
+
+// WriteMarkdown writes the report as a Markdown table preceded by a
+// summary line.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d queries: %d pass, %d fail, %d error, %d without consensus\n\n",
+		len(r.Results), r.Count(Pass), r.Count(Fail), r.Count(Error), r.Count(NoConsensus))
+	b.WriteString("| id | selector | status | result |\n")
+	b.WriteString("|---|---|---|---|\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "| %s | `%s` | %s | %s |\n", res.ID, escapeCell(res.Selector), res.Status, escapeCell(describe(res)))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func describe(res Result) string {
+	if res.Err != nil {
+		return res.Err.Error()
+	}
+	parts := make([]string, len(res.Got))
+	for i, raw := range res.Got {
+		parts[i] = string(raw)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func escapeCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,34 @@
+package peek
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/clean8s/peekcty/conformance"
+)
+
+var updateReport = flag.Bool("update-conformance", false, "rewrite test_fixture_conformance.md")
+
+// TestConformance runs the builtin corpus and compares the report with the
+// one checked in, so changes in behaviour show up in review.
+func TestConformance(t *testing.T) {
+	var buf bytes.Buffer
+	if err := conformance.Run(conformance.Builtin()).WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const golden = "test_fixture_conformance.md"
+	if *updateReport {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Errorf("conformance report changed, rerun with -update-conformance and review the diff:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,116 @@
+// Package core is the stable subset of package jsonpath: compiling
+// expressions, evaluating them against cty values, and storing or deleting
+// the values they match.
+//
+// # Compatibility
+//
+// Within major version 1 of the module, core keeps its API source
+// compatible, and an expression keeps the results it has: the syntax is that
+// of jsonpath.GrammarVersion 1, results come in document order, and failures
+// wrap the errors below so errors.Is keeps working. Fixes to behavior that
+// contradicts this documentation are the only exception.
+//
+// Package jsonpath has no such promise. Its options, expression functions,
+// documents and stores, streaming and the other subsystems built on the
+// engine still change between minor versions; programs that need no more
+// than core can depend on it alone and upgrade without churn.
+package core
+
+import (
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Errors wrapped by the failures of this package, shared with package
+// jsonpath.
+var (
+	// ErrSyntax means an expression is malformed.
+	ErrSyntax = jsonpath.ErrSyntax
+	// ErrNotFound means a required location doesn't exist in the document.
+	ErrNotFound = jsonpath.ErrNotFound
+	// ErrTypeMismatch means a step was applied to a value of the wrong type,
+	// e.g. indexing a string.
+	ErrTypeMismatch = jsonpath.ErrTypeMismatch
+	// ErrIndexOutOfBounds means an index falls outside an array.
+	ErrIndexOutOfBounds = jsonpath.ErrIndexOutOfBounds
+	// ErrUnsupported means an expression or a write needs something this
+	// package doesn't implement.
+	ErrUnsupported = jsonpath.ErrUnsupported
+)
+
+// Result is a value matched by an expression, with its location in the
+// document.
+type Result struct {
+	Path  cty.Path
+	Value cty.Value
+}
+
+// Path is a compiled expression. It is safe for concurrent use.
+type Path struct {
+	p *jsonpath.JSONPath
+}
+
+// Compile parses expr, e.g. `$.spec.containers[?(@.name == 'api')].image`.
+// Invalid expressions fail with an error wrapping ErrSyntax.
+func Compile(expr string) (*Path, error) {
+	p, err := jsonpath.NewPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Path{p: p}, nil
+}
+
+// MustCompile is Compile that panics on invalid expressions, for
+// expressions known at compile time.
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the expression p was compiled from.
+func (p *Path) String() string {
+	return p.p.String()
+}
+
+// Eval returns the values p matches in doc, in document order. Matching
+// nothing is not an error.
+func (p *Path) Eval(doc cty.Value) ([]Result, error) {
+	// a JSONPath keeps its evaluation state, in a context of its own for
+	// each call
+	matches, err := p.p.EvalMatches(doc, jsonpath.WithEvalContext(jsonpath.NewEvalContext()))
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(matches))
+	for i, m := range matches {
+		results[i] = Result{Path: m.Path, Value: m.Value}
+	}
+	return results, nil
+}
+
+// Eval compiles expr and evaluates it against doc.
+func Eval(doc cty.Value, expr string) ([]Result, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Eval(doc)
+}
+
+// Set returns a copy of doc with value stored at expr. A definite location,
+// made of fields and non-negative indexes only, is created along with any
+// missing objects leading to it; otherwise every existing match is
+// replaced.
+func Set(doc cty.Value, expr string, value cty.Value) (cty.Value, error) {
+	return jsonpath.Set(doc, expr, value)
+}
+
+// Delete returns a copy of doc without the locations expr matches:
+// attributes and map keys are dropped, and array elements removed with the
+// following ones shifting down.
+func Delete(doc cty.Value, expr string) (cty.Value, error) {
+	return jsonpath.Delete(doc, expr)
+}
@@ -0,0 +1,60 @@
+package peek
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/clean8s/peekcty/core"
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCore(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{"pods": [{"name": "a", "size": 1}, {"name": "b", "size": 3}]}`))
+	results, err := core.Eval(doc, "$.pods[?(@.size > 2)].name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || jsonpath.FormatPath(results[0].Path) != "$.pods[1].name" || results[0].Value.AsString() != "b" {
+		t.Errorf("unexpected results %v", results)
+	}
+	if p := core.MustCompile("$.pods[*].name"); p.String() != "$.pods[*].name" {
+		t.Errorf("String: got %s", p.String())
+	}
+	if _, err := core.Compile("$.pods[?("); !errors.Is(err, core.ErrSyntax) {
+		t.Errorf("Compile: got %v, want ErrSyntax", err)
+	}
+
+	doc, err = core.Set(doc, "$.pods[0].size", cty.NumberIntVal(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err = core.Delete(doc, "$.pods[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jsonpath.DebugString(doc); got != `{"pods": [{"name": "a", "size": 5}]}` {
+		t.Errorf("Set and Delete: got %s", got)
+	}
+}
+
+// Run with -race: a compiled Path is shared by the goroutines.
+func TestCoreConcurrentEval(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{"a": [1, 2, 3]}`))
+	p := core.MustCompile("$.a[?(@ > 1)]")
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if results, err := p.Eval(doc); err != nil || len(results) != 2 {
+					t.Errorf("unexpected results %v, %v", results, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
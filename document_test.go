@@ -0,0 +1,1460 @@
+package peek
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func TestReplaceByPath(t *testing.T) {
+	doc, err := jsonpath.ReplaceByPath(cty.Value(sampleDoc), "$..C", cty.StringVal("pi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(doc), map[string]Val{
+		"$..C": Tuple(Str("pi"), Str("pi"), Str("pi"), Str("pi")),
+		"$.B":  Tuple(Str("value")),
+	})
+	// original is untouched
+	assert(t, sampleDoc, map[string]Val{
+		"$.C": Tuple(NumFloat(3.14)),
+	})
+}
+
+func TestDocumentSubscribe(t *testing.T) {
+	doc := jsonpath.NewDocument(cty.Value(sampleDoc))
+	cache := jsonpath.NewResultCache(0)
+	doc.UseCache(cache)
+
+	if _, _, err := doc.Eval("$.D.C"); err != nil {
+		t.Fatal(err)
+	}
+
+	var dCalls, eCalls int
+	var lastD []cty.Value
+	unsubD, err := doc.Subscribe("$.D..C", func(vals []cty.Value, paths []cty.Path) {
+		dCalls++
+		lastD = vals
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Subscribe("$.E.A[0]", func(vals []cty.Value, paths []cty.Path) {
+		eCalls++
+	})
+
+	if err := doc.Set("$.D.C", cty.NumberIntVal(3)); err != nil {
+		t.Fatal(err)
+	}
+	if dCalls != 1 || eCalls != 0 {
+		t.Fatalf("expected only the $.D subscriber to run, got D=%d E=%d", dCalls, eCalls)
+	}
+	if len(lastD) != 2 || !lastD[0].RawEquals(cty.NumberIntVal(3)) {
+		t.Fatal("subscriber got stale values", lastD)
+	}
+	if cache.Len() != 0 {
+		t.Fatal("write should invalidate the cached snapshot")
+	}
+
+	unsubD()
+	doc.Set("$.E.A[0]", cty.StringVal("x"))
+	doc.Set("$.D.C", cty.NumberIntVal(4))
+	if dCalls != 1 || eCalls != 1 {
+		t.Fatalf("unexpected notification counts D=%d E=%d", dCalls, eCalls)
+	}
+}
+
+// Run with -race: subscribers are evaluated outside the document's lock.
+func TestDocumentConcurrentWrites(t *testing.T) {
+	doc := jsonpath.NewDocument(cty.ObjectVal(map[string]cty.Value{"n": cty.NumberIntVal(0)}))
+	var calls atomic.Int64
+	if _, err := doc.Subscribe("$.*", func(vals []cty.Value, paths []cty.Path) {
+		calls.Add(1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := doc.Set("$.n", cty.NumberIntVal(int64(g*100+i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if calls.Load() != 8*20 {
+		t.Errorf("expected a notification per write, got %d", calls.Load())
+	}
+}
+
+func TestDetach(t *testing.T) {
+	original := jsonpath.NewDocument(storeExample.Value)
+	matches, err := jsonpath.MustNewPath("$.store.book[?(@.price > 10)]").EvalMatches(original.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragments := matches.Detach()
+	if len(fragments) != 2 {
+		t.Fatalf("expected 2 fragments, got %d", len(fragments))
+	}
+	book := fragments[0]
+	if !book.Base().Equals(cty.GetAttrPath("store").GetAttr("book").IndexInt(1)) {
+		t.Fatal("unexpected base", book.Base())
+	}
+	_, paths, err := book.Eval("$.title")
+	if err != nil || len(paths) != 1 {
+		t.Fatal(paths, err)
+	}
+	if got := jsonpath.PrettyCtyPath(book.Absolute(paths[0])); got != ".store.book[1].title" {
+		t.Errorf("unexpected absolute path %s", got)
+	}
+
+	if err := book.Set("$.price", cty.NumberIntVal(5)); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := book.ApplyTo(original.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	price, _, _ := jsonpath.MustNewPath("$.store.book[1].price").Eval(updated)
+	if !price[0].RawEquals(cty.NumberIntVal(5)) {
+		t.Error("ApplyTo should store the edited fragment, got", price)
+	}
+
+	var notified int
+	original.Subscribe("$.store.book[*].price", func([]cty.Value, []cty.Path) { notified++ })
+	if err := book.WriteBack(original); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 1 || !original.Value().RawEquals(updated) {
+		t.Errorf("WriteBack should update the original once, notified %d times", notified)
+	}
+}
+
+func TestReplaceFunc(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"web": cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(2)}),
+		"db":  cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)}),
+	})
+	out, err := jsonpath.ReplaceFunc(doc, "$..replicas", func(old cty.Value, path cty.Path) (cty.Value, error) {
+		return old.Add(cty.NumberIntVal(1)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.web.replicas": Tuple(Num(3)),
+		"$.db.replicas":  Tuple(Num(2)),
+	})
+
+	// the same location matched twice is only replaced once
+	out, _ = jsonpath.ReplaceFunc(doc, "$.web['replicas','replicas']", func(old cty.Value, path cty.Path) (cty.Value, error) {
+		return old.Add(cty.NumberIntVal(1)), nil
+	})
+	assert(t, Val(out), map[string]Val{"$.web.replicas": Tuple(Num(3))})
+
+	failure := errors.New("nope")
+	out, err = jsonpath.ReplaceFunc(doc, "$..replicas", func(old cty.Value, path cty.Path) (cty.Value, error) {
+		return cty.NilVal, failure
+	})
+	var pathErr *jsonpath.PathError
+	if !errors.Is(err, failure) || !errors.As(err, &pathErr) || len(pathErr.Path) != 2 {
+		t.Fatal("expected the callback error with its path, got", err)
+	}
+	if !out.RawEquals(doc) {
+		t.Error("a failed replacement should return the original document")
+	}
+}
+
+func TestSetAndCopy(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"spec":   cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)}),
+		"labels": cty.MapVal(map[string]cty.Value{"app": cty.StringVal("web")}),
+		"empty":  cty.NullVal(cty.DynamicPseudoType),
+		"list":   cty.TupleVal([]cty.Value{cty.StringVal("a")}),
+	})
+
+	for expr, value := range map[string]cty.Value{
+		"$.spec.replicas":       cty.NumberIntVal(3),
+		"$.spec.template.image": cty.StringVal("nginx"),
+		"$.labels.team":         cty.StringVal("core"),
+		"$.empty.a[0].b":        cty.True,
+		"$.list[1]":             cty.StringVal("b"),
+		"$.created[0]":          cty.Zero,
+	} {
+		out, err := jsonpath.Set(doc, expr, value)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		assert(t, Val(out), map[string]Val{expr: Tuple(Val(value))})
+	}
+
+	for expr, kind := range map[string]error{
+		"$.list[5]":          jsonpath.ErrIndexOutOfBounds,
+		"$.created[2]":       jsonpath.ErrIndexOutOfBounds,
+		"$.spec.replicas.x":  jsonpath.ErrTypeMismatch,
+		"$.labels.team.name": jsonpath.ErrTypeMismatch,
+	} {
+		if _, err := jsonpath.Set(doc, expr, cty.True); !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, got %v", expr, kind, err)
+		}
+	}
+
+	out, err := jsonpath.CopyByPath(cty.Value(sampleDoc), "$.D.Type[2]", doc, "$.spec.fragment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{"$.spec.fragment.C": Tuple(NumFloat(3.141592))})
+
+	if _, err := jsonpath.CopyByPath(cty.Value(sampleDoc), "$..C", doc, "$.x"); !errors.Is(err, jsonpath.ErrMultipleMatches) {
+		t.Error("expected ErrMultipleMatches, got", err)
+	}
+	if _, err := jsonpath.CopyByPath(cty.Value(sampleDoc), "$.nope", doc, "$.x"); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Error("expected ErrNotFound, got", err)
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	template := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("TODO"),
+		"ports": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(0)}),
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(0)}),
+		}),
+	})
+
+	out, err := jsonpath.Instantiate(template, map[string]cty.Value{
+		"$.name":          cty.StringVal("web"),
+		"$.ports[*].port": cty.NumberIntVal(80),
+		"$.ports[1].port": cty.NumberIntVal(443),
+	}, jsonpath.InstantiateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.name":          Tuple(Str("web")),
+		"$.ports[*].port": Tuple(Num(80), Num(443)),
+	})
+
+	_, err = jsonpath.Instantiate(template, map[string]cty.Value{
+		"$.name":          cty.StringVal("web"),
+		"$.image":         cty.StringVal("nginx"),
+		"$.ports[?(@.x)]": cty.True,
+	}, jsonpath.InstantiateOptions{})
+	var multi *jsonpath.MultiPathError
+	if !errors.As(err, &multi) || len(multi.Errors) != 2 || !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Fatal("expected both missing paths to be reported, got", err)
+	}
+
+	out, err = jsonpath.Instantiate(template, map[string]cty.Value{
+		"$.image": cty.StringVal("nginx"),
+	}, jsonpath.InstantiateOptions{Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{"$.image": Tuple(Str("nginx"))})
+}
+
+func TestDryRun(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"spec": cty.ObjectVal(map[string]cty.Value{
+			"replicas": cty.NumberIntVal(1),
+			"ports":    cty.TupleVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+			"labels":   cty.NullVal(cty.Map(cty.String)),
+		}),
+	})
+	preview := func(name string, edit func(opt jsonpath.Option) (cty.Value, error), want string) {
+		t.Helper()
+		var changes []jsonpath.Change
+		out, err := edit(jsonpath.WithDryRun(&changes))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if !out.RawEquals(doc) {
+			t.Error(name, "changed the document")
+		}
+		patch, _ := jsonpath.MarshalPatch(changes)
+		if string(patch) != want {
+			t.Errorf("%s: unexpected changes %s", name, patch)
+		}
+	}
+
+	preview("Set", func(opt jsonpath.Option) (cty.Value, error) {
+		return jsonpath.Set(doc, "$.spec.replicas", cty.NumberIntVal(3), opt)
+	}, `[{"op":"replace","path":"/spec/replicas","value":3}]`)
+	preview("Set creating parents", func(opt jsonpath.Option) (cty.Value, error) {
+		return jsonpath.Set(doc, "$.spec.strategy.type", cty.StringVal("Recreate"), opt)
+	}, `[{"op":"add","path":"/spec/strategy","value":{"type":"Recreate"}}]`)
+	preview("Set of a filter", func(opt jsonpath.Option) (cty.Value, error) {
+		return jsonpath.Set(doc, "$.spec.ports[?(@ > 100)]", cty.NumberIntVal(8443), opt)
+	}, `[{"op":"replace","path":"/spec/ports/1","value":8443}]`)
+	preview("Delete", func(opt jsonpath.Option) (cty.Value, error) {
+		return jsonpath.Delete(doc, "$.spec.ports[*]", opt)
+	}, `[{"op":"remove","path":"/spec/ports/1"},{"op":"remove","path":"/spec/ports/0"}]`)
+	preview("ApplyPatch", func(opt jsonpath.Option) (cty.Value, error) {
+		return jsonpath.ApplyPatch(doc, []byte(`[
+			{"op": "test", "path": "/spec/replicas", "value": 1},
+			{"op": "add", "path": "/spec/ports/-", "value": 8080},
+			{"op": "move", "from": "/spec/replicas", "path": "/replicas"}
+		]`), opt)
+	}, `[{"op":"add","path":"/spec/ports/2","value":8080},{"op":"move","from":"/spec/replicas","path":"/replicas"}]`)
+
+	var changes []jsonpath.Change
+	_, err := jsonpath.Instantiate(doc, map[string]cty.Value{"$.spec.replicas": cty.NumberIntVal(2)},
+		jsonpath.InstantiateOptions{DryRun: &changes})
+	if err != nil || len(changes) != 1 || !changes[0].Old.RawEquals(cty.NumberIntVal(1)) || !changes[0].New.RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected Instantiate preview %#v, %v", changes, err)
+	}
+
+	// a failing edit still fails
+	if _, err := jsonpath.ApplyPatch(doc, []byte(`[{"op": "remove", "path": "/nope"}]`), jsonpath.WithDryRun(&changes)); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Error("expected ErrNotFound, got", err)
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{
+		"replicaCount": 2,
+		"spec": {"replicaCount": 3, "image": "web", "tag": "1.0"},
+		"sidecars": [{"image": "proxy", "tag": "2.0"}]
+	}`))
+	doc = jsonpath.MustSet(doc, "$.spec.image", cty.StringVal("web").Mark("reviewed"))
+
+	out, err := jsonpath.RenameKeys(doc, map[string]string{"replicaCount": "replicas", "image": "tag", "tag": "image"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.replicas":        Tuple(Num(2)),
+		"$.spec.replicas":   Tuple(Num(3)),
+		"$.spec.image":      Tuple(Str("1.0")),
+		"$..replicaCount":   Tuple(),
+		"$.sidecars[0].tag": Tuple(Str("proxy")),
+	})
+	if tag, _, _ := jsonpath.MustNewPath("$.spec.tag").Eval(out); len(tag) != 1 || !tag[0].HasMark("reviewed") {
+		t.Errorf("marks didn't follow the renamed key: %#v", tag)
+	}
+
+	out, err = jsonpath.RenameKeys(doc, map[string]string{"replicaCount": "replicas"}, "$.spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.replicaCount":  Tuple(Num(2)),
+		"$.spec.replicas": Tuple(Num(3)),
+	})
+
+	if _, err := jsonpath.RenameKeys(doc, map[string]string{"tag": "image"}, "$.spec"); !errors.Is(err, jsonpath.ErrConflict) {
+		t.Error("expected ErrConflict, got", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{"replicaCount": 2, "image": "web:1.0", "ports": [80]}`))
+	migrations := []jsonpath.Migration{
+		{Version: 3, Description: "drop ports", Transform: func(t *jsonpath.Txn) error {
+			return t.Delete("$.ports")
+		}},
+		{Version: 2, Description: "move the image under spec", Transform: func(t *jsonpath.Txn) error {
+			if err := t.Move("$.image", "$.spec.image"); err != nil {
+				return err
+			}
+			return t.Move("$.replicaCount", "$.spec.replicas")
+		}},
+	}
+
+	out, patch, err := jsonpath.Migrate(doc, 1, 3, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.spec.image":    Tuple(Str("web:1.0")),
+		"$.spec.replicas": Tuple(Num(2)),
+		"$.ports":         Tuple(),
+		"$.image":         Tuple(),
+	})
+	if again, err := jsonpath.ApplyPatch(doc, patch); err != nil || !again.RawEquals(out) {
+		t.Errorf("the patch %s doesn't reproduce the migration: %v", patch, err)
+	}
+
+	var changes []jsonpath.Change
+	dry, dryPatch, err := jsonpath.Migrate(doc, 1, 3, migrations, jsonpath.WithDryRun(&changes))
+	if err != nil || !dry.RawEquals(doc) || len(changes) == 0 || string(dryPatch) != string(patch) {
+		t.Errorf("unexpected dry run %#v, %d changes, %v", dry, len(changes), err)
+	}
+
+	out, _, err = jsonpath.Migrate(doc, 2, 3, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{"$.ports": Tuple(), "$.image": Tuple(Str("web:1.0"))})
+	if _, _, err := jsonpath.Migrate(doc, 1, 4, migrations); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Error("expected ErrNotFound for a missing version, got", err)
+	}
+	if _, _, err := jsonpath.Migrate(doc, 3, 1, migrations); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Error("expected ErrUnsupported for a downgrade, got", err)
+	}
+
+	_, _, err = jsonpath.Migrate(doc, 2, 3, []jsonpath.Migration{{Version: 3, Description: "broken", Transform: func(t *jsonpath.Txn) error {
+		return t.Move("$.nope", "$.x")
+	}}})
+	var failed *jsonpath.MigrationError
+	if !errors.As(err, &failed) || failed.Version != 3 || !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Error("expected a MigrationError, got", err)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"replicas": cty.NullVal(cty.Number),
+		"containers": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"image": cty.StringVal("web")}),
+			cty.ObjectVal(map[string]cty.Value{"image": cty.StringVal("db"), "pull": cty.StringVal("Always")}),
+			cty.StringVal("not an object"),
+		}),
+	})
+	out, err := jsonpath.ApplyDefaults(doc, map[string]cty.Value{
+		"$.replicas":            cty.NumberIntVal(1),
+		"$.strategy.type":       cty.StringVal("RollingUpdate"),
+		"$.containers[*].pull":  cty.StringVal("IfNotPresent"),
+		"$.containers[0].image": cty.StringVal("ignored"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.replicas":            Tuple(Num(1)),
+		"$.strategy.type":       Tuple(Str("RollingUpdate")),
+		"$.containers[*].pull":  Tuple(Str("IfNotPresent"), Str("Always")),
+		"$.containers[0].image": Tuple(Str("web")),
+	})
+}
+
+func TestCtyFunctions(t *testing.T) {
+	funcs := jsonpath.Functions()
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	})
+
+	got, err := funcs["jsonpath"].Call([]cty.Value{doc, cty.StringVal("$.tags[*]")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}); !got.RawEquals(want) {
+		t.Errorf("jsonpath: got %#v", got)
+	}
+
+	got, err = funcs["jsonpath_set"].Call([]cty.Value{doc, cty.StringVal("$.owner.name"), cty.StringVal("ops")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := got.GetAttr("owner").GetAttr("name"); !name.RawEquals(cty.StringVal("ops")) {
+		t.Errorf("jsonpath_set: got %#v", got)
+	}
+
+	_, err = funcs["jsonpath"].Call([]cty.Value{doc, cty.StringVal("$.tags[")})
+	var argErr function.ArgError
+	if !errors.As(err, &argErr) || argErr.Index != 1 {
+		t.Errorf("expected an argument error for expr, got %v", err)
+	}
+}
+
+func TestHashByPath(t *testing.T) {
+	a := cty.ObjectVal(map[string]cty.Value{
+		"spec":   cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(2), "image": cty.StringVal("web")}),
+		"status": cty.StringVal("ready"),
+	})
+	b, _ := jsonpath.Set(a, "$.status", cty.StringVal("pending"))
+	c, _ := jsonpath.Set(a, "$.spec.replicas", cty.NumberIntVal(3))
+
+	hash := func(doc cty.Value) string {
+		h, err := jsonpath.HashByPath(doc, "$.spec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	if hash(a) != hash(b) {
+		t.Error("changing status must not change the hash of spec")
+	}
+	if hash(a) == hash(c) {
+		t.Error("changing spec must change its hash")
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(`{"image":"web","replicas":2}`))); hash(a) != want {
+		t.Errorf("got digest %s, want %s", hash(a), want)
+	}
+
+	docs := cty.TupleVal([]cty.Value{a, c})
+	p, _ := jsonpath.NewPath(`$[?(sha256(@.spec) == '` + hash(a) + `')].spec.replicas`)
+	vals, _, err := p.Eval(docs)
+	if err != nil || len(vals) != 1 || !vals[0].RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected result %#v, %v", vals, err)
+	}
+	if _, err := jsonpath.HashByPath(docs, "$[*]"); !errors.Is(err, jsonpath.ErrMultipleMatches) {
+		t.Errorf("expected ErrMultipleMatches, got %v", err)
+	}
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"name": "a", "spec": {"port": 80, "port": 8080, "tags": [{"k": 1, "k": 2, "k": 3}]}}`))
+	var dupErr *jsonpath.DuplicateKeysError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("expected a DuplicateKeysError, got %v", err)
+	}
+	if got := dupErr.Error(); got != "duplicate keys: $.spec.port, $.spec.tags[0].k" {
+		t.Errorf("unexpected error %s", got)
+	}
+	assert(t, Val(doc), map[string]Val{
+		"$.spec.port":      Tuple(Num(8080)),
+		"$.spec.tags[0].k": Tuple(Num(3)),
+	})
+
+	if _, err := jsonpath.DecodeJSONStrict([]byte(`{"a": [1, 2.5, null, true]}`)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := jsonpath.DecodeJSONStrict([]byte(`{"a": 1} {}`)); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("trailing data must be rejected")
+	}
+	if _, err := jsonpath.DecodeJSONStrict([]byte(`{"a": [1,]}`)); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("malformed JSON should fail with ErrSyntax, got", err)
+	}
+}
+
+func TestInternedKeys(t *testing.T) {
+	data := []byte(`{"records": [
+		{"level": "info", "msg": "started", "tags": ["a"]},
+		{"level": "warn", "msg": "slow", "tags": ["b", "c"]}
+	], "mixed": [1, "two", null]}`)
+	plain, err := jsonpath.DecodeJSONStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonpath.DecodeJSONStrict(data, jsonpath.WithInternedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := doc.GetAttr("records")
+	if !records.Type().IsListType() || !doc.GetAttr("mixed").Type().IsTupleType() {
+		t.Errorf("unexpected types %s", doc.Type().GoString())
+	}
+	var keys []string
+	for it := records.ElementIterator(); it.Next(); {
+		_, rec := it.Element()
+		for key := range rec.AsValueMap() {
+			if key == "level" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) != 2 || unsafe.StringData(keys[0]) != unsafe.StringData(keys[1]) {
+		t.Error("keys aren't shared")
+	}
+
+	for _, expr := range []string{"$.records[*].msg", "$.records[?(@.level == 'warn')].tags[1]", "$.mixed[*]"} {
+		p := jsonpath.MustNewPath(expr)
+		want, _, _ := p.Eval(plain)
+		got, _, err := p.Eval(doc)
+		if err != nil || len(got) != len(want) {
+			t.Fatalf("%s: got %v, %v, want %v", expr, got, err, want)
+		}
+		for i := range got {
+			if !got[i].RawEquals(want[i]) {
+				t.Errorf("%s: got %#v, want %#v", expr, got[i], want[i])
+			}
+		}
+	}
+
+	updated, err := jsonpath.Set(doc, "$.records[1].level", cty.StringVal("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(updated), map[string]Val{"$.records[*].level": Tuple(Str("info"), Str("error"))})
+	if _, err := jsonpath.Set(doc, "$.records[1]", cty.StringVal("x")); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+}
+
+func TestFromJSONC(t *testing.T) {
+	doc, comments, err := jsonpath.FromJSONC([]byte(`// service settings
+{
+	"name": "web", // the public name
+	/* exposed ports */
+	"ports": [
+		80,
+		443, // TLS
+	],
+	"url": "http://example.com/*not a comment*/",
+	// trailing note
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(doc), map[string]Val{
+		"$.ports[*]": Tuple(Num(80), Num(443)),
+		"$.url":      Tuple(Str("http://example.com/*not a comment*/")),
+	})
+
+	want := []string{
+		": service settings",
+		".name: the public name",
+		".ports: exposed ports",
+		".ports[1]: TLS",
+		": trailing note",
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("got %d comments, want %d: %v", len(comments), len(want), comments)
+	}
+	for i, c := range comments {
+		if got := jsonpath.PrettyCtyPath(c.Path) + ": " + c.Text; got != want[i] {
+			t.Errorf("comment %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	if _, _, err := jsonpath.FromJSONC([]byte(`{"a": 1 /* open`)); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("an unterminated comment must fail with ErrSyntax, got", err)
+	}
+	if _, _, err := jsonpath.FromJSONC([]byte(`{"a": 1} // done
+	{}`)); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("trailing data must fail with ErrSyntax, got", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, err := jsonpath.DecodeJSONStrict([]byte(`{"name": "a", "containers": [
+		{"name": "x", "image": 1}, {"name": "y", "image": 1}, {"name": "z", "image": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := jsonpath.DecodeJSONStrict([]byte(`{"replicas": 3, "containers": [
+		{"name": "z", "image": 1}, {"name": "x", "image": 2}, {"name": "y", "image": 1}, {"name": "w", "image": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := jsonpath.Diff(old, new, jsonpath.DiffOptions{ArrayKeys: map[string]string{"$.containers": "@.name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpath.MarshalPatch(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"move","from":"/containers/2","path":"/containers/0"},` +
+		`{"op":"replace","path":"/containers/1/image","value":2},` +
+		`{"op":"add","path":"/containers/3","value":{"image":1,"name":"w"}},` +
+		`{"op":"remove","path":"/name"},` +
+		`{"op":"add","path":"/replicas","value":3}]`
+	if string(patch) != want {
+		t.Errorf("unexpected patch\n got %s\nwant %s", patch, want)
+	}
+
+	// by position, the reordering rewrites every name
+	changes, err = jsonpath.Diff(old, new, jsonpath.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 7 {
+		t.Errorf("expected 7 changes, got %d: %v", len(changes), changes)
+	}
+
+	if changes, _ := jsonpath.Diff(old, old, jsonpath.DiffOptions{}); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	old := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("web"),
+		"spec": cty.ObjectVal(map[string]cty.Value{
+			"replicas": cty.NumberIntVal(1),
+			"ports":    cty.TupleVal([]cty.Value{cty.NumberIntVal(80)}),
+		}),
+	})
+	new := cty.ObjectVal(map[string]cty.Value{
+		"spec": cty.ObjectVal(map[string]cty.Value{
+			"replicas": cty.NumberIntVal(3),
+			"ports":    cty.TupleVal([]cty.Value{cty.NumberIntVal(80), cty.StringVal("<tls>")}),
+		}),
+	})
+	changes, err := jsonpath.Diff(old, new, jsonpath.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := jsonpath.WriteDiff(&b, changes, jsonpath.RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `$
+  - $.name: "web"
+
+$.spec
+  + $.spec.ports[1]: "<tls>"
+  ~ $.spec.replicas: 1 => 3
+`
+	if b.String() != want {
+		t.Errorf("unexpected diff\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := jsonpath.WriteDiff(&b, changes, jsonpath.RenderOptions{Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\x1b[31m  - $.name: \"web\"\x1b[0m") {
+		t.Errorf("expected a red removal in %q", b.String())
+	}
+
+	b.Reset()
+	if err := jsonpath.WriteDiffHTML(&b, changes, jsonpath.RenderOptions{GroupDepth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		`<h4>$.spec.ports</h4>`,
+		`<li class="add"><code>$.spec.ports[1]</code> <ins>&#34;&lt;tls&gt;&#34;</ins></li>`,
+		`<li class="replace"><code>$.spec.replicas</code> <del>1</del> <ins>3</ins></li>`,
+	} {
+		if !strings.Contains(b.String(), part) {
+			t.Errorf("expected %s in\n%s", part, b.String())
+		}
+	}
+}
+
+func TestDeepEqual(t *testing.T) {
+	decode := func(s string) cty.Value {
+		v, err := jsonpath.DecodeJSONStrict([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	a := decode(`{"ratio": 0.1, "tags": ["a", "b"], "labels": {"app": "web"}}`)
+	b := decode(`{"ratio": 0.10000001, "tags": ["b", "a"], "labels": {"app": "web"}}`)
+	relaxed := jsonpath.EqualOptions{IgnoreArrayOrder: true, FloatEpsilon: 1e-6}
+
+	if jsonpath.DeepEqual(a, b, jsonpath.EqualOptions{}) {
+		t.Error("expected a difference without options")
+	}
+	if !jsonpath.DeepEqual(a, b, relaxed) {
+		t.Error("expected equality ignoring order and rounding")
+	}
+	asMap := cty.ObjectVal(map[string]cty.Value{
+		"ratio":  cty.MustParseNumberVal("0.1"),
+		"tags":   cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"labels": cty.MapVal(map[string]cty.Value{"app": cty.StringVal("web")}),
+	})
+	if !jsonpath.DeepEqual(a, asMap, jsonpath.EqualOptions{}) {
+		t.Error("objects and maps, tuples and lists with the same members must be equal")
+	}
+	marked := a.Mark("sensitive")
+	if jsonpath.DeepEqual(a, marked, jsonpath.EqualOptions{}) || !jsonpath.DeepEqual(a, marked, jsonpath.EqualOptions{IgnoreMarks: true}) {
+		t.Error("marks must only matter without IgnoreMarks")
+	}
+
+	if changes, _ := jsonpath.Diff(a, b, jsonpath.DiffOptions{}); len(changes) != 3 {
+		t.Errorf("expected 3 changes, got %v", changes)
+	}
+	if changes, _ := jsonpath.Diff(a, b, jsonpath.DiffOptions{Equal: relaxed}); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+
+	doc := decode(`{"pods": [{"ports": [80, 443]}, {"ports": [443, 80]}, {"ports": [80, 443]}]}`)
+	p := jsonpath.MustNewPath("$.pods[*].ports")
+	for _, c := range []struct {
+		opts jsonpath.EqualOptions
+		want []string
+	}{
+		{jsonpath.EqualOptions{}, []string{".pods[0].ports", ".pods[1].ports"}},
+		{jsonpath.EqualOptions{IgnoreArrayOrder: true}, []string{".pods[0].ports"}},
+	} {
+		_, paths, err := p.Eval(doc, jsonpath.WithDistinct(c.opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != len(c.want) {
+			t.Fatalf("got %d results, want %d", len(paths), len(c.want))
+		}
+		for i, path := range paths {
+			if got := jsonpath.PrettyCtyPath(path); got != c.want[i] {
+				t.Errorf("result %d: got %s, want %s", i, got, c.want[i])
+			}
+		}
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	decode := func(s string) cty.Value {
+		v, err := jsonpath.DecodeJSONStrict([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	base := decode(`{"name": "web", "replicas": 1, "ports": [80, 443], "labels": {"app": "web", "tier": "front"}}`)
+	ours := decode(`{"name": "web", "replicas": 2, "ports": [8080, 443], "labels": {"app": "web"}}`)
+	theirs := decode(`{"name": "api", "replicas": 3, "ports": [80, 8443], "labels": {"app": "web", "tier": "front", "team": "a"}}`)
+
+	merged, conflicts, err := jsonpath.Merge3(base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(merged), map[string]Val{
+		"$.name":       Tuple(Str("api")),
+		"$.replicas":   Tuple(Num(2)),
+		"$.ports[*]":   Tuple(Num(8080), Num(8443)),
+		"$.labels.*":   Tuple(Str("web"), Str("a")),
+		"$.labels.app": Tuple(Str("web")),
+	})
+	if len(conflicts) != 1 || conflicts[0].String() != "conflict at $.replicas" {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+	if !conflicts[0].Theirs.RawEquals(cty.NumberIntVal(3)) {
+		t.Errorf("unexpected conflict %#v", conflicts[0])
+	}
+
+	// deleting what the other side modified conflicts
+	_, conflicts, _ = jsonpath.Merge3(base, decode(`{"name": "web", "replicas": 1, "ports": [80, 443]}`), theirs)
+	if len(conflicts) != 1 || conflicts[0].String() != "conflict at $.labels" || conflicts[0].Ours != cty.NilVal {
+		t.Errorf("unexpected conflicts %v", conflicts)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	base, err := jsonpath.DecodeJSONStrict([]byte(`{"name": "web", "ports": [80, 443], "labels": {"app": "web"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := jsonpath.NewDocument(base)
+	var calls int
+	doc.Subscribe("$.ports[*]", func(vals []cty.Value, paths []cty.Path) {
+		calls++
+	})
+
+	txn := doc.Begin()
+	if err := txn.Set("$.labels.tier", cty.StringVal("front")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Delete("$.ports[0]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Patch([]byte(`[{"op": "test", "path": "/name", "value": "web"}, {"op": "add", "path": "/ports/-", "value": 8443}]`)); err != nil {
+		t.Fatal(err)
+	}
+	// a failed edit leaves the transaction intact
+	if err := txn.Patch([]byte(`[{"op": "remove", "path": "/name"}, {"op": "test", "path": "/name", "value": "api"}]`)); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if calls != 0 || !doc.Value().RawEquals(base) {
+		t.Fatal("edits must stay private until Commit")
+	}
+
+	value, patch, err := txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"add","path":"/labels/tier","value":"front"},` +
+		`{"op":"replace","path":"/ports/0","value":443},` +
+		`{"op":"replace","path":"/ports/1","value":8443}]`
+	if string(patch) != want {
+		t.Errorf("unexpected patch\n got %s\nwant %s", patch, want)
+	}
+	if calls != 1 || !doc.Value().RawEquals(value) {
+		t.Errorf("commit should publish the new snapshot, calls=%d", calls)
+	}
+	assert(t, Val(value), map[string]Val{
+		"$.name":     Tuple(Str("web")),
+		"$.ports[*]": Tuple(Num(443), Num(8443)),
+	})
+
+	// concurrent writes make stale transactions fail
+	stale := doc.Begin()
+	stale.Set("$.name", cty.StringVal("api"))
+	doc.Set("$.name", cty.StringVal("www"))
+	if _, _, err := stale.Commit(); !errors.Is(err, jsonpath.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+
+	rolled := doc.Begin()
+	rolled.Delete("$.labels")
+	rolled.Rollback()
+	if err := rolled.Set("$.name", cty.StringVal("x")); err == nil {
+		t.Error("a finished transaction must reject edits")
+	}
+	if _, err := jsonpath.ApplyPatch(value, []byte(`[{"op": "test", "path": "/name", "value": "api"}]`)); !errors.Is(err, jsonpath.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+
+	// adding at the root pointer replaces the document
+	var changes []jsonpath.Change
+	root, err := jsonpath.ApplyPatch(value, []byte(`[{"op": "add", "path": "", "value": {"name": "api"}}, {"op": "copy", "from": "/name", "path": "/alias"}]`))
+	if err != nil || jsonpath.DebugString(root) != `{"alias": "api", "name": "api"}` {
+		t.Errorf("unexpected root add result %s, %v", jsonpath.DebugString(root), err)
+	}
+	if _, err := jsonpath.ApplyPatch(value, []byte(`[{"op": "add", "path": "", "value": [1]}]`), jsonpath.WithDryRun(&changes)); err != nil || len(changes) != 1 || changes[0].Op != jsonpath.OpAdd || !changes[0].Old.RawEquals(value) {
+		t.Errorf("unexpected root add changes %+v, %v", changes, err)
+	}
+
+	// descendants of a removed location can sort after unrelated paths
+	nested, _ := jsonpath.DecodeJSONStrict([]byte(`{"arr": [{"x": 1}, [2, 3]], "b": {"c": {"d": 4}}}`))
+	if emptied, err := jsonpath.Delete(nested, "$..*"); err != nil || emptied.LengthInt() != 0 {
+		t.Errorf("expected an empty document, got %s, %v", jsonpath.DebugString(emptied), err)
+	}
+}
+
+func TestDocumentHistory(t *testing.T) {
+	doc := jsonpath.NewDocument(cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)}))
+	doc.KeepHistory(2)
+	var last []cty.Value
+	doc.Subscribe("$.replicas", func(vals []cty.Value, paths []cty.Path) {
+		last = vals
+	})
+	for i := int64(2); i <= 4; i++ {
+		if err := doc.Set("$.replicas", cty.NumberIntVal(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revs, err := doc.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 3 || revs[0].Patch != nil {
+		t.Fatalf("expected 2 kept revisions and the current one, got %v", revs)
+	}
+	if got := string(revs[2].Patch); got != `[{"op":"replace","path":"/replicas","value":4}]` {
+		t.Errorf("unexpected patch %s", got)
+	}
+	if v, err := doc.At(2); err != nil || !v.GetAttr("replicas").RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected revision %#v, %v", v, err)
+	}
+	if _, err := doc.At(3); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Errorf("expected ErrIndexOutOfBounds, got %v", err)
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 1 || !last[0].RawEquals(cty.NumberIntVal(3)) {
+		t.Errorf("subscriber should see the restored value, got %v", last)
+	}
+	doc.Undo()
+	if err := doc.Undo(); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	assert(t, Val(doc.Value()), map[string]Val{"$.replicas": Tuple(Num(2))})
+}
+
+func TestReplay(t *testing.T) {
+	initial := cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)})
+	log := [][]byte{
+		[]byte(`[{"op": "test", "path": "/replicas", "value": 1}, {"op": "replace", "path": "/replicas", "value": 2}]`),
+		[]byte(`[{"op": "add", "path": "/ports", "value": [80]}, {"op": "copy", "from": "/ports/0", "path": "/ports/-"}]`),
+		[]byte(`[{"op": "move", "from": "/ports", "path": "/spec"}]`),
+	}
+	out, err := jsonpath.Replay(initial, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(out), map[string]Val{
+		"$.replicas": Tuple(Num(2)),
+		"$.spec[*]":  Tuple(Num(80), Num(80)),
+		"$.ports":    Tuple(),
+	})
+
+	// a failing test op rejects its whole patch
+	stream := jsonpath.NewStream(initial)
+	stream.Apply(log[0])
+	err = stream.Apply([]byte(`[{"op": "replace", "path": "/replicas", "value": 5}, {"op": "test", "path": "/replicas", "value": 1}]`))
+	var seqErr *jsonpath.SequenceError
+	if !errors.As(err, &seqErr) || seqErr.Seq != 1 || !errors.Is(err, jsonpath.ErrConflict) {
+		t.Errorf("expected a conflict on patch 1, got %v", err)
+	}
+	if stream.Len() != 1 || !stream.Value().GetAttr("replicas").RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected stream state %#v", stream.Value())
+	}
+}
+
+func TestRead(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"name":     cty.StringVal("web"),
+		"replicas": cty.NumberIntVal(3),
+		"port":     cty.StringVal("8080"),
+		"ratio":    cty.NumberFloatVal(0.5),
+		"enabled":  cty.StringVal("true"),
+		"tags":     cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"none":     cty.NullVal(cty.String),
+	})
+	if s, err := jsonpath.ReadString(doc, "$.name"); err != nil || s != "web" {
+		t.Errorf("ReadString: %q, %v", s, err)
+	}
+	if s, err := jsonpath.ReadString(doc, "$.replicas"); err != nil || s != "3" {
+		t.Errorf("ReadString of a number: %q, %v", s, err)
+	}
+	if i, err := jsonpath.ReadInt(doc, "$.port"); err != nil || i != 8080 {
+		t.Errorf("ReadInt: %d, %v", i, err)
+	}
+	if b, err := jsonpath.ReadBool(doc, "$.enabled"); err != nil || !b {
+		t.Errorf("ReadBool: %v, %v", b, err)
+	}
+	if v, err := jsonpath.Read(doc, "$.tags[1]"); err != nil || !v.RawEquals(cty.StringVal("b")) {
+		t.Errorf("Read: %#v, %v", v, err)
+	}
+
+	for expr, kind := range map[string]error{
+		"$.missing": jsonpath.ErrNotFound,
+		"$.tags[*]": jsonpath.ErrMultipleMatches,
+		"$.ratio":   jsonpath.ErrTypeMismatch,
+		"$.name":    jsonpath.ErrTypeMismatch,
+		"$.none":    jsonpath.ErrTypeMismatch,
+	} {
+		if _, err := jsonpath.ReadInt(doc, expr); !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, got %v", expr, kind, err)
+		}
+	}
+}
+
+func TestMust(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("web")})
+	if v := jsonpath.MustRead(doc, "$.name"); !v.RawEquals(cty.StringVal("web")) {
+		t.Errorf("MustRead: %#v", v)
+	}
+	updated := jsonpath.MustSet(doc, "$.name", cty.StringVal("api"))
+	if v := jsonpath.MustRead(updated, "$.name"); !v.RawEquals(cty.StringVal("api")) {
+		t.Errorf("MustSet: %#v", v)
+	}
+
+	expectPanic := func(kind error, f func()) {
+		t.Helper()
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, kind) {
+				t.Errorf("expected a panic with %v, got %v", kind, err)
+			}
+		}()
+		f()
+	}
+	expectPanic(jsonpath.ErrSyntax, func() { jsonpath.MustNewPath("$.[") })
+	expectPanic(jsonpath.ErrNotFound, func() { jsonpath.MustRead(doc, "$.missing") })
+}
+
+func TestEvalPathSet(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"spec": cty.ObjectVal(map[string]cty.Value{
+			"password": cty.StringVal("hunter2").Mark("sensitive"),
+			"ports":    cty.TupleVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+		}),
+		"labels": cty.MapVal(map[string]cty.Value{"app": cty.StringVal("web")}),
+	})
+	paths := cty.NewPathSet(
+		cty.GetAttrPath("spec").GetAttr("ports").IndexInt(1),
+		cty.GetAttrPath("labels").GetAttr("app"),
+		cty.GetAttrPath("spec").GetAttr("password"),
+		cty.GetAttrPath("spec").GetAttr("ports").IndexInt(0),
+	)
+	vals, err := jsonpath.EvalPathSet(doc, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cty.Value{
+		cty.StringVal("web"),
+		cty.StringVal("hunter2").Mark("sensitive"),
+		cty.NumberIntVal(80),
+		cty.NumberIntVal(443),
+	}
+	if len(vals) != len(want) {
+		t.Fatalf("got %d values, want %d", len(vals), len(want))
+	}
+	for i := range vals {
+		if !vals[i].RawEquals(want[i]) {
+			t.Errorf("value %d: got %#v, want %#v", i, vals[i], want[i])
+		}
+	}
+
+	paths.Add(cty.GetAttrPath("spec").GetAttr("replicas"))
+	_, err = jsonpath.EvalPathSet(doc, paths)
+	var pathErr *jsonpath.PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, jsonpath.ErrNotFound) || jsonpath.PrettyCtyPath(pathErr.Path) != ".spec.replicas" {
+		t.Errorf("expected ErrNotFound at .spec.replicas, got %v", err)
+	}
+	if vals, err := jsonpath.EvalPathSet(doc, paths, jsonpath.WithMissingPaths(jsonpath.MissingPathsSkip)); err != nil || len(vals) != 4 {
+		t.Errorf("expected the missing path to be skipped, got %v, %v", vals, err)
+	}
+	vals, err = jsonpath.EvalPathSet(doc, paths, jsonpath.WithMissingPaths(jsonpath.MissingPathsNull))
+	if err != nil || len(vals) != 5 || !vals[4].IsNull() {
+		t.Errorf("expected a null for the missing path, got %v, %v", vals, err)
+	}
+
+	bad := cty.NewPathSet(cty.GetAttrPath("labels").IndexInt(0))
+	if _, err := jsonpath.EvalPathSet(doc, bad, jsonpath.WithMissingPaths(jsonpath.MissingPathsSkip)); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{
+		"cpu": [0.5, 0.25, 1, 0.25],
+		"hosts": {"a": {"cpu": [0.9, 0.7]}, "b": {"cpu": [0.1]}},
+		"names": ["a", "b"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		fn   func(cty.Value, string) (cty.Value, error)
+		path string
+		want float64
+	}{
+		{jsonpath.Sum, "$.cpu", 2},
+		{jsonpath.Sum, "$.cpu[*]", 2},
+		{jsonpath.Avg, "$.cpu", 0.5},
+		{jsonpath.Min, "$.cpu[*]", 0.25},
+		{jsonpath.Max, "$.cpu", 1},
+		{jsonpath.Max, "$.hosts.*.cpu", 0.9},
+		{jsonpath.Sum, "$.hosts..cpu[0]", 1},
+		{jsonpath.Sum, "$.missing", 0},
+	} {
+		got, err := c.fn(doc, c.path)
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+			continue
+		}
+		if f, _ := got.AsBigFloat().Float64(); f != c.want {
+			t.Errorf("%s: got %v, want %v", c.path, f, c.want)
+		}
+	}
+
+	if _, err := jsonpath.Avg(doc, "$.missing"); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := jsonpath.Sum(doc, "$.names"); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+
+	assert(t, Val(doc), map[string]Val{
+		"$.hosts[?(avg(@.cpu) > 0.5)].cpu[0]": Tuple(NumFloat(0.9)),
+		"$.hosts[?(max(@.cpu) < 0.5)].cpu[0]": Tuple(NumFloat(0.1)),
+	})
+}
+
+func TestOptions(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"years": cty.ObjectVal(map[string]cty.Value{"2023": cty.StringVal("new")}),
+	})
+	expected := []cty.Value{cty.StringVal("new")}
+
+	p := jsonpath.MustNewPath("$.years[2023]", jsonpath.WithNumericKeys())
+	if vals, _, err := p.Eval(doc); err != nil || !cty.TupleVal(vals).RawEquals(cty.TupleVal(expected)) {
+		t.Errorf("NewPath option: %#v, %v", vals, err)
+	}
+	p = jsonpath.MustNewPath("$.years[2023]")
+	if vals, _, err := p.Eval(doc, jsonpath.WithNumericKeys()); err != nil || !cty.TupleVal(vals).RawEquals(cty.TupleVal(expected)) {
+		t.Errorf("Eval option: %#v, %v", vals, err)
+	}
+	if _, _, err := p.Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("Eval options must not stick, got %v", err)
+	}
+
+	d := jsonpath.NewDocument(doc, jsonpath.WithNumericKeys(), jsonpath.WithHistory(1), jsonpath.WithCache(jsonpath.NewResultCache(0)))
+	if vals, _, err := d.Eval("$.years[2023]"); err != nil || len(vals) != 1 {
+		t.Errorf("Document option: %#v, %v", vals, err)
+	}
+	if err := d.Set("$.years[2023]", cty.StringVal("newer")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Undo(); err != nil {
+		t.Errorf("WithHistory: %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := jsonpath.NewStore()
+	store.Put("limits", cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(3)}))
+	store.Put("deployments", cty.TupleVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("web"), "replicas": cty.NumberIntVal(5)}),
+		cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("worker"), "replicas": cty.NumberIntVal(2)}),
+	}))
+
+	vals, _, err := store.Eval("deployments", `$[?(@.replicas > $doc("limits").replicas)].name`)
+	if err != nil || !cty.TupleVal(vals).RawEquals(cty.TupleVal([]cty.Value{cty.StringVal("web")})) {
+		t.Errorf("cross-document filter: %#v, %v", vals, err)
+	}
+	vals, paths, err := store.Eval("deployments", `$doc('limits').replicas`)
+	if err != nil || len(vals) != 1 || len(paths) != 1 || !vals[0].RawEquals(cty.NumberIntVal(3)) || jsonpath.PrettyCtyPath(paths[0]) != ".replicas" {
+		t.Errorf("$doc expression: %#v, %v, %v", vals, paths, err)
+	}
+	if _, _, err := store.Eval("deployments", `$doc("missing").x`); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected a missing document to be not found, got %v", err)
+	}
+	if _, _, err := store.Eval("missing", `$`); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected a missing document to be not found, got %v", err)
+	}
+	if _, err := jsonpath.NewPath(`$.a$doc("x")`); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected $doc in the middle to be rejected, got %v", err)
+	}
+	if p := jsonpath.MustNewPath(`$[?(@.a == $doc("x").b)]`); p.String() != `$[?(@.a == $doc('x').b)]` {
+		t.Errorf("unexpected canonical form %s", p)
+	}
+
+	exported, err := store.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := jsonpath.NewStore()
+	if err := copied.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	if names := copied.Names(); len(names) != 2 || names[0] != "deployments" {
+		t.Errorf("unexpected names %v", names)
+	}
+	if v, _, err := copied.Eval("limits", "$.replicas"); err != nil || !v[0].RawEquals(cty.NumberIntVal(3)) {
+		t.Errorf("imported value: %#v, %v", v, err)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	store, err := jsonpath.OpenStore(jsonpath.FileBackend(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := store.Put("apps/web", cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)}))
+	store.Put("tmp", cty.EmptyObjectVal)
+	if err := d.Set("$.replicas", cty.NumberIntVal(2)); err != nil {
+		t.Fatal(err)
+	}
+	store.Remove("tmp")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "apps%2Fweb.json"))
+	if err != nil || string(data) != `{"replicas":2}` {
+		t.Errorf("unexpected file content %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tmp.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the removed document to be deleted, got %v", err)
+	}
+
+	reopened, err := jsonpath.OpenStore(jsonpath.FileBackend(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if names := reopened.Names(); len(names) != 1 || names[0] != "apps/web" {
+		t.Errorf("unexpected names %v", names)
+	}
+	if v, _, err := reopened.Eval("apps/web", "$.replicas"); err != nil || !v[0].RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected value %#v, %v", v, err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"services/api.json":  `{"port": 8080}`,
+		"services/web.json":  `{"port": 80}`,
+		"services/old.json":  `{"port": 81}`,
+		"services/notes.txt": `not json`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree, err := jsonpath.FromFS(os.DirFS(dir), "services/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, err := jsonpath.ReadInt(tree.Doc, `$.services["api.json"].port`); err != nil || port != 8080 {
+		t.Fatalf("unexpected port %d, %v", port, err)
+	}
+
+	doc := jsonpath.MustSet(tree.Doc, `$.services["api.json"].port`, cty.NumberIntVal(9090))
+	doc, err = jsonpath.Delete(doc, `$.services["old.json"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := tree.WriteDir(dir, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(written, " ") != "services/api.json services/old.json" {
+		t.Errorf("unexpected files written %v", written)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "services", "api.json"))
+	if err != nil || string(data) != "{\n  \"port\": 9090\n}\n" {
+		t.Errorf("unexpected file content %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "services", "old.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the removed file to be deleted, got %v", err)
+	}
+
+	// a new file next to the others, without touching them
+	changes, err := jsonpath.Diff(tree.Doc, jsonpath.MustSet(tree.Doc, `$.services["db.json"]`, cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(5432)})), jsonpath.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written, err = tree.WriteBack(jsonpath.DirFS(dir), changes); err != nil || strings.Join(written, " ") != "services/db.json" {
+		t.Errorf("unexpected files written %v, %v", written, err)
+	}
+	if port, err := jsonpath.ReadInt(tree.Doc, `$.services["db.json"].port`); err != nil || port != 5432 {
+		t.Errorf("expected the new file in the document, got %d, %v", port, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "services", "db.json")); err != nil || !strings.Contains(string(data), "5432") {
+		t.Errorf("unexpected file content %q, %v", data, err)
+	}
+	changes = []jsonpath.Change{{Op: jsonpath.OpAdd, Path: cty.GetAttrPath("nodir").GetAttr("x"), New: cty.True}}
+	if _, err := tree.WriteBack(jsonpath.DirFS(dir), changes); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("expected a value outside the files to fail, got %v", err)
+	}
+
+	if _, err := jsonpath.FromFS(os.DirFS(dir), "services/*"); err == nil || !strings.Contains(err.Error(), "notes.txt") {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
+
+func TestInterner(t *testing.T) {
+	container := func(name string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"name":      cty.StringVal(name),
+			"resources": cty.ObjectVal(map[string]cty.Value{"cpu": cty.StringVal(fmt.Sprintf("%dm", 100))}),
+		})
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{"pods": cty.TupleVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"containers": cty.TupleVal([]cty.Value{container("a"), container("b")})}),
+		cty.ObjectVal(map[string]cty.Value{"containers": cty.TupleVal([]cty.Value{container("a")})}),
+	})})
+	in := jsonpath.NewInterner()
+	p := jsonpath.MustNewPath("$..containers[*]", jsonpath.WithInterner(in))
+	vals, paths, err := p.Eval(doc)
+	if err != nil || len(vals) != 3 || len(paths) != 3 {
+		t.Fatal(vals, paths, err)
+	}
+	// a, b, their names and resources, and the cpu string they share
+	if in.Len() != 6 {
+		t.Errorf("expected 6 distinct values, got %d", in.Len())
+	}
+	cpu := func(v cty.Value) *byte {
+		return unsafe.StringData(v.GetAttr("resources").GetAttr("cpu").AsString())
+	}
+	if cpu(vals[0]) != cpu(vals[1]) || cpu(vals[0]) != cpu(vals[2]) {
+		t.Error("expected identical subtrees to share memory")
+	}
+	if !vals[0].RawEquals(container("a")) || !vals[1].RawEquals(container("b")) || !vals[2].RawEquals(container("a")) {
+		t.Errorf("interning changed the results: %#v", vals)
+	}
+
+	// marked values are left alone
+	marked := cty.ObjectVal(map[string]cty.Value{"secret": cty.StringVal("x").Mark("sensitive")})
+	if v := in.Intern(marked); !v.RawEquals(marked) {
+		t.Errorf("unexpected interned marked value %#v", v)
+	}
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	store := jsonpath.NewStore()
+	d := store.Put("config", cty.ObjectVal(map[string]cty.Value{
+		"db":  cty.ObjectVal(map[string]cty.Value{"host": cty.StringVal("a"), "port": cty.NumberIntVal(1)}),
+		"log": cty.StringVal("info"),
+	}))
+	events, cancel, err := store.Subscribe("config", "$.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("$.log", cty.StringVal("debug")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("$.db.port", cty.NumberIntVal(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := <-events
+	if ev.Doc != "config" || ev.Op != jsonpath.OpReplace || jsonpath.PrettyCtyPath(ev.Path) != ".db.port" ||
+		!ev.Old.RawEquals(cty.NumberIntVal(1)) || !ev.New.RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if string(ev.Patch) != `[{"op":"replace","path":"/db/port","value":2}]` {
+		t.Errorf("unexpected patch %s", ev.Patch)
+	}
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("expected the channel to be closed")
+	}
+	if _, _, err := store.Subscribe("missing", "$"); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLayered(t *testing.T) {
+	base := cty.ObjectVal(map[string]cty.Value{
+		"db":    cty.ObjectVal(map[string]cty.Value{"host": cty.StringVal("localhost"), "port": cty.NumberIntVal(5432)}),
+		"hosts": cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	})
+	env := cty.ObjectVal(map[string]cty.Value{
+		"db":    cty.ObjectVal(map[string]cty.Value{"host": cty.StringVal("db.prod")}),
+		"hosts": cty.TupleVal([]cty.Value{cty.StringVal("c")}),
+	})
+	override := cty.ObjectVal(map[string]cty.Value{
+		"debug": cty.True,
+	})
+	layers := jsonpath.Layered(base, env, override)
+
+	assert(t, Val(layers.Value()), map[string]Val{
+		"$.db.host": Tuple(Str("db.prod")),
+		"$.db.port": Tuple(Num(5432)),
+		"$.hosts":   Tuple(Tuple(Str("c"))),
+		"$.debug":   Tuple(True),
+	})
+
+	matches, err := layers.Eval("$.db.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	supplied := map[string]int{}
+	for _, m := range matches {
+		supplied[jsonpath.PrettyCtyPath(m.Path)] = m.Layer
+	}
+	if supplied[".db.host"] != 1 || supplied[".db.port"] != 0 || len(supplied) != 2 {
+		t.Errorf("unexpected layers %v", supplied)
+	}
+
+	updated, replaced, err := layers.Set("$.db.port", cty.NumberIntVal(6432))
+	if err != nil || len(replaced) != 1 || replaced[0].Layer != 0 {
+		t.Fatalf("Set: %v, %v", replaced, err)
+	}
+	if v, _ := jsonpath.Read(updated.Layer(0), "$.db.port"); !v.RawEquals(cty.NumberIntVal(6432)) {
+		t.Errorf("expected the base layer to change, got %#v", v)
+	}
+	if v, _ := jsonpath.Read(layers.Value(), "$.db.port"); !v.RawEquals(cty.NumberIntVal(5432)) {
+		t.Errorf("expected the original stack to be unchanged, got %#v", v)
+	}
+
+	updated, err = updated.SetIn(2, "$.db.host", cty.StringVal("replica"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, _ = updated.Eval("$.db.host")
+	if len(matches) != 1 || matches[0].Layer != 2 || !matches[0].Value.RawEquals(cty.StringVal("replica")) {
+		t.Errorf("unexpected match %+v", matches)
+	}
+}
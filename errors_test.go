@@ -0,0 +1,198 @@
+package peek
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	for expr, kind := range map[string]error{
+		`$["]`:         jsonpath.ErrSyntax,
+		"$.A*]":        jsonpath.ErrSyntax,
+		"$.A[1:4:0:0]": jsonpath.ErrSyntax,
+		"$.A[?(@ > 1":  jsonpath.ErrSyntax,
+	} {
+		_, err := jsonpath.NewPath(expr)
+		if !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, got %v", expr, kind, err)
+		}
+	}
+
+	for expr, kind := range map[string]error{
+		"$.A[10]":     jsonpath.ErrIndexOutOfBounds,
+		"$.B[0]":      jsonpath.ErrTypeMismatch,
+		"$.B[?(@.C)]": jsonpath.ErrTypeMismatch,
+		"$.A[::0]":    jsonpath.ErrSyntax,
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		_, _, err = p.Eval(cty.Value(sampleDoc))
+		if !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, got %v", expr, kind, err)
+		}
+	}
+
+	_, err := jsonpath.ReplaceByPath(cty.Value(sampleDoc), "$.D.Type[2].C", cty.ListValEmpty(cty.String))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"m": cty.MapVal(map[string]cty.Value{"a": cty.StringVal("x"), "b": cty.StringVal("y")}),
+	})
+	_, err = jsonpath.ReplaceByPath(doc, "$.m.a", cty.True)
+	var pathErr *jsonpath.PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Fatal("expected a type mismatch PathError, got", err)
+	}
+	if !pathErr.Path.Equals(cty.GetAttrPath("m").Index(cty.StringVal("a"))) {
+		t.Error("unexpected error path", pathErr.Path)
+	}
+}
+
+func TestPartialResults(t *testing.T) {
+	p, _ := jsonpath.NewPath("$.*.Type[0,5]")
+
+	if _, _, err := p.Eval(cty.Value(sampleDoc)); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Fatal("without PartialResults the union should fail, got", err)
+	}
+
+	vals, paths, err := p.EvalWithOptions(cty.Value(sampleDoc), jsonpath.EvalOptions{PartialResults: true})
+	var multi *jsonpath.MultiPathError
+	if !errors.As(err, &multi) || len(multi.Errors) != 1 {
+		t.Fatal("expected one collected error, got", err)
+	}
+	if !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Error("collected errors should be reachable with errors.Is")
+	}
+	var branch *jsonpath.BranchError
+	if !errors.As(err, &branch) || branch.Position != 1 || !branch.Path.Equals(cty.GetAttrPath("D").GetAttr("Type")) {
+		t.Errorf("unexpected branch error %+v", branch)
+	}
+	expected := Tuple(Str("string2a"), Str("string4a"), Tuple(Str("string6a"), Str("string6b")))
+	if !cty.TupleVal(vals).RawEquals(cty.Value(expected)) || len(paths) != 3 {
+		t.Errorf("unexpected partial results %#v %v", vals, paths)
+	}
+}
+
+func TestUnknownValues(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"items": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{
+				"name": cty.StringVal("a"),
+				"tags": cty.ListVal([]cty.Value{cty.StringVal("x")}),
+				"p":    cty.NumberIntVal(1),
+			}),
+			cty.DynamicVal,
+			cty.ObjectVal(map[string]cty.Value{
+				"name": cty.DynamicVal,
+				"tags": cty.UnknownVal(cty.List(cty.String)),
+				"p":    cty.UnknownVal(cty.Number),
+			}),
+		}),
+	})
+	for _, c := range []struct {
+		expr     string
+		paths    []string
+		unknowns []string
+	}{
+		{"$.items[*].name", []string{".items[0].name", ".items[2].name"}, []string{".items[1]"}},
+		{"$.items[*].tags[0]", []string{".items[0].tags[0]"}, []string{".items[1]", ".items[2].tags"}},
+		{"$.items[?(@.p > 0)].name", []string{".items[0].name"}, []string{".items[1]", ".items[2]"}},
+		{"$.items[?(length(@.tags) == 1)].p", []string{".items[0].p"}, []string{".items[1]", ".items[2]"}},
+		{"$..tags.*", []string{".items[0].tags[0]"}, []string{".items[1]", ".items[2].name", ".items[2].tags"}},
+	} {
+		var unknowns []cty.Path
+		_, paths, err := jsonpath.MustNewPath(c.expr).Eval(doc, jsonpath.WithUnknowns(&unknowns))
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got := prettyPaths(paths); fmt.Sprint(got) != fmt.Sprint(c.paths) {
+			t.Errorf("%s: got paths %v, want %v", c.expr, got, c.paths)
+		}
+		if got := prettyPaths(unknowns); fmt.Sprint(got) != fmt.Sprint(c.unknowns) {
+			t.Errorf("%s: got unknowns %v, want %v", c.expr, got, c.unknowns)
+		}
+	}
+}
+
+func prettyPaths(paths []cty.Path) []string {
+	out := make([]string, len(paths))
+	for i, path := range paths {
+		out[i] = jsonpath.PrettyCtyPath(path)
+	}
+	return out
+}
+
+func TestElementErrors(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"items": cty.TupleVal([]cty.Value{
+			cty.TupleVal([]cty.Value{cty.StringVal("a")}),
+			cty.StringVal("scalar"),
+			cty.TupleVal([]cty.Value{cty.StringVal("c")}),
+		}),
+		"names": cty.TupleVal([]cty.Value{cty.StringVal("ab"), cty.NumberIntVal(5), cty.StringVal("abcdefgh")}),
+	})
+	for expr, want := range map[string]cty.Value{
+		"$.items[*][0]":              cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("c")}),
+		"$.names[?(@.length() < 5)]": cty.TupleVal([]cty.Value{cty.StringVal("ab")}),
+		"$.items[*][?(@ == 'c')]":    cty.TupleVal([]cty.Value{cty.StringVal("c")}),
+	} {
+		p := jsonpath.MustNewPath(expr)
+		if _, _, err := p.Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+			t.Errorf("%s: by default the evaluation should fail, got %v", expr, err)
+		}
+
+		vals, _, err := p.Eval(doc, jsonpath.WithElementErrors(jsonpath.ElementErrorsSkip))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", expr, err)
+		}
+		if !cty.TupleVal(vals).RawEquals(want) {
+			t.Errorf("%s: got %#v, want %#v", expr, vals, want)
+		}
+
+		vals, paths, err := p.Eval(doc, jsonpath.WithElementErrors(jsonpath.ElementErrorsCollect))
+		var elemErr *jsonpath.ElementError
+		if !errors.As(err, &elemErr) || !errors.Is(err, jsonpath.ErrTypeMismatch) {
+			t.Fatalf("%s: expected a collected element error, got %v", expr, err)
+		}
+		if !cty.TupleVal(vals).RawEquals(want) || len(paths) != len(vals) {
+			t.Errorf("%s: got %#v at %v, want %#v", expr, vals, paths, want)
+		}
+		key := strings.Split(expr, "[")[0][2:]
+		if !elemErr.Path.Equals(cty.GetAttrPath(key).IndexInt(1)) {
+			t.Errorf("%s: unexpected error path %#v", expr, elemErr.Path)
+		}
+	}
+}
+
+func TestMultiPathErrorJSON(t *testing.T) {
+	p := jsonpath.MustNewPath("$.*.Type[0,5]")
+	_, _, err := p.Eval(cty.Value(sampleDoc), jsonpath.WithPartialResults())
+	var multi *jsonpath.MultiPathError
+	if !errors.As(err, &multi) {
+		t.Fatal("expected a MultiPathError, got", err)
+	}
+	out, jsonErr := json.Marshal(multi)
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	var decoded struct {
+		Errors []map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(out, &decoded); err != nil || len(decoded.Errors) != 1 {
+		t.Fatalf("unexpected JSON %s", out)
+	}
+	got := decoded.Errors[0]
+	if got["path"] != "$.D.Type" || got["pointer"] != "/D/Type" || got["kind"] != jsonpath.ErrIndexOutOfBounds.Error() || got["message"] != multi.Errors[0].Error() {
+		t.Errorf("unexpected JSON %s", out)
+	}
+}
@@ -0,0 +1,782 @@
+package peek
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFilter(t *testing.T) {
+	store := Val(storeExample.Value)
+	assert(t, store, map[string]Val{
+		"$.store.book[?(@.price < 10)].title":              Tuple(Str("Sayings of the Century"), Str("Moby Dick")),
+		"$.store.book[?(@.isbn)].author":                   Tuple(Str("Herman Melville"), Str("J. R. R. Tolkien")),
+		`$.store.book[?(@.category == 'reference')].price`: Tuple(NumFloat(8.95)),
+		`$.store.book[?(@.category != "fiction")].author`:  Tuple(Str("Nigel Rees")),
+		"$.store.book[?(@.price >= 22.99)].title":          Tuple(Str("The Lord of the Rings")),
+		"$..book[?(@.price > 100)]":                        Tuple(),
+	})
+
+	assertError(t, []string{
+		"$.store.book[?(@.price < 10",
+		"$.store.book[?(@.price < 10)",
+	})
+
+	// objects are filtered by member, so filters can follow `..`
+	assert(t, store, map[string]Val{
+		"$.store[?(@.price)].color":      Tuple(Str("red")),
+		"$..[?(@.price < 10)].price":     Tuple(NumFloat(8.95), NumFloat(8.99)),
+		"$..[?(@.color == 'red')].price": Tuple(NumFloat(19.95)),
+		"$..[?(@.isbn)].title":           Tuple(Str("Moby Dick"), Str("The Lord of the Rings")),
+	})
+	p, _ := jsonpath.NewPath("$.store.bicycle.color[?(@)]")
+	if _, _, err := p.Eval(storeExample.Value); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Fatal("filtering a scalar should fail, got", err)
+	}
+}
+
+func TestHeterogeneousFilter(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{"items": cty.TupleVal([]cty.Value{
+		cty.NumberIntVal(1),
+		cty.StringVal("two"),
+		cty.ObjectVal(map[string]cty.Value{"v": cty.NumberIntVal(3)}),
+		cty.ObjectVal(map[string]cty.Value{"v": cty.StringVal("three"), "w": cty.True}),
+		cty.TupleVal([]cty.Value{cty.NumberIntVal(4)}),
+		cty.NullVal(cty.DynamicPseudoType),
+	})})
+	assert(t, Val(doc), map[string]Val{
+		"$.items[?(@.v)].v":      Tuple(Num(3), Str("three")),
+		"$.items[?(@ == 'two')]": Tuple(Str("two")),
+		"$.items[?(@.v == 3)].v": Tuple(Num(3)),
+		"$.items[?(@.w)].v":      Tuple(Str("three")),
+		// comparing across types is false, not an error
+		"$.items[?(@ < 10)]":         Tuple(Num(1)),
+		"$.items[?(@ >= 'a')]":       Tuple(Str("two")),
+		"$.items[?(@.v > 2)].v":      Tuple(Num(3)),
+		"$.items[?(@.v <= 'zzz')].v": Tuple(Str("three")),
+		"$.items[?(@.w > 1)]":        Tuple(),
+	})
+}
+
+func TestSortedFilter(t *testing.T) {
+	records := []Val{}
+	for i := 0; i < 1000; i++ {
+		records = append(records, Obj(kvPair("id", Num(i*2)), kvPair("even", True)))
+	}
+	doc := Obj(kvPair("records", Tuple(records...)), kvPair("ids", Tuple(Num(1), Num(3), Num(3), Num(8))))
+
+	opts := jsonpath.EvalOptions{SortedBy: []jsonpath.SortedHint{
+		{Path: cty.GetAttrPath("records"), Key: "id"},
+		{Path: cty.GetAttrPath("ids")},
+	}}
+	for expr, expected := range map[string]int{
+		"$.records[?(@.id == 842)]":  1,
+		"$.records[?(@.id == 843)]":  0,
+		"$.records[?(@.id == 0)]":    1,
+		"$.records[?(@.id == 1998)]": 1,
+		"$.ids[?(@ == 3)]":           2,
+		"$.ids[?(@ == 9)]":           0,
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fast, fastPaths, err := p.EvalWithOptions(cty.Value(doc), opts)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		slow, _, _ := p.Eval(cty.Value(doc))
+		if len(fast) != expected || len(slow) != expected || len(fastPaths) != expected {
+			t.Errorf("%s: expected %d matches, got %d (scan: %d)", expr, expected, len(fast), len(slow))
+		}
+	}
+}
+
+type kvBuilder map[string]Val
+
+func (b kvBuilder) Build() map[string]Val { return b }
+
+func kvPair(k string, v Val) KVBuilder { return kvBuilder{k: v} }
+
+func TestRegexKeys(t *testing.T) {
+	labels := cty.MapVal(map[string]cty.Value{
+		"app.kubernetes.io/name":    cty.StringVal("web"),
+		"app.kubernetes.io/part-of": cty.StringVal("shop"),
+		"team":                      cty.StringVal("core"),
+		"apps/v1":                   cty.StringVal("x"),
+	})
+	doc := Val(cty.ObjectVal(map[string]cty.Value{
+		"metadata": cty.ObjectVal(map[string]cty.Value{"labels": labels}),
+	}))
+	assert(t, doc, map[string]Val{
+		`$.metadata.labels[/^app\./]`:     Tuple(Str("web"), Str("shop")),
+		`$.metadata.labels[/^apps\/v1$/]`: Tuple(Str("x")),
+		`$..[/^te/]`:                      Tuple(Str("core")),
+		`$.metadata[/abel/][/name$/]`:     Tuple(Str("web")),
+		`$.metadata.labels[/^nope/]`:      Tuple(),
+	})
+	assertError(t, []string{`$.a[/(/]`, `$.a[/abc`})
+
+	p, _ := jsonpath.NewPath(`$.metadata.labels[/^app\./]`)
+	if p.String() != `$.metadata.labels[/^app\./]` {
+		t.Error("unexpected String()", p.String())
+	}
+
+	if _, err := jsonpath.NewPath(`$.metadata.labels[/^app\./]`, jsonpath.WithMaxRegexLength(6)); err != nil {
+		t.Error("unexpected error", err)
+	}
+	_, err := jsonpath.NewPath(`$.metadata.labels[/^app\.kubernetes/]`, jsonpath.WithMaxRegexLength(6))
+	if !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Error("expected ErrUnsupported, got", err)
+	}
+	_, err = jsonpath.NewPath(`$.a[/(/]`, jsonpath.WithMaxRegexLength(6))
+	if !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("expected ErrSyntax, got", err)
+	}
+
+	// the limit also holds for regexes nested in filters and unions
+	for _, expr := range []string{`$.a[?(@[/abcdefgh/])]`, `$.a[0,/abcdefgh/]`, `$.a[?(@.b[/abcdefgh/] == 1)]`} {
+		if _, err := jsonpath.NewPath(expr, jsonpath.WithMaxRegexLength(3)); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", expr, err)
+		}
+		if _, err := jsonpath.NewPath(expr); err != nil {
+			t.Errorf("%s: unexpected error %v", expr, err)
+		}
+	}
+}
+
+func TestNumericKeys(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"years": cty.ObjectVal(map[string]cty.Value{
+			"2022": cty.StringVal("old"),
+			"2023": cty.StringVal("new"),
+		}),
+		"ids": cty.MapVal(map[string]cty.Value{"7": cty.True}),
+	})
+	for expr, expected := range map[string]cty.Value{
+		"$.years[2023]":      cty.TupleVal([]cty.Value{cty.StringVal("new")}),
+		"$.years.[2023]":     cty.TupleVal([]cty.Value{cty.StringVal("new")}),
+		"$.years[2022,2023]": cty.TupleVal([]cty.Value{cty.StringVal("old"), cty.StringVal("new")}),
+		"$.years[1999]":      cty.EmptyTupleVal,
+		"$.ids[7]":           cty.TupleVal([]cty.Value{cty.True}),
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if _, _, err := p.Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+			t.Errorf("%s: expected a type mismatch without NumericKeys, got %v", expr, err)
+		}
+		vals, _, err := p.EvalWithOptions(doc, jsonpath.EvalOptions{NumericKeys: true})
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if !cty.TupleVal(vals).RawEquals(expected) {
+			t.Errorf("%s: expected %#v, got %#v", expr, expected, vals)
+		}
+	}
+}
+
+func TestFilterRootReference(t *testing.T) {
+	store := Val(storeExample.Value)
+	assert(t, store, map[string]Val{
+		"$.store.book[?(@.price > $.expensive)].title":           Tuple(Str("Sword of Honour"), Str("The Lord of the Rings")),
+		"$.store.book[?(@.price < $.store.bicycle.price)].title": Tuple(Str("Sayings of the Century"), Str("Sword of Honour"), Str("Moby Dick")),
+	})
+
+	p, _ := jsonpath.NewPath("$.store.book[?(@.price > $.expensive)].title")
+	if got := p.String(); got != "$.store.book[?(@.price > $.expensive)].title" {
+		t.Errorf("String: got %s", got)
+	}
+	want := []string{".store.book", ".expensive"}
+	prefixes := p.ReferencedPrefixes()
+	if len(prefixes) != len(want) {
+		t.Fatalf("got %d prefixes, want %d", len(prefixes), len(want))
+	}
+	for i, prefix := range prefixes {
+		if got := jsonpath.PrettyCtyPath(prefix); got != want[i] {
+			t.Errorf("prefix %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestFilterFunctions(t *testing.T) {
+	assert(t, Val(storeExample.Value), map[string]Val{
+		"$.store.book[?(length(@.author) > 12)].title": Tuple(Str("Moby Dick"), Str("The Lord of the Rings")),
+		"$.store.book[?(length(@) == 5)].title":        Tuple(Str("Moby Dick"), Str("The Lord of the Rings")),
+		"$.store.book[?(@.author.length > 12)].title":  Tuple(Str("Moby Dick"), Str("The Lord of the Rings")),
+		"$.store.book[?(@.length == 5)].title":         Tuple(Str("Moby Dick"), Str("The Lord of the Rings")),
+	})
+
+	// a real length key wins over the computed length
+	doc := cty.TupleVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"length": cty.NumberIntVal(7), "id": cty.StringVal("a")}),
+		cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(7), "id": cty.StringVal("b")}),
+		cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(1), "id": cty.StringVal("c")}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$[?(@.length == 7)].id":     Tuple(Str("a")),
+		"$[?(length(@) == 2)].id":    Tuple(Str("a"), Str("b"), Str("c")),
+		"$[?(@.size.length > 0)].id": Tuple(),
+	})
+	assertError(t, []string{
+		"$.store.book[?(nosuch(@) > 1)]",
+		"$.store.book[?(length(@, @) > 1)]",
+	})
+}
+
+func TestDialects(t *testing.T) {
+	cases := []struct {
+		dialect jsonpath.Dialect
+		expr    string
+		want    string
+		titles  []string
+	}{
+		{jsonpath.DialectOjg, "$.store.book[?(@.category==reference)].title", "$.store.book[?(@.category == 'reference')].title", []string{"Sayings of the Century"}},
+		{jsonpath.DialectAjson, "$.store.book[?(@.author.length > 12)].title", "$.store.book[?(@.author.length > 12)].title", []string{"Moby Dick", "The Lord of the Rings"}},
+		{jsonpath.DialectJSONPathPlus, "$.store.book[?(@.category === 'reference')].title", "$.store.book[?(@.category == 'reference')].title", []string{"Sayings of the Century"}},
+		// union branches are parsed in the same dialect
+		{jsonpath.DialectOjg, "$.store.book[1,?(@.category==reference)].title", "$.store.book[1,?(@.category == 'reference')].title", []string{"Sword of Honour", "Sayings of the Century"}},
+		{jsonpath.DialectJSONPathPlus, "$.store.book[1,?(@.category === 'reference')].title", "$.store.book[1,?(@.category == 'reference')].title", []string{"Sword of Honour", "Sayings of the Century"}},
+	}
+	for _, c := range cases {
+		p, err := jsonpath.CompileDialect(c.expr, c.dialect)
+		if err != nil {
+			t.Fatalf("%s %s: %s", c.dialect, c.expr, err)
+		}
+		if got := p.String(); got != c.want {
+			t.Errorf("%s %s: got %s, want %s", c.dialect, c.expr, got, c.want)
+		}
+		vals, _, err := p.Eval(storeExample.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vals) != len(c.titles) {
+			t.Fatalf("%s %s: got %d results, want %d", c.dialect, c.expr, len(vals), len(c.titles))
+		}
+		for i, v := range vals {
+			if v.AsString() != c.titles[i] {
+				t.Errorf("%s %s: result %d is %s, want %s", c.dialect, c.expr, i, v.AsString(), c.titles[i])
+			}
+		}
+	}
+
+	if _, err := jsonpath.NewPath("$.store.book[?(@.category==reference)]"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("bare words need a dialect, got %v", err)
+	}
+}
+
+func TestCheckCompat(t *testing.T) {
+	exprs := []string{
+		"$.store.book[?(@.price < 10)].title",
+		"$.store.book[?(@.category==fiction)].title",
+		"$.store.book[?(@.title.length > 20)].title",
+	}
+	divergences := jsonpath.CheckCompat(exprs, []cty.Value{storeExample.Value}, jsonpath.DialectAjson, jsonpath.DialectDefault)
+	// .length means the same in both
+	if len(divergences) != 1 {
+		t.Fatalf("got %d divergences, want 1: %v", len(divergences), divergences)
+	}
+	if d := divergences[0]; d.Expr != exprs[1] || d.OldErr != nil || !errors.Is(d.NewErr, jsonpath.ErrSyntax) {
+		t.Errorf("unexpected divergence %s", d)
+	}
+}
+
+func TestResolveRefs(t *testing.T) {
+	ref := func(target string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"$ref": cty.StringVal(target)})
+	}
+	spec := cty.ObjectVal(map[string]cty.Value{
+		"paths": cty.ObjectVal(map[string]cty.Value{
+			"/pets": cty.ObjectVal(map[string]cty.Value{
+				"schema": ref("#/components/schemas/Pets"),
+			}),
+		}),
+		"components": cty.ObjectVal(map[string]cty.Value{
+			"schemas": cty.ObjectVal(map[string]cty.Value{
+				"Pets": cty.ObjectVal(map[string]cty.Value{"type": cty.StringVal("array"), "items": ref("#/components/schemas/Pet")}),
+				"Pet":  cty.ObjectVal(map[string]cty.Value{"type": cty.StringVal("object"), "required": cty.TupleVal([]cty.Value{cty.StringVal("id")})}),
+				"A":    ref("#/components/schemas/B"),
+				"B":    ref("#/components/schemas/A"),
+				"Bad":  ref("#/components/nope"),
+			}),
+		}),
+	})
+
+	p, _ := jsonpath.NewPath("$.paths['/pets'].schema.items.required[0]")
+	opts := jsonpath.EvalOptions{ResolveRefs: true}
+	vals, paths, err := p.EvalWithOptions(spec, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 1 || vals[0].AsString() != "id" {
+		t.Fatalf("unexpected result %#v", vals)
+	}
+	if got := jsonpath.PrettyCtyPath(paths[0]); got != ".components.schemas.Pet.required[0]" {
+		t.Errorf("unexpected path %s", got)
+	}
+
+	if vals, _, _ := p.Eval(spec); len(vals) != 0 {
+		t.Errorf("references must not be followed by default, got %#v", vals)
+	}
+
+	p, _ = jsonpath.NewPath("$.components.schemas.A.type")
+	if _, _, err := p.EvalWithOptions(spec, opts); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("expected a reference cycle error, got %v", err)
+	}
+	p, _ = jsonpath.NewPath("$.components.schemas.Bad")
+	if _, _, err := p.EvalWithOptions(spec, opts); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoizedFilters(t *testing.T) {
+	pod := func(name, image string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"name": cty.StringVal(name),
+			"spec": cty.ObjectVal(map[string]cty.Value{"image": cty.StringVal(image)}),
+		})
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"pods": cty.TupleVal([]cty.Value{
+			pod("a", "nginx"), pod("b", "redis"), pod("c", "nginx"), pod("d", "nginx"),
+		}),
+		"image": cty.StringVal("nginx"),
+	})
+	for _, expr := range []string{
+		"$.pods[?(@.spec.image == 'nginx')].name",
+		"$.pods[*].spec[?(@.image == $.image)]",
+		"$.pods[?(length(@.spec.image) == 5)].name",
+		"$.pods[?(@.missing)]",
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantPaths, err := p.Eval(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, gotPaths, err := p.Eval(doc, jsonpath.WithMemoizedFilters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d results, want %d", expr, len(got), len(want))
+		}
+		for i := range got {
+			if !got[i].RawEquals(want[i]) || !gotPaths[i].Equals(wantPaths[i]) {
+				t.Errorf("%s: result %d differs: %#v at %#v", expr, i, got[i], gotPaths[i])
+			}
+		}
+	}
+}
+
+func TestEvalMatches(t *testing.T) {
+	p := jsonpath.MustNewPath("$.store.book[?(@.price < 10)].title")
+	matches, err := p.EvalMatches(storeExample.Value, jsonpath.WithTrace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(matches))
+	}
+	first := matches[0]
+	if first.Value.AsString() != "Sayings of the Century" || len(first.Trace) != 1 {
+		t.Fatalf("unexpected first match: %#v", first)
+	}
+	if got, want := first.Trace[0].String(), "$.store.book[0]: @.price=8.95 < 10"; got != want {
+		t.Errorf("got trace %q, want %q", got, want)
+	}
+
+	p = jsonpath.MustNewPath("$..book[?(@.isbn)].author")
+	matches, err = p.EvalMatches(storeExample.Value, jsonpath.WithTrace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range matches {
+		if len(m.Trace) != 1 || !strings.HasSuffix(m.Trace[0].String(), "@.isbn exists") {
+			t.Errorf("unexpected trace for %s: %v", m.Value.AsString(), m.Trace)
+		}
+	}
+
+	matches, err = p.EvalMatches(storeExample.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Trace != nil {
+		t.Errorf("traces recorded without WithTrace: %v", matches)
+	}
+}
+
+func TestFunctionSteps(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"csv":  cty.StringVal("a,b,c"),
+		"rows": cty.TupleVal([]cty.Value{cty.StringVal("x;y"), cty.StringVal("p;q;r")}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$.csv.split(',')[2]":                  Tuple(Str("c")),
+		"$.csv.split(',')":                     Tuple(Tuple(Str("a"), Str("b"), Str("c"))),
+		"$.rows[*].split(';')[-1]":             Tuple(Str("y"), Str("r")),
+		"$.rows[?(length(split(@, ';')) > 2)]": Tuple(Str("p;q;r")),
+		"$.rows.length()":                      Tuple(Num(2)),
+	})
+
+	p := jsonpath.MustNewPath("$.rows[1].split(';')[1]")
+	if got := p.String(); got != "$.rows[1].split(';')[1]" {
+		t.Errorf("unexpected formatting %s", got)
+	}
+	_, paths, err := p.Eval(doc)
+	if err != nil || len(paths) != 1 || !paths[0].Equals(cty.GetAttrPath("rows").IndexInt(1)) {
+		t.Errorf("results of a function step should be found at its input, got %v: %v", paths, err)
+	}
+
+	// computed matches are only found at the path of their source, which
+	// writes through them would clobber
+	const split = "$.rows[1].split(';')[1]"
+	writes := map[string]func() error{
+		"Set":           func() error { _, err := jsonpath.Set(doc, split, cty.StringVal("z")); return err },
+		"Delete":        func() error { _, err := jsonpath.Delete(doc, split); return err },
+		"ReplaceByPath": func() error { _, err := jsonpath.ReplaceByPath(doc, split, cty.StringVal("z")); return err },
+		"ReplaceFunc": func() error {
+			_, err := jsonpath.ReplaceFunc(doc, split, func(old cty.Value, _ cty.Path) (cty.Value, error) { return old, nil })
+			return err
+		},
+		"Document.Set": func() error { return jsonpath.NewDocument(doc).Set(split, cty.StringVal("z")) },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("%s through a computed match: got %v, want ErrUnsupported", name, err)
+		}
+	}
+	if updated, err := jsonpath.Delete(doc, "$.rows[?(@.split(';').length() > 2)]"); err != nil || updated.GetAttr("rows").LengthInt() != 1 {
+		t.Errorf("filters on computed values still select writable matches, got %v", err)
+	}
+	if _, _, err := jsonpath.MustNewPath("$.rows.split(';')").Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Error("split of an array should fail, got", err)
+	}
+	if _, err := jsonpath.NewPath("$.csv.split(',', ';')"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("split takes one argument as a step, got", err)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"m": cty.TupleVal([]cty.Value{
+			cty.TupleVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2)}),
+			cty.ListVal([]cty.Value{cty.NumberIntVal(3)}),
+			cty.NumberIntVal(4),
+		}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$.m.flatten()":                    Tuple(Tuple(Num(1), Num(2), Num(3), Num(4))),
+		"$.m.flatten()[1:]":                Tuple(Num(2), Num(3), Num(4)),
+		"$[?(length(flatten(@)) == 4)][0]": Tuple(Tuple(Num(1), Num(2))),
+	})
+
+	_, paths, err := jsonpath.MustNewPath("$.m.flatten()[*]").Eval(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".m[0][0]", ".m[0][1]", ".m[1][0]", ".m[2]"}
+	if got := prettyPaths(paths); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("flattened elements should keep their paths, got %v", got)
+	}
+	if _, _, err := jsonpath.MustNewPath("$.m[2].flatten()").Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Error("flatten of a number should fail, got", err)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	doc := Obj(kvPair("m", Tuple(Num(1), Num(2), Num(3), Num(4), Num(5))), kvPair("empty", Tuple()))
+	assert(t, doc, map[string]Val{
+		"$.m.chunks(2)[*]":  Tuple(Tuple(Num(1), Num(2)), Tuple(Num(3), Num(4)), Tuple(Num(5))),
+		"$.m.chunks(5)[*]":  Tuple(Tuple(Num(1), Num(2), Num(3), Num(4), Num(5))),
+		"$.m.chunks(2)[-1]": Tuple(Tuple(Num(5))),
+		"$.empty.chunks(2)": Tuple(Tuple()),
+	})
+
+	_, paths, err := jsonpath.MustNewPath("$.m.chunks(2)[1][*]").Eval(cty.Value(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(prettyPaths(paths), " "); got != ".m[2] .m[3]" {
+		t.Errorf("chunked elements should keep their paths, got %s", got)
+	}
+	for _, expr := range []string{"$.m.chunks(0)", "$.m.chunks(1.5)", "$.m[0].chunks(2)"} {
+		if _, _, err := jsonpath.MustNewPath(expr).Eval(cty.Value(doc)); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+			t.Errorf("%s: expected a type mismatch, got %v", expr, err)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	doc := Obj(kvPair("events", Tuple(Str("a"), Str("b"), Str("c"), Str("d"))))
+	assert(t, doc, map[string]Val{
+		"$.events.reverse()[*]":  Tuple(Str("d"), Str("c"), Str("b"), Str("a")),
+		"$.events.reverse()[:2]": Tuple(Str("d"), Str("c")),
+		"$.events.reverse()[0]":  Tuple(Str("d")),
+	})
+
+	_, paths, err := jsonpath.MustNewPath("$.events.reverse()[:2]").Eval(cty.Value(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(prettyPaths(paths), " "); got != ".events[3] .events[2]" {
+		t.Errorf("reversed elements should keep their paths, got %s", got)
+	}
+
+	matches, err := jsonpath.MustNewPath("$.events[1:]").EvalMatches(cty.Value(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := matches.Reverse()
+	if len(reversed) != 3 || reversed[0].Value.AsString() != "d" || !reversed[0].Path.Equals(matches[2].Path) {
+		t.Errorf("unexpected reversed matches %v", reversed)
+	}
+	if matches[0].Value.AsString() != "b" {
+		t.Error("Reverse should leave the matches alone")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	doc := Obj(kvPair("labels", Obj(kvPair("app", Str("web")), kvPair("tier", Str("front")))))
+	assert(t, doc, map[string]Val{
+		"$.labels.entries()[*].key":                          Tuple(Str("app"), Str("tier")),
+		"$.labels.entries()[?(@.key == 'tier')].value":       Tuple(Str("front")),
+		"$.labels.entries()[?(@.value == 'web')]":            Tuple(Obj(kvPair("key", Str("app")), kvPair("value", Str("web")))),
+		"$.labels.entries().from_entries()":                  Tuple(Obj(kvPair("app", Str("web")), kvPair("tier", Str("front")))),
+		"$.labels.entries()[?(@.key != 'app')].key.length()": Tuple(Num(4)),
+	})
+
+	for expr, want := range map[string]string{
+		"$.labels.entries()[?(@.key == 'tier')].value": ".labels.tier",
+		"$.labels.entries()[?(@.key == 'tier')]":       ".labels.tier",
+		"$.labels.entries().from_entries().app":        ".labels.app",
+		"$.labels.entries()[?(@.key == 'tier')].key":   ".labels",
+	} {
+		_, paths, err := jsonpath.MustNewPath(expr).Eval(cty.Value(doc))
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if got := strings.Join(prettyPaths(paths), " "); got != want {
+			t.Errorf("%s: got paths %s, want %s", expr, got, want)
+		}
+	}
+
+	// the values of entries can be written, the entries and keys can't
+	updated, err := jsonpath.ReplaceByPath(cty.Value(doc), "$.labels.entries()[?(@.key == 'tier')].value", cty.StringVal("back"))
+	if err != nil || jsonpath.DebugString(updated) != `{"labels": {"app": "web", "tier": "back"}}` {
+		t.Errorf("unexpected replacement %s, %v", jsonpath.DebugString(updated), err)
+	}
+	for _, expr := range []string{"$.labels.entries()", "$.labels.entries()[*]", "$.labels.entries()[*].key"} {
+		if _, err := jsonpath.ReplaceByPath(cty.Value(doc), expr, cty.StringVal("x")); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("ReplaceByPath %s: got %v, want ErrUnsupported", expr, err)
+		}
+		if _, err := jsonpath.Delete(cty.Value(doc), expr); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("Delete %s: got %v, want ErrUnsupported", expr, err)
+		}
+	}
+	for _, expr := range []string{"$.labels.app.entries()", "$.labels.from_entries()", "$.labels.app.from_entries()"} {
+		if _, _, err := jsonpath.MustNewPath(expr).Eval(cty.Value(doc)); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+			t.Errorf("%s: expected a type mismatch, got %v", expr, err)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	server := func(name, region string) Val {
+		return Obj(kvPair("name", Str(name)), kvPair("region", Str(region)))
+	}
+	doc := Obj(kvPair("servers", Tuple(
+		server("a", "eu"), server("b", "us"), server("c", "eu"),
+		Obj(kvPair("name", Str("d"))),
+	)))
+	assert(t, doc, map[string]Val{
+		"$.servers.group_by(@.region).eu[*].name":  Tuple(Str("a"), Str("c")),
+		"$.servers.group_by(@.region).us[*].name":  Tuple(Str("b")),
+		"$.servers.group_by(@.region).*.length()":  Tuple(Num(2), Num(1)),
+		"$[?(length(group_by(@, @.region)) == 2)]": Tuple(Tuple(server("a", "eu"), server("b", "us"), server("c", "eu"), Obj(kvPair("name", Str("d"))))),
+	})
+
+	_, paths, err := jsonpath.MustNewPath("$.servers.group_by(@.region).eu[*]").Eval(cty.Value(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(prettyPaths(paths), " "); got != ".servers[0] .servers[2]" {
+		t.Errorf("grouped elements should keep their paths, got %s", got)
+	}
+	if _, _, err := jsonpath.MustNewPath("$.servers.group_by(@)").Eval(cty.Value(doc)); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Error("objects can't be keys, got", err)
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	for _, c := range []struct {
+		v    cty.Value
+		want bool
+	}{
+		{cty.True, true},
+		{cty.False, false},
+		{cty.StringVal("x"), true},
+		{cty.StringVal(""), false},
+		{cty.NumberFloatVal(-0.5), true},
+		{cty.Zero, false},
+		{cty.TupleVal([]cty.Value{cty.False}), true},
+		{cty.EmptyTupleVal, false},
+		{cty.MapValEmpty(cty.String), false},
+		{cty.EmptyObjectVal, false},
+		{cty.ObjectVal(map[string]cty.Value{"a": cty.NullVal(cty.String)}), true},
+		{cty.NullVal(cty.Bool), false},
+		{cty.UnknownVal(cty.String), false},
+		{cty.StringVal("x").Mark("sensitive"), true},
+	} {
+		if got := jsonpath.Truthy(c.v); got != c.want {
+			t.Errorf("Truthy(%#v) = %v", c.v, got)
+		}
+		if got := Val(c.v).Truthy(); got != c.want {
+			t.Errorf("Val(%#v).Truthy() = %v", c.v, got)
+		}
+	}
+
+	doc := Obj(kvPair("items", Tuple(
+		Obj(kvPair("name", Str("a")), kvPair("tags", Tuple(Str("x")))),
+		Obj(kvPair("name", Str("b")), kvPair("tags", Tuple())),
+		Obj(kvPair("name", Str("c"))),
+	)))
+	assert(t, doc, map[string]Val{
+		"$.items[?(length(@.tags))].name": Tuple(Str("a")),
+		"$.items[?(@.tags)].name":         Tuple(Str("a"), Str("b")),
+		"$.items[?(0)].name":              Tuple(),
+		"$.items[?('')].name":             Tuple(),
+		"$.items[?('yes')].name":          Tuple(Str("a"), Str("b"), Str("c")),
+	})
+
+	// folded or not, a literal condition selects the same elements
+	for _, expr := range []string{"$.items[?(0)].name", "$.items[?('')].name", "$.items[?(false)].name", "$.items[?(1)].name", "$.items[?(true)].name"} {
+		optimized, _, err := jsonpath.MustNewPath(expr).Eval(cty.Value(doc))
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		plain, _, err := jsonpath.MustNewPath(expr, jsonpath.WithoutOptimization()).Eval(cty.Value(doc))
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if len(optimized) != len(plain) {
+			t.Errorf("%s: %d results optimized, %d without optimization", expr, len(optimized), len(plain))
+		}
+	}
+}
+
+func TestKeyBy(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"containers": [
+		{"name": "app", "port": 80},
+		{"name": "sidecar", "port": 15001},
+		{"name": "app", "port": 8080}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := jsonpath.MustNewPath("$.containers[0,1]").EvalMatches(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName, err := matches.KeyBy("$.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, err := jsonpath.ReadInt(byName, "$.sidecar.port"); err != nil || port != 15001 {
+		t.Errorf("unexpected keyed object %#v, %v", byName, err)
+	}
+	byPort, err := matches.KeyBy("$.port")
+	if err != nil || !byPort.Type().HasAttribute("80") {
+		t.Errorf("expected numbers as keys, got %#v, %v", byPort, err)
+	}
+
+	all, _ := jsonpath.MustNewPath("$.containers[*]").EvalMatches(doc)
+	var pathErr *jsonpath.PathError
+	if _, err := all.KeyBy("$.name"); !errors.Is(err, jsonpath.ErrConflict) || !errors.As(err, &pathErr) || jsonpath.FormatPath(pathErr.Path) != "$.containers[2]" {
+		t.Errorf("expected a conflict at the second app, got %v", err)
+	}
+	grouped, err := all.KeyBy("$.name", jsonpath.WithKeyCollisions(jsonpath.KeyCollisionsCollect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := jsonpath.Count(grouped, "$.app[*]"); err != nil || n != 2 {
+		t.Errorf("expected both apps under one key, got %d, %v", n, err)
+	}
+	if _, err := all.KeyBy("$.image"); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected a missing key to fail, got %v", err)
+	}
+	if _, err := all.KeyBy("$.*"); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected several keys to fail, got %v", err)
+	}
+}
+
+func TestMatchListInterop(t *testing.T) {
+	doc := Obj(
+		kvPair("b", Tuple(Num(2), Num(1))),
+		kvPair("a", Obj(kvPair("n", Num(3)))),
+	)
+	var matches jsonpath.MatchList
+	for _, expr := range []string{"$.b[*]", "$.a.n"} {
+		m, err := jsonpath.MustNewPath(expr).EvalMatches(cty.Value(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, m...)
+	}
+	sort.Sort(matches)
+	if got := matches.String(); got != "$.a.n: 3\n$.b[0]: 2\n$.b[1]: 1" {
+		t.Errorf("unexpected sorted matches %q", got)
+	}
+
+	b, err := json.Marshal(matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[{"path":"$.a.n","value":3},{"path":"$.b[0]","value":2},{"path":"$.b[1]","value":1}]` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+}
+
+func TestDecimalNumbers(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"payments": [
+		{"id": "a", "amount": 0.3, "parts": [0.1, 0.2]},
+		{"id": "b", "amount": 0.30000000000000004, "parts": [0.3]},
+		{"id": "c", "amount": 1.1, "parts": [1, 0.1]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expr, want := range map[string][2]string{
+		"$.payments[?(@.amount == 0.3)].id":       {"", "a b"},
+		"$.payments[?(@.amount == 1.1)].id":       {"", "c"},
+		"$.payments[?(@.amount > 0.3)].id":        {"a b c", "c"},
+		"$.payments[?(sum(@.parts) == 0.3)].id":   {"", "a b"},
+		"$.payments[?(sum(@.parts) == @.amount)]": {"$.payments[0] $.payments[2]", "$.payments[0] $.payments[1] $.payments[2]"},
+	} {
+		for i, opts := range [][]jsonpath.Option{nil, {jsonpath.WithDecimalNumbers()}} {
+			matches, err := jsonpath.MustNewPath(expr, opts...).EvalMatches(doc)
+			if err != nil {
+				t.Fatal(expr, err)
+			}
+			got := []string{}
+			for _, m := range matches {
+				if m.Value.Type() == cty.String {
+					got = append(got, m.Value.AsString())
+				} else {
+					got = append(got, jsonpath.FormatPath(m.Path))
+				}
+			}
+			if strings.Join(got, " ") != want[i] {
+				t.Errorf("%s (decimal %v): got %v, want %s", expr, i == 1, got, want[i])
+			}
+		}
+	}
+}
@@ -1,7 +1,8 @@
 module github.com/clean8s/peekcty
 
-go 1.17
+go 1.21
 
-require github.com/zclconf/go-cty v1.9.1
-
-require golang.org/x/text v0.3.6 // indirect
+require (
+	github.com/zclconf/go-cty v1.9.1
+	golang.org/x/text v0.3.6
+)
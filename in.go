@@ -7,7 +7,6 @@ import (
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/set"
 	"github.com/zclconf/go-cty/cty/gocty"
-	"fmt"
 )
 
 type StructPath struct {
@@ -55,7 +54,6 @@ func Transform(t Type, path []Val, transformer TypeTransformer) Type {
 		fnType := Transform(el, append(path, Unknown), transformer).CtyType()
 		return Type(fn(fnType))
 	}
-	return UnknownType
 }
 
 func (t Type) IsCapsule() bool {
@@ -71,9 +69,6 @@ func New(gv interface{}) Val {
 	var path cty.Path
 	var conv []StructPath = make([]StructPath, 0)
 	res, err := impliedType(rt, path, &conv)
-	for _, item := range conv {
-		fmt.Println(FormatCtyPath(item.Path), item.FieldNames)
-	}
 	if err != nil {
 		panic(err)
 	}
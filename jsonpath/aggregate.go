@@ -0,0 +1,212 @@
+package jsonpath
+
+import (
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Sum adds up the numbers jsonPath matches in doc; a matched array
+// contributes its elements, so `$.samples` and `$.samples[*]` are
+// equivalent. It's zero when nothing matches.
+//
+// When jsonPath is made of plain fields and indexes, optionally followed by
+// a wildcard, the numbers are read straight from doc, without the per-match
+// bookkeeping of Eval, which dominates on large metric arrays.
+func Sum(doc cty.Value, jsonPath string) (cty.Value, error) {
+	return aggregate(doc, jsonPath, "sum")
+}
+
+// Avg is the arithmetic mean of the numbers Sum would add up. It fails with
+// ErrNotFound when there are none.
+func Avg(doc cty.Value, jsonPath string) (cty.Value, error) {
+	return aggregate(doc, jsonPath, "avg")
+}
+
+// Min is the smallest of the numbers Sum would add up. It fails with
+// ErrNotFound when there are none.
+func Min(doc cty.Value, jsonPath string) (cty.Value, error) {
+	return aggregate(doc, jsonPath, "min")
+}
+
+// Max is the largest of the numbers Sum would add up. It fails with
+// ErrNotFound when there are none.
+func Max(doc cty.Value, jsonPath string) (cty.Value, error) {
+	return aggregate(doc, jsonPath, "max")
+}
+
+func aggregate(doc cty.Value, jsonPath, op string) (cty.Value, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	var acc accumulator
+	if err := acc.addPath(doc, p); err != nil {
+		return cty.NilVal, err
+	}
+	return acc.result(op)
+}
+
+// accumulator folds numbers into sum, min and max as they come, reading
+// each one's big.Float in place.
+type accumulator struct {
+	n        int
+	sum      big.Float
+	min, max *big.Float
+}
+
+// addPath adds the matches of p in doc, reading them directly when p is
+// static.
+func (a *accumulator) addPath(doc cty.Value, p *JSONPath) error {
+	steps := p.steps()
+	prefix := staticPrefix(steps)
+	rest := steps[len(prefix):]
+	if len(rest) == 0 || (len(rest) == 1 && isWildcardStep(rest[0])) {
+		v, ok := lookupStatic(doc, prefix)
+		if !ok {
+			return nil
+		}
+		if len(rest) == 0 {
+			return a.addMatch(v)
+		}
+		if v.IsNull() || !v.IsKnown() || !(isAggregatable(v) || isMapping(v.Type())) {
+			// like `[*]`, wildcards have nothing to select from scalars
+			return nil
+		}
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			if err := a.addMatch(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	vals, _, err := p.Eval(doc)
+	if err != nil {
+		return err
+	}
+	for _, v := range vals {
+		if err := a.addMatch(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMatch adds a number, or each element of an array of numbers.
+func (a *accumulator) addMatch(v cty.Value) error {
+	v, _ = v.Unmark()
+	if !isAggregatable(v) {
+		return a.add(v)
+	}
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		elem, _ = elem.Unmark()
+		if err := a.add(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *accumulator) add(v cty.Value) error {
+	if v.Type() != cty.Number || v.IsNull() || !v.IsKnown() {
+		return newError(ErrTypeMismatch, "can only aggregate numbers, found %s", friendlyValue(v))
+	}
+	f := v.AsBigFloat()
+	a.n++
+	a.sum.Add(&a.sum, f)
+	if a.min == nil || f.Cmp(a.min) < 0 {
+		a.min = f
+	}
+	if a.max == nil || f.Cmp(a.max) > 0 {
+		a.max = f
+	}
+	return nil
+}
+
+func (a *accumulator) result(op string) (cty.Value, error) {
+	if op == "sum" {
+		return cty.NumberVal(new(big.Float).Set(&a.sum)), nil
+	}
+	if a.n == 0 {
+		return cty.NilVal, newError(ErrNotFound, "no numbers to take the %s of", op)
+	}
+	switch op {
+	case "avg":
+		return cty.NumberVal(new(big.Float).Quo(&a.sum, big.NewFloat(float64(a.n)))), nil
+	case "min":
+		return cty.NumberVal(new(big.Float).Set(a.min)), nil
+	}
+	return cty.NumberVal(new(big.Float).Set(a.max)), nil
+}
+
+// aggregateFunc is the filter function form of an aggregation, taking the
+// array (or number) to aggregate.
+func aggregateFunc(op string) filterFunc {
+	return filterFunc{params: 1, impl: func(args []cty.Value) (cty.Value, error) {
+		var acc accumulator
+		if err := acc.addMatch(args[0]); err != nil {
+			return cty.NilVal, err
+		}
+		return acc.result(op)
+	}}
+}
+
+// lookupStatic follows path in doc, addressing objects and maps alike. It
+// reports false if a step doesn't exist.
+func lookupStatic(doc cty.Value, path cty.Path) (cty.Value, bool) {
+	v := doc
+	for _, step := range path {
+		v, _ = v.Unmark()
+		key := stepKey(step)
+		if v.IsNull() || !v.IsKnown() || key == cty.NilVal {
+			return cty.NilVal, false
+		}
+		ty := v.Type()
+		switch {
+		case ty.IsObjectType() && key.Type() == cty.String:
+			if !ty.HasAttribute(key.AsString()) {
+				return cty.NilVal, false
+			}
+			v = v.GetAttr(key.AsString())
+		case (ty.IsMapType() && key.Type() == cty.String) || ((ty.IsListType() || ty.IsTupleType()) && key.Type() == cty.Number):
+			if !v.HasIndex(key).True() {
+				return cty.NilVal, false
+			}
+			v = v.Index(key)
+		default:
+			return cty.NilVal, false
+		}
+	}
+	v, _ = v.Unmark()
+	return v, true
+}
+
+func isWildcardStep(node Node) bool {
+	switch node := node.(type) {
+	case *WildcardNode:
+		return true
+	case *ArrayNode:
+		return isWildcardSlice(node.Params)
+	}
+	return false
+}
+
+// isAggregatable reports whether v is a known array or set whose elements
+// are aggregated one by one.
+func isAggregatable(v cty.Value) bool {
+	ty := v.Type()
+	return (ty.IsListType() || ty.IsTupleType() || ty.IsSetType()) && !v.IsNull() && v.IsKnown()
+}
+
+func friendlyValue(v cty.Value) string {
+	switch {
+	case !v.IsKnown():
+		return "an unknown value"
+	case v.IsNull():
+		return "null"
+	}
+	return v.Type().FriendlyName()
+}
@@ -0,0 +1,190 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Assert checks every value jsonPath matches in doc against checks, e.g.
+// Assert(doc, "$.replicas", Gte(2)), for policy checks and tests. It returns
+// nil when all of them pass, or else a *MultiPathError listing a Violation
+// per failing value and check; Each reports the failing elements by their
+// own paths. A path matching nothing fails with ErrNotFound, since an
+// assertion about a missing value can't hold. Paths that don't compile or
+// evaluate return their error as is.
+func Assert(doc cty.Value, jsonPath string, checks ...Check) error {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return err
+	}
+	vals, paths, err := p.Eval(doc)
+	if err != nil {
+		return err
+	}
+	if len(vals) == 0 {
+		return &MultiPathError{Errors: []error{newError(ErrNotFound, "%s matches nothing", jsonPath)}}
+	}
+	errs := []error{}
+	for i, val := range vals {
+		for _, check := range checks {
+			rule := Rule{Path: jsonPath, Check: check}
+			for _, f := range checkFailures(check, val) {
+				path := append(paths[i].Copy(), f.path...)
+				errs = append(errs, Violation{Path: path, Value: f.value, Rule: rule, Message: f.message})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &MultiPathError{Errors: errs}
+	}
+	return nil
+}
+
+// checkFailure is a failure of a check at a path relative to the value it
+// checked.
+type checkFailure struct {
+	path    cty.Path
+	value   cty.Value
+	message string
+}
+
+// eachError carries the failures of the elements checked by Each.
+type eachError struct {
+	failures []checkFailure
+}
+
+func (e *eachError) Error() string {
+	msgs := make([]string, len(e.failures))
+	for i, f := range e.failures {
+		msgs[i] = fmt.Sprintf("$%s: %s", PrettyCtyPath(f.path), f.message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// checkFailures runs check on v and returns its failures.
+func checkFailures(check Check, v cty.Value) []checkFailure {
+	err := check(v)
+	if err == nil {
+		return nil
+	}
+	var each *eachError
+	if errors.As(err, &each) {
+		return each.failures
+	}
+	return []checkFailure{{path: cty.Path{}, value: v, message: err.Error()}}
+}
+
+// Eq checks that a value equals want, comparing numbers by value and
+// ignoring marks.
+func Eq(want cty.Value) Check {
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		if !valuesEqual(v, want) {
+			return fmt.Errorf("%s is not %s", DebugString(v), DebugString(want))
+		}
+		return nil
+	}
+}
+
+// Gte checks that a value is a number greater than or equal to min.
+func Gte(min float64) Check {
+	return compareNumber(">=", min, func(cmp int) bool { return cmp >= 0 })
+}
+
+// Lte checks that a value is a number less than or equal to max.
+func Lte(max float64) Check {
+	return compareNumber("<=", max, func(cmp int) bool { return cmp <= 0 })
+}
+
+func compareNumber(op string, bound float64, ok func(int) bool) Check {
+	b := big.NewFloat(bound)
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		if v.IsNull() || !v.IsKnown() || v.Type() != cty.Number {
+			return fmt.Errorf("must be a number %s %v", op, bound)
+		}
+		if n := v.AsBigFloat(); !ok(n.Cmp(b)) {
+			return fmt.Errorf("%s is not %s %v", n.Text('g', -1), op, bound)
+		}
+		return nil
+	}
+}
+
+// MatchesRegex is Matches with a pattern compiled on the spot. An invalid
+// pattern fails every value.
+func MatchesRegex(pattern string) Check {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return func(cty.Value) error {
+			return fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return Matches(re)
+}
+
+// LenBetween checks that a string has between min and max characters, or
+// an array or object between min and max elements, inclusive.
+func LenBetween(min, max int) Check {
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		ty := v.Type()
+		var n int
+		switch {
+		case v.IsNull() || !v.IsKnown():
+			return fmt.Errorf("must have a length between %d and %d", min, max)
+		case ty == cty.String:
+			n = utf8.RuneCountInString(v.AsString())
+		case v.CanIterateElements():
+			n = v.LengthInt()
+		default:
+			return fmt.Errorf("%s has no length", ty.FriendlyName())
+		}
+		if n < min || n > max {
+			return fmt.Errorf("length %d is not between %d and %d", n, min, max)
+		}
+		return nil
+	}
+}
+
+// Each checks every element of an array, or member value of an object,
+// with check. Assert reports the failing elements at their own paths.
+func Each(check Check) Check {
+	return func(v cty.Value) error {
+		unmarked, _ := v.Unmark()
+		if unmarked.IsNull() || !unmarked.IsKnown() || !unmarked.CanIterateElements() {
+			return fmt.Errorf("%s is not an array or object", unmarked.Type().FriendlyName())
+		}
+		ty := unmarked.Type()
+		failures := []checkFailure{}
+		i := 0
+		for it := unmarked.ElementIterator(); it.Next(); i++ {
+			key, elem := it.Element()
+			var step cty.PathStep
+			switch {
+			case ty.IsObjectType():
+				step = cty.GetAttrStep{Name: key.AsString()}
+			case ty.IsSetType():
+				// set elements are their own keys
+				step = cty.IndexStep{Key: elem}
+			case isSequence(ty):
+				step = cty.IndexStep{Key: cty.NumberIntVal(int64(i))}
+			default:
+				step = cty.IndexStep{Key: key}
+			}
+			for _, f := range checkFailures(check, elem) {
+				f.path = append(cty.Path{step}, f.path...)
+				failures = append(failures, f)
+			}
+		}
+		if len(failures) > 0 {
+			return &eachError{failures: failures}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package jsonpath
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// BudgetError is returned when the results of an evaluation grow beyond
+// EvalOptions.MaxResultBytes.
+type BudgetError struct {
+	Limit int
+	// Estimated is the size reached when the evaluation was aborted. It's a
+	// lower bound, since estimation stops as soon as the limit is crossed.
+	Estimated int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("result size estimate %d exceeds the budget of %d bytes", e.Estimated, e.Limit)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// checkBudget fails when the estimated size of vals exceeds the budget.
+func (j *JSONPath) checkBudget(vals []cty.Value, used int) (int, error) {
+	limit := j.opts.MaxResultBytes
+	for _, v := range vals {
+		used += estimateSize(v, limit-used)
+		if used > limit {
+			return used, &BudgetError{Limit: limit, Estimated: used}
+		}
+	}
+	return used, nil
+}
+
+// estimateSize approximates the memory held by v: the bytes of its strings
+// and object keys plus one unit per value. It stops early once the estimate
+// exceeds limit.
+func estimateSize(v cty.Value, limit int) int {
+	v, _ = v.Unmark()
+	size := 1
+	if v.IsNull() || !v.IsKnown() {
+		return size
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return size + len(v.AsString())
+	case ty == cty.Number:
+		return size + 8
+	case ty.IsPrimitiveType() || ty.IsCapsuleType():
+		return size
+	}
+
+	it := v.ElementIterator()
+	for it.Next() && size <= limit {
+		key, elem := it.Element()
+		if key.Type() == cty.String {
+			size += len(key.AsString())
+		}
+		size += estimateSize(elem, limit-size)
+	}
+	return size
+}
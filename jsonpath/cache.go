@@ -0,0 +1,186 @@
+package jsonpath
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultCacheSize is the number of results a ResultCache keeps when
+// NewResultCache is given no size.
+const DefaultCacheSize = 256
+
+// ResultCache memoizes Eval results per (document, expression) pair, keeping
+// the most recently used ones up to its size.
+//
+// Documents are identified by their content hash, so two structurally equal
+// documents share cache entries. This is useful when the same snapshot is
+// queried repeatedly (e.g. a UI re-rendering from an unchanged value).
+// Hashing walks the whole document, so a lookup costs about as much as
+// evaluating a simple expression; it pays off for recursive descents and
+// filters. A Document hashes each snapshot once instead of on every Eval.
+// A ResultCache is safe for concurrent use.
+type ResultCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[int][]*list.Element
+	// *cacheEntry, most recently used first
+	lru *list.List
+}
+
+type cacheEntry struct {
+	key   int
+	doc   cty.Value
+	expr  string
+	vals  []cty.Value
+	paths []cty.Path
+	// the Document snapshot the entry was computed for, if any
+	snapshot *snapshotID
+}
+
+// snapshotID identifies a snapshot of a Document, which is known to hold
+// the same value without comparing it.
+type snapshotID struct {
+	doc *Document
+	gen int
+}
+
+// NewResultCache creates an empty ResultCache keeping up to size results,
+// or DefaultCacheSize if size <= 0.
+func NewResultCache(size int) *ResultCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &ResultCache{
+		size:    size,
+		entries: map[int][]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Eval is like (*JSONPath).Eval, but returns a cached result when the same
+// expression was already evaluated against an equal document.
+func (c *ResultCache) Eval(jsonPath string, doc cty.Value) ([]cty.Value, []cty.Path, error) {
+	return c.eval(jsonPath, doc, docHash(doc), nil)
+}
+
+// eval is Eval for a document hashing to key, and when snapshot is set,
+// known to be that Document snapshot.
+func (c *ResultCache) eval(jsonPath string, doc cty.Value, key int, snapshot *snapshotID) ([]cty.Value, []cty.Path, error) {
+	c.mu.Lock()
+	if entry := c.lookup(jsonPath, doc, key, snapshot); entry != nil {
+		defer c.mu.Unlock()
+		return copyResult(entry.vals, entry.paths)
+	}
+	c.mu.Unlock()
+
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals, paths, err := p.Eval(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(jsonPath, doc, key, snapshot) == nil {
+		// not added by a concurrent Eval in the meantime
+		c.entries[key] = append(c.entries[key], c.lru.PushFront(&cacheEntry{key, doc, jsonPath, vals, paths, snapshot}))
+		for c.lru.Len() > c.size {
+			c.remove(c.lru.Back())
+		}
+	}
+	return copyResult(vals, paths)
+}
+
+// lookup returns the entry for jsonPath and doc, marking it as the most
+// recently used. Must be called with c.mu held.
+func (c *ResultCache) lookup(jsonPath string, doc cty.Value, key int, snapshot *snapshotID) *cacheEntry {
+	for _, elem := range c.entries[key] {
+		entry := elem.Value.(*cacheEntry)
+		if entry.expr != jsonPath {
+			continue
+		}
+		if sameSnapshot(entry.snapshot, snapshot) || entry.doc.RawEquals(doc) {
+			c.lru.MoveToFront(elem)
+			return entry
+		}
+	}
+	return nil
+}
+
+func sameSnapshot(a, b *snapshotID) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+// remove drops elem from the cache. Must be called with c.mu held.
+func (c *ResultCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	bucket := c.entries[entry.key]
+	for i, e := range bucket {
+		if e == elem {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(c.entries, entry.key)
+	} else {
+		c.entries[entry.key] = bucket
+	}
+}
+
+// Invalidate drops every cached result computed for doc.
+func (c *ResultCache) Invalidate(doc cty.Value) {
+	c.invalidate(doc, docHash(doc))
+}
+
+func (c *ResultCache) invalidate(doc cty.Value, key int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range append([]*list.Element(nil), c.entries[key]...) {
+		if elem.Value.(*cacheEntry).doc.RawEquals(doc) {
+			c.remove(elem)
+		}
+	}
+}
+
+// Clear drops all cached results.
+func (c *ResultCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[int][]*list.Element{}
+	c.lru.Init()
+}
+
+// Len returns the number of cached (document, expression) results.
+func (c *ResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func docHash(doc cty.Value) int {
+	unmarked, _ := doc.UnmarkDeep()
+	if !unmarked.IsWhollyKnown() {
+		// cty can't hash unknowns; such documents all share one bucket
+		// and are told apart by RawEquals.
+		return 0
+	}
+	return unmarked.Hash()
+}
+
+// copyResult keeps callers from mutating slices held by the cache.
+func copyResult(vals []cty.Value, paths []cty.Path) ([]cty.Value, []cty.Path, error) {
+	outVals := make([]cty.Value, len(vals))
+	copy(outVals, vals)
+	outPaths := make([]cty.Path, len(paths))
+	for i, path := range paths {
+		outPaths[i] = path.Copy()
+	}
+	return outVals, outPaths, nil
+}
@@ -0,0 +1,134 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EvalChunked evaluates the expression and hands the matches to emit in
+// batches instead of returning them all at once.
+//
+// With opts.ChunkSize > 0 every step works on at most ChunkSize values at a
+// time: a wildcard over a large array feeds the remaining steps one window of
+// elements after another, and the window is released before the next one is
+// built. This keeps peak memory bounded by the chunk size rather than by the
+// size of the array. Batches passed to emit hold at most ChunkSize matches
+// (the whole result when ChunkSize is 0). If emit returns an error, the
+// evaluation stops and the error is returned.
+//
+// Results come in the same order as Eval: unions are element-major either
+// way, so splitting their input into chunks doesn't reorder them.
+func (j *JSONPath) EvalChunked(data cty.Value, opts EvalOptions, emit func(vals []cty.Value, paths []cty.Path) error) error {
+	defer j.begin(opts)()
+
+	data, err := j.markPaths(data)
+	if err != nil {
+		return err
+	}
+	if err := j.evalChunked(data, emit); err != nil {
+		return err
+	}
+	return j.partialError()
+}
+
+func (j *JSONPath) evalChunked(data cty.Value, emit func(vals []cty.Value, paths []cty.Path) error) error {
+	j.root = data
+	unmarkedData, _ := data.UnmarkDeep()
+	return j.evalSteps([]cty.Value{data}, j.steps(), func(result []cty.Value) error {
+		for start := 0; start < len(result); start += j.chunkSize(len(result)) {
+			end := start + j.chunkSize(len(result))
+			if end > len(result) {
+				end = len(result)
+			}
+			vals, paths, derivedAt := resultPaths(result[start:end], unmarkedData)
+			if err := j.checkWritable(paths, derivedAt); err != nil {
+				return err
+			}
+			if err := emit(vals, paths); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (j *JSONPath) chunkSize(n int) int {
+	if j.opts.ChunkSize <= 0 || n < j.opts.ChunkSize {
+		if n == 0 {
+			return 1
+		}
+		return n
+	}
+	return j.opts.ChunkSize
+}
+
+// evalSteps runs steps over input depth-first, splitting every intermediate
+// result into chunks before passing it on.
+func (j *JSONPath) evalSteps(input []cty.Value, steps []Node, emit func([]cty.Value) error) error {
+	if len(steps) == 0 {
+		if len(input) == 0 {
+			return nil
+		}
+		return emit(input)
+	}
+	if wildcard, ok := steps[0].(*WildcardNode); ok && j.opts.ChunkSize > 0 {
+		return j.streamWildcard(input, wildcard, steps[1:], emit)
+	}
+
+	next, err := j.walk(input, steps[0])
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(next); start += j.chunkSize(len(next)) {
+		end := start + j.chunkSize(len(next))
+		if end > len(next) {
+			end = len(next)
+		}
+		if err := j.evalSteps(next[start:end], steps[1:], emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamWildcard is evalWildcard without materializing all children: they are
+// buffered up to the chunk size and flushed through the remaining steps.
+//
+// Its metrics only count values, since the time spent in the wildcard is
+// interleaved with the steps that follow.
+func (j *JSONPath) streamWildcard(input []cty.Value, node *WildcardNode, rest []Node, emit func([]cty.Value) error) error {
+	buf := make([]cty.Value, 0, j.opts.ChunkSize)
+	if j.opts.Metrics != nil {
+		defer func() { j.opts.Metrics.record(node, len(input), 0, 0) }()
+	}
+	flush := func() error {
+		if j.opts.Metrics != nil {
+			j.opts.Metrics.record(node, 0, len(buf), 0)
+		}
+		return j.evalSteps(buf, rest, emit)
+	}
+	for _, value := range input {
+		unmarked, _ := value.Unmark()
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			continue
+		}
+		// skipped like in evalWildcard
+		if unmarked.IsNull() || !unmarked.CanIterateElements() || unmarked.Type().IsSetType() {
+			continue
+		}
+		it := unmarked.ElementIterator()
+		for it.Next() {
+			buf = append(buf, getByIter(unmarked, it))
+			if len(buf) == j.opts.ChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+				buf = make([]cty.Value, 0, j.opts.ChunkSize)
+			}
+		}
+	}
+	if len(buf) > 0 {
+		return flush()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package jsonpath
+
+import "github.com/zclconf/go-cty/cty"
+
+// CloneByPath returns the subtrees of doc that jsonPath matches as values
+// independent of doc and of each other: the paths, including those the
+// marks of the values are recorded at, are fresh copies, and no mark of
+// the evaluation remains. The document's own marks, such as sensitivity,
+// are kept unless WithoutMarks is given. Other options are those of
+// NewPath.
+func CloneByPath(doc cty.Value, jsonPath string, opts ...Option) (MatchList, error) {
+	s := newSettings(opts)
+	p, err := NewPath(jsonPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	vals, paths, err := p.Eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	out := make(MatchList, len(vals))
+	for i, v := range vals {
+		out[i] = Match{Value: cloneValue(v, s.stripMarks), Path: paths[i].Copy()}
+	}
+	return out, nil
+}
+
+// cloneValue returns v without the path marks of Eval, or without any mark
+// with strip, sharing no path with it.
+func cloneValue(v cty.Value, strip bool) cty.Value {
+	if strip {
+		unmarked, _ := v.UnmarkDeep()
+		return unmarked
+	}
+	return stripPathRefs(v)
+}
@@ -0,0 +1,85 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func init() {
+	functions["b64decode"] = stringFunc("b64decode", b64decode)
+	functions["b64encode"] = stringFunc("b64encode", b64encode)
+	functions["hex"] = stringFunc("hex", hexEncode)
+	functions["urlquery"] = stringFunc("urlquery", urlQuery)
+}
+
+func b64decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", newError(ErrTypeMismatch, "invalid base64: %s", err)
+	}
+	if !utf8.Valid(b) {
+		return "", newError(ErrTypeMismatch, "decoded base64 is not UTF-8 text")
+	}
+	return string(b), nil
+}
+
+func b64encode(s string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func hexEncode(s string) (string, error) {
+	return hex.EncodeToString([]byte(s)), nil
+}
+
+func urlQuery(s string) (string, error) {
+	return url.QueryEscape(s), nil
+}
+
+// stringFunc adapts a string conversion to a filter function.
+func stringFunc(name string, conv func(string) (string, error)) filterFunc {
+	return filterFunc{params: 1, impl: func(args []cty.Value) (cty.Value, error) {
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return cty.NilVal, err
+		}
+		out, err := conv(s)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return cty.StringVal(out), nil
+	}}
+}
+
+// stringReplacer adapts a string conversion to a ReplaceFunc callback.
+func stringReplacer(name string, conv func(string) (string, error)) func(cty.Value, cty.Path) (cty.Value, error) {
+	return func(old cty.Value, path cty.Path) (cty.Value, error) {
+		unmarked, marks := old.Unmark()
+		s, err := stringArg(name, unmarked)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		out, err := conv(s)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return cty.StringVal(out).WithMarks(marks), nil
+	}
+}
+
+// Conversions for ReplaceFunc, e.g.
+//
+//	doc, err = jsonpath.ReplaceFunc(doc, "$.data.*", jsonpath.Base64Decode)
+//
+// They match the b64decode, b64encode, hex and urlquery filter functions.
+var (
+	Base64Decode = stringReplacer("b64decode", b64decode)
+	Base64Encode = stringReplacer("b64encode", b64encode)
+	HexEncode    = stringReplacer("hex", hexEncode)
+	URLQuery     = stringReplacer("urlquery", urlQuery)
+)
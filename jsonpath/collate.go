@@ -0,0 +1,187 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation controls how strings are ordered by SortBy and SortedKeys. The
+// zero value compares bytes.
+type Collation struct {
+	// IgnoreCase orders "b" and "B" together.
+	IgnoreCase bool
+	// Natural compares runs of digits by their numeric value, so that
+	// "item2" sorts before "item10".
+	Natural bool
+	// Locale, a BCP 47 tag such as "de" or "sv", applies the collation
+	// rules of that language.
+	Locale string
+}
+
+// comparer returns a string comparison function implementing c. The
+// function isn't safe for concurrent use.
+func (c Collation) comparer() func(a, b string) int {
+	if c.Locale != "" {
+		opts := []collate.Option{}
+		if c.IgnoreCase {
+			opts = append(opts, collate.IgnoreCase)
+		}
+		if c.Natural {
+			opts = append(opts, collate.Numeric)
+		}
+		return collate.New(language.Make(c.Locale), opts...).CompareString
+	}
+	return func(a, b string) int {
+		if c.IgnoreCase {
+			a, b = strings.ToLower(a), strings.ToLower(b)
+		}
+		if c.Natural {
+			return compareNatural(a, b)
+		}
+		return strings.Compare(a, b)
+	}
+}
+
+// compareNatural compares strings chunk by chunk, ordering digit runs by
+// their numeric value.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ca, restA := nextChunk(a)
+		cb, restB := nextChunk(b)
+		if isDigits(ca) && isDigits(cb) {
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+	return strings.Compare(a, b)
+}
+
+// nextChunk splits off the leading run of digits or of non-digits.
+func nextChunk(s string) (chunk, rest string) {
+	digits := isDigit(rune(s[0]))
+	for i, r := range s {
+		if isDigit(r) != digits {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+func isDigit(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsDigit(r)
+}
+
+func isDigits(s string) bool {
+	return s != "" && isDigit(rune(s[0]))
+}
+
+// SortBy sorts every array matched by jsonPath in ascending order of key,
+// an attribute of the elements, or of the elements themselves when key is
+// empty. Numbers sort numerically and strings according to c. The sort is
+// stable, and sets can't be sorted.
+func SortBy(doc cty.Value, jsonPath, key string, c Collation) (cty.Value, error) {
+	compare := c.comparer()
+	return ReplaceFunc(doc, jsonPath, func(old cty.Value, path cty.Path) (cty.Value, error) {
+		unmarked, marks := old.Unmark()
+		ty := unmarked.Type()
+		if unmarked.IsNull() || !unmarked.IsKnown() || !(ty.IsListType() || ty.IsTupleType()) {
+			return cty.NilVal, newError(ErrTypeMismatch, "can't sort %s", ty.FriendlyName())
+		}
+		elems := unmarked.AsValueSlice()
+		keys := make([]cty.Value, len(elems))
+		for i, elem := range elems {
+			k, err := sortKey(elem, key)
+			if err != nil {
+				return cty.NilVal, newError(ErrNotFound, "element %d: %s", i, err)
+			}
+			keys[i] = k
+		}
+		order := make([]int, len(elems))
+		for i := range order {
+			order[i] = i
+		}
+		var sortErr error
+		sort.SliceStable(order, func(x, y int) bool {
+			cmp, err := collateValues(keys[order[x]], keys[order[y]], compare)
+			if err != nil && sortErr == nil {
+				sortErr = err
+			}
+			return cmp < 0
+		})
+		if sortErr != nil {
+			return cty.NilVal, sortErr
+		}
+		sorted := make([]cty.Value, len(elems))
+		for i, j := range order {
+			sorted[i] = elems[j]
+		}
+		if len(sorted) == 0 {
+			return old, nil
+		}
+		if ty.IsListType() {
+			return cty.ListVal(sorted).WithMarks(marks), nil
+		}
+		return cty.TupleVal(sorted).WithMarks(marks), nil
+	})
+}
+
+func sortKey(elem cty.Value, key string) (cty.Value, error) {
+	elem, _ = elem.UnmarkDeep()
+	if key == "" {
+		return elem, nil
+	}
+	if elem.IsNull() || !elem.IsKnown() {
+		return cty.NilVal, newError(ErrNotFound, "no attribute %s", key)
+	}
+	switch ty := elem.Type(); {
+	case ty.IsObjectType() && ty.HasAttribute(key):
+		return elem.GetAttr(key), nil
+	case ty.IsMapType() && elem.HasIndex(cty.StringVal(key)).True():
+		return elem.Index(cty.StringVal(key)), nil
+	}
+	return cty.NilVal, newError(ErrNotFound, "no attribute %s", key)
+}
+
+// collateValues is like orderValues but compares strings with compare.
+func collateValues(left, right cty.Value, compare func(a, b string) int) (int, error) {
+	if !left.IsNull() && !right.IsNull() && left.IsKnown() && right.IsKnown() &&
+		left.Type() == cty.String && right.Type() == cty.String {
+		return compare(left.AsString(), right.AsString()), nil
+	}
+	return orderValues(left, right)
+}
+
+// SortedKeys returns the attribute names of an object or the keys of a map
+// ordered according to c, for output where key order matters.
+func SortedKeys(v cty.Value, c Collation) []string {
+	v, _ = v.UnmarkDeep()
+	if v.IsNull() || !v.IsKnown() || !(v.Type().IsObjectType() || v.Type().IsMapType()) {
+		return nil
+	}
+	keys := []string{}
+	for it := v.ElementIterator(); it.Next(); {
+		k, _ := it.Element()
+		keys = append(keys, k.AsString())
+	}
+	compare := c.comparer()
+	sort.SliceStable(keys, func(i, j int) bool { return compare(keys[i], keys[j]) < 0 })
+	return keys
+}
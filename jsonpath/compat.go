@@ -0,0 +1,86 @@
+package jsonpath
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Divergence is an expression that evaluates differently against a document
+// in two dialects.
+type Divergence struct {
+	Expr string
+	// Doc is the index of the document in the list passed to CheckCompat.
+	Doc int
+
+	OldVals, NewVals   []cty.Value
+	OldPaths, NewPaths []cty.Path
+	// OldErr and NewErr hold compile or evaluation errors.
+	OldErr, NewErr error
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s on document %d: %s vs %s", d.Expr, d.Doc,
+		describeOutcome(d.OldPaths, d.OldErr), describeOutcome(d.NewPaths, d.NewErr))
+}
+
+func describeOutcome(paths []cty.Path, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	out := "["
+	for i, path := range paths {
+		if i > 0 {
+			out += ", "
+		}
+		out += FormatPath(path)
+	}
+	return out + "]"
+}
+
+// CheckCompat evaluates every expression against every document in both
+// dialects and reports the combinations whose results differ, either in the
+// matched values and paths or in whether an error occurred.
+func CheckCompat(exprs []string, docs []cty.Value, oldDialect, newDialect Dialect) []Divergence {
+	divergences := []Divergence{}
+	for _, expr := range exprs {
+		oldPath, oldCompileErr := CompileDialect(expr, oldDialect)
+		newPath, newCompileErr := CompileDialect(expr, newDialect)
+		for i, doc := range docs {
+			d := Divergence{Expr: expr, Doc: i, OldErr: oldCompileErr, NewErr: newCompileErr}
+			if oldCompileErr == nil {
+				d.OldVals, d.OldPaths, d.OldErr = oldPath.Eval(doc)
+			}
+			if newCompileErr == nil {
+				d.NewVals, d.NewPaths, d.NewErr = newPath.Eval(doc)
+			}
+			if !sameOutcome(d) {
+				divergences = append(divergences, d)
+			}
+		}
+	}
+	return divergences
+}
+
+func sameOutcome(d Divergence) bool {
+	if (d.OldErr == nil) != (d.NewErr == nil) {
+		return false
+	}
+	if d.OldErr != nil {
+		return true
+	}
+	if len(d.OldPaths) != len(d.NewPaths) || len(d.OldVals) != len(d.NewVals) {
+		return false
+	}
+	for i := range d.OldPaths {
+		if len(d.OldPaths[i]) != len(d.NewPaths[i]) || !pathsOverlap(d.OldPaths[i], d.NewPaths[i]) {
+			return false
+		}
+	}
+	for i := range d.OldVals {
+		if !d.OldVals[i].RawEquals(d.NewVals[i]) {
+			return false
+		}
+	}
+	return true
+}
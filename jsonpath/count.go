@@ -0,0 +1,61 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Count returns the number of matches of jsonPath in doc, for metrics and
+// assertions such as "exactly one default route" where only the
+// cardinality matters. opts are those of NewPath.
+func Count(doc cty.Value, jsonPath string, opts ...Option) (int, error) {
+	p, err := NewPath(jsonPath, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return p.Count(doc)
+}
+
+// Count is like Eval but only returns the number of matches. It skips
+// working out the path of every match and stripping the bookkeeping marks
+// off its value, and looks definite paths (see Set) up directly. Errors
+// are those of Eval. Middleware added with Use isn't run.
+func (j *JSONPath) Count(data cty.Value, opts ...Option) (int, error) {
+	s := settings{eval: j.defaults}
+	s.apply(opts)
+	if path, ok := j.definitePath(); ok && j.doc == nil && !s.eval.ResolveRefs {
+		if _, err := applyPath(data, path); err == nil {
+			return 1, nil
+		}
+		// let the evaluation report the error, or find it with options
+		// such as WithNumericKeys
+	}
+
+	defer j.begin(s.eval)()
+	if j.doc != nil {
+		doc, err := j.lookupDoc(j.doc)
+		if err != nil {
+			return 0, err
+		}
+		data = doc
+	}
+	data, err := j.markPaths(data)
+	if err != nil {
+		return 0, err
+	}
+	res, err := j.fullEvaluate(data)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 1 {
+		return 0, newError(ErrInvariant, "expected one result list, got %d", len(res))
+	}
+	vals := res[0]
+	if s.eval.Distinct != nil {
+		// duplicates are told apart by value, not by where they are
+		for i, v := range vals {
+			vals[i] = stripPathRefs(v)
+		}
+		vals, _ = j.distinct(vals, make([]cty.Path, len(vals)))
+	}
+	return len(vals), j.partialError()
+}
@@ -0,0 +1,297 @@
+package jsonpath
+
+import (
+	"regexp"
+)
+
+// maxAlternatives caps how many filter-free paths the unions of an
+// expression may expand into for Covers and Overlaps.
+const maxAlternatives = 64
+
+// Covers reports whether every value b can match, in any document, lies
+// at or below a value a matches: Covers("$.spec", "$.spec.replicas") and
+// Covers("$..name", "$.items[0].name") hold. It's meant for checking
+// requested paths against allowed ones without a document.
+//
+// The analysis is conservative: false means coverage couldn't be proven.
+// It assumes the default evaluation options and fails with ErrUnsupported
+// for expressions with filters, function calls or $doc.
+func Covers(a, b string) (bool, error) {
+	as, bs, err := comparablePaths(a, b)
+	if err != nil {
+		return false, err
+	}
+	for _, bp := range bs {
+		covered := false
+		for _, ap := range as {
+			if newPatternPair(ap, bp).covers(0, 0) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Overlaps reports whether a value matched by one expression can lie at or
+// below a value matched by the other, in some document: $.spec and
+// $..replicas overlap, $.spec and $.status don't. Like Covers, it's
+// conservative: true means an overlap couldn't be ruled out.
+func Overlaps(a, b string) (bool, error) {
+	as, bs, err := comparablePaths(a, b)
+	if err != nil {
+		return false, err
+	}
+	for _, ap := range as {
+		for _, bp := range bs {
+			if newPatternPair(ap, bp).overlaps(0, 0) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// stepPattern is the set of path steps a step of an expression can take.
+type stepPattern struct {
+	kind   NodeType // NodeField, NodeArray, NodeRegex, NodeWildcard or NodeRecursive
+	key    string
+	re     *regexp.Regexp
+	params [3]ParamsEntry
+}
+
+func comparablePaths(a, b string) ([][]stepPattern, [][]stepPattern, error) {
+	as, err := pathPatterns(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	bs, err := pathPatterns(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return as, bs, nil
+}
+
+// pathPatterns expands the expression into the filter-free step sequences
+// its unions stand for.
+func pathPatterns(expr string) ([][]stepPattern, error) {
+	j, err := NewPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return expandPatterns(j.steps(), expr)
+}
+
+func expandPatterns(steps []Node, expr string) ([][]stepPattern, error) {
+	out := [][]stepPattern{{}}
+	extend := func(alternatives [][]stepPattern) error {
+		if len(out)*len(alternatives) > maxAlternatives {
+			return newError(ErrUnsupported, "%s has too many alternatives to compare", expr)
+		}
+		next := make([][]stepPattern, 0, len(out)*len(alternatives))
+		for _, prefix := range out {
+			for _, alt := range alternatives {
+				path := append(append([]stepPattern{}, prefix...), alt...)
+				next = append(next, path)
+			}
+		}
+		out = next
+		return nil
+	}
+	for _, node := range steps {
+		var err error
+		switch node := node.(type) {
+		case *FieldNode:
+			err = extend([][]stepPattern{{{kind: NodeField, key: node.Value}}})
+		case *ArrayNode:
+			if isWildcardSlice(node.Params) {
+				err = extend([][]stepPattern{{{kind: NodeWildcard}}})
+			} else {
+				err = extend([][]stepPattern{{{kind: NodeArray, params: node.Params}}})
+			}
+		case *RegexNode:
+			err = extend([][]stepPattern{{{kind: NodeRegex, re: node.Regexp}}})
+		case *WildcardNode:
+			err = extend([][]stepPattern{{{kind: NodeWildcard}}})
+		case *RecursiveNode:
+			err = extend([][]stepPattern{{{kind: NodeRecursive}}})
+		case *UnionNode:
+			alternatives := [][]stepPattern{}
+			for _, branch := range node.Nodes {
+				expanded, err := expandPatterns(flattenSteps(branch), expr)
+				if err != nil {
+					return nil, err
+				}
+				alternatives = append(alternatives, expanded...)
+			}
+			err = extend(alternatives)
+		default:
+			return nil, newError(ErrUnsupported, "%s: can't compare paths using %s", expr, formatStep(node))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// patternPair compares two step sequences, memoizing the outcome for each
+// pair of positions.
+type patternPair struct {
+	a, b []stepPattern
+	memo map[[2]int]bool
+}
+
+func newPatternPair(a, b []stepPattern) *patternPair {
+	return &patternPair{a: a, b: b, memo: map[[2]int]bool{}}
+}
+
+func (p *patternPair) cached(i, j int, f func() bool) bool {
+	key := [2]int{i, j}
+	if result, ok := p.memo[key]; ok {
+		return result
+	}
+	result := f()
+	p.memo[key] = result
+	return result
+}
+
+// covers reports whether every path matching b[j:] starts with a path
+// matching a[i:].
+func (p *patternPair) covers(i, j int) bool {
+	return p.cached(i, j, func() bool {
+		if i == len(p.a) {
+			return true
+		}
+		if j == len(p.b) {
+			// only descents, which can take no step, are left in a
+			for _, step := range p.a[i:] {
+				if step.kind != NodeRecursive {
+					return false
+				}
+			}
+			return true
+		}
+		a, b := p.a[i], p.b[j]
+		switch {
+		case a.kind == NodeRecursive:
+			// .. takes no more steps, or the one b takes
+			return p.covers(i+1, j) || p.covers(i, j+1)
+		case b.kind == NodeRecursive:
+			return false
+		}
+		return stepCovers(a, b) && p.covers(i+1, j+1)
+	})
+}
+
+// overlaps reports whether some path matching a[i:] and some path matching
+// b[j:] can be one a prefix of the other.
+func (p *patternPair) overlaps(i, j int) bool {
+	return p.cached(i, j, func() bool {
+		if i == len(p.a) || j == len(p.b) {
+			return true
+		}
+		a, b := p.a[i], p.b[j]
+		switch {
+		case a.kind == NodeRecursive:
+			return p.overlaps(i+1, j) || p.overlaps(i, j+1)
+		case b.kind == NodeRecursive:
+			return p.overlaps(i, j+1) || p.overlaps(i+1, j)
+		}
+		return stepsMeet(a, b) && p.overlaps(i+1, j+1)
+	})
+}
+
+// stepCovers reports whether every step b can take, a can take too.
+func stepCovers(a, b stepPattern) bool {
+	switch a.kind {
+	case NodeWildcard:
+		return true
+	case NodeField:
+		return b.kind == NodeField && b.key == a.key
+	case NodeRegex:
+		return (b.kind == NodeField && a.re.MatchString(b.key)) ||
+			(b.kind == NodeRegex && b.re.String() == a.re.String())
+	case NodeArray:
+		if b.kind != NodeArray {
+			return false
+		}
+		if a.params == b.params {
+			return true
+		}
+		alo, ahi, astep, aok := indexRange(a.params)
+		blo, bhi, bstep, bok := indexRange(b.params)
+		if !aok || !bok {
+			return false
+		}
+		if bhi == blo+1 {
+			return inRange(blo, alo, ahi, astep)
+		}
+		return astep == 1 && alo <= blo && (ahi < 0 || (bhi >= 0 && bhi <= ahi)) && bstep > 0
+	}
+	return false
+}
+
+// stepsMeet reports whether a and b may take the same step.
+func stepsMeet(a, b stepPattern) bool {
+	if a.kind == NodeWildcard || b.kind == NodeWildcard {
+		return true
+	}
+	if a.kind == NodeArray || b.kind == NodeArray {
+		if a.kind != b.kind {
+			// indexes and keys never select the same member
+			return false
+		}
+		alo, ahi, astep, aok := indexRange(a.params)
+		blo, bhi, bstep, bok := indexRange(b.params)
+		switch {
+		case !aok || !bok:
+			return true
+		case ahi == alo+1:
+			return inRange(alo, blo, bhi, bstep)
+		case bhi == blo+1:
+			return inRange(blo, alo, ahi, astep)
+		case astep == 1 && bstep == 1:
+			return (ahi < 0 || blo < ahi) && (bhi < 0 || alo < bhi)
+		}
+		return true
+	}
+	switch {
+	case a.kind == NodeField && b.kind == NodeField:
+		return a.key == b.key
+	case a.kind == NodeField:
+		return b.re.MatchString(a.key)
+	case b.kind == NodeField:
+		return a.re.MatchString(b.key)
+	}
+	// two regexes: whether they share a key is beyond this analysis
+	return true
+}
+
+// indexRange returns the indexes selected by array params as a range from
+// lo to hi (-1 for the end of the array) by step, when that doesn't depend
+// on the array's length.
+func indexRange(params [3]ParamsEntry) (lo, hi, step int, ok bool) {
+	start, end, stride := params[0], params[1], params[2]
+	lo, hi, step = 0, -1, 1
+	if start.Known {
+		lo = start.Value
+	}
+	if end.Known {
+		hi = end.Value
+	}
+	if stride.Known {
+		step = stride.Value
+	}
+	if lo < 0 || (end.Known && hi < 0) || step <= 0 {
+		return 0, 0, 0, false
+	}
+	return lo, hi, step, true
+}
+
+func inRange(i, lo, hi, step int) bool {
+	return i >= lo && (hi < 0 || i < hi) && (i-lo)%step == 0
+}
@@ -0,0 +1,61 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// JSONPathFunc returns a cty function jsonpath(value, expr) that evaluates
+// expr against value and returns a tuple of the matches, so that tools
+// built on go-cty's function system (e.g. HCL) can query documents.
+func JSONPathFunc() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "value", Type: cty.DynamicPseudoType, AllowDynamicType: true},
+			{Name: "expr", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			p, err := NewPath(args[1].AsString())
+			if err != nil {
+				return cty.NilVal, function.NewArgError(1, err)
+			}
+			vals, _, err := p.Eval(args[0])
+			if err != nil {
+				return cty.NilVal, err
+			}
+			if len(vals) == 0 {
+				return cty.EmptyTupleVal, nil
+			}
+			return cty.TupleVal(vals), nil
+		},
+	})
+}
+
+// JSONPathSetFunc returns a cty function jsonpath_set(value, expr, new)
+// returning a copy of value with new written at expr, like Set.
+func JSONPathSetFunc() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "value", Type: cty.DynamicPseudoType, AllowDynamicType: true},
+			{Name: "expr", Type: cty.String},
+			{Name: "new", Type: cty.DynamicPseudoType, AllowDynamicType: true, AllowNull: true},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if _, err := NewPath(args[1].AsString()); err != nil {
+				return cty.NilVal, function.NewArgError(1, err)
+			}
+			return Set(args[0], args[1].AsString(), args[2])
+		},
+	})
+}
+
+// Functions returns the cty functions of this package by their conventional
+// names, ready to be merged into an HCL evaluation context.
+func Functions() map[string]function.Function {
+	return map[string]function.Function{
+		"jsonpath":     JSONPathFunc(),
+		"jsonpath_set": JSONPathSetFunc(),
+	}
+}
@@ -0,0 +1,125 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Limits of DebugString.
+const (
+	debugMaxString   = 64
+	debugMaxElements = 20
+)
+
+// DebugString renders v for logs and test failures: in a JSON-like syntax,
+// with object keys sorted so equal values always print the same, strings
+// longer than 64 bytes and containers longer than 20 elements truncated,
+// and marks other than the package's own listed after the value they're on.
+// The result types of the package print their values with it.
+func DebugString(v cty.Value) string {
+	var b strings.Builder
+	writeDebug(&b, v)
+	return b.String()
+}
+
+func writeDebug(b *strings.Builder, v cty.Value) {
+	if v == cty.NilVal {
+		b.WriteString("(nil)")
+		return
+	}
+	v, marks := v.Unmark()
+	defer writeMarks(b, marks)
+	switch {
+	case !v.IsKnown():
+		b.WriteString("(unknown)")
+		return
+	case v.IsNull():
+		b.WriteString("null")
+		return
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		s := v.AsString()
+		if len(s) > debugMaxString {
+			b.WriteString(strconv.Quote(truncateString(s, debugMaxString)))
+			fmt.Fprintf(b, "…(%d bytes)", len(s))
+			return
+		}
+		b.WriteString(strconv.Quote(s))
+	case ty == cty.Number:
+		b.WriteString(v.AsBigFloat().Text('g', -1))
+	case ty == cty.Bool:
+		b.WriteString(strconv.FormatBool(v.True()))
+	case ty.IsObjectType() || ty.IsMapType():
+		keys := []string{}
+		for it := v.ElementIterator(); it.Next(); {
+			k, _ := it.Element()
+			keys = append(keys, k.AsString())
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i == debugMaxElements {
+				fmt.Fprintf(b, ", …%d more", len(keys)-i)
+				break
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.Quote(k) + ": ")
+			if ty.IsObjectType() {
+				writeDebug(b, v.GetAttr(k))
+			} else {
+				writeDebug(b, v.Index(cty.StringVal(k)))
+			}
+		}
+		b.WriteByte('}')
+	case v.CanIterateElements():
+		b.WriteByte('[')
+		i := 0
+		for it := v.ElementIterator(); it.Next(); i++ {
+			if i == debugMaxElements {
+				fmt.Fprintf(b, ", …%d more", v.LengthInt()-i)
+				break
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			_, elem := it.Element()
+			writeDebug(b, elem)
+		}
+		b.WriteByte(']')
+	default:
+		b.WriteString(v.GoString())
+	}
+}
+
+// writeMarks lists the marks of a value, leaving out the path marks of
+// Eval.
+func writeMarks(b *strings.Builder, marks cty.ValueMarks) {
+	names := []string{}
+	for mark := range marks {
+		if _, isPath := mark.(markPathRef); !isPath {
+			names = append(names, fmt.Sprint(mark))
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	b.WriteString(" (marked " + strings.Join(names, ", ") + ")")
+}
+
+// truncateString cuts s to at most n bytes without splitting a character.
+func truncateString(s string, n int) string {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,33 @@
+package jsonpath
+
+import (
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// decimalDigits is the precision of EvalOptions.DecimalNumbers, that of
+// IEEE 754 decimal64.
+const decimalDigits = 16
+
+// number returns v as filters compare it: under EvalOptions.DecimalNumbers,
+// numbers are rounded to decimalDigits significant decimal digits.
+func (j *JSONPath) number(v cty.Value) cty.Value {
+	if !j.opts.DecimalNumbers {
+		return v
+	}
+	unmarked, marks := v.Unmark()
+	if unmarked.IsNull() || !unmarked.IsKnown() || !unmarked.Type().Equals(cty.Number) {
+		return v
+	}
+	f := unmarked.AsBigFloat()
+	if f.IsInf() {
+		return v
+	}
+	// numbers with the same decimal digits parse to the same float
+	rounded, _, err := big.ParseFloat(f.Text('g', decimalDigits), 10, 512, big.ToNearestEven)
+	if err != nil {
+		return v
+	}
+	return cty.NumberVal(rounded).WithMarks(marks)
+}
@@ -0,0 +1,177 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DuplicateKeysError lists the object keys that occur more than once in a
+// JSON document.
+type DuplicateKeysError struct {
+	Paths []cty.Path
+}
+
+func (e *DuplicateKeysError) Error() string {
+	paths := make([]string, len(e.Paths))
+	for i, path := range e.Paths {
+		paths[i] = FormatPath(path)
+	}
+	return "duplicate keys: " + strings.Join(paths, ", ")
+}
+
+// DecodeJSONStrict decodes a JSON document into the same cty value as
+// ctyjson.SimpleJSONValue would (objects and tuples), but detects object
+// keys that occur more than once, which encoding/json silently resolves by
+// keeping the last one. The decoded value, with the last occurrence of
+// each duplicate, is returned along with a *DuplicateKeysError.
+//
+// The only option it takes is WithInternedKeys.
+func DecodeJSONStrict(data []byte, opts ...Option) (cty.Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	d := newStrictDecoder(dec, newSettings(opts))
+	v, err := d.value(cty.Path{})
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return cty.NilVal, newError(ErrSyntax, "unexpected data after the JSON value")
+	}
+	if len(d.duplicates) > 0 {
+		return v, &DuplicateKeysError{Paths: d.duplicates}
+	}
+	return v, nil
+}
+
+type strictDecoder struct {
+	dec        *json.Decoder
+	duplicates []cty.Path
+
+	// pending comments, in input order, not yet attached to a path
+	pending  []jsoncComment
+	comments []Comment
+	// last is the path of the last value decoded, which gets the comments
+	// written after it on the same line
+	last cty.Path
+
+	// keys interns object keys, see WithInternedKeys
+	keys map[string]string
+}
+
+func newStrictDecoder(dec *json.Decoder, s settings) *strictDecoder {
+	d := &strictDecoder{dec: dec}
+	if s.internKeys {
+		d.keys = map[string]string{}
+	}
+	return d
+}
+
+// intern returns the shared copy of key when interning.
+func (d *strictDecoder) intern(key string) string {
+	if d.keys == nil {
+		return key
+	}
+	if shared, ok := d.keys[key]; ok {
+		return shared
+	}
+	d.keys[key] = key
+	return key
+}
+
+// attach assigns the pending comments written before offset to path.
+func (d *strictDecoder) attach(path cty.Path, offset int64) {
+	for len(d.pending) > 0 && d.pending[0].offset < offset {
+		target := path
+		if d.pending[0].trailing && d.last != nil {
+			target = d.last
+		}
+		d.comments = append(d.comments, Comment{Path: target.Copy(), Text: d.pending[0].text})
+		d.pending = d.pending[1:]
+	}
+}
+
+// done records that the value at path has been decoded.
+func (d *strictDecoder) done(path cty.Path, v cty.Value) (cty.Value, error) {
+	d.last = path.Copy()
+	return v, nil
+}
+
+func (d *strictDecoder) value(path cty.Path) (cty.Value, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return cty.NilVal, newPathError(path, ErrSyntax, "%s", err)
+	}
+	d.attach(path, d.dec.InputOffset())
+	switch tok := tok.(type) {
+	case nil:
+		return d.done(path, cty.NullVal(cty.DynamicPseudoType))
+	case bool:
+		return d.done(path, cty.BoolVal(tok))
+	case string:
+		return d.done(path, cty.StringVal(tok))
+	case json.Number:
+		n, err := cty.ParseNumberVal(tok.String())
+		if err != nil {
+			return cty.NilVal, newPathError(path, ErrSyntax, "%s", err)
+		}
+		return d.done(path, n)
+	case json.Delim:
+		if tok == '[' {
+			return d.array(path)
+		}
+		return d.object(path)
+	}
+	return cty.NilVal, newPathError(path, ErrSyntax, "unexpected token %v", tok)
+}
+
+func (d *strictDecoder) array(path cty.Path) (cty.Value, error) {
+	elems := []cty.Value{}
+	for d.dec.More() {
+		elem, err := d.value(path.IndexInt(len(elems)))
+		if err != nil {
+			return cty.NilVal, err
+		}
+		elems = append(elems, elem)
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return cty.NilVal, newPathError(path, ErrSyntax, "%s", err)
+	}
+	d.attach(path, d.dec.InputOffset())
+	if len(elems) == 0 {
+		return d.done(path, cty.EmptyTupleVal)
+	}
+	if d.keys != nil && !elems[0].Type().Equals(cty.DynamicPseudoType) && sameElementTypes(elems) {
+		return d.done(path, cty.ListVal(elems))
+	}
+	return d.done(path, cty.TupleVal(elems))
+}
+
+func (d *strictDecoder) object(path cty.Path) (cty.Value, error) {
+	attrs := map[string]cty.Value{}
+	reported := map[string]bool{}
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return cty.NilVal, newPathError(path, ErrSyntax, "%s", err)
+		}
+		key := d.intern(tok.(string))
+		keyPath := path.Copy().GetAttr(key)
+		d.attach(keyPath, d.dec.InputOffset())
+		if _, dup := attrs[key]; dup && !reported[key] {
+			reported[key] = true
+			d.duplicates = append(d.duplicates, keyPath)
+		}
+		if attrs[key], err = d.value(keyPath); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return cty.NilVal, newPathError(path, ErrSyntax, "%s", err)
+	}
+	d.attach(path, d.dec.InputOffset())
+	return d.done(path, cty.ObjectVal(attrs))
+}
@@ -0,0 +1,73 @@
+package jsonpath
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ApplyDefaults returns a copy of doc where every path of defaults that is
+// missing or null holds its default value. Present values are never
+// overwritten.
+//
+// Definite paths (see Set) get their missing parents created. When a path
+// ends with a field, e.g. `$.containers[*].imagePullPolicy`, the field is
+// defaulted in every object the rest of the path matches. Other paths only
+// fill in the null values they match. Defaults are applied in the lexical
+// order of their paths.
+func ApplyDefaults(doc cty.Value, defaults map[string]cty.Value) (cty.Value, error) {
+	exprs := make([]string, 0, len(defaults))
+	for expr := range defaults {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	for _, expr := range exprs {
+		p, err := NewPath(expr)
+		if err != nil {
+			return doc, err
+		}
+		paths, err := defaultablePaths(doc, p)
+		if err != nil {
+			return doc, err
+		}
+		for _, path := range paths {
+			if current, err := path.Apply(doc); err == nil && !current.IsNull() {
+				continue
+			}
+			doc, err = createAtPath(doc, path, defaults[expr])
+			if err != nil {
+				return doc, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+// defaultablePaths lists the locations a default for p applies to, whether
+// or not they exist yet.
+func defaultablePaths(doc cty.Value, p *JSONPath) ([]cty.Path, error) {
+	if path, ok := p.definitePath(); ok {
+		return []cty.Path{path}, nil
+	}
+
+	steps := p.steps()
+	if field, ok := steps[len(steps)-1].(*FieldNode); ok {
+		_, parents, err := pathFromSteps(steps[:len(steps)-1]).Eval(doc)
+		if err != nil {
+			return nil, err
+		}
+		paths := []cty.Path{}
+		for _, parent := range parents {
+			value, _ := parent.Apply(doc)
+			value, _ = value.Unmark()
+			if value.IsNull() || !(value.Type().IsObjectType() || value.Type().IsMapType()) {
+				continue
+			}
+			paths = append(paths, parent.Copy().GetAttr(field.Value))
+		}
+		return paths, nil
+	}
+
+	return p.writePaths(doc)
+}
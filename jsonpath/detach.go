@@ -0,0 +1,62 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Detach wraps each matched value in a Document of its own, remembering
+// where it was found, so it can be queried and edited on its own and then
+// written back with WriteBack or ApplyTo. opts are passed to NewDocument.
+// A match computed by a function step, e.g. a substring, is written back
+// over the value it was computed from.
+func (m MatchList) Detach(opts ...Option) []*Document {
+	docs := make([]*Document, len(m))
+	for i, match := range m {
+		docs[i] = NewDocument(match.Value, opts...)
+		docs[i].base = match.Path.Copy()
+	}
+	return docs
+}
+
+// Base returns the path a detached document was found at in the document
+// it was detached from, and an empty path for other documents.
+func (d *Document) Base() cty.Path {
+	return d.base.Copy()
+}
+
+// Absolute translates paths within a detached document, e.g. those
+// returned by its Eval, into paths of the document it was detached from.
+func (d *Document) Absolute(path cty.Path) cty.Path {
+	abs := make(cty.Path, 0, len(d.base)+len(path))
+	abs = append(abs, d.base...)
+	return append(abs, path...)
+}
+
+// ApplyTo returns original with the current value of a detached document
+// stored back where it was found.
+func (d *Document) ApplyTo(original cty.Value) (cty.Value, error) {
+	if len(d.base) == 0 {
+		return d.Value(), nil
+	}
+	return setAtPath(original, d.base, d.Value())
+}
+
+// WriteBack stores the current value of a detached document back where it
+// was found in target, as one write notifying target's subscribers.
+func (d *Document) WriteBack(target *Document) error {
+	value := d.Value()
+	target.mu.Lock()
+	updated := value
+	if len(d.base) > 0 {
+		var err error
+		if updated, err = setAtPath(target.value, d.base, value); err != nil {
+			target.mu.Unlock()
+			return err
+		}
+	}
+	notify := target.replace(updated, []cty.Path{d.Base()})
+	target.mu.Unlock()
+
+	target.publish(notify, updated)
+	return nil
+}
@@ -0,0 +1,94 @@
+package jsonpath
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Dialect selects syntax variants of other JSONPath engines that the parser
+// accepts on top of its own syntax. Variants only affect filters. All
+// dialects accept @.length as well as length(@).
+type Dialect int
+
+const (
+	// DialectDefault is this package's own syntax.
+	DialectDefault Dialect = iota
+	// DialectOjg accepts bare words as strings, e.g. [?(@.category==fiction)].
+	DialectOjg
+	// DialectAjson accepts bare words as strings.
+	DialectAjson
+	// DialectJSONPathPlus accepts the JavaScript === and !== operators.
+	DialectJSONPathPlus
+)
+
+var dialectNames = map[Dialect]string{
+	DialectDefault:      "default",
+	DialectOjg:          "ojg",
+	DialectAjson:        "ajson",
+	DialectJSONPathPlus: "jsonpath-plus",
+}
+
+func (d Dialect) String() string {
+	if name, ok := dialectNames[d]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func (d Dialect) bareWords() bool {
+	return d == DialectOjg || d == DialectAjson
+}
+
+// CompileDialect is like NewPath() but also accepts the syntax variants of
+// dialect.
+func CompileDialect(jsonPath string, dialect Dialect) (*JSONPath, error) {
+	return Compile(jsonPath, CompileOptions{Dialect: dialect})
+}
+
+// parseOptions is like Parse() but honours the dialect, the enabled
+// functions and the regex limit of opts.
+func parseOptions(text string, opts CompileOptions) (*Parser, error) {
+	p := &Parser{dialect: opts.Dialect, enabled: opts.EnableFunctions, maxRegex: opts.MaxRegexLength}
+	if err := p.Parse(text); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// operator maps a filter operator to its native spelling.
+func (d Dialect) operator(op string) string {
+	if d == DialectJSONPathPlus {
+		switch op {
+		case "===":
+			return "=="
+		case "!==":
+			return "!="
+		}
+	}
+	return op
+}
+
+// operand rewrites a filter operand into native syntax.
+func (d Dialect) operand(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if d.bareWords() && isBareWord(trimmed) {
+		return "'" + trimmed + "'"
+	}
+	return text
+}
+
+// isBareWord reports whether s is an unquoted string like fiction.
+func isBareWord(s string) bool {
+	if s == "" || isBool(s) || s == "null" {
+		return false
+	}
+	for i, r := range s {
+		if i == 0 && r != '_' && !unicode.IsLetter(r) {
+			return false
+		}
+		if r != '_' && r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
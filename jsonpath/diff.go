@@ -0,0 +1,359 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ChangeOp is the kind of a Change, named after the JSON Patch operations.
+type ChangeOp string
+
+const (
+	OpAdd     ChangeOp = "add"
+	OpRemove  ChangeOp = "remove"
+	OpReplace ChangeOp = "replace"
+	OpMove    ChangeOp = "move"
+	// OpCopy and OpTest only appear in patches given to ApplyPatch; Diff
+	// and dry runs describe copies as additions.
+	OpCopy ChangeOp = "copy"
+	OpTest ChangeOp = "test"
+)
+
+// Change is one step turning a document into another. Applied in order,
+// the changes returned by Diff are a valid JSON Patch: paths refer to the
+// document as left by the previous changes.
+type Change struct {
+	Op   ChangeOp
+	Path cty.Path
+	// From is the source location of a move.
+	From cty.Path
+	// Old is the value removed or replaced, New the value added or
+	// replacing it.
+	Old, New cty.Value
+}
+
+// DiffOptions tweaks how Diff compares documents.
+type DiffOptions struct {
+	// ArrayKeys identifies the elements of arrays by a key instead of by
+	// position. It maps expressions locating arrays in the new document,
+	// e.g. "$.spec.containers", to the path of the key relative to an
+	// element, e.g. "@.name". Elements with the same key are diffed with
+	// each other, and reordering them produces moves instead of a series
+	// of replacements. Arrays whose keys are missing or not unique are
+	// compared by position.
+	ArrayKeys map[string]string
+	// Equal decides which values are unchanged. Diff ignores marks
+	// whatever Equal.IgnoreMarks says.
+	Equal EqualOptions
+}
+
+// Diff returns the changes turning old into new. Marks are ignored.
+func Diff(old, new cty.Value, opts DiffOptions) ([]Change, error) {
+	old, _ = old.UnmarkDeep()
+	new, _ = new.UnmarkDeep()
+	d := differ{keys: map[string]*JSONPath{}, equal: opts.Equal}
+	exprs := make([]string, 0, len(opts.ArrayKeys))
+	for expr := range opts.ArrayKeys {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		p, err := NewPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		key, err := NewPath(opts.ArrayKeys[expr])
+		if err != nil {
+			return nil, err
+		}
+		_, paths, err := p.Eval(new)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			d.keys[pathKey(path)] = key
+		}
+	}
+	d.diff(cty.Path{}, old, new)
+	return d.changes, nil
+}
+
+type differ struct {
+	// keys holds the identity path of keyed arrays by pathKey
+	keys    map[string]*JSONPath
+	equal   EqualOptions
+	changes []Change
+}
+
+func (d *differ) emit(c Change) {
+	c.Path = c.Path.Copy()
+	d.changes = append(d.changes, c)
+}
+
+func (d *differ) diff(path cty.Path, old, new cty.Value) {
+	if old.RawEquals(new) || (d.equal != EqualOptions{} && d.equal.equal(old, new)) {
+		return
+	}
+	oldTy, newTy := old.Type(), new.Type()
+	switch {
+	case old.IsNull() || new.IsNull() || !old.IsKnown() || !new.IsKnown():
+	case isMapping(oldTy) && isMapping(newTy):
+		d.diffMapping(path, old, new)
+		return
+	case isSequence(oldTy) && isSequence(newTy):
+		if key, ok := d.keys[pathKey(path)]; ok && d.diffKeyed(path, old.AsValueSlice(), new.AsValueSlice(), key) {
+			return
+		}
+		d.diffSequence(path, old.AsValueSlice(), new.AsValueSlice())
+		return
+	}
+	d.emit(Change{Op: OpReplace, Path: path, Old: old, New: new})
+}
+
+func isMapping(ty cty.Type) bool {
+	return ty.IsObjectType() || ty.IsMapType()
+}
+
+func isSequence(ty cty.Type) bool {
+	return ty.IsListType() || ty.IsTupleType()
+}
+
+func (d *differ) diffMapping(path cty.Path, old, new cty.Value) {
+	oldAttrs, newAttrs := old.AsValueMap(), new.AsValueMap()
+	keys := []string{}
+	for k := range oldAttrs {
+		keys = append(keys, k)
+	}
+	for k := range newAttrs {
+		if _, ok := oldAttrs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o, inOld := oldAttrs[k]
+		n, inNew := newAttrs[k]
+		switch {
+		case !inNew:
+			d.emit(Change{Op: OpRemove, Path: path.GetAttr(k), Old: o})
+		case !inOld:
+			d.emit(Change{Op: OpAdd, Path: path.GetAttr(k), New: n})
+		default:
+			d.diff(path.GetAttr(k), o, n)
+		}
+	}
+}
+
+// diffSequence compares elements by position.
+func (d *differ) diffSequence(path cty.Path, old, new []cty.Value) {
+	for i := 0; i < len(old) && i < len(new); i++ {
+		d.diff(path.IndexInt(i), old[i], new[i])
+	}
+	for i := len(new); i < len(old); i++ {
+		// removing the tail back to front keeps the indexes valid
+		j := len(old) - 1 - (i - len(new))
+		d.emit(Change{Op: OpRemove, Path: path.IndexInt(j), Old: old[j]})
+	}
+	for i := len(old); i < len(new); i++ {
+		d.emit(Change{Op: OpAdd, Path: path.IndexInt(i), New: new[i]})
+	}
+}
+
+// diffKeyed compares elements by key: elements that disappeared are
+// removed, new ones added, and the ones outside the longest common
+// subsequence of keys moved. ok is false when the keys aren't usable.
+func (d *differ) diffKeyed(path cty.Path, old, new []cty.Value, key *JSONPath) (ok bool) {
+	oldKeys, ok := elementKeys(old, key)
+	if !ok {
+		return false
+	}
+	newKeys, ok := elementKeys(new, key)
+	if !ok {
+		return false
+	}
+	oldByKey := map[string]cty.Value{}
+	for i, k := range oldKeys {
+		oldByKey[k] = old[i]
+	}
+	inNew := map[string]bool{}
+	for _, k := range newKeys {
+		inNew[k] = true
+	}
+
+	// current order of the keys while the changes are applied
+	cur := []string{}
+	for i := len(oldKeys) - 1; i >= 0; i-- {
+		if !inNew[oldKeys[i]] {
+			d.emit(Change{Op: OpRemove, Path: path.IndexInt(i), Old: old[i]})
+		}
+	}
+	for _, k := range oldKeys {
+		if inNew[k] {
+			cur = append(cur, k)
+		}
+	}
+	common := []string{}
+	for _, k := range newKeys {
+		if _, ok := oldByKey[k]; ok {
+			common = append(common, k)
+		}
+	}
+	stable := map[string]bool{}
+	for _, k := range longestCommonSubsequence(cur, common) {
+		stable[k] = true
+	}
+
+	for t, k := range newKeys {
+		old, existed := oldByKey[k]
+		if !existed {
+			cur = insertKey(cur, t, k)
+			d.emit(Change{Op: OpAdd, Path: path.IndexInt(t), New: new[t]})
+			continue
+		}
+		// an element that moves later blocks a stable one: park it at the
+		// end until its turn comes
+		for stable[k] && cur[t] != k {
+			blocked := cur[t]
+			cur = append(removeKey(cur, t), blocked)
+			d.emit(Change{Op: OpMove, From: path.IndexInt(t), Path: path.IndexInt(len(cur) - 1), New: oldByKey[blocked]})
+		}
+		if from := indexOf(cur, k); from != t {
+			cur = insertKey(removeKey(cur, from), t, k)
+			d.emit(Change{Op: OpMove, From: path.IndexInt(from), Path: path.IndexInt(t), New: old})
+		}
+		d.diff(path.IndexInt(t), old, new[t])
+	}
+	return true
+}
+
+// elementKeys evaluates key against every element. ok is false unless
+// every element has exactly one key and keys are unique.
+func elementKeys(elems []cty.Value, key *JSONPath) ([]string, bool) {
+	keys := make([]string, len(elems))
+	seen := map[string]bool{}
+	for i, elem := range elems {
+		vals, _, err := key.Eval(elem)
+		if err != nil || len(vals) != 1 {
+			return nil, false
+		}
+		b, err := canonicalJSON(vals[0])
+		if err != nil || seen[string(b)] {
+			return nil, false
+		}
+		seen[string(b)] = true
+		keys[i] = string(b)
+	}
+	return keys, true
+}
+
+func longestCommonSubsequence(a, b []string) []string {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	out := []string{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+func indexOf(keys []string, k string) int {
+	for i, key := range keys {
+		if key == k {
+			return i
+		}
+	}
+	return -1
+}
+
+func insertKey(keys []string, i int, k string) []string {
+	keys = append(keys, "")
+	copy(keys[i+1:], keys[i:])
+	keys[i] = k
+	return keys
+}
+
+func removeKey(keys []string, i int) []string {
+	return append(keys[:i:i], keys[i+1:]...)
+}
+
+// pathKey identifies a path in maps, treating attributes and string keys
+// alike.
+func pathKey(path cty.Path) string {
+	return JSONPointer(path)
+}
+
+// JSONPointer renders path as an RFC 6901 JSON Pointer, e.g. "/spec/ports/0".
+func JSONPointer(path cty.Path) string {
+	var b strings.Builder
+	for _, step := range path {
+		b.WriteByte('/')
+		var token string
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			token = step.Name
+		case cty.IndexStep:
+			if step.Key.Type() == cty.Number {
+				i, _ := step.Key.AsBigFloat().Int64()
+				token = strconv.FormatInt(i, 10)
+			} else if step.Key.Type() == cty.String {
+				token = step.Key.AsString()
+			}
+		}
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+type patchOp struct {
+	Op    ChangeOp        `json:"op"`
+	From  string          `json:"from,omitempty"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MarshalPatch encodes changes as an RFC 6902 JSON Patch document.
+func MarshalPatch(changes []Change) ([]byte, error) {
+	ops := make([]patchOp, len(changes))
+	for i, c := range changes {
+		ops[i] = patchOp{Op: c.Op, Path: JSONPointer(c.Path)}
+		switch c.Op {
+		case OpMove:
+			ops[i].From = JSONPointer(c.From)
+		case OpAdd, OpReplace:
+			v, _ := c.New.UnmarkDeep()
+			b, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			ops[i].Value = b
+		}
+	}
+	return json.Marshal(ops)
+}
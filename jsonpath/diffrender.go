@@ -0,0 +1,177 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// RenderOptions tweaks WriteDiff and WriteDiffHTML.
+type RenderOptions struct {
+	// GroupDepth is the number of leading path steps changes are grouped
+	// by, 1 if zero: with 1, changes to $.spec.replicas and
+	// $.spec.ports[0] appear together under $.spec, and a change to $.name
+	// under $.
+	GroupDepth int
+	// Color highlights the terminal output with ANSI escape sequences.
+	Color bool
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// WriteDiff writes changes for a terminal, one per line, grouped by path
+// prefix:
+//
+//	$.spec
+//	  ~ $.spec.replicas: 1 => 3
+//	  + $.spec.ports[2]: 8443
+//	  - $.spec.name: "web"
+//	  > $.spec.containers[2] => $.spec.containers[0]
+//
+// Groups appear in the order of their first change and keep the order of
+// changes within them.
+func WriteDiff(w io.Writer, changes []Change, opts RenderOptions) error {
+	var b strings.Builder
+	paint := func(color, s string) string {
+		if !opts.Color {
+			return s
+		}
+		return color + s + ansiReset
+	}
+	for i, g := range groupChanges(changes, opts.GroupDepth) {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(paint(ansiBold, g.prefix) + "\n")
+		for _, c := range g.changes {
+			path := FormatPath(c.Path)
+			switch c.Op {
+			case OpAdd:
+				b.WriteString(paint(ansiGreen, fmt.Sprintf("  + %s: %s", path, diffValue(c.New))))
+			case OpRemove:
+				b.WriteString(paint(ansiRed, fmt.Sprintf("  - %s: %s", path, diffValue(c.Old))))
+			case OpReplace:
+				fmt.Fprintf(&b, "%s %s: %s => %s", paint(ansiYellow, "  ~"), path,
+					paint(ansiRed, diffValue(c.Old)), paint(ansiGreen, diffValue(c.New)))
+			case OpMove:
+				b.WriteString(paint(ansiCyan, fmt.Sprintf("  > $%s => %s", PrettyCtyPath(c.From), path)))
+			}
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDiffHTML writes changes as an HTML fragment grouped like WriteDiff:
+// a div of class "jsonpath-diff" holding a section per group, with a
+// heading and a list whose items have the class of their operation (add,
+// remove, replace or move). Values are in del and ins elements, paths in
+// code elements; styling is left to the page.
+func WriteDiffHTML(w io.Writer, changes []Change, opts RenderOptions) error {
+	var b strings.Builder
+	code := func(path cty.Path) string {
+		return "<code>" + html.EscapeString(FormatPath(path)) + "</code>"
+	}
+	b.WriteString("<div class=\"jsonpath-diff\">\n")
+	for _, g := range groupChanges(changes, opts.GroupDepth) {
+		fmt.Fprintf(&b, "<section>\n<h4>%s</h4>\n<ul>\n", html.EscapeString(g.prefix))
+		for _, c := range g.changes {
+			fmt.Fprintf(&b, "<li class=\"%s\">", c.Op)
+			switch c.Op {
+			case OpAdd:
+				fmt.Fprintf(&b, "%s <ins>%s</ins>", code(c.Path), html.EscapeString(diffValue(c.New)))
+			case OpRemove:
+				fmt.Fprintf(&b, "%s <del>%s</del>", code(c.Path), html.EscapeString(diffValue(c.Old)))
+			case OpReplace:
+				fmt.Fprintf(&b, "%s <del>%s</del> <ins>%s</ins>", code(c.Path),
+					html.EscapeString(diffValue(c.Old)), html.EscapeString(diffValue(c.New)))
+			case OpMove:
+				fmt.Fprintf(&b, "%s &rarr; %s", code(c.From), code(c.Path))
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ul>\n</section>\n")
+	}
+	b.WriteString("</div>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type changeGroup struct {
+	prefix  string
+	changes []Change
+}
+
+// groupChanges groups changes by their first depth steps, or their parent
+// if shorter, in the order of the first change of each group.
+func groupChanges(changes []Change, depth int) []changeGroup {
+	if depth <= 0 {
+		depth = 1
+	}
+	groups := []changeGroup{}
+	index := map[string]int{}
+	for _, c := range changes {
+		// a change is listed under its parent at most
+		n := len(c.Path) - 1
+		if n > depth {
+			n = depth
+		}
+		if n < 0 {
+			n = 0
+		}
+		prefix := c.Path[:n]
+		key := FormatPath(prefix)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, changeGroup{prefix: key})
+		}
+		groups[i].changes = append(groups[i].changes, c)
+	}
+	return groups
+}
+
+// diffValue shows v as compact JSON.
+func diffValue(v cty.Value) string {
+	if v.Type() == cty.NilType {
+		return "null"
+	}
+	v, _ = v.UnmarkDeep()
+	if !v.IsWhollyKnown() {
+		return "(unknown)"
+	}
+	b, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+	if err != nil {
+		return v.GoString()
+	}
+	// encoding/json escapes <, > and &, which reads badly in a terminal
+	// and would be escaped twice in HTML
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return string(b)
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return string(b)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
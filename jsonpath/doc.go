@@ -0,0 +1,21 @@
+// Package jsonpath evaluates JSONPath expressions against cty values.
+//
+// Package core exposes the stable subset of this package, Compile, Eval, Set
+// and Delete, with a compatibility promise; the rest of the API may still
+// change between minor versions.
+//
+// # Minimal builds
+//
+// Building with the jsonpath_minimal tag, e.g. for WebAssembly with TinyGo,
+// leaves out the optional parts that pull in large dependencies or rely on
+// reflection:
+//
+//   - the codec, semver, uuid, network and env filter functions, with
+//     ExpandEnv and the Base64Decode family of ReplaceFunc conversions
+//   - Query and MatchList.Into, which decode into Go values
+//   - SortBy, SortedKeys and Collation, which depend on golang.org/x/text
+//   - JSONPath.MarshalBinary and UnmarshalBinary, which use encoding/gob
+//
+// The core API remains: NewPath and Compile, Eval, EvalMatches, Read and
+// its typed variants, Set and the other writes, Diff and Document.
+package jsonpath
@@ -0,0 +1,207 @@
+package jsonpath
+
+import (
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Document is a mutable handle around an immutable cty.Value snapshot.
+//
+// Writes replace the snapshot, drop stale results from an attached
+// ResultCache and notify subscribers whose queries could be affected.
+// A Document is safe for concurrent use.
+type Document struct {
+	mu     sync.Mutex
+	value  cty.Value
+	cache  *ResultCache
+	subs   map[int]*subscription
+	nextID int
+
+	// counts the snapshots, with the content hash of the current one once
+	// an Eval through the cache needed it
+	gen    int
+	hash   int
+	hashed bool
+
+	// previous snapshots, oldest first (see KeepHistory)
+	history      []cty.Value
+	historyLimit int
+
+	// options for the expressions the document compiles
+	opts     []Option
+	pathOpts bool
+
+	// where a detached fragment was found (see MatchList.Detach)
+	base cty.Path
+}
+
+type subscription struct {
+	path     *JSONPath
+	prefixes []cty.Path
+	fn       func(vals []cty.Value, paths []cty.Path)
+}
+
+// NewDocument creates a Document holding value. WithHistory and WithCache
+// configure the document itself; other options apply to the expressions
+// given to Eval, Set and Subscribe.
+func NewDocument(value cty.Value, opts ...Option) *Document {
+	s := newSettings(opts)
+	return &Document{
+		value:        value,
+		subs:         map[int]*subscription{},
+		cache:        s.cache,
+		historyLimit: s.historyLimit,
+		opts:         opts,
+		pathOpts:     s.path,
+	}
+}
+
+// Value returns the current snapshot.
+func (d *Document) Value() cty.Value {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.value
+}
+
+// UseCache makes Eval go through cache. Writes to the document invalidate
+// the entries of the replaced snapshot, which is hashed once rather than
+// on every Eval. The cache holds results for the
+// default options, so it is bypassed when the document was created with
+// options affecting expressions.
+func (d *Document) UseCache(cache *ResultCache) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cache = cache
+}
+
+// Eval evaluates jsonPath against the current snapshot.
+func (d *Document) Eval(jsonPath string) ([]cty.Value, []cty.Path, error) {
+	d.mu.Lock()
+	value, cache, gen := d.value, d.cache, d.gen
+	hash, hashed := d.hash, d.hashed
+	d.mu.Unlock()
+
+	if cache != nil && !d.pathOpts {
+		if !hashed {
+			hash = docHash(value)
+			d.mu.Lock()
+			if d.gen == gen {
+				d.hash, d.hashed = hash, true
+			}
+			d.mu.Unlock()
+		}
+		return cache.eval(jsonPath, value, hash, &snapshotID{d, gen})
+	}
+	p, err := NewPath(jsonPath, d.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.Eval(value)
+}
+
+// Set replaces every location matched by jsonPath with value.
+func (d *Document) Set(jsonPath string, value cty.Value) error {
+	p, err := NewPath(jsonPath, d.opts...)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	old := d.value
+	changed, err := p.writePaths(old)
+	if err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	updated, err := replacePaths(old, changed, value)
+	if err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	notify := d.replace(updated, changed)
+	d.mu.Unlock()
+
+	d.publish(notify, updated)
+	return nil
+}
+
+// replace installs a new snapshot and returns the subscriptions to notify.
+// Must be called with d.mu held.
+func (d *Document) replace(updated cty.Value, changed []cty.Path) []*subscription {
+	d.dropSnapshot()
+	d.record(d.value)
+	d.value = updated
+	return d.affected(changed)
+}
+
+// Subscribe calls fn with the fresh results of jsonPath every time a write
+// touches a location the query could depend on. Only queries with a
+// referenced prefix (see ReferencedPrefixes) overlapping a changed path are
+// re-evaluated. The returned function
+// cancels the subscription.
+func (d *Document) Subscribe(jsonPath string, fn func(vals []cty.Value, paths []cty.Path)) (func(), error) {
+	p, err := NewPath(jsonPath, d.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := d.nextID
+	d.nextID++
+	d.subs[id] = &subscription{path: p, prefixes: p.ReferencedPrefixes(), fn: fn}
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.subs, id)
+	}, nil
+}
+
+// affected returns the subscriptions with a prefix overlapping any of the
+// changed paths. Must be called with d.mu held.
+func (d *Document) affected(changed []cty.Path) []*subscription {
+	out := []*subscription{}
+	for _, sub := range d.subs {
+		if sub.touches(changed) {
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+func (s *subscription) touches(changed []cty.Path) bool {
+	for _, prefix := range s.prefixes {
+		for _, path := range changed {
+			if pathsOverlap(prefix, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropSnapshot removes the results of the current snapshot from the cache
+// before it is replaced. Must be called with d.mu held.
+func (d *Document) dropSnapshot() {
+	if d.cache != nil && d.hashed {
+		// only an Eval through the cache hashes the snapshot, so there is
+		// nothing to drop otherwise
+		d.cache.invalidate(d.value, d.hash)
+	}
+	d.gen++
+	d.hashed = false
+}
+
+// publish hands the fresh results of subs to their callbacks. It runs
+// outside d.mu, so concurrent writes may publish at once: each evaluation
+// gets a context of its own, since a JSONPath keeps its evaluation state.
+func (d *Document) publish(subs []*subscription, value cty.Value) {
+	for _, sub := range subs {
+		vals, paths, err := sub.path.Eval(value, WithEvalContext(NewEvalContext()))
+		if err != nil {
+			continue
+		}
+		sub.fn(vals, paths)
+	}
+}
@@ -0,0 +1,46 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// createChange describes storing a value at path in before, which gave
+// after: missing or null parents being created show as a single change at
+// the first of them.
+func createChange(before, after cty.Value, path cty.Path) Change {
+	for i := range path {
+		at := path[:i+1].Copy()
+		old, err := applyPath(before, at)
+		if err != nil {
+			new, _ := applyPath(after, at)
+			return Change{Op: OpAdd, Path: at, New: new}
+		}
+		if unmarked, _ := old.Unmark(); unmarked.IsNull() && i < len(path)-1 {
+			new, _ := applyPath(after, at)
+			return Change{Op: OpReplace, Path: at, Old: old, New: new}
+		}
+	}
+	return replaceChange(before, after, path)
+}
+
+// replaceChange describes the replacement of the value at path.
+func replaceChange(before, after cty.Value, path cty.Path) Change {
+	old, _ := applyPath(before, path)
+	new, _ := applyPath(after, path)
+	return Change{Op: OpReplace, Path: path.Copy(), Old: old, New: new}
+}
+
+// replaceChanges describes the replacement of the values at paths, once
+// per distinct path like replacePaths.
+func replaceChanges(before, after cty.Value, paths []cty.Path) []Change {
+	changes := []Change{}
+	seen := cty.NewPathSet()
+	for _, path := range paths {
+		if seen.Has(path) {
+			continue
+		}
+		seen.Add(path)
+		changes = append(changes, replaceChange(before, after, path))
+	}
+	return changes
+}
@@ -0,0 +1,51 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func init() {
+	functions["env"] = filterFunc{params: 1, impl: envLookup, optIn: true}
+}
+
+var envRefRex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// envLookup implements env("NAME"), which evaluates to null when NAME is
+// not set.
+func envLookup(args []cty.Value) (cty.Value, error) {
+	name := args[0]
+	if name.IsNull() || !name.IsKnown() || name.Type() != cty.String {
+		return cty.NilVal, newError(ErrTypeMismatch, "env takes a variable name")
+	}
+	if value, ok := os.LookupEnv(name.AsString()); ok {
+		return cty.StringVal(value), nil
+	}
+	return cty.NullVal(cty.String), nil
+}
+
+// ExpandEnv returns a copy of doc where every ${VAR} in a string value is
+// replaced by the environment variable VAR, or by the empty string when it
+// isn't set. Keys and $VAR without braces are left alone.
+func ExpandEnv(doc cty.Value) cty.Value {
+	return ExpandEnvFunc(doc, os.Getenv)
+}
+
+// ExpandEnvFunc is like ExpandEnv but looks variables up with mapping.
+func ExpandEnvFunc(doc cty.Value, mapping func(name string) string) cty.Value {
+	expanded, _ := cty.Transform(doc, func(path cty.Path, v cty.Value) (cty.Value, error) {
+		unmarked, marks := v.Unmark()
+		if unmarked.IsNull() || !unmarked.IsKnown() || unmarked.Type() != cty.String {
+			return v, nil
+		}
+		s := envRefRex.ReplaceAllStringFunc(unmarked.AsString(), func(ref string) string {
+			return mapping(ref[2 : len(ref)-1])
+		})
+		return cty.StringVal(s).WithMarks(marks), nil
+	})
+	return expanded
+}
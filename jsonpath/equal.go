@@ -0,0 +1,133 @@
+package jsonpath
+
+import (
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EqualOptions relaxes the comparison of documents by DeepEqual, Diff
+// (DiffOptions.Equal) and result de-duplication (EvalOptions.Distinct).
+// The zero value compares exactly, except that objects and maps with the
+// same members are equal, as are arrays of any kind with the same
+// elements, as they would be once serialized to JSON.
+type EqualOptions struct {
+	// IgnoreArrayOrder compares arrays as multisets. Sets always are.
+	IgnoreArrayOrder bool
+	// FloatEpsilon is the largest difference between numbers considered
+	// equal, to absorb rounding introduced by re-serialization.
+	FloatEpsilon float64
+	// IgnoreMarks compares values regardless of their marks.
+	IgnoreMarks bool
+}
+
+// DeepEqual reports whether a and b are equal under opts.
+func DeepEqual(a, b cty.Value, opts EqualOptions) bool {
+	return opts.equal(a, b)
+}
+
+func (o EqualOptions) equal(a, b cty.Value) bool {
+	if !o.IgnoreMarks && !a.Marks().Equal(b.Marks()) {
+		return false
+	}
+	a, _ = a.Unmark()
+	b, _ = b.Unmark()
+	if !a.IsKnown() || !b.IsKnown() {
+		return a.RawEquals(b)
+	}
+	if a.IsNull() || b.IsNull() {
+		return a.IsNull() && b.IsNull()
+	}
+
+	ta, tb := a.Type(), b.Type()
+	switch {
+	case isMapping(ta) && isMapping(tb):
+		am, bm := a.AsValueMap(), b.AsValueMap()
+		if len(am) != len(bm) {
+			return false
+		}
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok || !o.equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case isArray(ta) && isArray(tb):
+		as, bs := a.AsValueSlice(), b.AsValueSlice()
+		if len(as) != len(bs) {
+			return false
+		}
+		if o.IgnoreArrayOrder || ta.IsSetType() || tb.IsSetType() {
+			return o.equalUnordered(as, bs)
+		}
+		for i := range as {
+			if !o.equal(as[i], bs[i]) {
+				return false
+			}
+		}
+		return true
+	case ta == cty.Number && tb == cty.Number:
+		if o.FloatEpsilon == 0 {
+			return a.AsBigFloat().Cmp(b.AsBigFloat()) == 0
+		}
+		diff := new(big.Float).Sub(a.AsBigFloat(), b.AsBigFloat())
+		return diff.Abs(diff).Cmp(big.NewFloat(o.FloatEpsilon)) <= 0
+	case ta.Equals(tb):
+		return a.RawEquals(b)
+	}
+	return false
+}
+
+// equalUnordered pairs each element of a with an equal one of b. Pairing
+// is greedy, so with FloatEpsilon numbers close to several others may be
+// reported unequal although a pairing exists.
+func (o EqualOptions) equalUnordered(a, b []cty.Value) bool {
+	used := make([]bool, len(b))
+Elements:
+	for _, av := range a {
+		for i, bv := range b {
+			if !used[i] && o.equal(av, bv) {
+				used[i] = true
+				continue Elements
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isArray(ty cty.Type) bool {
+	return isSequence(ty) || ty.IsSetType()
+}
+
+// distinct drops the results equal, under EvalOptions.Distinct, to an
+// earlier one.
+func (j *JSONPath) distinct(vals []cty.Value, paths []cty.Path) ([]cty.Value, []cty.Path) {
+	opts := j.opts.Distinct
+	if opts == nil {
+		return vals, paths
+	}
+	// exact comparisons can be bucketed by JSON encoding, which doesn't
+	// tell objects from maps either; relaxed ones can't
+	hashed := !opts.IgnoreArrayOrder && opts.FloatEpsilon == 0
+	buckets := map[string][]cty.Value{}
+	outVals, outPaths := vals[:0:0], paths[:0:0]
+Results:
+	for i, v := range vals {
+		var h string
+		if hashed {
+			b, _ := canonicalJSON(v)
+			h = string(b)
+		}
+		for _, seen := range buckets[h] {
+			if opts.equal(seen, v) {
+				continue Results
+			}
+		}
+		buckets[h] = append(buckets[h], v)
+		outVals = append(outVals, v)
+		outPaths = append(outPaths, paths[i])
+	}
+	return outVals, outPaths
+}
@@ -0,0 +1,79 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Sentinel errors. Every error returned by this package matches one of them
+// with errors.Is, so callers can branch on the kind of failure without
+// inspecting messages.
+var (
+	// ErrSyntax means the expression couldn't be parsed.
+	ErrSyntax = errors.New("invalid syntax")
+	// ErrNotFound means a required location doesn't exist in the document.
+	ErrNotFound = errors.New("not found")
+	// ErrTypeMismatch means a step was applied to a value of the wrong type,
+	// e.g. indexing a string or filtering an object.
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrIndexOutOfBounds means an index or slice falls outside an array.
+	ErrIndexOutOfBounds = errors.New("index out of bounds")
+	// ErrUnsupported means the expression uses a construct this package
+	// doesn't implement.
+	ErrUnsupported = errors.New("unsupported")
+	// ErrMultipleMatches means an expression expected to select a single
+	// value matched several.
+	ErrMultipleMatches = errors.New("multiple matches")
+	// ErrConflict means a write's precondition doesn't hold: a JSON Patch
+	// test operation failed, or the document changed since a transaction
+	// began.
+	ErrConflict = errors.New("conflict")
+	// ErrOverflow means a number doesn't fit the Go type it was requested
+	// as, or isn't an integer when one was expected.
+	ErrOverflow = errors.New("numeric overflow")
+	// ErrBudgetExceeded means the results of an evaluation outgrew
+	// EvalOptions.MaxResultBytes (see BudgetError).
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	// ErrInvariant means Verify caught the package misbehaving: a panic, a
+	// result path that doesn't lead to its value, and the like.
+	ErrInvariant = errors.New("invariant violated")
+)
+
+// Error describes a failure of a given Kind (one of the sentinel errors).
+type Error struct {
+	Kind error
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Unwrap makes errors.Is(err, e.Kind) hold.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// PathError is an error tied to a location in the document.
+type PathError struct {
+	Path cty.Path
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("$%s: %s", PrettyCtyPath(e.Path), e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+func newPathError(path cty.Path, kind error, format string, args ...interface{}) error {
+	return &PathError{Path: path.Copy(), Err: newError(kind, format, args...)}
+}
@@ -0,0 +1,49 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EvalContext holds what evaluations can reuse from one call to the next:
+// the document marked with the paths of its values, which every evaluation
+// otherwise rebuilds, and the buffers of MemoizeFilters. Services answering
+// many queries can keep a context per goroutine and pass it with
+// WithEvalContext; the same JSONPath can then be evaluated concurrently,
+// each goroutine through its own context.
+//
+// A context keeps the last document it was used with, and only pays off
+// while queries go to the same document; Reset releases it. It must not be
+// used concurrently.
+type EvalContext struct {
+	doc, marked cty.Value
+	memo        filterMemo
+}
+
+// NewEvalContext creates an empty EvalContext.
+func NewEvalContext() *EvalContext {
+	return &EvalContext{memo: filterMemo{}}
+}
+
+// Reset drops the document the context holds on to.
+func (c *EvalContext) Reset() {
+	c.doc, c.marked = cty.NilVal, cty.NilVal
+	clear(c.memo)
+}
+
+// markPaths is markPaths going through the context's document, if any,
+// after checking EvalOptions.MaxDepth.
+func (j *JSONPath) markPaths(data cty.Value) (cty.Value, error) {
+	if j.opts.MaxDepth > 0 {
+		if err := checkDepth(data, j.opts.MaxDepth); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	c := j.opts.Context
+	if c == nil {
+		return markPaths(data), nil
+	}
+	if c.doc == cty.NilVal || !c.doc.RawEquals(data) {
+		c.doc, c.marked = data, markPaths(data)
+	}
+	return c.marked, nil
+}
@@ -0,0 +1,125 @@
+package jsonpath
+
+import (
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ChangeEvent reports one change made to a document of a Store.
+type ChangeEvent struct {
+	// Doc is the name of the changed document.
+	Doc string
+	Change
+	// Patch is Change as a single-operation JSON Patch. The events of one
+	// write arrive in order, so their patches applied in sequence turn
+	// the old document into the new one.
+	Patch []byte
+}
+
+// Subscribe returns a channel receiving the changes to the document stored
+// under docName that touch a location matched by pathPattern, in the
+// document before or after the write. Changes are computed with Diff
+// between consecutive snapshots, whichever way they were written.
+//
+// Events are delivered in order and a full channel holds up the writer, so
+// receivers should keep up. The returned function stops the subscription
+// and closes the channel.
+func (s *Store) Subscribe(docName, pathPattern string) (<-chan ChangeEvent, func(), error) {
+	d, ok := s.Document(docName)
+	if !ok {
+		return nil, nil, newError(ErrNotFound, "document %q not found", docName)
+	}
+	pattern, err := NewPath(pathPattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &eventWatcher{
+		doc:     docName,
+		pattern: pattern,
+		last:    d.Value(),
+		ch:      make(chan ChangeEvent, 16),
+		done:    make(chan struct{}),
+	}
+	unsubscribe, err := d.Subscribe("$", func(vals []cty.Value, _ []cty.Path) {
+		if len(vals) == 1 {
+			w.observe(vals[0])
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return w.ch, func() {
+		once.Do(func() {
+			unsubscribe()
+			close(w.done)
+			w.mu.Lock()
+			w.closed = true
+			close(w.ch)
+			w.mu.Unlock()
+		})
+	}, nil
+}
+
+type eventWatcher struct {
+	doc     string
+	pattern *JSONPath
+
+	// mu serializes deliveries, so events keep the order of the writes
+	mu     sync.Mutex
+	last   cty.Value
+	closed bool
+	ch     chan ChangeEvent
+	done   chan struct{}
+}
+
+// observe sends the changes from the previous snapshot to value.
+func (w *eventWatcher) observe(value cty.Value) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	old := w.last
+	w.last = value
+
+	changes, err := Diff(old, value, DiffOptions{})
+	if err != nil || len(changes) == 0 {
+		return
+	}
+	matched := w.matched(old)
+	matched = append(matched, w.matched(value)...)
+	for _, c := range changes {
+		if !touchesAny(c, matched) {
+			continue
+		}
+		patch, err := MarshalPatch([]Change{c})
+		if err != nil {
+			continue
+		}
+		select {
+		case w.ch <- ChangeEvent{Doc: w.doc, Change: c, Patch: patch}:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *eventWatcher) matched(doc cty.Value) []cty.Path {
+	_, paths, err := w.pattern.Eval(doc)
+	if err != nil {
+		return nil
+	}
+	return paths
+}
+
+func touchesAny(c Change, matched []cty.Path) bool {
+	for _, path := range matched {
+		if pathsOverlap(c.Path, path) || (c.Op == OpMove && pathsOverlap(c.From, path)) {
+			return true
+		}
+	}
+	return false
+}
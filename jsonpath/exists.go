@@ -0,0 +1,63 @@
+package jsonpath
+
+import (
+	"errors"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// errFound stops an evaluation at its first match.
+var errFound = errors.New("found")
+
+// ExistsMatrix reports which of paths match something in which of docs,
+// e.g. which services set `$.limits.memory`: the result has a row per
+// document and a column per path. opts are those of NewPath.
+//
+// Each path is compiled once. Definite paths (see Set) are looked up
+// directly, the others evaluated until their first match. A path whose
+// evaluation fails on a document, e.g. by indexing a string, doesn't exist
+// in it. Paths that don't compile are reported together in a
+// *MultiPathError.
+func ExistsMatrix(docs []cty.Value, paths []string, opts ...Option) ([][]bool, error) {
+	compiled := make([]*JSONPath, len(paths))
+	errs := []error{}
+	for i, expr := range paths {
+		p, err := NewPath(expr, opts...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		compiled[i] = p
+	}
+	if len(errs) > 0 {
+		return nil, &MultiPathError{Errors: errs}
+	}
+
+	out := make([][]bool, len(docs))
+	for i, doc := range docs {
+		out[i] = make([]bool, len(paths))
+		for j, p := range compiled {
+			out[i][j] = p.exists(doc)
+		}
+	}
+	return out, nil
+}
+
+// exists reports whether j matches anything in doc.
+func (j *JSONPath) exists(doc cty.Value) bool {
+	if path, ok := j.definitePath(); ok {
+		if _, err := applyPath(doc, path); err == nil {
+			return true
+		}
+		// options such as WithNumericKeys may still find it
+	}
+	opts := j.defaults
+	opts.ChunkSize = 1
+	err := j.EvalChunked(doc, opts, func(vals []cty.Value, paths []cty.Path) error {
+		if len(vals) > 0 {
+			return errFound
+		}
+		return nil
+	})
+	return err == errFound
+}
@@ -0,0 +1,139 @@
+package jsonpath
+
+import (
+	"sort"
+	"strings"
+)
+
+// GrammarVersion is the revision of the expression syntax accepted by the
+// parser. It changes whenever an expression valid in one version would be
+// rejected or evaluated differently by another.
+const GrammarVersion = 1
+
+// Feature names a construct beyond plain child and index steps, so hosting
+// applications can advertise what they accept and reject expressions using
+// more (see CompileOptions.AllowedFeatures).
+type Feature string
+
+const (
+	FeatureWildcard       Feature = "wildcard"          // .* and [*]
+	FeatureRecursive      Feature = "recursive-descent" // ..
+	FeatureUnion          Feature = "union"             // [0,1], ['a','b']
+	FeatureSlice          Feature = "slice"             // [1:5:2]
+	FeatureFilter         Feature = "filter"            // [?(@.price < 10)]
+	FeatureRootReference  Feature = "root-reference"    // $ inside a filter
+	FeatureFunctions      Feature = "functions"         // length(@.tags), $.csv.split(',')
+	FeatureLengthProperty Feature = "length-property"   // @.tags.length
+	FeatureRegexKeys      Feature = "regex-keys"        // [/^app\./]
+	FeatureDocuments      Feature = "documents"         // $doc("other").x
+
+	// Constructs of other engines this package doesn't implement. They
+	// are never returned by SupportedFeatures and expressions using them
+	// fail to parse.
+	FeatureScript Feature = "script" // [(@.length-1)]
+	FeatureParent Feature = "parent" // ^
+)
+
+// SupportedFeatures lists the features the parser accepts.
+func SupportedFeatures() []Feature {
+	return []Feature{
+		FeatureWildcard,
+		FeatureRecursive,
+		FeatureUnion,
+		FeatureSlice,
+		FeatureFilter,
+		FeatureRootReference,
+		FeatureFunctions,
+		FeatureLengthProperty,
+		FeatureRegexKeys,
+		FeatureDocuments,
+	}
+}
+
+// Features lists, sorted, the features the expression uses as written,
+// before any optimization.
+func (j *JSONPath) Features() []Feature {
+	return append([]Feature(nil), j.features...)
+}
+
+// usedFeatures collects the features used below root.
+func usedFeatures(root *ListNode) []Feature {
+	seen := map[Feature]bool{}
+	collectFeatures(flattenSteps(root), seen)
+	out := make([]Feature, 0, len(seen))
+	for f := range seen {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a] < out[b] })
+	return out
+}
+
+func collectFeatures(steps []Node, seen map[Feature]bool) {
+	for _, node := range steps {
+		switch node := node.(type) {
+		case *WildcardNode:
+			seen[FeatureWildcard] = true
+		case *RecursiveNode:
+			seen[FeatureRecursive] = true
+		case *RegexNode:
+			seen[FeatureRegexKeys] = true
+		case *DocNode:
+			seen[FeatureDocuments] = true
+		case *ArrayNode:
+			switch {
+			case isWildcardSlice(node.Params):
+				seen[FeatureWildcard] = true
+			case !isSingleIndex(node.Params):
+				seen[FeatureSlice] = true
+			}
+		case *UnionNode:
+			seen[FeatureUnion] = true
+			for _, branch := range node.Nodes {
+				collectFeatures(flattenSteps(branch), seen)
+			}
+		case *FilterNode:
+			seen[FeatureFilter] = true
+			collectOperandFeatures(node.Left, seen)
+			collectOperandFeatures(node.Right, seen)
+		case *FunctionNode:
+			if node.Property {
+				seen[FeatureLengthProperty] = true
+			} else {
+				seen[FeatureFunctions] = true
+			}
+			for _, arg := range node.Args {
+				collectOperandFeatures(arg, seen)
+			}
+		}
+	}
+}
+
+func collectOperandFeatures(operand *ListNode, seen map[Feature]bool) {
+	if operand == nil {
+		return
+	}
+	steps := flattenSteps(operand)
+	if len(steps) > 0 && steps[0].Type() == NodeRoot {
+		seen[FeatureRootReference] = true
+	}
+	collectFeatures(steps, seen)
+}
+
+// checkFeatures fails with ErrUnsupported if used contains a feature
+// outside allowed.
+func checkFeatures(used, allowed []Feature) error {
+	var denied []string
+	for _, f := range used {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == f
+		}
+		if !ok {
+			denied = append(denied, string(f))
+		}
+	}
+	if len(denied) > 0 {
+		return newError(ErrUnsupported, "expression uses disallowed features: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
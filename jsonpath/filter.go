@@ -0,0 +1,373 @@
+package jsonpath
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// evalFilter keeps the elements of arrays, and the member values of
+// objects and maps, that satisfy the FilterNode. Treating both kinds of
+// container alike lets `$..[?(...)]` test every value below the root.
+func (j *JSONPath) evalFilter(input []cty.Value, node *FilterNode) ([]cty.Value, error) {
+	results := []cty.Value{}
+	for _, value := range input {
+		unmarked, _ := value.Unmark()
+		ty := unmarked.Type()
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			continue
+		}
+		if unmarked.IsNull() || !unmarked.CanIterateElements() {
+			err := newError(ErrTypeMismatch, "%s is not an array or object and cannot be filtered", ty.FriendlyName())
+			if err := j.elementFailed(value, node, err); err != nil {
+				return input, err
+			}
+			continue
+		}
+
+		var elems []cty.Value
+		if ty.IsListType() || ty.IsTupleType() || ty.IsSetType() {
+			if matched, ok := j.evalSortedFilter(value, node); ok {
+				results = append(results, matched...)
+				continue
+			}
+			elems = unmarked.AsValueSlice()
+		} else {
+			for it := unmarked.ElementIterator(); it.Next(); {
+				elems = append(elems, getByIter(unmarked, it))
+			}
+		}
+
+		step := j.statStep(node)
+		for _, elem := range elems {
+			pass, err := j.memoFilterMatches(elem, node)
+			if step != nil {
+				step.Tested++
+				if pass && err == nil {
+					step.Passed++
+				}
+			}
+			if err != nil {
+				// only elem is dropped under ElementErrors
+				if err := j.elementFailed(elem, node, err); err != nil {
+					return input, err
+				}
+				continue
+			}
+			if pass {
+				results = append(results, elem)
+			}
+		}
+	}
+	return results, nil
+}
+
+// filterMatches reports whether elem satisfies the filter predicate.
+func (j *JSONPath) filterMatches(elem cty.Value, node *FilterNode) (bool, error) {
+	pass, left, right, err := j.testFilter(elem, node)
+	if pass && j.opts.traces != nil {
+		j.trace(elem, node, left, right)
+	}
+	return pass, err
+}
+
+// testFilter evaluates the filter predicate on elem, returning the
+// operand values it compared.
+func (j *JSONPath) testFilter(elem cty.Value, node *FilterNode) (pass bool, left, right cty.Value, err error) {
+	if pass, ok := constantFilter(node); ok {
+		return pass, cty.NilVal, cty.NilVal, nil
+	}
+	temp := []cty.Value{elem}
+	lefts, err := j.evalList(temp, node.Left)
+
+	//case exists
+	if node.Operator == "exists" {
+		if len(lefts) > 0 {
+			left = lefts[0]
+		}
+		if isPredicateCall(node.Left) {
+			// a lone function call like [?(uuid(@.id))] tests its result
+			return err == nil && len(lefts) == 1 && Truthy(lefts[0]), left, cty.NilVal, err
+		}
+		if literal, ok := literalValue(node.Left); ok {
+			// a lone literal like [?(0)] is a condition, as folded by
+			// foldFilter
+			return Truthy(literal), literal, cty.NilVal, nil
+		}
+		return len(lefts) > 0, left, cty.NilVal, nil
+	}
+	if err != nil {
+		return false, cty.NilVal, cty.NilVal, err
+	}
+	switch {
+	case len(lefts) == 0:
+		return false, cty.NilVal, cty.NilVal, nil
+	case len(lefts) > 1:
+		return false, cty.NilVal, cty.NilVal, newError(ErrUnsupported, "can only compare one element at a time")
+	}
+
+	rights, err := j.evalList(temp, node.Right)
+	if err != nil {
+		return false, cty.NilVal, cty.NilVal, err
+	}
+	switch {
+	case len(rights) == 0:
+		return false, cty.NilVal, cty.NilVal, nil
+	case len(rights) > 1:
+		return false, cty.NilVal, cty.NilVal, newError(ErrUnsupported, "can only compare one element at a time")
+	}
+
+	if !lefts[0].IsWhollyKnown() || !rights[0].IsWhollyKnown() {
+		// the outcome is unknown: leave elem out, but say so
+		j.unknown(elem)
+		return false, cty.NilVal, cty.NilVal, nil
+	}
+	pass, err = compareValues(node.Operator, j.number(lefts[0]), j.number(rights[0]))
+	return pass, lefts[0], rights[0], err
+}
+
+// filterMemo caches filter outcomes by element content within one
+// evaluation (see EvalOptions.MemoizeFilters). Hashes can collide, so each
+// bucket keeps the values it was computed for.
+type filterMemo map[filterMemoKey][]filterMemoEntry
+
+type filterMemoKey struct {
+	node *FilterNode
+	hash int
+}
+
+type filterMemoEntry struct {
+	value cty.Value
+	pass  bool
+	err   error
+}
+
+// memoFilterMatches is filterMatches going through j.memo when enabled.
+// Filters only depend on the element and the document root, which doesn't
+// change during an evaluation, so equal elements get equal outcomes.
+func (j *JSONPath) memoFilterMatches(elem cty.Value, node *FilterNode) (bool, error) {
+	unmarked, _ := elem.UnmarkDeep()
+	if !(j.opts.MemoizeFilters || j.memoSteps[node]) || !unmarked.IsWhollyKnown() || j.opts.traces != nil {
+		// unknown outcomes and traces are reported per element
+		return j.filterMatches(elem, node)
+	}
+	step := j.statStep(node)
+	if step != nil {
+		step.Lookups++
+	}
+	key := filterMemoKey{node, docHash(unmarked)}
+	for _, entry := range j.memo[key] {
+		if entry.value.RawEquals(unmarked) {
+			if step != nil {
+				step.Hits++
+			}
+			return entry.pass, entry.err
+		}
+	}
+	pass, err := j.filterMatches(elem, node)
+	if j.memo == nil {
+		j.memo = filterMemo{}
+	}
+	j.memo[key] = append(j.memo[key], filterMemoEntry{unmarked, pass, err})
+	return pass, err
+}
+
+// filterOperators are the comparisons compareValues implements, as listed
+// by Grammar.
+var filterOperators = []string{"==", "!=", "<", "<=", ">", ">="}
+
+// compareValues applies a filter operator to two values. Numbers and strings
+// are ordered, every other type only supports (in)equality: as in RFC 9535,
+// ordering values of different types, or of types without an order, is
+// false rather than an error.
+func compareValues(op string, left, right cty.Value) (bool, error) {
+	left, _ = left.UnmarkDeep()
+	right, _ = right.UnmarkDeep()
+
+	switch op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	}
+
+	if left.IsKnown() && right.IsKnown() && !ordered(left, right) {
+		return false, nil
+	}
+	cmp, err := orderValues(left, right)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, newError(ErrSyntax, "unrecognized filter operator %s", op)
+}
+
+func valuesEqual(left, right cty.Value) bool {
+	if !left.IsWhollyKnown() || !right.IsWhollyKnown() {
+		return false
+	}
+	if !left.Type().Equals(right.Type()) {
+		return false
+	}
+	return left.Equals(right).True()
+}
+
+// ordered reports whether left and right are both numbers or both strings.
+func ordered(left, right cty.Value) bool {
+	if left.IsNull() || right.IsNull() {
+		return false
+	}
+	ty := left.Type()
+	return ty.Equals(right.Type()) && (ty == cty.Number || ty == cty.String)
+}
+
+// orderValues returns -1, 0 or 1 like strings.Compare.
+func orderValues(left, right cty.Value) (int, error) {
+	if left.IsNull() || right.IsNull() || !left.IsKnown() || !right.IsKnown() {
+		return 0, newError(ErrTypeMismatch, "can't compare null or unknown values")
+	}
+	switch {
+	case left.Type() == cty.Number && right.Type() == cty.Number:
+		return left.AsBigFloat().Cmp(right.AsBigFloat()), nil
+	case left.Type() == cty.String && right.Type() == cty.String:
+		l, r := left.AsString(), right.AsString()
+		switch {
+		case l < r:
+			return -1, nil
+		case l > r:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, newError(ErrTypeMismatch, "can't compare %s with %s", left.Type().FriendlyName(), right.Type().FriendlyName())
+}
+
+// evalSortedFilter handles `[?(@.key == literal)]` on arrays declared sorted
+// by key through EvalOptions.SortedBy. ok is false when the fast path doesn't
+// apply and the caller should scan instead.
+func (j *JSONPath) evalSortedFilter(value cty.Value, node *FilterNode) (results []cty.Value, ok bool) {
+	if node.Operator != "==" || len(j.opts.SortedBy) == 0 || j.opts.traces != nil {
+		// traces are recorded by testing every element
+		return nil, false
+	}
+	path, found := valuePath(value)
+	if !found {
+		return nil, false
+	}
+	key, hinted := j.opts.sortedKey(path)
+	if !hinted {
+		return nil, false
+	}
+
+	left := flattenSteps(node.Left)
+	switch {
+	case key == "" && len(left) == 0:
+	case len(left) == 1:
+		field, isField := left[0].(*FieldNode)
+		if !isField || field.Value != key {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	target, isLiteral := literalValue(node.Right)
+	if !isLiteral {
+		return nil, false
+	}
+	target = j.number(target)
+
+	unmarked, _ := value.Unmark()
+	if unmarked.Type().IsSetType() {
+		return nil, false
+	}
+	elems := unmarked.AsValueSlice()
+	keyOf := func(i int) (cty.Value, bool) {
+		elem, _ := elems[i].UnmarkDeep()
+		if key == "" {
+			return j.number(elem), true
+		}
+		if elem.IsNull() || !elem.Type().IsObjectType() || !elem.Type().HasAttribute(key) {
+			return cty.NilVal, false
+		}
+		return j.number(elem.GetAttr(key)), true
+	}
+
+	var searchErr error
+	first := sort.Search(len(elems), func(i int) bool {
+		k, ok := keyOf(i)
+		if !ok {
+			searchErr = newError(ErrNotFound, "element %d has no sort key", i)
+			return true
+		}
+		cmp, err := orderValues(k, target)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return cmp >= 0
+	})
+	if searchErr != nil {
+		return nil, false
+	}
+
+	results = []cty.Value{}
+	for i := first; i < len(elems); i++ {
+		k, _ := keyOf(i)
+		if !valuesEqual(k, target) {
+			break
+		}
+		results = append(results, elems[i])
+	}
+	return results, true
+}
+
+// literalValue returns the constant a filter operand evaluates to, if it
+// consists of a single literal.
+func literalValue(list *ListNode) (cty.Value, bool) {
+	steps := flattenSteps(list)
+	if len(steps) != 1 {
+		return cty.NilVal, false
+	}
+	switch node := steps[0].(type) {
+	case *IntNode:
+		return cty.NumberIntVal(int64(node.Value)), true
+	case *FloatNode:
+		return cty.NumberFloatVal(node.Value), true
+	case *TextNode:
+		return cty.StringVal(node.Text), true
+	case *BoolNode:
+		return cty.BoolVal(node.Value), true
+	}
+	return cty.NilVal, false
+}
+
+// valuePath returns the document location of a value marked by Eval. Values
+// inherit the path marks of their containers, so the longest one is the
+// value's own, except for keys listed by entries(), which are found at their
+// object.
+func valuePath(value cty.Value) (cty.Path, bool) {
+	var out cty.Path
+	found := false
+	for mark := range value.Marks() {
+		if pr, ok := mark.(markPathRef); ok {
+			if pr.key {
+				return *pr.path, true
+			}
+			if !found || len(*pr.path) > len(out) {
+				out = *pr.path
+				found = true
+			}
+		}
+	}
+	return out, found
+}
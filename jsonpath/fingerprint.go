@@ -0,0 +1,123 @@
+package jsonpath
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Fingerprints returns a 64-bit FNV-1a hash of doc and of every value down
+// to depth levels below it, keyed by their paths as FormatPath renders
+// them: depth 0 only fingerprints the document itself. Comparing the
+// fingerprints of two documents tells which subtrees differ before running
+// a full Diff.
+//
+// Like the digests of HashByPath, fingerprints follow the JSON encoding:
+// marks are ignored, lists and tuples or objects and maps with the same
+// contents get the same fingerprint, and attribute order doesn't matter.
+// They are stable across processes and releases. Unknown values all share
+// one fingerprint, and elements of sets aren't fingerprinted on their own,
+// having no path.
+func Fingerprints(doc cty.Value, depth int) map[string]uint64 {
+	out := map[string]uint64{}
+	fingerprint(doc, cty.Path{}, depth, out)
+	return out
+}
+
+// Kinds of values, written before their contents so values of different
+// kinds never share an encoding.
+const (
+	fpNull byte = iota
+	fpUnknown
+	fpBool
+	fpNumber
+	fpString
+	fpArray
+	fpObject
+)
+
+// fingerprint hashes v bottom-up, containers from the fingerprints of their
+// children, and records the fingerprints of v and its children at most
+// depth levels below path.
+func fingerprint(v cty.Value, path cty.Path, depth int, out map[string]uint64) uint64 {
+	h := fnv.New64a()
+	v, _ = v.Unmark()
+	ty := v.Type()
+	record := depth >= 0 && out != nil
+	// child hashes a child at step, recording it while within depth
+	child := func(c cty.Value, step cty.PathStep) uint64 {
+		if !record || step == nil {
+			return fingerprint(c, nil, -1, nil)
+		}
+		return fingerprint(c, append(path[:len(path):len(path)], step), depth-1, out)
+	}
+	writeUint := func(n uint64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		h.Write(b[:])
+	}
+	writeString := func(s string) {
+		writeUint(uint64(len(s)))
+		h.Write([]byte(s))
+	}
+
+	switch {
+	case !v.IsKnown():
+		h.Write([]byte{fpUnknown})
+	case v.IsNull():
+		h.Write([]byte{fpNull})
+	case ty == cty.Bool:
+		h.Write([]byte{fpBool})
+		if v.True() {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	case ty == cty.Number:
+		h.Write([]byte{fpNumber})
+		writeString(v.AsBigFloat().Text('g', -1))
+	case ty == cty.String:
+		h.Write([]byte{fpString})
+		writeString(v.AsString())
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		h.Write([]byte{fpArray})
+		writeUint(uint64(v.LengthInt()))
+		i := 0
+		for it := v.ElementIterator(); it.Next(); i++ {
+			_, elem := it.Element()
+			var step cty.PathStep
+			if !ty.IsSetType() {
+				step = cty.IndexStep{Key: cty.NumberIntVal(int64(i))}
+			}
+			writeUint(child(elem, step))
+		}
+	case ty.IsObjectType() || ty.IsMapType():
+		h.Write([]byte{fpObject})
+		attrs := v.AsValueMap()
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeUint(uint64(len(keys)))
+		for _, k := range keys {
+			var step cty.PathStep = cty.GetAttrStep{Name: k}
+			if ty.IsMapType() {
+				step = cty.IndexStep{Key: cty.StringVal(k)}
+			}
+			writeString(k)
+			writeUint(child(attrs[k], step))
+		}
+	default:
+		// capsules have no JSON encoding; only their type is hashed
+		writeString(ty.FriendlyName())
+	}
+
+	sum := h.Sum64()
+	if record {
+		out[FormatPath(path)] = sum
+	}
+	return sum
+}
@@ -0,0 +1,154 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// String returns the parsed expression in canonical JSONPath syntax.
+func (j *JSONPath) String() string {
+	steps := j.steps()
+	if len(steps) > 0 && steps[0].Type() == NodeDoc {
+		return formatSteps(steps)
+	}
+	return "$" + formatSteps(steps)
+}
+
+// formatSteps renders a flat step sequence (see flattenSteps) back into
+// JSONPath syntax.
+func formatSteps(steps []Node) string {
+	var buf strings.Builder
+	afterRecursive := false
+	for _, node := range steps {
+		s := formatStep(node)
+		if afterRecursive && strings.HasPrefix(s, ".") && recursiveShorthand(s[1:]) {
+			s = s[1:]
+		}
+		buf.WriteString(s)
+		_, afterRecursive = node.(*RecursiveNode)
+	}
+	return buf.String()
+}
+
+// recursiveShorthand reports whether the step s, rendered without its
+// leading dot, can follow .. directly, as in $..name and $..*.
+func recursiveShorthand(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '*' || isAlphaNumeric(r)
+}
+
+// formatStep renders a single step.
+func formatStep(node Node) string {
+	switch node := node.(type) {
+	case *ListNode:
+		return formatSteps(flattenSteps(node))
+	case *FieldNode:
+		if isPlainKey(node.Value) {
+			return "." + node.Value
+		}
+		return "[" + quoteKey(node.Value) + "]"
+	case *ArrayNode:
+		return "[" + formatParams(node.Params) + "]"
+	case *WildcardNode:
+		return ".*"
+	case *RecursiveNode:
+		return ".."
+	case *UnionNode:
+		parts := []string{}
+		for _, branch := range node.Nodes {
+			parts = append(parts, formatUnionBranch(branch))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case *FilterNode:
+		if node.Operator == "exists" {
+			return "[?(" + formatOperand(node.Left) + ")]"
+		}
+		return fmt.Sprintf("[?(%s %s %s)]", formatOperand(node.Left), node.Operator, formatOperand(node.Right))
+	case *TextNode:
+		return quoteKey(node.Text)
+	case *IntNode:
+		return strconv.Itoa(node.Value)
+	case *FloatNode:
+		return strconv.FormatFloat(node.Value, 'g', -1, 64)
+	case *BoolNode:
+		return strconv.FormatBool(node.Value)
+	case *IdentifierNode:
+		return node.Name
+	case *RegexNode:
+		return "[/" + node.Regexp.String() + "/]"
+	case *DocNode:
+		return "$doc(" + quoteKey(node.Name) + ")"
+	case *FunctionNode:
+		if node.Property {
+			return formatOperand(node.Args[0]) + ".length"
+		}
+		args := []string{}
+		for _, arg := range node.Args {
+			args = append(args, formatOperand(arg))
+		}
+		if node.Method {
+			return "." + node.Name + "(" + strings.Join(args[1:], ", ") + ")"
+		}
+		return node.Name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return node.String()
+}
+
+func formatParams(params [3]ParamsEntry) string {
+	start, end, step := params[0], params[1], params[2]
+	if isSingleIndex(params) {
+		return strconv.Itoa(start.Value)
+	}
+	if isWildcardSlice(params) {
+		return "*"
+	}
+	out := ""
+	if start.Known {
+		out += strconv.Itoa(start.Value)
+	}
+	out += ":"
+	if end.Known {
+		out += strconv.Itoa(end.Value)
+	}
+	if step.Known {
+		out += ":" + strconv.Itoa(step.Value)
+	}
+	return out
+}
+
+// formatUnionBranch renders one selector of a union without its brackets.
+func formatUnionBranch(branch *ListNode) string {
+	steps := flattenSteps(branch)
+	if len(steps) == 1 {
+		switch node := steps[0].(type) {
+		case *ArrayNode:
+			return formatParams(node.Params)
+		case *FieldNode:
+			return quoteKey(node.Value)
+		}
+		// filters and regexes keep their own syntax inside the brackets
+		if s := formatStep(steps[0]); strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			return s[1 : len(s)-1]
+		}
+	}
+	return formatSteps(steps)
+}
+
+// formatOperand renders one side of a filter comparison.
+func formatOperand(list *ListNode) string {
+	if _, ok := literalValue(list); ok {
+		return formatSteps(flattenSteps(list))
+	}
+	steps := flattenSteps(list)
+	if len(steps) > 0 {
+		switch steps[0].Type() {
+		case NodeRoot:
+			return "$" + formatSteps(steps[1:])
+		case NodeFunction, NodeDoc:
+			return formatSteps(steps)
+		}
+	}
+	return "@" + formatSteps(steps)
+}
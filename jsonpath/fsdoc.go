@@ -0,0 +1,280 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// FSTree is a directory of JSON files read as one document by FromFS.
+type FSTree struct {
+	// Doc holds the decoded files, nested by directory and keyed by file
+	// name, so services/api.json is at $.services["api.json"].
+	Doc cty.Value
+	// files holds the decoded contents of each file by slash-separated
+	// name, as last read or written.
+	files map[string]cty.Value
+}
+
+// FromFS reads the JSON files of fsys matching glob (see fs.Glob) into a
+// single document, so a directory of configuration files can be queried as
+// one tree. Directories matching glob are skipped. opts are those of
+// DecodeJSONStrict; a file that doesn't decode fails the whole read, with
+// its name in the error.
+func FromFS(fsys fs.FS, glob string, opts ...Option) (*FSTree, error) {
+	names, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return nil, newError(ErrSyntax, "glob %q: %s", glob, err)
+	}
+	t := &FSTree{files: map[string]cty.Value{}}
+	for _, name := range names {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := DecodeJSONStrict(data, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		t.files[name] = v
+	}
+	t.Doc = t.tree()
+	return t, nil
+}
+
+// tree nests the files by directory.
+func (t *FSTree) tree() cty.Value {
+	root := map[string]interface{}{}
+	for name, v := range t.files {
+		dir := root
+		parts := strings.Split(name, "/")
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := dir[part].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+				dir[part] = sub
+			}
+			dir = sub
+		}
+		dir[parts[len(parts)-1]] = v
+	}
+	var build func(map[string]interface{}) cty.Value
+	build = func(dir map[string]interface{}) cty.Value {
+		attrs := make(map[string]cty.Value, len(dir))
+		for k, entry := range dir {
+			if sub, ok := entry.(map[string]interface{}); ok {
+				attrs[k] = build(sub)
+			} else {
+				attrs[k] = entry.(cty.Value)
+			}
+		}
+		return cty.ObjectVal(attrs)
+	}
+	return build(root)
+}
+
+// filePath returns the location of the named file in Doc.
+func filePath(name string) cty.Path {
+	path := cty.Path{}
+	for _, part := range strings.Split(name, "/") {
+		path = path.GetAttr(part)
+	}
+	return path
+}
+
+// WritableFS is a file system FSTree.WriteBack can write files to. Names
+// are slash-separated, as with fs.FS.
+type WritableFS interface {
+	fs.FS
+	// WriteFile replaces or creates the named file, creating missing
+	// directories.
+	WriteFile(name string, data []byte) error
+	// Remove deletes the named file. Removing a missing file isn't an
+	// error.
+	Remove(name string) error
+}
+
+// DirFS returns a WritableFS for the files under dir, reading like
+// os.DirFS and replacing files atomically.
+func DirFS(dir string) WritableFS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d dirFS) WriteFile(name string, data []byte) error {
+	path := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (d dirFS) Remove(name string) error {
+	err := os.Remove(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// WriteBack applies changes, e.g. from Diff or a dry run, to Doc and
+// writes the files they touch to fsys, leaving the others alone. A change
+// inside a file rewrites it, one removing a file or a directory removes
+// the files, and one adding a value to a directory creates a file of that
+// name. Files are written as JSON with sorted keys and two-space
+// indentation, so unchanged contents give the same bytes. It returns the
+// names of the files written or removed, sorted, and makes the result the
+// new Doc. A change that doesn't fall within a file or directory fails with
+// ErrUnsupported before anything is written.
+func (t *FSTree) WriteBack(fsys WritableFS, changes []Change) ([]string, error) {
+	affected := map[string]bool{}
+	for _, c := range changes {
+		for _, path := range []cty.Path{c.Path, c.From} {
+			if path == nil {
+				continue
+			}
+			names, err := t.owners(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				affected[name] = true
+			}
+		}
+	}
+	patch, err := MarshalPatch(changes)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ApplyPatch(t.Doc, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(affected))
+	for name := range affected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	written := []string{}
+	for _, name := range names {
+		v, err := applyPath(doc, filePath(name))
+		if errors.Is(err, ErrNotFound) {
+			if _, ok := t.files[name]; ok {
+				if err := fsys.Remove(name); err != nil {
+					return written, err
+				}
+				delete(t.files, name)
+				written = append(written, name)
+			}
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		v, _ = v.UnmarkDeep()
+		if old, ok := t.files[name]; ok && v.RawEquals(old) {
+			continue
+		}
+		data, err := encodeFile(name, v)
+		if err != nil {
+			return written, err
+		}
+		if err := fsys.WriteFile(name, data); err != nil {
+			return written, err
+		}
+		t.files[name] = v
+		written = append(written, name)
+	}
+	t.Doc = doc
+	return written, nil
+}
+
+// owners returns the names of the files path falls within, or of the
+// files below it if it locates a directory, or the name of the file it
+// creates if it is a new entry of a directory.
+func (t *FSTree) owners(path cty.Path) ([]string, error) {
+	parts := make([]string, len(path))
+	for i, step := range path {
+		key := stepKey(step)
+		if key == cty.NilVal || key.Type() != cty.String {
+			return nil, newPathError(path[:i+1], ErrUnsupported, "not a file or directory name")
+		}
+		parts[i] = key.AsString()
+		if _, ok := t.files[strings.Join(parts[:i+1], "/")]; ok {
+			return []string{strings.Join(parts[:i+1], "/")}, nil
+		}
+	}
+	name := strings.Join(parts, "/")
+	below := []string{}
+	for file := range t.files {
+		if name == "" || strings.HasPrefix(file, name+"/") {
+			below = append(below, file)
+		}
+	}
+	if len(below) > 0 {
+		return below, nil
+	}
+	if len(path) > 0 && t.isDir(strings.Join(parts[:len(parts)-1], "/")) {
+		return []string{name}, nil
+	}
+	return nil, newPathError(path, ErrUnsupported, "no file or directory holds this path")
+}
+
+// isDir reports whether dir holds files, the root always does.
+func (t *FSTree) isDir(dir string) bool {
+	if dir == "" {
+		return true
+	}
+	for file := range t.files {
+		if strings.HasPrefix(file, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeFile renders the contents of the named file.
+func encodeFile(name string, v cty.Value) ([]byte, error) {
+	data, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return nil, newError(ErrUnsupported, "file %q: %s", name, err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// WriteDir writes the differences between Doc and doc, an edited copy of
+// it, to the directory dir holding the files read by FromFS, like
+// WriteBack with DirFS(dir).
+func (t *FSTree) WriteDir(dir string, doc cty.Value) ([]string, error) {
+	changes, err := Diff(t.Doc, doc, DiffOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return t.WriteBack(DirFS(dir), changes)
+}
@@ -0,0 +1,385 @@
+package jsonpath
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// filterFunc is a function callable from filter expressions.
+type filterFunc struct {
+	params int
+	impl   func(args []cty.Value) (cty.Value, error)
+	// optIn functions must be enabled through
+	// CompileOptions.EnableFunctions.
+	optIn bool
+	// check, when set, validates the arguments at compile time, e.g. to
+	// reject malformed literals early.
+	check func(args []*ListNode) error
+	// marked functions get their arguments with marks, and return
+	// containers whose elements keep them, so the elements selected
+	// afterwards keep their paths, as with flatten.
+	marked bool
+	// perElement functions get the arguments after the first evaluated
+	// against each element of the first, as tuples of the results, with
+	// null where an argument matches nothing: for $.items.group_by(@.region)
+	// the regions of the items.
+	perElement bool
+}
+
+// functions holds the functions filters may call, by name. It's fixed at
+// init and only ever read afterwards, so compiling and evaluating
+// expressions concurrently needs no locking; per-expression choices, such
+// as opt-in functions, live in CompileOptions instead. The optional
+// functions add themselves from the files the jsonpath_minimal build tag
+// leaves out.
+var functions = map[string]filterFunc{
+	"length": {params: 1, impl: lengthOf},
+	"split":  {params: 2, impl: splitString},
+
+	"flatten":      {params: 1, impl: flatten, marked: true},
+	"chunks":       {params: 2, impl: chunks, marked: true},
+	"reverse":      {params: 1, impl: reverse, marked: true},
+	"entries":      {params: 1, impl: entries, marked: true},
+	"from_entries": {params: 1, impl: fromEntries, marked: true},
+	"group_by":     {params: 2, impl: groupBy, marked: true, perElement: true},
+
+	"sha256": digestFunc(sha256.New),
+	"md5":    digestFunc(md5.New),
+
+	"sum": aggregateFunc("sum"),
+	"avg": aggregateFunc("avg"),
+	"min": aggregateFunc("min"),
+	"max": aggregateFunc("max"),
+}
+
+// isPredicateCall reports whether a filter operand is a single function
+// call, whose boolean result decides the filter on its own.
+func isPredicateCall(operand *ListNode) bool {
+	steps := flattenSteps(operand)
+	return len(steps) == 1 && steps[0].Type() == NodeFunction
+}
+
+// evalFunction calls node's function once per input value, with the
+// arguments evaluated relative to that value. Inputs for which an argument
+// matches nothing produce no result.
+func (j *JSONPath) evalFunction(input []cty.Value, node *FunctionNode) ([]cty.Value, error) {
+	fn := functions[node.Name]
+	results := []cty.Value{}
+Inputs:
+	for _, value := range input {
+		args := make([]cty.Value, len(node.Args))
+		for i, arg := range node.Args {
+			if fn.perElement && i > 0 {
+				var err error
+				if args[i], err = j.evalPerElement(args[0], arg); err != nil {
+					return input, err
+				}
+				continue
+			}
+			vals, err := j.evalList([]cty.Value{value}, arg)
+			if err != nil {
+				return input, err
+			}
+			switch {
+			case len(vals) == 0:
+				continue Inputs
+			case len(vals) > 1:
+				return input, newError(ErrUnsupported, "argument %d of %s matches %d values, expected one", i+1, node.Name, len(vals))
+			}
+			args[i], _ = vals[0].UnmarkDeep()
+			if !args[i].IsKnown() {
+				j.unknown(value)
+				continue Inputs
+			}
+			if fn.marked {
+				args[i] = vals[0]
+			}
+		}
+		if node.Property {
+			// as a property, length reads like a field: a "length" key
+			// wins and values without a length don't match
+			if v, ok := lengthKey(args[0]); ok {
+				results = append(results, v)
+				continue
+			}
+			if result, err := fn.impl(args); err == nil {
+				results = append(results, result)
+			}
+			continue
+		}
+		result, err := fn.impl(args)
+		if err != nil {
+			return input, err
+		}
+		switch {
+		case node.Method && fn.marked:
+			// the elements have paths of their own
+			result = result.WithMarks(derivedMarks(value))
+		case node.Method:
+			result = derivedValue(value, result)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// evalPerElement evaluates arg against each element of array, for
+// perElement functions.
+func (j *JSONPath) evalPerElement(array cty.Value, arg *ListNode) (cty.Value, error) {
+	unmarked, _ := array.Unmark()
+	if !isArray(unmarked.Type()) || unmarked.IsNull() {
+		// left for the function to reject
+		return cty.EmptyTupleVal, nil
+	}
+	out := []cty.Value{}
+	for it := unmarked.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		vals, err := j.evalList([]cty.Value{elem}, arg)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		switch {
+		case len(vals) == 0:
+			out = append(out, cty.NullVal(cty.DynamicPseudoType))
+			continue
+		case len(vals) > 1:
+			return cty.NilVal, newError(ErrUnsupported, "%s matches %d values on an element, expected one", formatOperand(arg), len(vals))
+		}
+		v, _ := vals[0].UnmarkDeep()
+		if !v.IsWhollyKnown() {
+			j.unknown(elem)
+			v = cty.NullVal(cty.DynamicPseudoType)
+		}
+		out = append(out, v)
+	}
+	return cty.TupleVal(out), nil
+}
+
+// lengthKey returns the "length" attribute or key of an object or map.
+func lengthKey(v cty.Value) (cty.Value, bool) {
+	if v.IsNull() || !v.IsKnown() {
+		return cty.NilVal, false
+	}
+	ty := v.Type()
+	switch {
+	case ty.IsObjectType() && ty.HasAttribute("length"):
+		return v.GetAttr("length"), true
+	case ty.IsMapType() && v.HasIndex(cty.StringVal("length")).True():
+		return v.Index(cty.StringVal("length")), true
+	}
+	return cty.NilVal, false
+}
+
+// lengthOf returns the number of characters of a string, elements of a
+// collection or attributes of an object.
+func lengthOf(args []cty.Value) (cty.Value, error) {
+	v := args[0]
+	if v.IsNull() || !v.IsKnown() {
+		return cty.NilVal, newError(ErrTypeMismatch, "can't take the length of a null or unknown value")
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return cty.NumberIntVal(int64(utf8.RuneCountInString(v.AsString()))), nil
+	case ty.IsObjectType():
+		return cty.NumberIntVal(int64(len(ty.AttributeTypes()))), nil
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType() || ty.IsMapType():
+		return cty.NumberIntVal(int64(v.LengthInt())), nil
+	}
+	return cty.NilVal, newError(ErrTypeMismatch, "%s has no length", ty.FriendlyName())
+}
+
+// splitString splits a string around a separator into a tuple of strings,
+// e.g. for selecting a field of a CSV value: $.csv.split(',')[2].
+func splitString(args []cty.Value) (cty.Value, error) {
+	s, err := stringArg("split", args[0])
+	if err != nil {
+		return cty.NilVal, err
+	}
+	sep, err := stringArg("split", args[1])
+	if err != nil {
+		return cty.NilVal, err
+	}
+	parts := strings.Split(s, sep)
+	elems := make([]cty.Value, len(parts))
+	for i, part := range parts {
+		elems[i] = cty.StringVal(part)
+	}
+	return cty.TupleVal(elems), nil
+}
+
+// flatten collapses an array of arrays one level, e.g. [[1,2],[3],4] into
+// [1,2,3,4], keeping the marks of the elements.
+func flatten(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isArray(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "flatten takes an array, got %s", v.Type().FriendlyName())
+	}
+	elems := []cty.Value{}
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		inner, _ := elem.Unmark()
+		if !isArray(inner.Type()) || inner.IsNull() || !inner.IsKnown() {
+			elems = append(elems, elem)
+			continue
+		}
+		for it := inner.ElementIterator(); it.Next(); {
+			_, child := it.Element()
+			elems = append(elems, child)
+		}
+	}
+	return cty.TupleVal(elems), nil
+}
+
+// chunks splits an array into tuples of at most n elements, for processing
+// large arrays in batches: $.items.chunks(100). The elements keep their
+// marks, and the chunks are found at the path of the array.
+func chunks(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isArray(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "chunks takes an array, got %s", v.Type().FriendlyName())
+	}
+	size, _ := args[1].UnmarkDeep()
+	n, ok := intArg(size)
+	if !ok || n <= 0 {
+		return cty.NilVal, newError(ErrTypeMismatch, "chunk size must be a positive whole number")
+	}
+	marks := derivedMarks(args[0])
+	out := []cty.Value{}
+	chunk := []cty.Value{}
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		chunk = append(chunk, elem)
+		if len(chunk) == n {
+			out = append(out, cty.TupleVal(chunk).WithMarks(marks))
+			chunk = []cty.Value{}
+		}
+	}
+	if len(chunk) > 0 {
+		out = append(out, cty.TupleVal(chunk).WithMarks(marks))
+	}
+	return cty.TupleVal(out), nil
+}
+
+// intArg returns v as an int if it's a whole number.
+func intArg(v cty.Value) (int, bool) {
+	if v.IsNull() || !v.IsKnown() || !v.Type().Equals(cty.Number) {
+		return 0, false
+	}
+	f := v.AsBigFloat()
+	if !f.IsInt() {
+		return 0, false
+	}
+	i, acc := f.Int64()
+	return int(i), acc == big.Exact
+}
+
+// reverse returns the elements of an array in reverse order, keeping their
+// marks: $.events.reverse()[:10] selects the last ten events, latest first.
+func reverse(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isArray(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "reverse takes an array, got %s", v.Type().FriendlyName())
+	}
+	elems := v.AsValueSlice()
+	out := make([]cty.Value, len(elems))
+	for i, elem := range elems {
+		out[len(elems)-1-i] = elem
+	}
+	return cty.TupleVal(out), nil
+}
+
+// entries turns an object or map into a tuple of {key, value} objects, in
+// key order, so filters can test keys:
+// $.labels.entries()[?(@.key == 'app')].value. Each entry is found at the
+// path of its value, and its key, which has no path of its own, at the path
+// of the object.
+func entries(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isMapping(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "entries takes an object or map, got %s", v.Type().FriendlyName())
+	}
+	keyMarks := derivedMarks(args[0])
+	if path, ok := valuePath(args[0]); ok {
+		keyMarks[markPathRef{path: &path, derived: true, key: true}] = struct{}{}
+	}
+	out := []cty.Value{}
+	for it := v.ElementIterator(); it.Next(); {
+		key, _ := it.Element()
+		value := getByIter(v, it)
+		marks := derivedMarks(value)
+		out = append(out, cty.ObjectVal(map[string]cty.Value{
+			"key":   key.WithMarks(keyMarks),
+			"value": value,
+		}).WithMarks(marks))
+	}
+	return cty.TupleVal(out), nil
+}
+
+// fromEntries is the inverse of entries, turning an array of {key, value}
+// objects into an object. A key given twice takes the last value.
+func fromEntries(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isArray(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "from_entries takes an array, got %s", v.Type().FriendlyName())
+	}
+	attrs := map[string]cty.Value{}
+	for it := v.ElementIterator(); it.Next(); {
+		_, entry := it.Element()
+		unmarked, _ := entry.Unmark()
+		ty := unmarked.Type()
+		if unmarked.IsNull() || !ty.IsObjectType() || !ty.HasAttribute("key") || !ty.HasAttribute("value") {
+			return cty.NilVal, newError(ErrTypeMismatch, "from_entries takes {key, value} objects, got %s", ty.FriendlyName())
+		}
+		key, _ := unmarked.GetAttr("key").UnmarkDeep()
+		if key.IsNull() || !key.IsKnown() || !key.Type().Equals(cty.String) {
+			return cty.NilVal, newError(ErrTypeMismatch, "entry keys must be strings, got %s", friendlyValue(key))
+		}
+		attrs[key.AsString()] = unmarked.GetAttr("value")
+	}
+	return cty.ObjectVal(attrs), nil
+}
+
+// groupBy groups the elements of an array by a key computed from each,
+// into an object of arrays: $.servers.group_by(@.region). Keys are strings,
+// numbers or booleans, used as strings; elements without a key are left
+// out. The elements keep their marks, and the groups are found at the path
+// of the array.
+func groupBy(args []cty.Value) (cty.Value, error) {
+	v, _ := args[0].Unmark()
+	if !isArray(v.Type()) || v.IsNull() {
+		return cty.NilVal, newError(ErrTypeMismatch, "group_by takes an array, got %s", v.Type().FriendlyName())
+	}
+	keys := args[1].AsValueSlice()
+	groups := map[string][]cty.Value{}
+	for i, elem := range v.AsValueSlice() {
+		key := keys[i]
+		if key.IsNull() {
+			continue
+		}
+		if !key.Type().IsPrimitiveType() {
+			return cty.NilVal, newError(ErrTypeMismatch, "group_by keys must be strings, numbers or booleans, got %s", key.Type().FriendlyName())
+		}
+		key, _ = convert.Convert(key, cty.String)
+		groups[key.AsString()] = append(groups[key.AsString()], elem)
+	}
+	marks := derivedMarks(args[0])
+	attrs := make(map[string]cty.Value, len(groups))
+	for key, elems := range groups {
+		attrs[key] = cty.TupleVal(elems).WithMarks(marks)
+	}
+	return cty.ObjectVal(attrs), nil
+}
+
+func stringArg(name string, v cty.Value) (string, error) {
+	if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return "", newError(ErrTypeMismatch, "%s takes a string, got %s", name, v.Type().FriendlyName())
+	}
+	return v.AsString(), nil
+}
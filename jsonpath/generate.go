@@ -0,0 +1,242 @@
+package jsonpath
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// GenerateOptions tweaks GenerateValue. Zero fields take their defaults.
+type GenerateOptions struct {
+	// MaxElements bounds the number of elements of lists, sets, maps and
+	// dynamic objects and tuples. Defaults to 4.
+	MaxElements int
+	// MaxStringLength bounds the length in runes of strings and map keys.
+	// Defaults to 8.
+	MaxStringLength int
+	// MaxDepth bounds the nesting of the values generated for
+	// cty.DynamicPseudoType. Defaults to 3.
+	MaxDepth int
+	// Nulls makes any value, not only optional attributes, null now and
+	// then.
+	Nulls bool
+}
+
+// generateRunes mixes plain letters with characters that need quoting in
+// expressions, so generated keys exercise the parser as well.
+var generateRunes = []rune("abcxyz019._-'\"\\[]()*,$@ ?=ü")
+
+// GenerateValue returns a random value conforming to t, the same for the
+// same seed. Optional attributes are sometimes null, and
+// cty.DynamicPseudoType stands for any JSON-like value: objects, tuples,
+// strings, numbers, bools and nulls. Capsule types can't be generated and
+// give a null value.
+//
+// It's meant for property tests of queries against the documents of a
+// schema:
+//
+//	for seed := int64(0); seed < 100; seed++ {
+//		doc := jsonpath.GenerateValue(schema, seed, jsonpath.GenerateOptions{})
+//		...
+//	}
+func GenerateValue(t cty.Type, seed int64, opts GenerateOptions) cty.Value {
+	if opts.MaxElements <= 0 {
+		opts.MaxElements = 4
+	}
+	if opts.MaxStringLength <= 0 {
+		opts.MaxStringLength = 8
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = 3
+	}
+	g := generator{rnd: rand.New(rand.NewSource(seed)), opts: opts}
+	return g.value(t, 0)
+}
+
+type generator struct {
+	rnd  *rand.Rand
+	opts GenerateOptions
+}
+
+func (g *generator) value(t cty.Type, depth int) cty.Value {
+	if g.opts.Nulls && g.rnd.Intn(8) == 0 {
+		return cty.NullVal(t)
+	}
+	switch {
+	case t == cty.DynamicPseudoType:
+		return g.dynamic(depth)
+	case t == cty.Bool:
+		return cty.BoolVal(g.rnd.Intn(2) == 0)
+	case t == cty.Number:
+		return g.number()
+	case t == cty.String:
+		return cty.StringVal(g.string())
+	case t.IsListType():
+		ety, elems := g.elems(t.ElementType(), depth)
+		if len(elems) == 0 {
+			return cty.ListValEmpty(ety)
+		}
+		return cty.ListVal(elems)
+	case t.IsSetType():
+		// cty sets can hold nulls, but few operations on them cope
+		nulls := g.opts.Nulls
+		g.opts.Nulls = false
+		ety, elems := g.elems(t.ElementType(), depth)
+		g.opts.Nulls = nulls
+		if len(elems) == 0 {
+			return cty.SetValEmpty(ety)
+		}
+		return cty.SetVal(elems)
+	case t.IsMapType():
+		ety := g.concrete(t.ElementType())
+		n := g.rnd.Intn(g.opts.MaxElements + 1)
+		if n == 0 {
+			return cty.MapValEmpty(ety)
+		}
+		elems := make(map[string]cty.Value, n)
+		for i := 0; i < n; i++ {
+			elems[g.string()] = g.value(ety, depth+1)
+		}
+		return cty.MapVal(elems)
+	case t.IsTupleType():
+		types := t.TupleElementTypes()
+		if len(types) == 0 {
+			return cty.EmptyTupleVal
+		}
+		elems := make([]cty.Value, len(types))
+		for i, ety := range types {
+			elems[i] = g.value(ety, depth+1)
+		}
+		return cty.TupleVal(elems)
+	case t.IsObjectType():
+		names := sortedAttrs(t)
+		if len(names) == 0 {
+			return cty.EmptyObjectVal
+		}
+		attrs := make(map[string]cty.Value, len(names))
+		for _, name := range names {
+			aty := t.AttributeType(name)
+			if t.AttributeOptional(name) && g.rnd.Intn(4) == 0 {
+				attrs[name] = cty.NullVal(aty)
+				continue
+			}
+			attrs[name] = g.value(aty, depth+1)
+		}
+		return cty.ObjectVal(attrs)
+	}
+	return cty.NullVal(t)
+}
+
+// elems generates the elements of a list or set, along with their type.
+func (g *generator) elems(ety cty.Type, depth int) (cty.Type, []cty.Value) {
+	ety = g.concrete(ety)
+	elems := make([]cty.Value, g.rnd.Intn(g.opts.MaxElements+1))
+	for i := range elems {
+		elems[i] = g.value(ety, depth+1)
+	}
+	return ety, elems
+}
+
+// concrete replaces the cty.DynamicPseudoType within t by primitive types,
+// since the elements of a collection must share their type.
+func (g *generator) concrete(t cty.Type) cty.Type {
+	switch {
+	case t == cty.DynamicPseudoType:
+		return []cty.Type{cty.Bool, cty.Number, cty.String}[g.rnd.Intn(3)]
+	case !t.HasDynamicTypes():
+		return t
+	case t.IsListType():
+		return cty.List(g.concrete(t.ElementType()))
+	case t.IsSetType():
+		return cty.Set(g.concrete(t.ElementType()))
+	case t.IsMapType():
+		return cty.Map(g.concrete(t.ElementType()))
+	case t.IsTupleType():
+		types := t.TupleElementTypes()
+		out := make([]cty.Type, len(types))
+		for i, ety := range types {
+			out[i] = g.concrete(ety)
+		}
+		return cty.Tuple(out)
+	case t.IsObjectType():
+		out := map[string]cty.Type{}
+		optional := []string{}
+		for _, name := range sortedAttrs(t) {
+			out[name] = g.concrete(t.AttributeType(name))
+			if t.AttributeOptional(name) {
+				optional = append(optional, name)
+			}
+		}
+		return cty.ObjectWithOptionalAttrs(out, optional)
+	}
+	return t
+}
+
+// sortedAttrs returns the attribute names of the object type t in order,
+// so generation doesn't depend on map iteration.
+func sortedAttrs(t cty.Type) []string {
+	names := make([]string, 0, len(t.AttributeTypes()))
+	for name := range t.AttributeTypes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *generator) number() cty.Value {
+	switch g.rnd.Intn(4) {
+	case 0:
+		return cty.NumberIntVal(int64(g.rnd.Intn(201) - 100))
+	case 1:
+		return cty.NumberFloatVal(float64(g.rnd.Intn(20001)-10000) / 100)
+	case 2:
+		return cty.NumberIntVal(g.rnd.Int63() - g.rnd.Int63())
+	}
+	return cty.NumberIntVal(int64(g.rnd.Intn(10)))
+}
+
+func (g *generator) string() string {
+	s := make([]rune, g.rnd.Intn(g.opts.MaxStringLength+1))
+	for i := range s {
+		s[i] = generateRunes[g.rnd.Intn(len(generateRunes))]
+	}
+	return string(s)
+}
+
+// dynamic generates a JSON-like value, nesting at most MaxDepth levels.
+func (g *generator) dynamic(depth int) cty.Value {
+	kinds := 6
+	if depth >= g.opts.MaxDepth {
+		kinds = 4
+	}
+	switch g.rnd.Intn(kinds) {
+	case 0:
+		return cty.NullVal(cty.DynamicPseudoType)
+	case 1:
+		return cty.BoolVal(g.rnd.Intn(2) == 0)
+	case 2:
+		return g.number()
+	case 3:
+		return cty.StringVal(g.string())
+	case 4:
+		n := g.rnd.Intn(g.opts.MaxElements + 1)
+		if n == 0 {
+			return cty.EmptyTupleVal
+		}
+		elems := make([]cty.Value, n)
+		for i := range elems {
+			elems[i] = g.value(cty.DynamicPseudoType, depth+1)
+		}
+		return cty.TupleVal(elems)
+	}
+	n := g.rnd.Intn(g.opts.MaxElements + 1)
+	if n == 0 {
+		return cty.EmptyObjectVal
+	}
+	attrs := make(map[string]cty.Value, n)
+	for i := 0; i < n; i++ {
+		attrs[g.string()] = g.value(cty.DynamicPseudoType, depth+1)
+	}
+	return cty.ObjectVal(attrs)
+}
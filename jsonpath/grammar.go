@@ -0,0 +1,111 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// grammar is the JSON document returned by Grammar.
+type grammar struct {
+	Version int `json:"version"`
+	// EBNF is Rules as one text, in ISO 14977 style.
+	EBNF  string        `json:"ebnf"`
+	Rules []grammarRule `json:"rules"`
+
+	Operators     []string          `json:"operators"`
+	Functions     []grammarFunction `json:"functions"`
+	IndexKeywords []string          `json:"indexKeywords"`
+	Features      []Feature         `json:"features"`
+	Dialects      []string          `json:"dialects"`
+}
+
+type grammarRule struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+type grammarFunction struct {
+	Name   string `json:"name"`
+	Params int    `json:"params"`
+	// OptIn functions must be enabled with CompileOptions.EnableFunctions.
+	OptIn bool `json:"optIn,omitempty"`
+}
+
+// Grammar describes the syntax the parser accepts as JSON, for editors and
+// validators to stay in sync with it: the GrammarVersion, EBNF rules (also
+// as one text), and the filter operators, functions, index keywords,
+// features and dialects, taken from the tables the parser and evaluator
+// use. The output is stable for a given version of the package.
+func Grammar() []byte {
+	g := grammar{
+		Version:   GrammarVersion,
+		Operators: append([]string(nil), filterOperators...),
+		Features:  SupportedFeatures(),
+	}
+	for name, fn := range functions {
+		g.Functions = append(g.Functions, grammarFunction{Name: name, Params: fn.params, OptIn: fn.optIn})
+	}
+	sort.Slice(g.Functions, func(a, b int) bool { return g.Functions[a].Name < g.Functions[b].Name })
+	for keyword := range indexKeywords {
+		g.IndexKeywords = append(g.IndexKeywords, keyword)
+	}
+	sort.Strings(g.IndexKeywords)
+	for d := DialectDefault; d <= DialectJSONPathPlus; d++ {
+		g.Dialects = append(g.Dialects, d.String())
+	}
+
+	g.Rules = grammarRules(g)
+	var ebnf strings.Builder
+	for _, rule := range g.Rules {
+		ebnf.WriteString(rule.Name + " = " + rule.Definition + " ;\n")
+	}
+	g.EBNF = ebnf.String()
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		// only plain strings and numbers go in
+		panic(err)
+	}
+	return out.Bytes()
+}
+
+func grammarRules(g grammar) []grammarRule {
+	terminals := func(words []string) string {
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = strconv.Quote(w)
+		}
+		return strings.Join(quoted, " | ")
+	}
+	names := make([]string, len(g.Functions))
+	for i, fn := range g.Functions {
+		names[i] = fn.Name
+	}
+	return []grammarRule{
+		{"query", `( "$" | document ) , { segment }`},
+		{"document", `"$doc(" , string , ")"`},
+		{"segment", `child | descendant`},
+		{"child", `"." , ( name | "*" | method ) | bracket`},
+		{"descendant", `".." , ( name | "*" | bracket )`},
+		{"method", `function , "(" , [ operand , { "," , operand } ] , ")" | keyword , "()"`},
+		{"bracket", `"[" , selector , { "," , selector } , "]" | filter | regex`},
+		{"selector", `string | integer | slice | "*" | keyword`},
+		{"slice", `[ integer ] , ":" , [ integer ] , [ ":" , [ integer ] ]`},
+		{"keyword", terminals(g.IndexKeywords)},
+		{"filter", `"[?(" , ( operand | operand , operator , operand ) , ")]"`},
+		{"operator", terminals(g.Operators)},
+		{"operand", `( "@" | "$" | document ) , { segment } , [ ".length" ] | call | literal`},
+		{"call", `function , "(" , [ operand , { "," , operand } ] , ")"`},
+		{"function", terminals(names)},
+		{"literal", `string | number | "true" | "false"`},
+		{"regex", `"[/" , pattern , "/]"`},
+		{"name", `letter , { letter | digit | "_" | "-" | "/" }`},
+		{"string", `"'" , { character } , "'" | '"' , { character } , '"'`},
+	}
+}
@@ -0,0 +1,53 @@
+package jsonpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// canonicalJSON encodes v as JSON with object keys in sorted order, so equal
+// values always produce the same bytes.
+func canonicalJSON(v cty.Value) ([]byte, error) {
+	v, _ = v.UnmarkDeep()
+	if !v.IsWhollyKnown() {
+		return nil, newError(ErrTypeMismatch, "can't hash a value that isn't wholly known")
+	}
+	return ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+}
+
+func digest(newHash func() hash.Hash, v cty.Value) (string, error) {
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return "", err
+	}
+	h := newHash()
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestFunc adapts a hash to a filter function returning the hex digest of
+// the canonical JSON of its argument.
+func digestFunc(newHash func() hash.Hash) filterFunc {
+	return filterFunc{params: 1, impl: func(args []cty.Value) (cty.Value, error) {
+		sum, err := digest(newHash, args[0])
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return cty.StringVal(sum), nil
+	}}
+}
+
+// HashByPath returns the hex SHA-256 digest of the canonical JSON of the
+// single value matched by jsonPath, the same as sha256(@) in a filter. It
+// is meant for change detection and cache keys on document fragments.
+func HashByPath(doc cty.Value, jsonPath string) (string, error) {
+	v, err := getOne(doc, jsonPath)
+	if err != nil {
+		return "", err
+	}
+	return digest(sha256.New, v)
+}
@@ -0,0 +1,106 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Revision is a snapshot kept in a Document's history.
+type Revision struct {
+	Value cty.Value
+	// Patch is the JSON Patch turning the previous revision into this one,
+	// nil for the oldest revision kept.
+	Patch []byte
+}
+
+// KeepHistory makes the document remember up to n snapshots preceding the
+// current one, for History, At and Undo. Zero, the default, disables the
+// history; lowering n drops the oldest snapshots. Snapshots are immutable,
+// so keeping them costs no copies.
+func (d *Document) KeepHistory(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.historyLimit = n
+	d.trimHistory()
+}
+
+// record remembers a replaced snapshot. Must be called with d.mu held.
+func (d *Document) record(old cty.Value) {
+	if d.historyLimit <= 0 {
+		return
+	}
+	d.history = append(d.history, old)
+	d.trimHistory()
+}
+
+func (d *Document) trimHistory() {
+	if n := len(d.history) - d.historyLimit; n > 0 {
+		d.history = append([]cty.Value(nil), d.history[n:]...)
+	}
+}
+
+// History returns the kept snapshots followed by the current one, oldest
+// first, with the patches between them.
+func (d *Document) History() ([]Revision, error) {
+	d.mu.Lock()
+	values := append(append([]cty.Value(nil), d.history...), d.value)
+	d.mu.Unlock()
+
+	revs := make([]Revision, len(values))
+	for i, v := range values {
+		revs[i].Value = v
+		if i == 0 {
+			continue
+		}
+		changes, err := Diff(values[i-1], v, DiffOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if revs[i].Patch, err = MarshalPatch(changes); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+// At returns the snapshot n writes back: At(0) is the current one, At(1)
+// the one before the last write, and so on.
+func (d *Document) At(n int) (cty.Value, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case n == 0:
+		return d.value, nil
+	case n < 0 || n > len(d.history):
+		return cty.NilVal, newError(ErrIndexOutOfBounds, "%d revisions kept, can't go back %d", len(d.history), n)
+	}
+	return d.history[len(d.history)-n], nil
+}
+
+// Undo reverts the last write, restoring the previous snapshot, and
+// notifies the subscribers affected. The undone snapshot is forgotten. It
+// fails with ErrNotFound when the history is empty.
+func (d *Document) Undo() error {
+	d.mu.Lock()
+	if len(d.history) == 0 {
+		d.mu.Unlock()
+		return newError(ErrNotFound, "nothing to undo")
+	}
+	prev := d.history[len(d.history)-1]
+	changes, err := Diff(d.value, prev, DiffOptions{})
+	if err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	changed := []cty.Path{}
+	for _, c := range changes {
+		changed = append(changed, c.Path)
+	}
+	d.history = d.history[:len(d.history)-1]
+	d.dropSnapshot()
+	d.value = prev
+	notify := d.affected(changed)
+	d.mu.Unlock()
+
+	d.publish(notify, prev)
+	return nil
+}
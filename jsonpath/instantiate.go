@@ -0,0 +1,98 @@
+package jsonpath
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// InstantiateOptions tweaks Instantiate.
+type InstantiateOptions struct {
+	// Create allows paths missing from the template; their parents are
+	// created like Set does. By default a missing path is an error.
+	Create bool
+	// DryRun, when set, makes Instantiate check and apply the values as
+	// usual but return the template unchanged, storing the changes it
+	// would make here, like WithDryRun.
+	DryRun *[]Change
+}
+
+// Instantiate fills a template document: values maps JSONPath expressions to
+// the value stored at every location they match.
+//
+// All paths are checked against the template before anything is written, and
+// every missing one is reported in a single *MultiPathError. Definite paths (see
+// Set) are resolved without evaluating the expression, which keeps large
+// override sets cheap. Overrides are applied in the lexical order of their
+// paths, so overlapping paths give deterministic results.
+func Instantiate(template cty.Value, values map[string]cty.Value, opts InstantiateOptions) (cty.Value, error) {
+	exprs := make([]string, 0, len(values))
+	for expr := range values {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	type target struct {
+		expr     string
+		definite cty.Path
+		paths    []cty.Path
+	}
+	targets := []target{}
+	errs := []error{}
+	for _, expr := range exprs {
+		p, err := NewPath(expr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if path, ok := p.definitePath(); ok {
+			if _, err := path.Apply(template); err != nil && !opts.Create {
+				errs = append(errs, &PathError{Path: path, Err: newError(ErrNotFound, "%s doesn't exist in the template", expr)})
+				continue
+			}
+			targets = append(targets, target{expr: expr, definite: path})
+			continue
+		}
+		_, paths, err := p.Eval(template)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(paths) == 0 && !opts.Create {
+			errs = append(errs, newError(ErrNotFound, "%s doesn't match anything in the template", expr))
+			continue
+		}
+		targets = append(targets, target{expr: expr, paths: paths})
+	}
+	if len(errs) > 0 {
+		return template, &MultiPathError{Errors: errs}
+	}
+
+	doc := template
+	changes := []Change{}
+	for _, t := range targets {
+		before := doc
+		var err error
+		if t.paths == nil {
+			doc, err = createAtPath(doc, t.definite, values[t.expr])
+		} else {
+			doc, err = replacePaths(doc, t.paths, values[t.expr])
+		}
+		if err != nil {
+			return template, err
+		}
+		if opts.DryRun == nil {
+			continue
+		}
+		if t.paths == nil {
+			changes = append(changes, createChange(before, doc, t.definite))
+		} else {
+			changes = append(changes, replaceChanges(before, doc, t.paths)...)
+		}
+	}
+	if opts.DryRun != nil {
+		*opts.DryRun = changes
+		return template, nil
+	}
+	return doc, nil
+}
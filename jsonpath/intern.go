@@ -0,0 +1,130 @@
+package jsonpath
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Interner hash-conses values: structurally identical values, down to
+// their types, come back as one shared instance, so results of recursive
+// queries over repetitive documents, or results kept side by side in a
+// cache, don't hold many copies of the same subtrees. Set it with
+// WithInterner, and share one Interner between evaluations to share values
+// across their results. An Interner keeps every value it has seen; drop it
+// to release them. It is safe for concurrent use.
+type Interner struct {
+	mu    sync.Mutex
+	table map[uint64][]cty.Value
+}
+
+// NewInterner creates an empty Interner.
+func NewInterner() *Interner {
+	return &Interner{table: map[uint64][]cty.Value{}}
+}
+
+// Intern returns the shared instance of v, whose containers hold shared
+// instances of their elements. Values carrying marks are returned as they
+// are.
+func (in *Interner) Intern(v cty.Value) cty.Value {
+	if v.ContainsMarked() {
+		return v
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	v, _ = in.intern(v)
+	return v
+}
+
+// Len returns the number of distinct values held.
+func (in *Interner) Len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	n := 0
+	for _, vals := range in.table {
+		n += len(vals)
+	}
+	return n
+}
+
+// intern interns the elements of v, then v itself, and returns it along
+// with its hash.
+func (in *Interner) intern(v cty.Value) (cty.Value, uint64) {
+	h := fnv.New64a()
+	writeUint := func(n uint64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		h.Write(b[:])
+	}
+	ty := v.Type()
+	h.Write([]byte(ty.FriendlyName()))
+	switch {
+	case !v.IsKnown() || v.IsNull():
+		// unknown and null values are cheap; nothing to share
+		return v, 0
+	case ty == cty.String:
+		h.Write([]byte(v.AsString()))
+	case ty == cty.Number:
+		h.Write([]byte(v.AsBigFloat().Text('g', -1)))
+	case ty == cty.Bool:
+		return v, 0
+	case ty.IsObjectType() || ty.IsMapType():
+		attrs := v.AsValueMap()
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var sum uint64
+			attrs[k], sum = in.intern(attrs[k])
+			h.Write([]byte(k))
+			writeUint(sum)
+		}
+		switch {
+		case len(attrs) == 0:
+		case ty.IsObjectType():
+			v = cty.ObjectVal(attrs)
+		default:
+			v = cty.MapVal(attrs)
+		}
+	case ty.IsListType() || ty.IsTupleType():
+		elems := v.AsValueSlice()
+		for i := range elems {
+			var sum uint64
+			elems[i], sum = in.intern(elems[i])
+			writeUint(sum)
+		}
+		switch {
+		case len(elems) == 0:
+		case ty.IsTupleType():
+			v = cty.TupleVal(elems)
+		default:
+			v = cty.ListVal(elems)
+		}
+	default:
+		// sets and capsules are compared whole
+	}
+	sum := h.Sum64()
+	for _, seen := range in.table[sum] {
+		if seen.RawEquals(v) {
+			return seen, sum
+		}
+	}
+	in.table[sum] = append(in.table[sum], v)
+	return v, sum
+}
+
+// intern interns vals in place with EvalOptions.Interner, if any.
+func (j *JSONPath) intern(vals []cty.Value) []cty.Value {
+	if j.opts.Interner == nil {
+		return vals
+	}
+	for i, v := range vals {
+		vals[i] = j.opts.Interner.Intern(v)
+	}
+	return vals
+}
@@ -0,0 +1,90 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ElementErrors decides what happens when a step fails on one of the
+// values it's applied to, e.g. `[0]` on the one element of `$.items[*]`
+// that isn't an array.
+type ElementErrors int
+
+const (
+	// ElementErrorsFail fails the whole evaluation, the default.
+	ElementErrorsFail ElementErrors = iota
+	// ElementErrorsSkip drops the failing value and carries on with the
+	// others.
+	ElementErrorsSkip
+	// ElementErrorsCollect drops the failing value too, and returns the
+	// results of the others together with a *MultiPathError of *ElementError
+	// values.
+	ElementErrorsCollect
+)
+
+// ElementError reports a step that failed on one of its input values (see
+// EvalOptions.ElementErrors).
+type ElementError struct {
+	// Step is the failing step in JSONPath syntax.
+	Step string
+	// Path locates the value the step was applied to.
+	Path cty.Path
+	Err  error
+}
+
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("%s at $%s: %s", e.Step, PrettyCtyPath(e.Path), e.Err)
+}
+
+func (e *ElementError) Unwrap() error {
+	return e.Err
+}
+
+// elementFailed applies the ElementErrors policy to node failing on value
+// with err. It returns the error to abort with, if any.
+func (j *JSONPath) elementFailed(value cty.Value, node Node, err error) error {
+	// syntax errors are mistakes in the expression, which would fail on
+	// every value
+	if j.opts.ElementErrors == ElementErrorsFail || errors.Is(err, ErrSyntax) {
+		return err
+	}
+	if j.opts.ElementErrors == ElementErrorsCollect {
+		path, _ := valuePath(value)
+		j.partial = append(j.partial, &ElementError{Step: formatStep(node), Path: path.Copy(), Err: err})
+	}
+	return nil
+}
+
+// walkIsolated applies node to each input value separately, so a value
+// the step fails on only drops its own results.
+func (j *JSONPath) walkIsolated(input []cty.Value, node Node, err error) ([]cty.Value, error) {
+	if len(input) == 1 {
+		// no need to apply it again to find the failing value
+		return []cty.Value{}, j.elementFailed(input[0], node, err)
+	}
+	results := []cty.Value{}
+	for _, value := range input {
+		temp, err := j.walkNode([]cty.Value{value}, node)
+		if err != nil {
+			if err := j.elementFailed(value, node, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		results = append(results, temp...)
+	}
+	return results, nil
+}
+
+// isolatable reports whether node selects from each input value on its
+// own, as opposed to ignoring its input like $ or $doc("name").
+func isolatable(node Node) bool {
+	switch node.(type) {
+	case *FieldNode, *ArrayNode, *FilterNode, *WildcardNode, *RecursiveNode,
+		*UnionNode, *RegexNode, *FunctionNode:
+		return true
+	}
+	return false
+}
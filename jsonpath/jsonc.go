@@ -0,0 +1,119 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Comment is a comment found by FromJSONC, keyed by the location of the
+// value it follows on the same line, or else of the value it precedes, or
+// of the enclosing container for comments written after its last member.
+type Comment struct {
+	Path cty.Path
+	Text string
+}
+
+type jsoncComment struct {
+	offset int64
+	text   string
+	// trailing comments follow a value on the same line
+	trailing bool
+}
+
+// FromJSONC decodes JSON with comments (// and /* */) and trailing commas,
+// as found in human-edited configuration files. Besides the value, which
+// has the same shape as with DecodeJSONStrict, it returns the comments in
+// input order, with their delimiters and surrounding space removed. Later
+// duplicate keys win, as with encoding/json. Options are those of
+// DecodeJSONStrict.
+func FromJSONC(data []byte, opts ...Option) (cty.Value, []Comment, error) {
+	clean, comments, err := stripJSONC(data)
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(clean))
+	dec.UseNumber()
+	d := newStrictDecoder(dec, newSettings(opts))
+	d.pending = comments
+	v, err := d.value(cty.Path{})
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return cty.NilVal, nil, newError(ErrSyntax, "unexpected data after the JSON value")
+	}
+	d.attach(cty.Path{}, int64(len(clean))+1)
+	return v, d.comments, nil
+}
+
+// stripJSONC blanks out comments and trailing commas, keeping the offsets
+// of everything else intact.
+func stripJSONC(data []byte) ([]byte, []jsoncComment, error) {
+	out := append([]byte(nil), data...)
+	comments := []jsoncComment{}
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := bytes.IndexByte(out[i:], '\n')
+			if end < 0 {
+				end = len(out) - i
+			}
+			comments = append(comments, jsoncComment{int64(i), strings.TrimSpace(string(out[i+2 : i+end])), afterValue(out, i)})
+			blank(i, i+end)
+			i += end - 1
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, nil, newError(ErrSyntax, "unterminated comment at offset %d", i)
+			}
+			comments = append(comments, jsoncComment{int64(i), strings.TrimSpace(string(out[i+2 : i+2+end])), afterValue(out, i)})
+			blank(i, i+end+4)
+			i += end + 3
+		}
+	}
+
+	for i := 0; i < len(out); i++ {
+		switch out[i] {
+		case '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case ',':
+			next := i + 1
+			for next < len(out) && strings.ContainsRune(" \t\r\n", rune(out[next])) {
+				next++
+			}
+			if next < len(out) && (out[next] == '}' || out[next] == ']') {
+				out[i] = ' '
+			}
+		}
+	}
+	return out, comments, nil
+}
+
+// afterValue reports whether the line up to offset i holds more than
+// whitespace, commas and opening brackets.
+func afterValue(data []byte, i int) bool {
+	start := bytes.LastIndexByte(data[:i], '\n') + 1
+	return strings.Trim(string(data[start:i]), " \t\r,{[") != ""
+}
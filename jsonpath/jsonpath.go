@@ -18,8 +18,10 @@ package jsonpath
 
 import (
 	"fmt"
-	"reflect"
-	"strings"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/zclconf/go-cty/cty"
 )
@@ -37,26 +39,152 @@ type JSONPath struct {
 
 	allowMissingKeys bool
 	outputJSON       bool
+
+	opts     EvalOptions
+	defaults EvalOptions
+	features []Feature
+	// doc is the leading $doc("name") step selecting the document to
+	// evaluate against, if any
+	doc     *DocNode
+	memo    filterMemo
+	partial []error
+	logger  *slog.Logger
+	root    cty.Value
+
+	middleware []Middleware
+
+	// stats receives the statistics of every evaluation, keyed by
+	// statsKey; statIndex numbers the top-level steps, statRun holds the
+	// evaluation in progress and memoSteps the filters chosen to memoize
+	stats     *Stats
+	statsKey  string
+	statIndex map[Node]int
+	statRun   []StepStats
+	memoSteps map[*FilterNode]bool
+}
+
+// CompileOptions tweaks how an expression is parsed.
+type CompileOptions struct {
+	// Logger receives debug events about parsing and, unless
+	// EvalOptions.Logger overrides it, about every evaluation of the path.
+	Logger *slog.Logger
+	// NoOptimize keeps the expression exactly as parsed instead of
+	// rewriting it into an equivalent, cheaper form. String() shows the
+	// form that is evaluated.
+	NoOptimize bool
+	// Dialect accepts the syntax variants of another engine.
+	Dialect Dialect
+	// EnableFunctions lists the opt-in filter functions the expression may
+	// call, such as env, which reads the process environment.
+	EnableFunctions []string
+	// AllowedFeatures, when not nil, makes expressions using any other
+	// feature fail with ErrUnsupported.
+	AllowedFeatures []Feature
+	// MaxRegexLength, when positive, rejects regex key selectors such as
+	// [/^app\./] whose pattern is longer, with ErrUnsupported. Regexes are
+	// compiled along with the expression and run on Go's RE2 engine, in
+	// time linear in the length of the key, so bounding the pattern bounds
+	// the cost of untrusted expressions.
+	MaxRegexLength int
+	// StartSpan, when set, records a span for the compilation and installs
+	// Tracing on the path to record one per evaluation.
+	StartSpan StartSpan
+	// Stats, when set, collects selector statistics across evaluations
+	// and tunes the evaluation of the path from those recorded so far.
+	Stats *Stats
+}
+
+// NewPath creates a new JSONPath with the given name. Evaluation options
+// among opts become the defaults of Eval.
+func NewPath(jsonPath string, opts ...Option) (*JSONPath, error) {
+	s := newSettings(opts)
+	j, err := Compile(jsonPath, s.compile)
+	j.defaults = s.eval
+	j.outputJSON = s.jsonOutput
+	return j, err
+}
+
+// Compile is like NewPath() but lets you tweak the compilation.
+func Compile(jsonPath string, opts CompileOptions) (*JSONPath, error) {
+	j, err := compile(jsonPath, opts)
+	if opts.StartSpan != nil {
+		traceCompile(opts.StartSpan, j, err)
+		if err == nil {
+			j.Use(j.Tracing(opts.StartSpan))
+		}
+	}
+	return j, err
 }
 
-// NewPath creates a new JSONPath with the given name.
-func NewPath(jsonPath string) (*JSONPath, error) {
+func compile(jsonPath string, opts CompileOptions) (*JSONPath, error) {
 	j := &JSONPath{
 		name:       "",
 		beginRange: 0,
 		inRange:    0,
 		endRange:   0,
+		logger:     opts.Logger,
 	}
 	var err error
-	j.parser, err = Parse(jsonPath)
+	j.parser, err = parseOptions(jsonPath, opts)
+	if err != nil {
+		j.debug("jsonpath: parse failed", slog.String("expr", jsonPath), slog.Any("error", err))
+	} else if err = checkSelectors(j.steps()); err != nil {
+		j.debug("jsonpath: parse failed", slog.String("expr", jsonPath), slog.Any("error", err))
+		return j, err
+	} else {
+		if steps := j.steps(); len(steps) > 0 {
+			j.doc, _ = steps[0].(*DocNode)
+		}
+		j.features = usedFeatures(j.parser.Root)
+		if opts.AllowedFeatures != nil {
+			if err = checkFeatures(j.features, opts.AllowedFeatures); err != nil {
+				return j, err
+			}
+		}
+		if !opts.NoOptimize {
+			optimize(j.parser.Root)
+		}
+		if opts.Stats != nil {
+			j.adapt(jsonPath, opts.Stats)
+		}
+		j.debug("jsonpath: parsed", slog.String("expr", jsonPath), slog.String("steps", j.String()))
+	}
 	return j, err
 }
 
-type markPathRef struct { path *cty.Path }
+// checkSelectors rejects literals outside filters, such as `$.a 0`, which
+// would evaluate to values that aren't part of the document, and repeated
+// recursive descents, which the parser can't tell apart from one.
+func checkSelectors(steps []Node) error {
+	for i, node := range steps {
+		switch node.(type) {
+		case *IntNode, *FloatNode, *TextNode, *BoolNode:
+			return newError(ErrSyntax, "literal %s outside a filter", formatStep(node))
+		case *DocNode:
+			if i > 0 {
+				return newError(ErrSyntax, "$doc must start the expression")
+			}
+		case *RecursiveNode:
+			if i > 0 && steps[i-1].Type() == NodeRecursive {
+				return newError(ErrSyntax, "invalid multiple recursive descent")
+			}
+		}
+	}
+	return nil
+}
+
+type markPathRef struct {
+	path *cty.Path
+	// derived marks values computed from the one at path, e.g. substrings
+	derived bool
+	// key marks the keys of the object or map at path, as listed by
+	// entries(); it wins over the paths keys inherit from their entries
+	key bool
+}
 
 func newPathRef(path cty.Path) markPathRef {
 	p := path.Copy()
-	return markPathRef{&p}
+	return markPathRef{path: &p}
 }
 
 type SearchResult struct {
@@ -83,73 +211,226 @@ func (j *JSONPath) Search(data cty.Value) SearchResult {
 func (s SearchResult) String() (out string) {
 	for _, item := range s.Paths {
 		applied, _ := item.Apply(s.original)
-		out += fmt.Sprintf("%#v => %s\n", PrettyCtyPath(item), applied.GoString())
+		out += fmt.Sprintf("%#v => %s\n", PrettyCtyPath(item), DebugString(applied))
 	}
 	return
 }
 
 // EvalRaw is like Eval() without extra processing (cty.Path and unmarking)
 func (j *JSONPath) EvalRaw(data cty.Value) ([][]cty.Value, error) {
-	data, _ = cty.Transform(data, func(path cty.Path, value cty.Value) (cty.Value, error) {
-		return value.Mark(newPathRef(path)), nil
-	})
+	data = markPaths(data)
 	res, err := j.fullEvaluate(data)
 	return res, err
 }
 
 // Returns a list of matched lists and paths based on a JSON path.
-func (j *JSONPath) Eval(data cty.Value) ([]cty.Value, []cty.Path, error) {
-	data, _ = cty.Transform(data, func(path cty.Path, value cty.Value) (cty.Value, error) {
-		return value.Mark(newPathRef(path)), nil
-	})
+// Marks carried by data (e.g. sensitivity) are kept on the results.
+// opts are applied on top of those given to NewPath.
+func (j *JSONPath) Eval(data cty.Value, opts ...Option) ([]cty.Value, []cty.Path, error) {
+	s := settings{eval: j.defaults}
+	s.apply(opts)
+	return j.EvalWithOptions(data, s.eval)
+}
+
+// EvalWithOptions is like Eval() but lets you tweak the evaluation.
+//
+// The options are kept on j for the duration of the call, so a single
+// JSONPath must not be evaluated concurrently, except through different
+// EvalContexts.
+func (j *JSONPath) EvalWithOptions(data cty.Value, opts EvalOptions) ([]cty.Value, []cty.Path, error) {
+	if opts.Context != nil {
+		// the evaluation state lives in a copy, so contexts of different
+		// goroutines can share j
+		run := *j
+		j = &run
+	}
+	if len(j.middleware) > 0 {
+		return j.chain()(data, opts)
+	}
+	return j.evalWithOptions(data, opts)
+}
+
+func (j *JSONPath) evalWithOptions(data cty.Value, opts EvalOptions) ([]cty.Value, []cty.Path, error) {
+	defer j.begin(opts)()
+
+	if j.doc != nil {
+		// results and their paths belong to the referenced document
+		doc, err := j.lookupDoc(j.doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = doc
+	}
+	data, err := j.markPaths(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.ChunkSize > 0 {
+		vals, paths := []cty.Value{}, []cty.Path{}
+		used := 0
+		err := j.evalChunked(data, func(v []cty.Value, p []cty.Path) (err error) {
+			if opts.MaxResultBytes > 0 {
+				if used, err = j.checkBudget(v, used); err != nil {
+					return err
+				}
+			}
+			vals = append(vals, v...)
+			paths = append(paths, p...)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		vals, paths = j.distinct(vals, paths)
+		return j.intern(vals), paths, j.partialError()
+	}
 	res, err := j.fullEvaluate(data)
 	if err != nil {
 		return nil, nil, err
 	}
 	unmarkedData, _ := data.UnmarkDeep()
 	if len(res) == 1 {
-		result := res[0]
-		paths := []cty.Path{}
-		for _, item := range result {
-			for mark, _ := range item.Marks() {
-				if pr, ok := mark.(markPathRef); ok {
-					P := *(pr.path)
-					paths = append(paths, P)
-				}
+		if opts.MaxResultBytes > 0 {
+			if _, err := j.checkBudget(res[0], 0); err != nil {
+				return nil, nil, err
 			}
 		}
+		result, filteredPaths, derivedAt := resultPaths(res[0], unmarkedData)
+		if err := j.checkWritable(filteredPaths, derivedAt); err != nil {
+			return nil, nil, err
+		}
+		result, filteredPaths = j.distinct(result, filteredPaths)
+		return j.intern(result), filteredPaths, j.partialError()
+	}
+	return nil, nil, newError(ErrInvariant, "expected len(nodes) = 1, shouldn't happen unless internal error")
+}
+
+// begin installs opts for one evaluation and returns the function that
+// resets the evaluation state afterwards.
+func (j *JSONPath) begin(opts EvalOptions) func() {
+	j.opts = opts
+	j.partial = nil
+	if opts.Metrics != nil {
+		opts.Metrics.prepare(j.steps())
+	}
+	endStats := j.beginStats()
+	if opts.Context != nil {
+		j.memo = opts.Context.memo
+	}
+	return func() {
+		endStats()
+		if opts.Context != nil {
+			clear(opts.Context.memo)
+		}
+		j.opts = EvalOptions{}
+		j.partial = nil
+		j.memo = nil
+		j.root = cty.NilVal
+	}
+}
 
-		for i, _ := range result {
-			result[i], _ = result[i].UnmarkDeep()
+// markPaths marks every value in data with its own path, so results can be
+// traced back to where they were found.
+func markPaths(data cty.Value) cty.Value {
+	data, _ = cty.Transform(data, func(path cty.Path, value cty.Value) (cty.Value, error) {
+		return value.Mark(newPathRef(path)), nil
+	})
+	return data
+}
+
+// stripPathRefs removes the marks added by markPaths from v, keeping any
+// marks the caller's document carried, at copies of their paths.
+func stripPathRefs(v cty.Value) cty.Value {
+	unmarked, pvm := v.UnmarkDeepWithPaths()
+	kept := []cty.PathValueMarks{}
+	for _, pm := range pvm {
+		marks := cty.ValueMarks{}
+		for mark := range pm.Marks {
+			if _, ok := mark.(markPathRef); !ok {
+				marks[mark] = struct{}{}
+			}
+		}
+		if len(marks) > 0 {
+			kept = append(kept, cty.PathValueMarks{Path: pm.Path.Copy(), Marks: marks})
 		}
+	}
+	return unmarked.MarkWithPaths(kept)
+}
 
-		filteredPaths := []cty.Path{}
-		for _, path := range paths {
-			outcome, _ := path.Apply(unmarkedData)
-			put := false
-			for _, item := range result {
-				if item.Equals(outcome).True() {
-					put = true
-					break
+// resultPaths unmarks result in place and returns the paths it was found at.
+// A value computed from the document, e.g. a substring, is found at the path
+// of the value it was computed from, unless it's also part of the document;
+// derived lists the indexes of such values.
+func resultPaths(result []cty.Value, unmarkedData cty.Value) ([]cty.Value, []cty.Path, []int) {
+	filteredPaths := []cty.Path{}
+	var derivedAt []int
+	for i, item := range result {
+		unmarked, _ := item.UnmarkDeep()
+		found := false
+		var derived *cty.Path
+		keyOf := false
+		candidates := []*cty.Path{}
+		for mark, _ := range item.Marks() {
+			pr, ok := mark.(markPathRef)
+			switch {
+			case !ok:
+			case pr.key:
+				derived, keyOf = pr.path, true
+			case pr.derived && !keyOf:
+				if derived == nil || len(*pr.path) > len(*derived) {
+					derived = pr.path
 				}
+			default:
+				candidates = append(candidates, pr.path)
 			}
-			if put {
-				filteredPaths = append(filteredPaths, path)
+		}
+		// values are also marked with the paths of their parents, which
+		// are shorter than their own; trying the longest first keeps deep
+		// documents from costing a lookup per ancestor
+		sort.Slice(candidates, func(a, b int) bool { return len(*candidates[a]) > len(*candidates[b]) })
+		for _, path := range candidates {
+			if outcome, _ := path.Apply(unmarkedData); unmarked.RawEquals(outcome) {
+				filteredPaths = append(filteredPaths, *path)
+				found = true
+				break
 			}
 		}
+		if !found && derived != nil {
+			derivedAt = append(derivedAt, len(filteredPaths))
+			filteredPaths = append(filteredPaths, *derived)
+		}
+		result[i] = stripPathRefs(item)
+	}
+	return result, filteredPaths, derivedAt
+}
 
-		return result, filteredPaths, err
+// checkWritable fails, for evaluations locating values to write, when one
+// of the results at derivedAt was computed from the document: its path is
+// that of its source, which the write would clobber.
+func (j *JSONPath) checkWritable(paths []cty.Path, derivedAt []int) error {
+	if !j.opts.writes || len(derivedAt) == 0 {
+		return nil
 	}
-	return nil, nil, fmt.Errorf("expected len(nodes) = 1, shouldn't happen unless internal error.")
+	return newPathError(paths[derivedAt[0]], ErrUnsupported, "the match is computed from the value here, not stored in the document, and can't be written")
+}
+
+// writePaths evaluates j against doc for a write and returns the locations
+// it matches. Matches computed from the document, like substrings or the
+// entries of an object, fail with ErrUnsupported.
+func (j *JSONPath) writePaths(doc cty.Value) ([]cty.Path, error) {
+	opts := j.defaults
+	opts.writes = true
+	_, paths, err := j.EvalWithOptions(doc, opts)
+	return paths, err
 }
 
 func (j *JSONPath) fullEvaluate(data cty.Value) ([][]cty.Value, error) {
 	if j.parser == nil {
-		return nil, fmt.Errorf("%s is an incomplete jsonpath template", j.name)
+		return nil, newError(ErrSyntax, "%s is an incomplete jsonpath template", j.name)
 	}
 
-	//cur := []cty.Value{reflect.ValueOf(data)}
 	cur := []cty.Value{data}
+	j.root = data
 	nodes := j.parser.Root.Nodes
 	fullResult := [][]cty.Value{}
 	for i := 0; i < len(nodes); i++ {
@@ -210,6 +491,40 @@ func (j *JSONPath) EnableJSONOutput(v bool) {
 
 // walk visits tree rooted at the given node in DFS order
 func (j *JSONPath) walk(value []cty.Value, node Node) ([]cty.Value, error) {
+	var start time.Time
+	if j.opts.Metrics != nil {
+		start = time.Now()
+	}
+	_, isList := node.(*ListNode)
+	var err error
+	if j.opts.ResolveRefs && !isList {
+		if value, err = j.resolveRefs(value); err != nil {
+			return nil, err
+		}
+	}
+	results, err := j.walkNode(value, node)
+	if err != nil && j.opts.ElementErrors != ElementErrorsFail && isolatable(node) {
+		results, err = j.walkIsolated(value, node, err)
+	}
+	if err == nil && j.opts.ResolveRefs && !isList {
+		results, err = j.resolveRefs(results)
+	}
+	if err != nil {
+		j.logStepError(value, node, err)
+		return results, err
+	}
+	if j.opts.Metrics != nil {
+		j.opts.Metrics.record(node, len(value), len(results), time.Since(start))
+	}
+	if step := j.statStep(node); step != nil {
+		step.Input += len(value)
+		step.Output += len(results)
+	}
+	j.logStep(value, node, results)
+	return results, nil
+}
+
+func (j *JSONPath) walkNode(value []cty.Value, node Node) ([]cty.Value, error) {
 	switch node := node.(type) {
 	case *ListNode:
 		return j.evalList(value, node)
@@ -235,8 +550,20 @@ func (j *JSONPath) walk(value []cty.Value, node Node) ([]cty.Value, error) {
 		return j.evalUnion(value, node)
 	case *IdentifierNode:
 		return j.evalIdentifier(value, node)
+	case *RegexNode:
+		return j.evalRegex(value, node)
+	case *RootNode:
+		return []cty.Value{j.root}, nil
+	case *DocNode:
+		if node == j.doc {
+			// already selected by EvalWithOptions
+			return value, nil
+		}
+		return j.evalDoc(node)
+	case *FunctionNode:
+		return j.evalFunction(value, node)
 	default:
-		return value, fmt.Errorf("unexpected Node %v", node)
+		return value, newError(ErrUnsupported, "unexpected Node %v", node)
 	}
 }
 
@@ -269,10 +596,22 @@ func (j *JSONPath) evalBool(input []cty.Value, node *BoolNode) ([]cty.Value, err
 
 // evalList evaluates ListNode
 func (j *JSONPath) evalList(value []cty.Value, node *ListNode) ([]cty.Value, error) {
+	if j.opts.UnionLimit > 0 && j.opts.ChunkSize <= 0 {
+		for i, step := range node.Nodes {
+			if union, ok := step.(*UnionNode); ok {
+				return j.evalLimitedUnion(value, node.Nodes[:i], union, node.Nodes[i+1:])
+			}
+		}
+	}
 	var err error
 	curValue := value
-	for _, node := range node.Nodes {
-		curValue, err = j.walk(curValue, node)
+	for i := 0; i < len(node.Nodes); i++ {
+		if field, ok := node.Nodes[i].(*FieldNode); ok && j.canMergeFields(node.Nodes[i+1:], field.merged) {
+			curValue = j.evalFields(curValue, node.Nodes[i:i+1+len(field.merged)])
+			i += len(field.merged)
+			continue
+		}
+		curValue, err = j.walk(curValue, node.Nodes[i])
 		if err != nil {
 			return curValue, err
 		}
@@ -280,6 +619,38 @@ func (j *JSONPath) evalList(value []cty.Value, node *ListNode) ([]cty.Value, err
 	return curValue, nil
 }
 
+// canMergeFields reports whether the attribute steps merged into a field by
+// optimize can be looked up together with it: they still follow it, and
+// nothing observes the steps one by one.
+func (j *JSONPath) canMergeFields(rest []Node, merged []*FieldNode) bool {
+	if len(merged) == 0 || len(merged) > len(rest) {
+		return false
+	}
+	for i, field := range merged {
+		if rest[i] != Node(field) {
+			return false
+		}
+	}
+	return j.opts.Metrics == nil && !j.opts.ResolveRefs && j.statRun == nil && !j.debugEnabled()
+}
+
+// evalFields evaluates a run of attribute steps, following each input value
+// down the whole run before moving to the next.
+func (j *JSONPath) evalFields(input []cty.Value, fields []Node) []cty.Value {
+	results := []cty.Value{}
+next:
+	for _, value := range input {
+		for _, field := range fields {
+			var ok bool
+			if value, ok = j.field(value, field.(*FieldNode).Value); !ok {
+				continue next
+			}
+		}
+		results = append(results, value)
+	}
+	return results
+}
+
 // evalIdentifier evaluates IdentifierNode
 func (j *JSONPath) evalIdentifier(input []cty.Value, node *IdentifierNode) ([]cty.Value, error) {
 	results := []cty.Value{}
@@ -291,10 +662,10 @@ func (j *JSONPath) evalIdentifier(input []cty.Value, node *IdentifierNode) ([]ct
 		if j.inRange > 0 {
 			j.endRange++
 		} else {
-			return results, fmt.Errorf("not in range, nothing to end")
+			return results, newError(ErrSyntax, "not in range, nothing to end")
 		}
 	default:
-		return input, fmt.Errorf("unrecognized identifier %v", node.Name)
+		return input, newError(ErrUnsupported, "unrecognized identifier %v", node.Name)
 	}
 	return results, nil
 }
@@ -303,121 +674,207 @@ func (j *JSONPath) evalIdentifier(input []cty.Value, node *IdentifierNode) ([]ct
 func (j *JSONPath) evalArray(input []cty.Value, node *ArrayNode) ([]cty.Value, error) {
 	result := []cty.Value{}
 	for _, value := range input {
-		//
-		//value, isNil := template.Indirect(value)
-		//if isNil {
-		//	continue
-		//}
-		//if value.Kind() != reflect.Array && value.Kind() != reflect.Slice {
-		//	return input, fmt.Errorf("%v is not array or slice", value.Type())
-		//}
 		unmarked, _ := value.Unmark()
-		sliceLength := unmarked.LengthInt()
-
-		params := node.Params
-		if !params[0].Known {
-			params[0].Value = 0
-		}
-		if params[0].Value < 0 {
-			params[0].Value += sliceLength
+		ty := unmarked.Type()
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			continue
 		}
-		if !params[1].Known {
-			params[1].Value = sliceLength
+		if j.opts.NumericKeys && (ty.IsObjectType() || ty.IsMapType()) && isSingleIndex(node.Params) {
+			// {"2023": ...}[2023] reads the "2023" key
+			results, err := j.evalField([]cty.Value{value}, newField(strconv.Itoa(node.Params[0].Value)))
+			if err != nil {
+				return input, err
+			}
+			result = append(result, results...)
+			continue
 		}
-
-		if params[1].Value < 0 || (params[1].Value == 0 && params[1].Derived) {
-			params[1].Value += sliceLength
+		if (ty.IsObjectType() || ty.IsMapType()) && isWildcardSlice(node.Params) {
+			// `[*]` selects members like `.*`
+			results, _ := j.evalWildcard([]cty.Value{value}, &WildcardNode{NodeType: NodeWildcard})
+			result = append(result, results...)
+			continue
 		}
-
-		if params[1].Value != params[0].Value { // if you're requesting zero elements, allow it through.
-			if params[0].Value >= sliceLength || params[0].Value < 0 {
-				return input, fmt.Errorf("array index out of bounds: index %d, length %d", params[0].Value, sliceLength)
-			}
-			if params[1].Value > sliceLength || params[1].Value < 0 {
-				return input, fmt.Errorf("array index out of bounds: index %d, length %d", params[1].Value-1, sliceLength)
+		if !(ty.IsListType() || ty.IsTupleType()) || unmarked.IsNull() {
+			if isWildcardSlice(node.Params) {
+				// like `.*`, `[*]` has nothing to select from scalars
+				continue
 			}
-			if params[0].Value > params[1].Value {
-				return input, fmt.Errorf("starting index %d is greater than ending index %d", params[0].Value, params[1].Value)
+			if j.opts.StringIndexes && ty.Equals(cty.String) && !unmarked.IsNull() {
+				results, err := j.evalStringIndex(value, node)
+				if err != nil {
+					return input, err
+				}
+				result = append(result, results...)
+				continue
 			}
-		} else {
-			return result, nil
+			return input, newError(ErrTypeMismatch, "%s is not array and cannot be indexed", ty.FriendlyName())
 		}
-
-		indices := make([]int, sliceLength)
-		for i, _ := range indices {
-			indices[i] = i
+		indices, err := sliceIndices(node.Params, unmarked.LengthInt(), j.opts.OutOfRange)
+		if err != nil {
+			return input, err
 		}
-		indices = indices[params[0].Value : params[1].Value]
-		newVal := []cty.Value{}
-		for _, item := range indices {
-			child, _ := cty.Path{}.IndexInt(item).Apply(unmarked)
-			newVal = append(newVal, child)
+		for _, i := range indices {
+			child, _ := cty.Path{}.IndexInt(i).Apply(unmarked)
+			result = append(result, child)
 		}
-		value = cty.TupleVal(newVal)
+	}
 
-		//value = cty.TupleVal(unmarked.AsValueSlice()[params[0].Value : params[1].Value])
-		//value = value.Slice(params[0].Value, params[1].Value)
+	return result, nil
+}
 
-		step := 1
-		if params[2].Known {
-			if params[2].Value <= 0 {
-				return input, fmt.Errorf("step must be > 0")
-			}
-			step = params[2].Value
+// sliceIndices returns the indexes params select in an array of the given
+// length. A single index out of range is handled as mode says. Slices follow
+// RFC 9535: negative bounds count from the end, bounds past either end are
+// clamped, and a negative step walks backwards from the end.
+func sliceIndices(params [3]ParamsEntry, length int, mode OutOfRange) ([]int, error) {
+	normalize := func(i, min, max int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < min {
+			return min
 		}
-		_ = step
-		for i := 0; i < value.LengthInt(); i += step {
-			result = append(result, value.Index(cty.NumberIntVal(int64(i))))
+		if i > max {
+			return max
+		}
+		return i
+	}
+	if isSingleIndex(params) {
+		i := params[0].Value
+		if i < 0 {
+			i += length
+		}
+		if i >= 0 && i < length {
+			return []int{i}, nil
+		}
+		switch {
+		case mode == OutOfRangeError:
+			return nil, newError(ErrIndexOutOfBounds, "array index out of bounds: index %d, length %d", i, length)
+		case length == 0 || mode == OutOfRangeEmpty:
+			return []int{}, nil
+		case mode == OutOfRangeWrap:
+			return []int{(i%length + length) % length}, nil
+		case i < 0:
+			return []int{0}, nil
+		default:
+			return []int{length - 1}, nil
 		}
 	}
 
-	return result, nil
+	step := 1
+	if params[2].Known {
+		if params[2].Value == 0 {
+			return nil, newError(ErrSyntax, "step must not be 0")
+		}
+		step = params[2].Value
+	}
+	indices := []int{}
+	if step > 0 {
+		start, end := 0, length
+		if params[0].Known {
+			start = normalize(params[0].Value, 0, length)
+		}
+		if params[1].Known {
+			end = normalize(params[1].Value, 0, length)
+		}
+		for i := start; i < end; i += step {
+			indices = append(indices, i)
+		}
+		return indices, nil
+	}
+	start, end := length-1, -1
+	if params[0].Known {
+		start = normalize(params[0].Value, -1, length-1)
+	}
+	if params[1].Known {
+		end = normalize(params[1].Value, -1, length-1)
+	}
+	for i := start; i > end; i += step {
+		indices = append(indices, i)
+	}
+	return indices, nil
+}
+
+// isSingleIndex reports whether params select one element, as `[3]`.
+func isSingleIndex(params [3]ParamsEntry) bool {
+	return params[0].Known && params[1].Derived && !params[2].Known
+}
+
+// isWildcardSlice reports whether params select a whole array, as `[*]`.
+func isWildcardSlice(params [3]ParamsEntry) bool {
+	return !params[0].Known && !params[1].Known && !params[2].Known
 }
 
-// evalUnion evaluates UnionNode
+// evalUnion evaluates UnionNode. Results are element-major: all the
+// matches of the selectors on the first input, in query order, then those
+// on the second input, and so on, so `$.users[*]['name','age']` yields
+// name and age of each user in turn.
 func (j *JSONPath) evalUnion(input []cty.Value, node *UnionNode) ([]cty.Value, error) {
+	if j.opts.PartialResults {
+		return j.evalUnionPartial(input, node), nil
+	}
 	result := []cty.Value{}
-	for _, listNode := range node.Nodes {
-		temp, err := j.evalList(input, listNode)
-		if err != nil {
-			return input, err
+	for _, value := range input {
+		for _, listNode := range node.Nodes {
+			temp, err := j.evalList([]cty.Value{value}, listNode)
+			if err != nil {
+				return input, err
+			}
+			result = append(result, temp...)
 		}
-		result = append(result, temp...)
 	}
 	return result, nil
 }
 
-func (j *JSONPath) findFieldInValue(value *reflect.Value, node *FieldNode) (reflect.Value, error) {
-	t := value.Type()
-	var inlineValue *reflect.Value
-	for ix := 0; ix < t.NumField(); ix++ {
-		f := t.Field(ix)
-		jsonTag := f.Tag.Get("json")
-		parts := strings.Split(jsonTag, ",")
-		if len(parts) == 0 {
-			continue
-		}
-		if parts[0] == node.Value {
-			return value.Field(ix), nil
-		}
-		if len(parts[0]) == 0 {
-			val := value.Field(ix)
-			inlineValue = &val
+// evalLimitedUnion evaluates the steps before union, then each selector of
+// union followed by the steps after it, stopping every selector once it has
+// yielded EvalOptions.UnionLimit matches.
+func (j *JSONPath) evalLimitedUnion(value []cty.Value, before []Node, union *UnionNode, after []Node) ([]cty.Value, error) {
+	var err error
+	for _, node := range before {
+		if value, err = j.walk(value, node); err != nil {
+			return value, err
 		}
 	}
-	if inlineValue != nil {
-		if inlineValue.Kind() == reflect.Struct {
-			// handle 'inline'
-			match, err := j.findFieldInValue(inlineValue, node)
+	result := []cty.Value{}
+	for _, v := range value {
+		for _, listNode := range union.Nodes {
+			steps := append(listNode.Nodes[:len(listNode.Nodes):len(listNode.Nodes)], after...)
+			temp, err := j.evalQuota([]cty.Value{v}, steps, j.opts.UnionLimit)
 			if err != nil {
-				return reflect.Value{}, err
-			}
-			if match.IsValid() {
-				return match, nil
+				return value, err
 			}
+			result = append(result, temp...)
 		}
 	}
-	return value.FieldByName(node.Value), nil
+	return result, nil
+}
+
+// evalQuota runs steps over input depth-first, one value at a time, and
+// returns at most quota results.
+func (j *JSONPath) evalQuota(input []cty.Value, steps []Node, quota int) ([]cty.Value, error) {
+	if len(steps) == 0 {
+		if len(input) > quota {
+			input = input[:quota]
+		}
+		return input, nil
+	}
+	result := []cty.Value{}
+	for _, v := range input {
+		next, err := j.walk([]cty.Value{v}, steps[0])
+		if err != nil {
+			return result, err
+		}
+		temp, err := j.evalQuota(next, steps[1:], quota-len(result))
+		if err != nil {
+			return result, err
+		}
+		if result = append(result, temp...); len(result) >= quota {
+			break
+		}
+	}
+	return result, nil
 }
 
 // evalField evaluates field of struct or key of map.
@@ -428,21 +885,7 @@ func (j *JSONPath) evalField(input []cty.Value, node *FieldNode) ([]cty.Value, e
 		return results, nil
 	}
 	for _, value := range input {
-		unmarked, _ := value.Unmark()
-		var result cty.Value = cty.DynamicVal
-
-		if value.Type().IsObjectType() {
-			if value.Type().HasAttribute(node.Value) {
-				result = value.GetAttr(node.Value)
-			}
-		} else {
-			ss := cty.StringVal(node.Value)
-			if unmarked.CanIterateElements() && unmarked.HasIndex(ss).True() {
-				result = value.Index(ss)
-			}
-		}
-
-		if result.IsKnown() {
+		if result, ok := j.field(value, node.Value); ok {
 			results = append(results, result)
 		}
 	}
@@ -450,14 +893,41 @@ func (j *JSONPath) evalField(input []cty.Value, node *FieldNode) ([]cty.Value, e
 		if true {
 			return results, nil
 		}
-		return results, fmt.Errorf("%s is not found", node.Value)
+		return results, newError(ErrNotFound, "%s is not found", node.Value)
 	}
 	return results, nil
 }
 
+// field looks up the attribute or map key name of value.
+func (j *JSONPath) field(value cty.Value, name string) (cty.Value, bool) {
+	unmarked, _ := value.Unmark()
+	switch {
+	case unmarked.IsNull():
+	case value.Type().IsObjectType():
+		// an unknown object still has its attributes, with unknown
+		// values
+		if value.Type().HasAttribute(name) {
+			return value.GetAttr(name), true
+		}
+	case !unmarked.IsKnown():
+		j.unknownContainer(value)
+	default:
+		ss := cty.StringVal(name)
+		// sets have no keys, and HasIndex panics on them
+		if unmarked.CanIterateElements() && !unmarked.Type().IsSetType() && unmarked.HasIndex(ss).True() {
+			return value.Index(ss), true
+		}
+	}
+	return cty.NilVal, false
+}
+
 func getByIter(value cty.Value, iter cty.ElementIterator) (out cty.Value) {
 	out = cty.DynamicVal
-	index, _ := iter.Element()
+	index, elem := iter.Element()
+	if value.Type().IsSetType() {
+		// set elements are their own keys
+		return elem
+	}
 	if value.Type().IsObjectType() {
 		if index.Type().Equals(cty.String) && value.Type().HasAttribute(index.AsString()) {
 			out = value.GetAttr(index.AsString())
@@ -474,7 +944,12 @@ func (j *JSONPath) evalWildcard(input []cty.Value, node *WildcardNode) ([]cty.Va
 	results := []cty.Value{}
 	for _, value := range input {
 		unmarked, _ := value.Unmark()
-		if !unmarked.CanIterateElements() {
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			continue
+		}
+		// set elements have no path of their own, like with [*]
+		if unmarked.IsNull() || !unmarked.CanIterateElements() || unmarked.Type().IsSetType() {
 			continue
 		}
 		it := unmarked.ElementIterator()
@@ -485,43 +960,49 @@ func (j *JSONPath) evalWildcard(input []cty.Value, node *WildcardNode) ([]cty.Va
 	return results, nil
 }
 
-// evalRecursive visits the given value recursively and pushes all of them to result
-func (j *JSONPath) evalRecursive(input []cty.Value, node *RecursiveNode) ([]cty.Value, error) {
-	result := []cty.Value{}
+// evalRegex selects the attributes or keys matching the regex
+func (j *JSONPath) evalRegex(input []cty.Value, node *RegexNode) ([]cty.Value, error) {
+	results := []cty.Value{}
 	for _, value := range input {
-		results := []cty.Value{}
-
 		unmarked, _ := value.Unmark()
-		if !unmarked.CanIterateElements() {
+		ty := unmarked.Type()
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			continue
+		}
+		if !(ty.IsObjectType() || ty.IsMapType()) || unmarked.IsNull() {
 			continue
 		}
-
 		it := unmarked.ElementIterator()
 		for it.Next() {
-			res := getByIter(unmarked, it)
-			if !res.IsKnown() {
-				continue
+			key, _ := it.Element()
+			if node.Regexp.MatchString(key.AsString()) {
+				results = append(results, getByIter(unmarked, it))
 			}
-			results = append(results, res)
 		}
+	}
+	return results, nil
+}
 
-		if len(results) != 0 {
-			result = append(result, value)
-
-			output, err := j.evalRecursive(results, node)
-			if len(output) == 0 {
-				continue
-			}
-			if err != nil {
-				return result, err
-			}
-			result = append(result, output...)
+// evalRecursive returns every container of input and below it, objects,
+// maps and arrays alike, parents before their children, for the next step
+// to select from.
+func (j *JSONPath) evalRecursive(input []cty.Value, node *RecursiveNode) ([]cty.Value, error) {
+	result := []cty.Value{}
+	visit := func(_ cty.Path, value cty.Value) (bool, error) {
+		unmarked, _ := value.Unmark()
+		if !unmarked.IsKnown() {
+			j.unknownContainer(value)
+			return false, nil
+		}
+		if unmarked.IsNull() || !unmarked.CanIterateElements() {
+			return false, nil
 		}
+		result = append(result, value)
+		return true, nil
+	}
+	for _, value := range input {
+		walkValues(value, nil, visit)
 	}
 	return result, nil
 }
-
-// evalFilter filters array according to FilterNode
-func (j *JSONPath) evalFilter(input []cty.Value, node *FilterNode) ([]cty.Value, error) {
-	return nil, fmt.Errorf("filters not implemented yet")
-}
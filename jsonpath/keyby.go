@@ -0,0 +1,67 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// KeyCollisions decides what KeyBy does with matches sharing a key.
+type KeyCollisions int
+
+const (
+	// KeyCollisionsError fails with ErrConflict at the second match.
+	KeyCollisionsError KeyCollisions = iota
+	// KeyCollisionsCollect maps every key to an array of the matches
+	// having it, in match order, whether or not the key repeats.
+	KeyCollisionsCollect
+)
+
+// KeyBy turns the matches into an object keyed by the value keyPath finds
+// in each, e.g. the containers of a pod keyed by "$.name", evaluated
+// against the match itself. Keys are strings, numbers or booleans, used as
+// strings. A match where keyPath finds nothing fails with ErrNotFound, and
+// one where it finds several values or a value of another kind with
+// ErrTypeMismatch; both errors carry the path of the match. Values keep
+// their marks. opts are those of NewPath, for keyPath, and
+// WithKeyCollisions.
+func (m MatchList) KeyBy(keyPath string, opts ...Option) (cty.Value, error) {
+	s := newSettings(opts)
+	p, err := NewPath(keyPath, opts...)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	attrs := map[string]cty.Value{}
+	groups := map[string][]cty.Value{}
+	first := map[string]cty.Path{}
+	for _, match := range m {
+		keys, _, err := p.Eval(match.Value)
+		if err != nil {
+			return cty.NilVal, &PathError{Path: match.Path.Copy(), Err: err}
+		}
+		if len(keys) == 0 {
+			return cty.NilVal, newPathError(match.Path, ErrNotFound, "%s matches nothing", keyPath)
+		}
+		if len(keys) > 1 {
+			return cty.NilVal, newPathError(match.Path, ErrTypeMismatch, "%s matches %d values, not one key", keyPath, len(keys))
+		}
+		key, _ := keys[0].UnmarkDeep()
+		if key.IsNull() || !key.IsKnown() || !key.Type().IsPrimitiveType() {
+			return cty.NilVal, newPathError(match.Path, ErrTypeMismatch, "keys must be strings, numbers or booleans, got %s", friendlyValue(key))
+		}
+		key, _ = convert.Convert(key, cty.String)
+		name := key.AsString()
+		if s.keyCollisions == KeyCollisionsCollect {
+			groups[name] = append(groups[name], match.Value)
+			continue
+		}
+		if at, ok := first[name]; ok {
+			return cty.NilVal, newPathError(match.Path, ErrConflict, "key %q is also the key of %s", name, FormatPath(at))
+		}
+		first[name] = match.Path
+		attrs[name] = match.Value
+	}
+	for name, vals := range groups {
+		attrs[name] = cty.TupleVal(vals)
+	}
+	return cty.ObjectVal(attrs), nil
+}
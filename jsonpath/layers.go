@@ -0,0 +1,151 @@
+package jsonpath
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Layers is a read-through stack of documents, such as base settings,
+// per-environment settings and overrides. The virtual document it exposes
+// merges objects and maps key by key, higher layers winning; any other
+// value, arrays included, comes whole from the highest layer defining it.
+// A null in a higher layer overrides like any other value.
+//
+// Layers are immutable: Set and SetIn return a new stack.
+type Layers struct {
+	layers []cty.Value
+	merged cty.Value
+}
+
+// LayerMatch is a value of the merged document with the index of the layer
+// that supplied it.
+type LayerMatch struct {
+	Value cty.Value
+	Path  cty.Path
+	Layer int
+}
+
+// Layered stacks docs, the first being the lowest layer. Marks are
+// ignored.
+func Layered(docs ...cty.Value) *Layers {
+	layers := make([]cty.Value, len(docs))
+	for i, doc := range docs {
+		layers[i], _ = doc.UnmarkDeep()
+	}
+	return &Layers{layers: layers, merged: mergeLayers(layers)}
+}
+
+// Value returns the merged document.
+func (l *Layers) Value() cty.Value {
+	return l.merged
+}
+
+// Len returns the number of layers.
+func (l *Layers) Len() int {
+	return len(l.layers)
+}
+
+// Layer returns the document of layer i.
+func (l *Layers) Layer(i int) cty.Value {
+	return l.layers[i]
+}
+
+// Eval evaluates jsonPath against the merged document.
+func (l *Layers) Eval(jsonPath string) ([]LayerMatch, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	vals, paths, err := p.Eval(l.merged)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]LayerMatch, len(vals))
+	for i := range vals {
+		matches[i] = LayerMatch{Value: vals[i], Path: paths[i], Layer: l.supplier(paths[i])}
+	}
+	return matches, nil
+}
+
+// Set stores value at every location jsonPath matches in the merged
+// document, each in the layer that supplied it, and returns the new stack
+// with the replaced matches.
+func (l *Layers) Set(jsonPath string, value cty.Value) (*Layers, []LayerMatch, error) {
+	matches, err := l.Eval(jsonPath)
+	if err != nil {
+		return l, nil, err
+	}
+	layers := append([]cty.Value(nil), l.layers...)
+	for _, m := range matches {
+		if layers[m.Layer], err = setAtPath(layers[m.Layer], m.Path, value); err != nil {
+			return l, nil, err
+		}
+	}
+	return &Layers{layers: layers, merged: mergeLayers(layers)}, matches, nil
+}
+
+// SetIn is Set applied to layer i alone, so it can create locations, e.g.
+// to override a base setting in the top layer.
+func (l *Layers) SetIn(i int, jsonPath string, value cty.Value) (*Layers, error) {
+	if i < 0 || i >= len(l.layers) {
+		return l, newError(ErrIndexOutOfBounds, "layer %d out of %d", i, len(l.layers))
+	}
+	updated, err := Set(l.layers[i], jsonPath, value)
+	if err != nil {
+		return l, err
+	}
+	layers := append([]cty.Value(nil), l.layers...)
+	layers[i], _ = updated.UnmarkDeep()
+	return &Layers{layers: layers, merged: mergeLayers(layers)}, nil
+}
+
+// supplier returns the highest layer defining path. Since merging only
+// descends into objects and maps, that's the layer the merged value at
+// path came from.
+func (l *Layers) supplier(path cty.Path) int {
+	for i := len(l.layers) - 1; i > 0; i-- {
+		if _, err := path.Apply(l.layers[i]); err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+// mergeLayers merges values defined at the same location, lowest first.
+func mergeLayers(values []cty.Value) cty.Value {
+	if len(values) == 0 {
+		return cty.EmptyObjectVal
+	}
+	top := values[len(values)-1]
+	if !isMergeable(top) {
+		return top
+	}
+	start := len(values) - 1
+	for start > 0 && isMergeable(values[start-1]) {
+		start--
+	}
+	values = values[start:]
+
+	byKey := map[string][]cty.Value{}
+	for _, v := range values {
+		for it := v.ElementIterator(); it.Next(); {
+			k, elem := it.Element()
+			byKey[k.AsString()] = append(byKey[k.AsString()], elem)
+		}
+	}
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make(map[string]cty.Value, len(keys))
+	for _, k := range keys {
+		attrs[k] = mergeLayers(byKey[k])
+	}
+	return rebuildMapping(top.Type(), attrs)
+}
+
+func isMergeable(v cty.Value) bool {
+	return !v.IsNull() && v.IsKnown() && isMapping(v.Type())
+}
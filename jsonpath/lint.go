@@ -0,0 +1,145 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning is a likely mistake in an expression, found by Lint.
+type Warning struct {
+	// Code identifies the kind of mistake, e.g. to suppress it: one of the
+	// Lint* constants.
+	Code string
+	// Step is the offending step as String would render it, empty when
+	// the warning is about the whole expression.
+	Step    string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Step == "" {
+		return fmt.Sprintf("%s: %s", w.Code, w.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", w.Code, w.Step, w.Message)
+}
+
+const (
+	// LintSyntax: the expression doesn't compile.
+	LintSyntax = "syntax"
+	// LintDottedKey: fields like .kubernetes.io, probably meant as one key
+	// containing dots, which must be quoted.
+	LintDottedKey = "dotted-key"
+	// LintRecursiveWildcard: ..* selects every value of the document,
+	// which is expensive on large ones.
+	LintRecursiveWildcard = "recursive-wildcard"
+	// LintMixedQuotes: string literals use both single and double quotes.
+	LintMixedQuotes = "mixed-quotes"
+	// LintZeroStep: a slice with step 0, which fails on every array.
+	LintZeroStep = "zero-step"
+)
+
+// dottedKeyParts are the key segments that give away a domain-style key,
+// e.g. the "io" of app.kubernetes.io/name, parsed as the field "io/name".
+var dottedKeyParts = map[string]bool{
+	"com": true, "dev": true, "io": true, "net": true, "org": true, "sh": true,
+}
+
+// Lint reports likely mistakes in expr, meant for checking stored queries
+// in CI. An expression that doesn't compile gets a single LintSyntax
+// warning.
+func Lint(expr string) []Warning {
+	j, err := Compile(expr, CompileOptions{NoOptimize: true})
+	if err != nil {
+		return []Warning{{Code: LintSyntax, Message: err.Error()}}
+	}
+	warnings := []Warning{}
+	lintSteps(j.steps(), &warnings)
+	if usesMixedQuotes(expr) {
+		warnings = append(warnings, Warning{Code: LintMixedQuotes, Message: "string literals mix single and double quotes"})
+	}
+	return warnings
+}
+
+func lintSteps(steps []Node, warnings *[]Warning) {
+	for i, node := range steps {
+		switch node := node.(type) {
+		case *RecursiveNode:
+			if i+1 < len(steps) && isWildcardStep(steps[i+1]) {
+				*warnings = append(*warnings, Warning{
+					Code:    LintRecursiveWildcard,
+					Step:    formatSteps(steps[i : i+2]),
+					Message: "selects every value of the document; name the field looked for if possible",
+				})
+			}
+		case *FieldNode:
+			prev, ok := previousField(steps, i)
+			segment, _, _ := strings.Cut(node.Value, "/")
+			if ok && dottedKeyParts[segment] {
+				*warnings = append(*warnings, Warning{
+					Code:    LintDottedKey,
+					Step:    formatSteps(steps[i-1 : i+1]),
+					Message: fmt.Sprintf("looks like a key containing dots, which must be quoted, e.g. ['%s.%s']", prev, node.Value),
+				})
+			}
+		case *ArrayNode:
+			if node.Params[2].Known && node.Params[2].Value == 0 {
+				*warnings = append(*warnings, Warning{
+					Code:    LintZeroStep,
+					Step:    formatStep(node),
+					Message: "a slice step of 0 fails on every array",
+				})
+			}
+		case *UnionNode:
+			for _, branch := range node.Nodes {
+				lintSteps(flattenSteps(branch), warnings)
+			}
+		case *FilterNode:
+			lintOperand(node.Left, warnings)
+			lintOperand(node.Right, warnings)
+		case *FunctionNode:
+			for _, arg := range node.Args {
+				lintOperand(arg, warnings)
+			}
+		}
+	}
+}
+
+func lintOperand(operand *ListNode, warnings *[]Warning) {
+	if operand != nil {
+		lintSteps(flattenSteps(operand), warnings)
+	}
+}
+
+// previousField returns the name of the field step before steps[i], if
+// that's what it is.
+func previousField(steps []Node, i int) (string, bool) {
+	if i == 0 {
+		return "", false
+	}
+	field, ok := steps[i-1].(*FieldNode)
+	if !ok {
+		return "", false
+	}
+	return field.Value, true
+}
+
+// usesMixedQuotes reports whether the string literals of expr use both
+// kinds of quotes.
+func usesMixedQuotes(expr string) bool {
+	single, double := false, false
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			i++
+		case '\'', '"':
+			single = single || expr[i] == '\''
+			double = double || expr[i] == '"'
+			end := skipQuoted(expr, i)
+			if end < 0 {
+				return false
+			}
+			i = end - 1
+		}
+	}
+	return single && double
+}
@@ -0,0 +1,65 @@
+package jsonpath
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// maxLoggedPaths caps how many input paths are attached to a log event.
+const maxLoggedPaths = 10
+
+func (j *JSONPath) activeLogger() *slog.Logger {
+	if j.opts.Logger != nil {
+		return j.opts.Logger
+	}
+	return j.logger
+}
+
+func (j *JSONPath) debugEnabled() bool {
+	l := j.activeLogger()
+	return l != nil && l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func (j *JSONPath) debug(msg string, attrs ...slog.Attr) {
+	if !j.debugEnabled() {
+		return
+	}
+	j.activeLogger().LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// logStep reports a completed step. Lists only group other steps, so they
+// aren't reported on their own.
+func (j *JSONPath) logStep(input []cty.Value, node Node, results []cty.Value) {
+	if _, isList := node.(*ListNode); isList || !j.debugEnabled() {
+		return
+	}
+	j.debug("jsonpath: step",
+		slog.String("step", formatStep(node)),
+		slog.Int("in", len(input)),
+		slog.Int("out", len(results)),
+	)
+}
+
+// logStepError reports a failed step along with where its inputs are
+// located in the document.
+func (j *JSONPath) logStepError(input []cty.Value, node Node, err error) {
+	if _, isList := node.(*ListNode); isList || !j.debugEnabled() {
+		return
+	}
+	paths := []string{}
+	for _, value := range input {
+		if len(paths) == maxLoggedPaths {
+			break
+		}
+		if path, ok := valuePath(value); ok {
+			paths = append(paths, FormatPath(path))
+		}
+	}
+	j.debug("jsonpath: step failed",
+		slog.String("step", formatStep(node)),
+		slog.Any("paths", paths),
+		slog.Any("error", err),
+	)
+}
@@ -0,0 +1,165 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Match is a result of EvalMatches.
+type Match struct {
+	Value cty.Value
+	Path  cty.Path
+	// Trace lists, in evaluation order, the filter tests passed by the
+	// match or by the element it was selected from. It's only recorded
+	// with EvalOptions.Trace.
+	Trace []FilterTrace
+}
+
+// MatchList holds the results of EvalMatches, in document order.
+type MatchList []Match
+
+// Reverse returns the matches in reverse order, each with its own path.
+func (m MatchList) Reverse() MatchList {
+	out := make(MatchList, len(m))
+	for i, match := range m {
+		out[len(m)-1-i] = match
+	}
+	return out
+}
+
+// Len, Less and Swap sort matches in document order by path (see
+// SortPaths) with sort.Sort, e.g. after merging the results of several
+// expressions.
+func (m MatchList) Len() int           { return len(m) }
+func (m MatchList) Less(i, j int) bool { return pathBefore(m[i].Path, m[j].Path) }
+func (m MatchList) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// String shows the match as `$.store.book[0].price: 8.95`, see DebugString.
+func (m Match) String() string {
+	return FormatPath(m.Path) + ": " + DebugString(m.Value)
+}
+
+// String lists the matches one per line.
+func (m MatchList) String() string {
+	lines := make([]string, len(m))
+	for i, match := range m {
+		lines[i] = match.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MarshalJSON encodes the matches as an array of path/value pairs:
+//
+//	[{"path": "$.store.book[0].price", "value": 8.95}]
+//
+// Marks are dropped; unknown values can't be encoded.
+func (m MatchList) MarshalJSON() ([]byte, error) {
+	type pair struct {
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	pairs := make([]pair, len(m))
+	for i, match := range m {
+		v, _ := match.Value.UnmarkDeep()
+		b, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+		if err != nil {
+			return nil, newPathError(match.Path, ErrUnsupported, "%s", err)
+		}
+		pairs[i] = pair{FormatPath(match.Path), b}
+	}
+	return json.Marshal(pairs)
+}
+
+// FilterTrace records a filter test an element passed, as evidence of why
+// a match was included.
+type FilterTrace struct {
+	// Filter is the filter step, e.g. [?(@.price < 10)].
+	Filter string
+	// Path locates the element tested.
+	Path cty.Path
+	// Left and Right are the operand values compared. Right is cty.NilVal
+	// for existence tests, and both are for filters that are constant.
+	Left, Right cty.Value
+
+	node *FilterNode
+}
+
+// String shows the test with its operand values, e.g.
+// `$.store.book[0]: @.price=8.95 < 10`.
+func (t FilterTrace) String() string {
+	var b strings.Builder
+	b.WriteString(FormatPath(t.Path) + ": ")
+	if t.node == nil || t.Left == cty.NilVal {
+		b.WriteString(t.Filter)
+		return b.String()
+	}
+	if t.node.Operator == "exists" {
+		b.WriteString(formatOperand(t.node.Left) + " exists")
+		return b.String()
+	}
+	b.WriteString(traceOperand(t.node.Left, t.Left))
+	b.WriteString(" " + t.node.Operator + " " + traceOperand(t.node.Right, t.Right))
+	return b.String()
+}
+
+// traceOperand shows an operand with its value, unless it's a literal.
+func traceOperand(operand *ListNode, v cty.Value) string {
+	text := formatOperand(operand)
+	if _, ok := literalValue(operand); ok {
+		return text
+	}
+	return text + "=" + DebugString(v)
+}
+
+// EvalMatches is Eval returning the values and paths together, and with
+// EvalOptions.Trace (WithTrace), the filter tests behind each match.
+// Results are computed in one go, whatever EvalOptions.ChunkSize says.
+func (j *JSONPath) EvalMatches(data cty.Value, opts ...Option) (MatchList, error) {
+	s := settings{eval: j.defaults}
+	s.apply(opts)
+	var traces []FilterTrace
+	if s.eval.Trace {
+		s.eval.traces = &traces
+	}
+	s.eval.ChunkSize = 0
+	vals, paths, err := j.EvalWithOptions(data, s.eval)
+	if len(vals) != len(paths) {
+		return nil, newError(ErrInvariant, "%d values for %d paths", len(vals), len(paths))
+	}
+	matches := make(MatchList, len(vals))
+	for i := range vals {
+		matches[i] = Match{Value: vals[i], Path: paths[i]}
+		for _, t := range traces {
+			if len(t.Path) <= len(paths[i]) && pathsOverlap(t.Path, paths[i]) {
+				matches[i].Trace = append(matches[i].Trace, t)
+			}
+		}
+	}
+	return matches, err
+}
+
+// trace records that elem passed the filter node (see EvalOptions.Trace).
+func (j *JSONPath) trace(elem cty.Value, node *FilterNode, left, right cty.Value) {
+	path, ok := valuePath(elem)
+	if !ok {
+		return
+	}
+	unmark := func(v cty.Value) cty.Value {
+		if v == cty.NilVal {
+			return v
+		}
+		v, _ = v.UnmarkDeep()
+		return v
+	}
+	t := FilterTrace{Filter: formatStep(node), Path: path.Copy(), Left: unmark(left), Right: unmark(right), node: node}
+	for _, seen := range *j.opts.traces {
+		// e.g. tested again through another recursive descent
+		if seen.node == node && seen.Path.Equals(t.Path) {
+			return
+		}
+	}
+	*j.opts.traces = append(*j.opts.traces, t)
+}
@@ -0,0 +1,175 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Conflict is a location both sides of a three-way merge changed
+// differently. Missing values are cty.NilVal.
+type Conflict struct {
+	Path               cty.Path
+	Base, Ours, Theirs cty.Value
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("conflict at $%s", PrettyCtyPath(c.Path))
+}
+
+// Merge3 merges the edits ours and theirs made to base. Changes to
+// different attributes, map keys and array elements are combined; where
+// both sides changed the same location differently a Conflict is reported
+// and ours is kept. Arrays whose length changed on both sides differently
+// conflict as a whole. Marks are ignored.
+func Merge3(base, ours, theirs cty.Value) (cty.Value, []Conflict, error) {
+	base, _ = base.UnmarkDeep()
+	ours, _ = ours.UnmarkDeep()
+	theirs, _ = theirs.UnmarkDeep()
+	m := merger{}
+	merged, err := m.merge(cty.Path{}, base, ours, theirs)
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+	return merged, m.conflicts, nil
+}
+
+type merger struct {
+	conflicts []Conflict
+}
+
+func (m *merger) conflict(path cty.Path, base, ours, theirs cty.Value) cty.Value {
+	m.conflicts = append(m.conflicts, Conflict{Path: path.Copy(), Base: base, Ours: ours, Theirs: theirs})
+	return ours
+}
+
+func (m *merger) merge(path cty.Path, base, ours, theirs cty.Value) (cty.Value, error) {
+	switch {
+	case ours.RawEquals(theirs), theirs.RawEquals(base):
+		return ours, nil
+	case ours.RawEquals(base):
+		return theirs, nil
+	case !isContainer(base) || !isContainer(ours) || !isContainer(theirs):
+		return m.conflict(path, base, ours, theirs), nil
+	}
+	bt, ot, tt := base.Type(), ours.Type(), theirs.Type()
+	switch {
+	case isMapping(bt) && isMapping(ot) && isMapping(tt):
+		return m.mergeMapping(path, base, ours, theirs)
+	case isSequence(bt) && isSequence(ot) && isSequence(tt):
+		return m.mergeSequence(path, base, ours, theirs)
+	}
+	return m.conflict(path, base, ours, theirs), nil
+}
+
+func isContainer(v cty.Value) bool {
+	if v.IsNull() || !v.IsKnown() {
+		return false
+	}
+	ty := v.Type()
+	return isMapping(ty) || isSequence(ty)
+}
+
+func (m *merger) mergeMapping(path cty.Path, base, ours, theirs cty.Value) (cty.Value, error) {
+	b, o, t := base.AsValueMap(), ours.AsValueMap(), theirs.AsValueMap()
+	keys := map[string]bool{}
+	for _, attrs := range []map[string]cty.Value{b, o, t} {
+		for k := range attrs {
+			keys[k] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	out := map[string]cty.Value{}
+	for _, k := range sorted {
+		bv, inBase := b[k]
+		ov, inOurs := o[k]
+		tv, inTheirs := t[k]
+		at := path.GetAttr(k)
+		switch {
+		case !inOurs && !inTheirs:
+			// deleted on both sides
+		case inOurs && inTheirs:
+			v, err := m.merge(at, orNull(bv, inBase), ov, tv)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			out[k] = v
+		case !inBase:
+			// added on one side only
+			if inOurs {
+				out[k] = ov
+			} else {
+				out[k] = tv
+			}
+		case inOurs && ov.RawEquals(bv), inTheirs && tv.RawEquals(bv):
+			// deleted on one side, untouched on the other
+		case inOurs:
+			out[k] = m.conflict(at, bv, ov, cty.NilVal)
+		case inTheirs:
+			// ours deleted it: keep it deleted
+			m.conflict(at, bv, cty.NilVal, tv)
+		}
+	}
+	return rebuildMapping(ours.Type(), out), nil
+}
+
+func orNull(v cty.Value, ok bool) cty.Value {
+	if !ok {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	return v
+}
+
+func (m *merger) mergeSequence(path cty.Path, base, ours, theirs cty.Value) (cty.Value, error) {
+	b, o, t := base.AsValueSlice(), ours.AsValueSlice(), theirs.AsValueSlice()
+	switch {
+	case len(o) == len(b) && len(t) == len(b):
+	case len(t) == len(b) && sameSlice(b, t):
+		return ours, nil
+	case len(o) == len(b) && sameSlice(b, o):
+		return theirs, nil
+	default:
+		return m.conflict(path, base, ours, theirs), nil
+	}
+	out := make([]cty.Value, len(b))
+	for i := range b {
+		v, err := m.merge(path.IndexInt(i), b[i], o[i], t[i])
+		if err != nil {
+			return cty.NilVal, err
+		}
+		out[i] = v
+	}
+	if ours.Type().IsListType() && len(out) > 0 && sameElementTypes(out) {
+		return cty.ListVal(out), nil
+	}
+	return cty.TupleVal(out), nil
+}
+
+func sameSlice(a, b []cty.Value) bool {
+	for i := range a {
+		if !a[i].RawEquals(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildMapping returns attrs as a map when ty is a map type and the
+// values allow it, and as an object otherwise.
+func rebuildMapping(ty cty.Type, attrs map[string]cty.Value) cty.Value {
+	if ty.IsMapType() {
+		if len(attrs) == 0 {
+			return cty.MapValEmpty(ty.ElementType())
+		}
+		if sameElementTypes(mapValues(attrs)) {
+			return cty.MapVal(attrs)
+		}
+	}
+	return cty.ObjectVal(attrs)
+}
@@ -0,0 +1,86 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Metrics collects per-step statistics of evaluations. Pass it through
+// EvalOptions.Metrics; repeated evaluations of a compiled expression
+// accumulate into the same steps, and evaluations of other ones append
+// theirs.
+type Metrics struct {
+	Steps []StepMetrics
+
+	index map[Node]int
+}
+
+// StepMetrics describes one step of the expression.
+type StepMetrics struct {
+	// Step is the step in JSONPath syntax, e.g. `..` or `[?(@.a > 1)]`.
+	Step string
+	// Calls counts how often the step ran (more than once with chunking).
+	Calls int
+	// Duration is the cumulative time spent in the step.
+	Duration time.Duration
+	// Input and Output are the cumulative numbers of values going into and
+	// coming out of the step.
+	Input  int
+	Output int
+}
+
+// Explain evaluates the expression against data and reports how much time
+// and how many values each step accounted for.
+func (j *JSONPath) Explain(data cty.Value) (*Metrics, error) {
+	m := &Metrics{}
+	_, _, err := j.EvalWithOptions(data, EvalOptions{Metrics: m})
+	return m, err
+}
+
+// String formats the metrics as a table.
+func (m *Metrics) String() string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tCALLS\tTIME\tIN\tOUT")
+	var total time.Duration
+	for _, step := range m.Steps {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\n", step.Step, step.Calls, step.Duration, step.Input, step.Output)
+		total += step.Duration
+	}
+	fmt.Fprintf(w, "total\t\t%s\t\t\n", total)
+	w.Flush()
+	return buf.String()
+}
+
+// prepare registers steps, except those already registered by an earlier
+// evaluation of the same expression.
+func (m *Metrics) prepare(steps []Node) {
+	if m.index == nil {
+		m.index = map[Node]int{}
+	}
+	for _, node := range steps {
+		if _, ok := m.index[node]; ok {
+			continue
+		}
+		m.index[node] = len(m.Steps)
+		m.Steps = append(m.Steps, StepMetrics{Step: formatStep(node)})
+	}
+}
+
+// record accounts a run of node, ignoring nodes that aren't top-level steps
+// (e.g. the operands of a filter, which count towards the filter itself).
+func (m *Metrics) record(node Node, in, out int, elapsed time.Duration) {
+	i, ok := m.index[node]
+	if !ok {
+		return
+	}
+	step := &m.Steps[i]
+	step.Calls++
+	step.Duration += elapsed
+	step.Input += in
+	step.Output += out
+}
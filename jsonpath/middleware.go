@@ -0,0 +1,28 @@
+package jsonpath
+
+import "github.com/zclconf/go-cty/cty"
+
+// EvalFunc evaluates a path, as EvalWithOptions does.
+type EvalFunc func(data cty.Value, opts EvalOptions) ([]cty.Value, []cty.Path, error)
+
+// Middleware wraps the evaluations of a path, for caching, metrics, access
+// checks, tracing spans and the like. It may inspect or change the document
+// and options, call next any number of times (or not at all) and inspect or
+// change the results.
+type Middleware func(next EvalFunc) EvalFunc
+
+// Use adds middleware around every evaluation of j through Eval,
+// EvalWithOptions and EvalMatches. The first middleware added is the
+// outermost. Use must not be called while j is being evaluated.
+func (j *JSONPath) Use(mw ...Middleware) {
+	j.middleware = append(j.middleware, mw...)
+}
+
+// chain returns j's evaluation wrapped in its middleware.
+func (j *JSONPath) chain() EvalFunc {
+	eval := EvalFunc(j.evalWithOptions)
+	for i := len(j.middleware) - 1; i >= 0; i-- {
+		eval = j.middleware[i](eval)
+	}
+	return eval
+}
@@ -0,0 +1,86 @@
+package jsonpath
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Migration upgrades documents from the previous version to Version.
+// Transform edits the document through a transaction, with the Set, Delete,
+// Move and Patch primitives; returning an error aborts the migration.
+type Migration struct {
+	Version     int
+	Description string
+	Transform   func(t *Txn) error
+}
+
+// MigrationError reports the migration that failed.
+type MigrationError struct {
+	Version     int
+	Description string
+	Err         error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration to version %d (%s): %s", e.Version, e.Description, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// Migrate upgrades doc from version from to version to by running the
+// migrations in between in version order, and returns the upgraded
+// document along with the JSON Patch turning doc into it. Every version
+// from from+1 to to needs exactly one migration, or Migrate fails with
+// ErrNotFound or ErrConflict before running any. A failing migration is
+// reported as a *MigrationError and leaves doc untouched.
+//
+// With WithDryRun, Migrate runs the migrations but returns doc unchanged,
+// storing the changes they would make; the patch is returned either way.
+func Migrate(doc cty.Value, from, to int, migrations []Migration, opts ...Option) (cty.Value, []byte, error) {
+	s := newSettings(opts)
+	if to < from {
+		return doc, nil, newError(ErrUnsupported, "can't migrate down from version %d to %d", from, to)
+	}
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		if m.Version <= from || m.Version > to {
+			continue
+		}
+		if _, ok := byVersion[m.Version]; ok {
+			return doc, nil, newError(ErrConflict, "several migrations to version %d", m.Version)
+		}
+		byVersion[m.Version] = m
+	}
+	steps := make([]Migration, 0, to-from)
+	for v := from + 1; v <= to; v++ {
+		m, ok := byVersion[v]
+		if !ok {
+			return doc, nil, newError(ErrNotFound, "no migration to version %d", v)
+		}
+		steps = append(steps, m)
+	}
+
+	txn := NewDocument(doc).Begin()
+	for _, m := range steps {
+		if err := m.Transform(txn); err != nil {
+			return doc, nil, &MigrationError{Version: m.Version, Description: m.Description, Err: err}
+		}
+	}
+	migrated := txn.Value()
+	changes, err := Diff(doc, migrated, DiffOptions{})
+	if err != nil {
+		return doc, nil, err
+	}
+	patch, err := MarshalPatch(changes)
+	if err != nil {
+		return doc, nil, err
+	}
+	if s.dryRun != nil {
+		*s.dryRun = changes
+		return doc, patch, nil
+	}
+	return migrated, patch, nil
+}
@@ -0,0 +1,47 @@
+package jsonpath
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The Must variants panic instead of returning an error. They are meant for
+// tests and for package-level expressions known to be valid. The panic value
+// is an error naming the expression and wrapping the original one, so a
+// recovered value still works with errors.Is and errors.As (e.g. to get at a
+// *PathError).
+
+// MustNewPath is like NewPath but panics if the expression doesn't parse.
+func MustNewPath(jsonPath string, opts ...Option) *JSONPath {
+	v, err := NewPath(jsonPath, opts...)
+	mustSucceed(jsonPath, err)
+	return v
+}
+
+// MustCompile is like Compile but panics if the expression doesn't parse.
+func MustCompile(jsonPath string, opts CompileOptions) *JSONPath {
+	v, err := Compile(jsonPath, opts)
+	mustSucceed(jsonPath, err)
+	return v
+}
+
+// MustRead is like Read but panics on failure.
+func MustRead(doc cty.Value, jsonPath string) cty.Value {
+	v, err := Read(doc, jsonPath)
+	mustSucceed(jsonPath, err)
+	return v
+}
+
+// MustSet is like Set but panics on failure.
+func MustSet(doc cty.Value, jsonPath string, value cty.Value) cty.Value {
+	v, err := Set(doc, jsonPath, value)
+	mustSucceed(jsonPath, err)
+	return v
+}
+
+func mustSucceed(jsonPath string, err error) {
+	if err != nil {
+		panic(fmt.Errorf("jsonpath %q: %w", jsonPath, err))
+	}
+}
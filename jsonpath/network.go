@@ -0,0 +1,62 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"net/netip"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// cidrContains implements cidr_contains(cidr, address), which tells whether
+// address, an IP or a CIDR block, lies within cidr. Addresses that don't
+// parse are not contained.
+func init() {
+	functions["cidr_contains"] = filterFunc{params: 2, impl: cidrContains, check: checkCIDRLiteral}
+	functions["is_ip"] = filterFunc{params: 1, impl: isIP}
+}
+
+func cidrContains(args []cty.Value) (cty.Value, error) {
+	s, err := stringArg("cidr_contains", args[0])
+	if err != nil {
+		return cty.NilVal, err
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return cty.NilVal, newError(ErrTypeMismatch, "invalid CIDR %q", s)
+	}
+	addr := args[1]
+	if addr.IsNull() || !addr.IsKnown() || addr.Type() != cty.String {
+		return cty.False, nil
+	}
+	if ip, err := netip.ParseAddr(addr.AsString()); err == nil {
+		return cty.BoolVal(prefix.Contains(ip.Unmap())), nil
+	}
+	if sub, err := netip.ParsePrefix(addr.AsString()); err == nil {
+		return cty.BoolVal(sub.Bits() >= prefix.Bits() && prefix.Contains(sub.Addr())), nil
+	}
+	return cty.False, nil
+}
+
+// checkCIDRLiteral rejects a malformed literal CIDR at compile time.
+func checkCIDRLiteral(args []*ListNode) error {
+	cidr, ok := literalValue(args[0])
+	if !ok || cidr.Type() != cty.String {
+		return nil
+	}
+	if _, err := netip.ParsePrefix(cidr.AsString()); err != nil {
+		return newError(ErrSyntax, "cidr_contains: invalid CIDR %q", cidr.AsString())
+	}
+	return nil
+}
+
+// isIP implements is_ip(s), which tells whether s is an IPv4 or IPv6
+// address.
+func isIP(args []cty.Value) (cty.Value, error) {
+	v := args[0]
+	if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return cty.False, nil
+	}
+	_, err := netip.ParseAddr(v.AsString())
+	return cty.BoolVal(err == nil), nil
+}
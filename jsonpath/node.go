@@ -16,7 +16,10 @@ limitations under the License.
 
 package jsonpath
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
 
 // NodeType identifies the type of a parse tree node.
 type NodeType int
@@ -43,6 +46,10 @@ const (
 	NodeRecursive
 	NodeUnion
 	NodeBool
+	NodeRegex
+	NodeRoot
+	NodeFunction
+	NodeDoc
 )
 
 var NodeTypeName = map[NodeType]string{
@@ -58,6 +65,10 @@ var NodeTypeName = map[NodeType]string{
 	NodeRecursive:  "NodeRecursive",
 	NodeUnion:      "NodeUnion",
 	NodeBool:       "NodeBool",
+	NodeRegex:      "NodeRegex",
+	NodeRoot:       "NodeRoot",
+	NodeFunction:   "NodeFunction",
+	NodeDoc:        "NodeDoc",
 }
 
 type Node interface {
@@ -101,6 +112,9 @@ func (t *TextNode) String() string {
 type FieldNode struct {
 	NodeType
 	Value string
+	// merged are the attribute steps right after this one, which optimize
+	// lets it look up in the same pass
+	merged []*FieldNode
 }
 
 func newField(value string) *FieldNode {
@@ -148,6 +162,15 @@ func newArray(params [3]ParamsEntry) *ArrayNode {
 	}
 }
 
+// newIndex returns the selector of a single index, as parsed from [i].
+func newIndex(i int) *ArrayNode {
+	return newArray([3]ParamsEntry{
+		{Value: i, Known: true},
+		{Value: i + 1, Known: true, Derived: true},
+		{},
+	})
+}
+
 func (a *ArrayNode) String() string {
 	return fmt.Sprintf("%s: %v", a.Type(), a.Params)
 }
@@ -253,4 +276,71 @@ func newBool(value bool) *BoolNode {
 
 func (b *BoolNode) String() string {
 	return fmt.Sprintf("%s: %t", b.Type(), b.Value)
-}
\ No newline at end of file
+}
+
+// RegexNode selects the object attributes or map keys matching a regex
+type RegexNode struct {
+	NodeType
+	Regexp *regexp.Regexp
+}
+
+func newRegex(re *regexp.Regexp) *RegexNode {
+	return &RegexNode{NodeType: NodeRegex, Regexp: re}
+}
+
+func (r *RegexNode) String() string {
+	return fmt.Sprintf("%s: %s", r.Type(), r.Regexp)
+}
+
+// RootNode refers to the document root from inside a filter, as in
+// [?(@.size > $.limits.size)]
+type RootNode struct {
+	NodeType
+}
+
+func newRoot() *RootNode {
+	return &RootNode{NodeType: NodeRoot}
+}
+
+func (r *RootNode) String() string {
+	return r.Type().String()
+}
+
+// FunctionNode calls a function on its arguments inside a filter, as in
+// [?(length(@.items) > 2)], or as a step (see Method).
+type FunctionNode struct {
+	NodeType
+	Name string
+	Args []*ListNode
+	// Property marks a length call written as a property, as in
+	// [?(@.items.length > 2)]. An object or map with a "length" key
+	// yields that key instead.
+	Property bool
+	// Method marks a call written as a step, as in $.csv.split(',')[2],
+	// whose first argument is the current value. Its results are found at
+	// the path of that value.
+	Method bool
+}
+
+func newFunction(name string, args []*ListNode) *FunctionNode {
+	return &FunctionNode{NodeType: NodeFunction, Name: name, Args: args}
+}
+
+func (f *FunctionNode) String() string {
+	return fmt.Sprintf("%s: %s%v", f.Type(), f.Name, f.Args)
+}
+
+// DocNode refers to another document of a Store, as in
+// $doc("limits").size or [?(@.size > $doc("limits").size)]
+type DocNode struct {
+	NodeType
+	Name string
+}
+
+func newDoc(name string) *DocNode {
+	return &DocNode{NodeType: NodeDoc, Name: name}
+}
+
+func (d *DocNode) String() string {
+	return fmt.Sprintf("%s: %s", d.Type(), d.Name)
+}
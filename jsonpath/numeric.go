@@ -0,0 +1,81 @@
+package jsonpath
+
+import (
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// AsInt64Exact returns the matched number as an int64. Unlike
+// cty.Value.AsBigFloat().Int64(), it fails with ErrOverflow rather than
+// truncating numbers with a fractional part or out of range, which
+// matters for IDs and amounts of money.
+func (m Match) AsInt64Exact() (int64, error) {
+	n, err := m.number()
+	if err != nil {
+		return 0, err
+	}
+	i, acc := n.Int64()
+	if acc != big.Exact {
+		return 0, m.errorf(ErrOverflow, "%s is not an int64", n.Text('g', -1))
+	}
+	return i, nil
+}
+
+// AsUint64 is AsInt64Exact for unsigned numbers: negative numbers fail
+// with ErrOverflow too.
+func (m Match) AsUint64() (uint64, error) {
+	n, err := m.number()
+	if err != nil {
+		return 0, err
+	}
+	u, acc := n.Uint64()
+	if acc != big.Exact {
+		return 0, m.errorf(ErrOverflow, "%s is not a uint64", n.Text('g', -1))
+	}
+	return u, nil
+}
+
+// AsDecimalString returns the matched number in plain decimal notation,
+// with as many digits as it takes to represent it without loss, e.g.
+// "12345678901234567890.01". Numbers beyond about 1e±1200, which would
+// take that many digits, fail with ErrOverflow.
+func (m Match) AsDecimalString() (string, error) {
+	n, err := m.number()
+	if err != nil {
+		return "", err
+	}
+	if exp := n.MantExp(nil); exp > maxDecimalExp || exp < -maxDecimalExp {
+		return "", m.errorf(ErrOverflow, "%s is too large to print in decimal", n.Text('g', 10))
+	}
+	return n.Text('f', -1), nil
+}
+
+// maxDecimalExp bounds the binary exponent of the numbers AsDecimalString
+// prints, which otherwise grow without limit.
+const maxDecimalExp = 4096
+
+// number returns the matched value as a number.
+func (m Match) number() (*big.Float, error) {
+	v, _ := m.Value.UnmarkDeep()
+	switch {
+	case v == cty.NilVal || !v.IsKnown():
+		return nil, m.errorf(ErrTypeMismatch, "the value is unknown")
+	case v.IsNull():
+		return nil, m.errorf(ErrTypeMismatch, "the value is null")
+	case !v.Type().Equals(cty.Number):
+		return nil, m.errorf(ErrTypeMismatch, "%s is not a number", v.Type().FriendlyName())
+	}
+	n := v.AsBigFloat()
+	if n.IsInf() {
+		return nil, m.errorf(ErrOverflow, "%s is not finite", n.Text('g', -1))
+	}
+	return n, nil
+}
+
+func (m Match) errorf(kind error, format string, args ...interface{}) error {
+	if m.Path == nil {
+		return newError(kind, format, args...)
+	}
+	return newPathError(m.Path, kind, format, args...)
+}
@@ -0,0 +1,95 @@
+package jsonpath
+
+// optimize rewrites a parsed expression into an equivalent form that is
+// cheaper to evaluate: the nested lists produced by the parser become a
+// single flat step sequence, runs of attribute steps like .spec.template.spec
+// are looked up in a single pass, and filters comparing two literals are
+// decided once instead of for every element.
+func optimize(root *ListNode) {
+	for i, node := range root.Nodes {
+		if list, ok := node.(*ListNode); ok {
+			root.Nodes[i] = optimizeList(list)
+		}
+	}
+}
+
+func optimizeList(list *ListNode) *ListNode {
+	flat := newList()
+	for _, node := range flattenSteps(list) {
+		switch node := node.(type) {
+		case *FilterNode:
+			flat.append(foldFilter(node))
+		case *UnionNode:
+			for i, branch := range node.Nodes {
+				node.Nodes[i] = optimizeList(branch)
+			}
+			flat.append(node)
+		default:
+			flat.append(node)
+		}
+	}
+	mergeFields(flat.Nodes)
+	return flat
+}
+
+// mergeFields records each run of consecutive attribute steps on its first
+// step. The steps themselves stay in place for everything inspecting the
+// expression; evalList looks the whole run up at once when no step needs to
+// be observed on its own.
+func mergeFields(nodes []Node) {
+	for i := 0; i < len(nodes); i++ {
+		head, ok := nodes[i].(*FieldNode)
+		if !ok {
+			continue
+		}
+		head.merged = nil
+		for i+1 < len(nodes) {
+			next, ok := nodes[i+1].(*FieldNode)
+			if !ok {
+				break
+			}
+			head.merged = append(head.merged, next)
+			i++
+		}
+	}
+}
+
+// foldFilter replaces a filter whose outcome doesn't depend on the element
+// with a literal [?(true)] or [?(false)]. Comparisons that fail are kept so
+// they still report their error at evaluation time.
+func foldFilter(node *FilterNode) Node {
+	node.Left = optimizeList(node.Left)
+	node.Right = optimizeList(node.Right)
+
+	left, ok := literalValue(node.Left)
+	if !ok {
+		return node
+	}
+	// a lone literal is a condition, see Truthy
+	pass := Truthy(left)
+	if node.Operator != "exists" {
+		right, ok := literalValue(node.Right)
+		if !ok {
+			return node
+		}
+		var err error
+		if pass, err = compareValues(node.Operator, left, right); err != nil {
+			return node
+		}
+	}
+	constant := newList()
+	constant.append(newBool(pass))
+	return newFilter(constant, newList(), "exists")
+}
+
+// constantFilter reports the outcome of a filter folded by foldFilter.
+func constantFilter(node *FilterNode) (pass, ok bool) {
+	if node.Operator != "exists" || len(node.Left.Nodes) != 1 {
+		return false, false
+	}
+	b, ok := node.Left.Nodes[0].(*BoolNode)
+	if !ok {
+		return false, false
+	}
+	return b.Value, true
+}
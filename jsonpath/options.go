@@ -0,0 +1,423 @@
+package jsonpath
+
+import (
+	"log/slog"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EvalOptions tweaks how an expression is evaluated. The zero value gives
+// the default behaviour of Eval.
+type EvalOptions struct {
+	// SortedBy lists arrays known to be sorted in ascending order. An
+	// equality filter on the sort key of such an array, e.g.
+	// `$.records[?(@.id == 42)]`, binary-searches instead of scanning.
+	SortedBy []SortedHint
+
+	// ChunkSize bounds how many intermediate values a step hands to the
+	// next one at a time (see EvalChunked). Zero disables chunking.
+	ChunkSize int
+
+	// MaxResultBytes caps the estimated size (string bytes plus element
+	// counts) of the final result; the values steps pass on to the next
+	// ones, like the subtrees `..` visits, don't count. Exceeding it fails
+	// the evaluation with a *BudgetError, matching ErrBudgetExceeded. Zero
+	// means unlimited.
+	MaxResultBytes int
+
+	// MaxDepth, when positive, fails evaluations of documents nested more
+	// than MaxDepth levels deep with ErrUnsupported, before any work that
+	// grows with depth: tracking the paths of deeply nested values costs
+	// time and memory more than linear in the depth, so services
+	// evaluating untrusted documents should set it.
+	MaxDepth int
+
+	// Metrics, when set, receives per-step timings and cardinalities.
+	Metrics *Metrics
+
+	// Logger receives debug events for every step of the evaluation and
+	// for failures. It overrides CompileOptions.Logger.
+	Logger *slog.Logger
+
+	// PartialResults makes a failing union selector drop only its own
+	// matches: the evaluation carries on and returns the matches of the
+	// other selectors together with a *MultiPathError of *BranchError values.
+	PartialResults bool
+
+	// UnionLimit caps the matches each selector of a union contributes,
+	// counted after the steps following the union, so
+	// `$['errors','warnings'][?(@.level > 2)]` yields at most UnionLimit
+	// errors and UnionLimit warnings. Each selector's matches are carried
+	// through the remaining steps one at a time, and the selector stops as
+	// soon as its quota is met. Zero means unlimited. It is ignored with
+	// ChunkSize.
+	UnionLimit int
+
+	// Interner, when set, makes identical result values share memory:
+	// every result goes through Interner.Intern.
+	Interner *Interner
+
+	// Context, when set, supplies the buffers and caches of the
+	// evaluation, see EvalContext.
+	Context *EvalContext
+
+	// ElementErrors decides whether a step failing on one of its input
+	// values, or a filter failing on one element, fails the evaluation
+	// (the default), drops that value, or drops it and reports it in a
+	// *MultiPathError of *ElementError values next to the other results.
+	ElementErrors ElementErrors
+
+	// OutOfRange decides what a single index past either end of an array,
+	// e.g. `$.items[5]` on three items, selects: nothing but an
+	// ErrIndexOutOfBounds error by default, the nearest element, nothing,
+	// or the element the index wraps around to. Templates usually want
+	// OutOfRangeEmpty while validators want the error.
+	OutOfRange OutOfRange
+
+	// StringIndexes lets indexes and slices select from strings by rune,
+	// as in other JSONPath engines: `$.name[0]` is the first character and
+	// `$.name[0:3]` the first three, while they fail with ErrTypeMismatch
+	// by default. `[*]` still selects nothing from a string. The results
+	// are found at the path of their string, so writes through them fail
+	// with ErrUnsupported rather than replace the whole string.
+	StringIndexes bool
+
+	// NumericKeys lets a single index select the key of the same name on
+	// objects and maps, so `$.years[2023]` reads `{"years": {"2023": ...}}`
+	// instead of failing with ErrTypeMismatch.
+	NumericKeys bool
+
+	// ResolveRefs replaces objects of the form {"$ref": "#/a/b"} by the
+	// value the JSON Reference points to in the same document, as found in
+	// OpenAPI specs, before selecting from them and in the results. Result
+	// paths are those of the referenced values. Recursive descent doesn't
+	// follow references.
+	ResolveRefs bool
+
+	// DecimalNumbers makes filters compare numbers as decimals of 16
+	// significant digits, like IEEE 754 decimal64, so 0.3 in a document
+	// equals the literal 0.3 and sums of amounts equal the expected total,
+	// whatever binary precision the numbers were parsed or computed with.
+	DecimalNumbers bool
+
+	// MemoizeFilters remembers the outcome of every filter for each
+	// distinct element during the evaluation, so structurally identical
+	// elements (e.g. from templated arrays) are only tested once. It costs
+	// hashing every filtered element, which pays off when filters are
+	// expensive or elements repeat a lot.
+	MemoizeFilters bool
+
+	// Unknowns, when set, receives the paths of the unknown values (e.g.
+	// cty.DynamicVal in a plan) the evaluation couldn't look into, and of
+	// the elements a filter couldn't decide on because an operand is
+	// unknown. Matches may hide there; the known parts of the document are
+	// evaluated as usual either way.
+	Unknowns *[]cty.Path
+
+	// Distinct, when set, drops the results equal under these options to
+	// an earlier result, e.g. the same label found through several
+	// references.
+	Distinct *EqualOptions
+
+	// Trace records, for EvalMatches, the filter tests each match passed
+	// along with the operand values compared, e.g. @.price=8.95 < 10. It
+	// disables MemoizeFilters and SortedBy, since every element has to be
+	// tested for its own trace.
+	Trace bool
+	// traces receives the tests recorded with Trace.
+	traces *[]FilterTrace
+	// writes marks evaluations locating the values a write replaces or
+	// removes, which fail on matches computed from the document rather
+	// than found in it (see writePaths).
+	writes bool
+
+	// Documents resolves the names of $doc("name") references. A Store
+	// sets it to look up its own documents.
+	Documents func(name string) (cty.Value, bool)
+}
+
+// OutOfRange is how an array index past either end is handled (see
+// EvalOptions.OutOfRange).
+type OutOfRange int
+
+const (
+	// OutOfRangeError fails with ErrIndexOutOfBounds.
+	OutOfRangeError OutOfRange = iota
+	// OutOfRangeClamp selects the first or last element instead.
+	OutOfRangeClamp
+	// OutOfRangeEmpty selects nothing, as a slice would.
+	OutOfRangeEmpty
+	// OutOfRangeWrap counts the index modulo the length of the array, so
+	// [3] on three elements selects the first one and [-4] the last.
+	OutOfRangeWrap
+)
+
+// SortedHint declares that the array at Path is sorted ascending by the
+// attribute Key of its elements. An empty Key means the elements themselves
+// are sorted (and are matched by `[?(@ == value)]`).
+//
+// Elements must all be numbers or all be strings; if the array turns out to
+// be unsortable the filter falls back to a regular scan.
+type SortedHint struct {
+	Path cty.Path
+	Key  string
+}
+
+// sortedKey returns the sort key hinted for the array located at path.
+func (o EvalOptions) sortedKey(path cty.Path) (string, bool) {
+	for _, hint := range o.SortedBy {
+		if len(hint.Path) == len(path) && pathsOverlap(hint.Path, path) {
+			return hint.Key, true
+		}
+	}
+	return "", false
+}
+
+// Option configures NewPath, Eval and NewDocument. Options are an
+// alternative to filling in CompileOptions and EvalOptions by hand: the same
+// Option can be passed wherever it makes sense, and each entry point picks
+// the settings it understands.
+//
+//	p, err := NewPath("$.items[?(@.price < 10)]", WithDialect(DialectOjg), WithPartialResults())
+//	vals, paths, err := p.Eval(doc, WithNumericKeys())
+//
+// Compile-time options given to Eval are ignored, since the expression is
+// already parsed by then.
+type Option func(*settings)
+
+type settings struct {
+	compile    CompileOptions
+	eval       EvalOptions
+	jsonOutput bool
+	// path is set by the options that affect expressions
+	path bool
+
+	historyLimit int
+	cache        *ResultCache
+
+	internKeys   bool
+	missingPaths MissingPaths
+	stripMarks   bool
+	dryRun       *[]Change
+
+	keyCollisions KeyCollisions
+}
+
+func newSettings(opts []Option) settings {
+	var s settings
+	s.apply(opts)
+	return s
+}
+
+func (s *settings) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(s)
+	}
+}
+
+// pathOption marks an Option as affecting how expressions are compiled or
+// evaluated, as opposed to configuring a Document.
+func pathOption(f func(*settings)) Option {
+	return func(s *settings) {
+		s.path = true
+		f(s)
+	}
+}
+
+// WithLogger sets CompileOptions.Logger, and so the logger used by every
+// evaluation of the path.
+func WithLogger(logger *slog.Logger) Option {
+	return pathOption(func(s *settings) {
+		s.compile.Logger = logger
+		s.eval.Logger = logger
+	})
+}
+
+// WithoutOptimization sets CompileOptions.NoOptimize.
+func WithoutOptimization() Option {
+	return pathOption(func(s *settings) { s.compile.NoOptimize = true })
+}
+
+// WithDialect sets CompileOptions.Dialect.
+func WithDialect(dialect Dialect) Option {
+	return pathOption(func(s *settings) { s.compile.Dialect = dialect })
+}
+
+// WithFunctions adds to CompileOptions.EnableFunctions.
+func WithFunctions(names ...string) Option {
+	return pathOption(func(s *settings) {
+		s.compile.EnableFunctions = append(s.compile.EnableFunctions, names...)
+	})
+}
+
+// WithAllowedFeatures sets CompileOptions.AllowedFeatures.
+func WithAllowedFeatures(features ...Feature) Option {
+	return pathOption(func(s *settings) {
+		s.compile.AllowedFeatures = append([]Feature{}, features...)
+	})
+}
+
+// WithMaxRegexLength sets CompileOptions.MaxRegexLength.
+func WithMaxRegexLength(n int) Option {
+	return pathOption(func(s *settings) { s.compile.MaxRegexLength = n })
+}
+
+// WithTracing sets CompileOptions.StartSpan.
+func WithTracing(start StartSpan) Option {
+	return pathOption(func(s *settings) { s.compile.StartSpan = start })
+}
+
+// WithStats sets CompileOptions.Stats.
+func WithStats(stats *Stats) Option {
+	return pathOption(func(s *settings) { s.compile.Stats = stats })
+}
+
+// WithJSONOutput is EnableJSONOutput(true).
+func WithJSONOutput() Option {
+	return pathOption(func(s *settings) { s.jsonOutput = true })
+}
+
+// WithSortedBy adds to EvalOptions.SortedBy.
+func WithSortedBy(hints ...SortedHint) Option {
+	return pathOption(func(s *settings) {
+		s.eval.SortedBy = append(s.eval.SortedBy[:len(s.eval.SortedBy):len(s.eval.SortedBy)], hints...)
+	})
+}
+
+// WithChunkSize sets EvalOptions.ChunkSize.
+func WithChunkSize(n int) Option {
+	return pathOption(func(s *settings) { s.eval.ChunkSize = n })
+}
+
+// WithMaxResultBytes sets EvalOptions.MaxResultBytes.
+func WithMaxResultBytes(n int) Option {
+	return pathOption(func(s *settings) { s.eval.MaxResultBytes = n })
+}
+
+// WithMetrics sets EvalOptions.Metrics.
+func WithMetrics(m *Metrics) Option {
+	return pathOption(func(s *settings) { s.eval.Metrics = m })
+}
+
+// WithPartialResults sets EvalOptions.PartialResults.
+func WithPartialResults() Option {
+	return pathOption(func(s *settings) { s.eval.PartialResults = true })
+}
+
+// WithInterner sets EvalOptions.Interner.
+func WithInterner(in *Interner) Option {
+	return pathOption(func(s *settings) { s.eval.Interner = in })
+}
+
+// WithEvalContext sets EvalOptions.Context.
+func WithEvalContext(c *EvalContext) Option {
+	return pathOption(func(s *settings) { s.eval.Context = c })
+}
+
+// WithMaxDepth sets EvalOptions.MaxDepth.
+func WithMaxDepth(n int) Option {
+	return pathOption(func(s *settings) { s.eval.MaxDepth = n })
+}
+
+// WithUnionLimit sets EvalOptions.UnionLimit.
+func WithUnionLimit(n int) Option {
+	return pathOption(func(s *settings) { s.eval.UnionLimit = n })
+}
+
+// WithElementErrors sets EvalOptions.ElementErrors.
+func WithElementErrors(policy ElementErrors) Option {
+	return pathOption(func(s *settings) { s.eval.ElementErrors = policy })
+}
+
+// WithOutOfRange sets EvalOptions.OutOfRange.
+func WithOutOfRange(mode OutOfRange) Option {
+	return pathOption(func(s *settings) { s.eval.OutOfRange = mode })
+}
+
+// WithStringIndexes sets EvalOptions.StringIndexes.
+func WithStringIndexes() Option {
+	return pathOption(func(s *settings) { s.eval.StringIndexes = true })
+}
+
+// WithNumericKeys sets EvalOptions.NumericKeys.
+func WithNumericKeys() Option {
+	return pathOption(func(s *settings) { s.eval.NumericKeys = true })
+}
+
+// WithResolveRefs sets EvalOptions.ResolveRefs.
+func WithResolveRefs() Option {
+	return pathOption(func(s *settings) { s.eval.ResolveRefs = true })
+}
+
+// WithDecimalNumbers sets EvalOptions.DecimalNumbers.
+func WithDecimalNumbers() Option {
+	return pathOption(func(s *settings) { s.eval.DecimalNumbers = true })
+}
+
+// WithMemoizedFilters sets EvalOptions.MemoizeFilters.
+func WithMemoizedFilters() Option {
+	return pathOption(func(s *settings) { s.eval.MemoizeFilters = true })
+}
+
+// WithUnknowns sets EvalOptions.Unknowns.
+func WithUnknowns(paths *[]cty.Path) Option {
+	return pathOption(func(s *settings) { s.eval.Unknowns = paths })
+}
+
+// WithTrace sets EvalOptions.Trace.
+func WithTrace() Option {
+	return pathOption(func(s *settings) { s.eval.Trace = true })
+}
+
+// WithDistinct sets EvalOptions.Distinct.
+func WithDistinct(opts EqualOptions) Option {
+	return pathOption(func(s *settings) { s.eval.Distinct = &opts })
+}
+
+// WithDocuments sets EvalOptions.Documents.
+func WithDocuments(lookup func(name string) (cty.Value, bool)) Option {
+	return pathOption(func(s *settings) { s.eval.Documents = lookup })
+}
+
+// WithHistory is KeepHistory(n) for NewDocument.
+func WithHistory(n int) Option {
+	return func(s *settings) { s.historyLimit = n }
+}
+
+// WithCache is UseCache(cache) for NewDocument.
+func WithCache(cache *ResultCache) Option {
+	return func(s *settings) { s.cache = cache }
+}
+
+// WithInternedKeys makes DecodeJSONStrict and FromJSONC share one string
+// per distinct object key, and decode arrays whose elements all have the
+// same type as lists, so their elements share that type instead of each
+// carrying its own. On logs and metrics made of uniform records that saves
+// most of the memory spent on keys and types; in exchange, Set can no
+// longer give one element of such an array a different shape.
+func WithInternedKeys() Option {
+	return func(s *settings) { s.internKeys = true }
+}
+
+// WithMissingPaths sets how EvalPathSet handles paths that don't exist.
+func WithMissingPaths(policy MissingPaths) Option {
+	return func(s *settings) { s.missingPaths = policy }
+}
+
+// WithKeyCollisions sets what MatchList.KeyBy does with matches sharing
+// a key.
+func WithKeyCollisions(policy KeyCollisions) Option {
+	return func(s *settings) { s.keyCollisions = policy }
+}
+
+// WithoutMarks makes CloneByPath drop every mark of the values it clones.
+func WithoutMarks() Option {
+	return func(s *settings) { s.stripMarks = true }
+}
+
+// WithDryRun makes Set, Delete and ApplyPatch resolve and check the edit as
+// usual but return the document unchanged, storing in *changes what the
+// edit would do. Instantiate has InstantiateOptions.DryRun instead.
+func WithDryRun(changes *[]Change) Option {
+	return func(s *settings) { s.dryRun = changes }
+}
@@ -0,0 +1,80 @@
+package jsonpath
+
+import (
+	"errors"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Page is a window of the matches of an expression, see EvalPage.
+type Page struct {
+	Matches MatchList
+	// Offset is the position of the first match of the page among all the
+	// matches, NextOffset that of the first match after it.
+	Offset, NextOffset int
+	// More is true when matches follow the page.
+	More bool
+
+	path  *JSONPath
+	doc   cty.Value
+	limit int
+}
+
+// errPageFull stops the evaluation of a page once it's known to be full.
+var errPageFull = errors.New("page full")
+
+// EvalPage returns at most limit matches of jsonPath in doc, skipping the
+// first offset ones. Matches are computed in chunks (see
+// EvalOptions.ChunkSize, by default the page size) and the evaluation
+// stops as soon as the page is full, so a page near the start of a large
+// array doesn't require matching the whole array. opts are those of
+// NewPath.
+func EvalPage(doc cty.Value, jsonPath string, offset, limit int, opts ...Option) (*Page, error) {
+	p, err := NewPath(jsonPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p.EvalPage(doc, offset, limit)
+}
+
+// EvalPage is the package-level EvalPage for a compiled path.
+func (j *JSONPath) EvalPage(doc cty.Value, offset, limit int) (*Page, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, newError(ErrIndexOutOfBounds, "invalid page of %d matches at offset %d", limit, offset)
+	}
+	page := &Page{Matches: MatchList{}, Offset: offset, path: j, doc: doc, limit: limit}
+	opts := j.defaults
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = limit
+	}
+	seen := 0
+	err := j.EvalChunked(doc, opts, func(vals []cty.Value, paths []cty.Path) error {
+		for i := range vals {
+			if seen < offset {
+				seen++
+				continue
+			}
+			if len(page.Matches) == limit {
+				page.More = true
+				return errPageFull
+			}
+			page.Matches = append(page.Matches, Match{Value: vals[i], Path: paths[i]})
+			seen++
+		}
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+	page.NextOffset = offset + len(page.Matches)
+	return page, nil
+}
+
+// NextPage evaluates the page following p, of the same size. It fails with
+// ErrNotFound when p is the last page.
+func (p *Page) NextPage() (*Page, error) {
+	if !p.More {
+		return nil, newError(ErrNotFound, "no matches after offset %d", p.NextOffset)
+	}
+	return p.path.EvalPage(p.doc, p.NextOffset, p.limit)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package jsonpath
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -29,19 +28,30 @@ import (
 const eof = -1
 
 type Parser struct {
-	Root  *ListNode
-	input string
-	pos   int
-	start int
-	width int
+	Root    *ListNode
+	input   string
+	pos     int
+	start   int
+	width   int
+	dialect Dialect
+	enabled []string
+	// maxRegex is CompileOptions.MaxRegexLength
+	maxRegex int
 }
 
 var (
-	ErrSyntax        = errors.New("invalid syntax")
-	dictKeyRex       = regexp.MustCompile(`^'([^']*)'$`)
-	sliceOperatorRex = regexp.MustCompile(`^(-?[\d]*)(:-?[\d]*)?(:-?[\d]*)?$`)
+	sliceOperatorRex  = regexp.MustCompile(`^(-?[\d]*)(:-?[\d]*)?(:-?[\d]*)?$`)
+	functionCallRex   = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\((.*)\)\s*$`)
+	methodCallRex     = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\(`)
 )
 
+// indexKeywords are the readable aliases of indexes accepted as [first]
+// and [last], or as the steps .first() and .last().
+var indexKeywords = map[string]int{
+	"first": 0,
+	"last":  -1,
+}
+
 // Parse parsed the given text and return a node Parser.
 // If an error is encountered, parsing stops and an empty
 // Parser is returned with the error.
@@ -54,15 +64,16 @@ func Parse(text string) (*Parser, error) {
 	return p, err
 }
 
-// parseAction parsed the expression inside delimiter
-func parseAction(text string) (*Parser, error) {
-	p, err := Parse(text)
-	// when error happens, p will be nil, so we need to return here
+// parseAction parsed the expression inside delimiter, with the settings of
+// the enclosing parser
+func (p *Parser) parseAction(text string) (*Parser, error) {
+	nested := &Parser{dialect: p.dialect, enabled: p.enabled, maxRegex: p.maxRegex}
+	err := nested.Parse(text)
 	if err != nil {
-		return p, err
+		return nil, err
 	}
-	p.Root = p.Root.Nodes[0].(*ListNode)
-	return p, nil
+	nested.Root = nested.Root.Nodes[0].(*ListNode)
+	return nested, nil
 }
 
 func (p *Parser) Parse(text string) error {
@@ -131,7 +142,9 @@ func (p *Parser) parseInsideAction(cur *ListNode) error {
 
 	prefixMap := map[string]func(*ListNode) error{
 		"[?(":      p.parseFilter,
+		"[/":       p.parseRegex,
 		"..":       p.parseRecursive,
+		"$doc(":    p.parseDoc,
 	}
 	for prefix, parseFunc := range prefixMap {
 		if strings.HasPrefix(p.input[p.pos:], prefix) {
@@ -159,7 +172,7 @@ func (p *Parser) parseInsideAction(cur *ListNode) error {
 	//	p.backup()
 	//	return p.parseIdentifier(cur)
 	default:
-		return fmt.Errorf("unrecognized character in action: %#U", r)
+		return newError(ErrSyntax, "unrecognized character in action: %#U", r)
 	}
 	return p.parseInsideAction(cur)
 }
@@ -179,7 +192,7 @@ func (p *Parser) parseIdentifier(cur *ListNode) error {
 	if isBool(value) {
 		v, err := strconv.ParseBool(value)
 		if err != nil {
-			return fmt.Errorf("can not parse bool '%s': %s", value, err.Error())
+			return newError(ErrSyntax, "can not parse bool '%s': %s", value, err.Error())
 		}
 
 		cur.append(newBool(v))
@@ -190,16 +203,43 @@ func (p *Parser) parseIdentifier(cur *ListNode) error {
 	return p.parseInsideAction(cur)
 }
 
+// parseDoc scans a reference to another document, $doc("name")
+func (p *Parser) parseDoc(cur *ListNode) error {
+	p.pos += len("$doc(")
+	p.consumeText()
+	rest := p.input[p.pos:]
+	end := -1
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		end = skipQuoted(rest, 0)
+	}
+	if end < 0 || !strings.HasPrefix(rest[end:], ")") {
+		return newError(ErrSyntax, "$doc takes a quoted document name")
+	}
+	name, ok := quotedString(rest[:end])
+	if !ok {
+		return newError(ErrSyntax, "invalid document name %s", rest[:end])
+	}
+	p.pos += end + 1
+	p.consumeText()
+	cur.append(newDoc(name))
+	return p.parseInsideAction(cur)
+}
+
 // parseRecursive scans the recursive descent operator ..
 func (p *Parser) parseRecursive(cur *ListNode) error {
 	if lastIndex := len(cur.Nodes) - 1; lastIndex >= 0 && cur.Nodes[lastIndex].Type() == NodeRecursive {
-		return fmt.Errorf("invalid multiple recursive descent")
+		return newError(ErrSyntax, "invalid multiple recursive descent")
 	}
 	p.pos += len("..")
 	p.consumeText()
 	cur.append(newRecursive())
-	if r := p.peek(); isAlphaNumeric(r) {
+	switch r := p.peek(); {
+	case isAlphaNumeric(r):
 		return p.parseField(cur)
+	case r == '*':
+		p.next()
+		p.consumeText()
+		cur.append(newWildcard())
 	}
 	return p.parseInsideAction(cur)
 }
@@ -228,7 +268,7 @@ func (p *Parser) parseNumber(cur *ListNode) error {
 		cur.append(newFloat(d))
 		return p.parseInsideAction(cur)
 	}
-	return fmt.Errorf("cannot parse number %s", value)
+	return newError(ErrSyntax, "cannot parse number %s", value)
 }
 
 // parseArray scans array index selection
@@ -237,7 +277,13 @@ Loop:
 	for {
 		switch p.next() {
 		case eof, '\n':
-			return fmt.Errorf("unterminated array")
+			return newError(ErrSyntax, "unterminated array")
+		case '\'', '"':
+			end := skipQuoted(p.input, p.pos-1)
+			if end < 0 {
+				return newError(ErrSyntax, "unterminated quoted string")
+			}
+			p.pos = end
 		case ']':
 			break Loop
 		}
@@ -247,13 +293,20 @@ Loop:
 	if text == "*" {
 		text = ":"
 	}
+	if index, ok := indexKeywords[strings.TrimSpace(text)]; ok {
+		cur.append(newIndex(index))
+		return p.parseInsideAction(cur)
+	}
+	if strings.TrimSpace(text) == "" {
+		return newError(ErrSyntax, "empty brackets")
+	}
 
 	//union operator
-	strs := strings.Split(text, ",")
+	strs := splitOutside(text, ',')
 	if len(strs) > 1 {
 		union := []*ListNode{}
 		for _, str := range strs {
-			parser, err := parseAction(fmt.Sprintf("[%s]", strings.Trim(str, " ")))
+			parser, err := p.parseAction(fmt.Sprintf("[%s]", strings.Trim(str, " ")))
 			if err != nil {
 				return err
 			}
@@ -264,22 +317,15 @@ Loop:
 	}
 
 	// dict key
-	value := dictKeyRex.FindStringSubmatch(text)
-	if value != nil {
-		parser, err := parseAction(fmt.Sprintf(".%s", value[1]))
-		if err != nil {
-			return err
-		}
-		for _, node := range parser.Root.Nodes {
-			cur.append(node)
-		}
+	if key, ok := quotedString(strings.TrimSpace(text)); ok {
+		cur.append(newField(key))
 		return p.parseInsideAction(cur)
 	}
 
 	//slice operator
-	value = sliceOperatorRex.FindStringSubmatch(text)
+	value := sliceOperatorRex.FindStringSubmatch(text)
 	if value == nil {
-		return fmt.Errorf("invalid array index %s", text)
+		return newError(ErrSyntax, "invalid array index %s", text)
 	}
 	value = value[1:]
 	params := [3]ParamsEntry{}
@@ -295,7 +341,7 @@ Loop:
 				params[i].Known = true
 				params[i].Value, err = strconv.Atoi(value[i])
 				if err != nil {
-					return fmt.Errorf("array index %s is not a number", value[i])
+					return newError(ErrSyntax, "array index %s is not a number", value[i])
 				}
 			}
 		} else {
@@ -315,83 +361,257 @@ Loop:
 
 // parseFilter scans filter inside array selection
 func (p *Parser) parseFilter(cur *ListNode) error {
-	return fmt.Errorf("filters are not yet implemented")
-//	p.pos += len("[?(")
-//	p.consumeText()
-//	begin := false
-//	end := false
-//	var pair rune
-//
-//Loop:
-//	for {
-//		r := p.next()
-//		switch r {
-//		case eof, '\n':
-//			return fmt.Errorf("unterminated filter")
-//		case '"', '\'':
-//			if begin == false {
-//				//save the paired rune
-//				begin = true
-//				pair = r
-//				continue
-//			}
-//			//only add when met paired rune
-//			if p.input[p.pos-2] != '\\' && r == pair {
-//				end = true
-//			}
-//		case ')':
-//			//in rightParser below quotes only appear zero or once
-//			//and must be paired at the beginning and end
-//			if begin == end {
-//				break Loop
-//			}
-//		}
-//	}
-//	if p.next() != ']' {
-//		return fmt.Errorf("unclosed array expect ]")
-//	}
-//	reg := regexp.MustCompile(`^([^!<>=]+)([!<>=]+)(.+?)$`)
-//	text := p.consumeText()
-//	text = text[:len(text)-2]
-//	value := reg.FindStringSubmatch(text)
-//	if value == nil {
-//		parser, err := parseAction("text", text)
-//		if err != nil {
-//			return err
-//		}
-//		cur.append(newFilter(parser.Root, newList(), "exists"))
-//	} else {
-//		leftParser, err := parseAction("left", value[1])
-//		if err != nil {
-//			return err
-//		}
-//		rightParser, err := parseAction("right", value[3])
-//		if err != nil {
-//			return err
-//		}
-//		cur.append(newFilter(leftParser.Root, rightParser.Root, value[2]))
-//	}
-//	return p.parseInsideAction(cur)
+	p.pos += len("[?(")
+	p.consumeText()
+	depth := 0
+
+Loop:
+	for {
+		r := p.next()
+		switch {
+		case r == eof || r == '\n':
+			return newError(ErrSyntax, "unterminated filter")
+		case r == '"' || r == '\'':
+			end := skipQuoted(p.input, p.pos-1)
+			if end < 0 {
+				return newError(ErrSyntax, "unterminated filter")
+			}
+			p.pos = end
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth == 0 {
+				break Loop
+			}
+			depth--
+		}
+	}
+	if p.next() != ']' {
+		return newError(ErrSyntax, "unclosed array expect ]")
+	}
+	text := p.consumeText()
+	text = text[:len(text)-2]
+	value := splitComparison(text)
+	if value == nil {
+		operand, err := p.parseOperand(text)
+		if err != nil {
+			return err
+		}
+		cur.append(newFilter(operand, newList(), "exists"))
+	} else {
+		left, err := p.parseOperand(value[1])
+		if err != nil {
+			return err
+		}
+		right, err := p.parseOperand(value[3])
+		if err != nil {
+			return err
+		}
+		cur.append(newFilter(left, right, p.dialect.operator(value[2])))
+	}
+	return p.parseInsideAction(cur)
 }
 
-// parseQuote unquotes string inside double or single quote
-func (p *Parser) parseQuote(cur *ListNode, end rune) error {
+// splitComparison splits a filter into the whole text, the left operand,
+// the operator and the right operand, like a regexp submatch. The operator
+// is the first run of !<>= outside string literals; nil means the filter is
+// a lone operand.
+func splitComparison(text string) []string {
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"' || c == '\'':
+			end := skipQuoted(text, i)
+			if end < 0 {
+				return nil
+			}
+			i = end - 1
+		case strings.IndexByte("!<>=", c) >= 0:
+			if i == 0 {
+				return nil
+			}
+			j := i
+			for j < len(text) && strings.IndexByte("!<>=", text[j]) >= 0 {
+				j++
+			}
+			if j == len(text) {
+				return nil
+			}
+			return []string{text, text[:i], text[i:j], text[j:]}
+		}
+	}
+	return nil
+}
+
+// parseOperand parses one side of a filter. Operands starting with $ are
+// evaluated against the document root instead of the current element,
+// operands starting with $doc("name") against another document of a Store,
+// operands like length(@.items) call a function, and true and false are
+// boolean literals.
+func (p *Parser) parseOperand(text string) (*ListNode, error) {
+	text = p.dialect.operand(text)
+	if call := functionCallRex.FindStringSubmatch(text); call != nil {
+		return p.parseCall(call[1], call[2])
+	}
+	if trimmed := strings.TrimSpace(text); isBool(trimmed) {
+		list := newList()
+		list.append(newBool(trimmed == "true"))
+		return list, nil
+	}
+	if trimmed := strings.TrimSpace(text); strings.HasSuffix(trimmed, ".length") &&
+		(strings.HasPrefix(trimmed, "@") || strings.HasPrefix(trimmed, "$")) {
+		return p.parseLengthProperty(strings.TrimSuffix(trimmed, ".length"))
+	}
+	parser, err := p.parseAction(text)
+	if err != nil {
+		return nil, err
+	}
+	if steps := flattenSteps(parser.Root); len(steps) > 1 {
+		// only a lone literal is a value, in a path it's a stray token
+		if err := checkSelectors(steps); err != nil {
+			return nil, err
+		}
+	}
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "$") && !strings.HasPrefix(trimmed, "$doc(") {
+		parser.Root.Nodes = append([]Node{newRoot()}, parser.Root.Nodes...)
+	}
+	return parser.Root, nil
+}
+
+// parseCall parses the arguments of a function call operand.
+func (p *Parser) parseCall(name, argsText string) (*ListNode, error) {
+	call, err := p.newCall(name, nil, argsText)
+	if err != nil {
+		return nil, err
+	}
+	list := newList()
+	list.append(call)
+	return list, nil
+}
+
+// parseMethod scans a function call step like .split(','), which passes
+// the current value as the first argument: split(@, ',').
+func (p *Parser) parseMethod(cur *ListNode, name string) error {
+	open := p.pos + len(name)
+	end := closingParen(p.input, open)
+	if end < 0 {
+		return newError(ErrSyntax, "unterminated call of %s", name)
+	}
+	current, err := p.parseOperand("@")
+	if err != nil {
+		return err
+	}
+	call, err := p.newCall(name, []*ListNode{current}, p.input[open+1:end])
+	if err != nil {
+		return err
+	}
+	call.Method = true
+	p.pos = end + 1
+	p.consumeText()
+	cur.append(call)
+	return p.parseInsideAction(cur)
+}
+
+// newCall parses the arguments of a call of name and checks them, after
+// those given already.
+func (p *Parser) newCall(name string, args []*ListNode, argsText string) (*FunctionNode, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, newError(ErrSyntax, "unknown function %s", name)
+	}
+	if fn.optIn && !p.enables(name) {
+		return nil, newError(ErrUnsupported, "function %s must be enabled with CompileOptions.EnableFunctions", name)
+	}
+	if strings.TrimSpace(argsText) != "" {
+		for _, arg := range splitArgs(argsText) {
+			operand, err := p.parseOperand(arg)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, operand)
+		}
+	}
+	if len(args) != fn.params {
+		return nil, newError(ErrSyntax, "%s takes %d argument(s), got %d", name, fn.params, len(args))
+	}
+	if fn.check != nil {
+		if err := fn.check(args); err != nil {
+			return nil, err
+		}
+	}
+	return newFunction(name, args), nil
+}
+
+// parseLengthProperty parses `operand.length` into a length call.
+func (p *Parser) parseLengthProperty(operand string) (*ListNode, error) {
+	arg, err := p.parseOperand(operand)
+	if err != nil {
+		return nil, err
+	}
+	call := newFunction("length", []*ListNode{arg})
+	call.Property = true
+	list := newList()
+	list.append(call)
+	return list, nil
+}
+
+func (p *Parser) enables(name string) bool {
+	for _, enabled := range p.enabled {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArgs splits function arguments on commas outside of quotes and
+// parentheses.
+func splitArgs(text string) []string {
+	return splitOutside(text, ',')
+}
+
+// parseRegex scans a key regex selector like [/^app\./]
+func (p *Parser) parseRegex(cur *ListNode) error {
+	p.pos += len("[/")
+	p.consumeText()
 Loop:
 	for {
 		switch p.next() {
 		case eof, '\n':
-			return fmt.Errorf("unterminated quoted string")
-		case end:
-			//if it's not escape break the Loop
-			if p.input[p.pos-2] != '\\' {
+			return newError(ErrSyntax, "unterminated regex")
+		case '\\':
+			p.next()
+		case '/':
+			if p.peek() == ']' {
 				break Loop
 			}
 		}
 	}
+	text := p.consumeText()
+	text = text[:len(text)-1]
+	p.next()
+	p.consumeText()
+	if p.maxRegex > 0 && len(text) > p.maxRegex {
+		return newError(ErrUnsupported, "regex of %d bytes exceeds the limit of %d", len(text), p.maxRegex)
+	}
+	re, err := regexp.Compile(text)
+	if err != nil {
+		return newError(ErrSyntax, "invalid regex %s: %v", text, err)
+	}
+	cur.append(newRegex(re))
+	return p.parseInsideAction(cur)
+}
+
+// parseQuote unquotes string inside double or single quote
+func (p *Parser) parseQuote(cur *ListNode, end rune) error {
+	stop := skipQuoted(p.input, p.pos-1)
+	if stop < 0 || strings.ContainsRune(p.input[p.pos:stop], '\n') {
+		return newError(ErrSyntax, "unterminated quoted string")
+	}
+	p.pos = stop
 	value := p.consumeText()
 	s, err := UnquoteExtend(value)
 	if err != nil {
-		return fmt.Errorf("unquote string %s error %v", value, err)
+		return newError(ErrSyntax, "unquote string %s error %v", value, err)
 	}
 	cur.append(newText(s))
 	return p.parseInsideAction(cur)
@@ -400,12 +620,26 @@ Loop:
 // parseField scans a field until a terminator
 func (p *Parser) parseField(cur *ListNode) error {
 	p.consumeText()
+	if call := methodCallRex.FindStringSubmatch(p.input[p.pos:]); call != nil {
+		if index, ok := indexKeywords[call[1]]; ok && strings.HasPrefix(p.input[p.pos+len(call[0]):], ")") {
+			p.pos += len(call[0]) + 1
+			p.consumeText()
+			cur.append(newIndex(index))
+			return p.parseInsideAction(cur)
+		}
+		if _, ok := functions[call[1]]; ok {
+			return p.parseMethod(cur, call[1])
+		}
+	}
 	for p.advance() {
 	}
 	value := p.consumeText()
-	if value == "*" {
+	switch value {
+	case "*":
 		cur.append(newWildcard())
-	} else {
+	case "":
+		// `$.[0]` is the same as `$[0]`
+	default:
 		cur.append(newField(strings.Replace(value, "\\", "", -1)))
 	}
 	return p.parseInsideAction(cur)
@@ -454,51 +688,3 @@ func isAlphaNumeric(r rune) bool {
 func isBool(s string) bool {
 	return s == "true" || s == "false"
 }
-
-//UnquoteExtend is almost same as strconv.Unquote(), but it support parse single quotes as a string
-func UnquoteExtend(s string) (string, error) {
-	n := len(s)
-	if n < 2 {
-		return "", ErrSyntax
-	}
-	quote := s[0]
-	if quote != s[n-1] {
-		return "", ErrSyntax
-	}
-	s = s[1 : n-1]
-
-	if quote != '"' && quote != '\'' {
-		return "", ErrSyntax
-	}
-
-	// Is it trivial?  Avoid allocation.
-	if !contains(s, '\\') && !contains(s, quote) {
-		return s, nil
-	}
-
-	var runeTmp [utf8.UTFMax]byte
-	buf := make([]byte, 0, 3*len(s)/2) // Try to avoid more allocations.
-	for len(s) > 0 {
-		c, multibyte, ss, err := strconv.UnquoteChar(s, quote)
-		if err != nil {
-			return "", err
-		}
-		s = ss
-		if c < utf8.RuneSelf || !multibyte {
-			buf = append(buf, byte(c))
-		} else {
-			n := utf8.EncodeRune(runeTmp[:], c)
-			buf = append(buf, runeTmp[:n]...)
-		}
-	}
-	return string(buf), nil
-}
-
-func contains(s string, c byte) bool {
-	for i := 0; i < len(s); i++ {
-		if s[i] == c {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
@@ -0,0 +1,132 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// MultiPathError groups the failures of an operation that carries on
+// after the first one: evaluations with EvalOptions.PartialResults or
+// EvalOptions.ElementErrors, and Instantiate. Errors tied to a location
+// (*PathError, *ElementError, *BranchError, Violation) report it in the
+// JSON form.
+type MultiPathError struct {
+	Errors []error
+}
+
+func (m *MultiPathError) Error() string {
+	msgs := make([]string, len(m.Errors))
+	for i, err := range m.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(m.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As look into every collected error.
+func (m *MultiPathError) Unwrap() []error {
+	return m.Errors
+}
+
+// MarshalJSON lists the errors with their location, when they have one,
+// as a JSONPath and a JSON Pointer, and their kind, the message of the
+// sentinel error they match:
+//
+//	{"errors": [{"path": "$.a[0]", "pointer": "/a/0", "kind": "not found", "message": "..."}]}
+func (m *MultiPathError) MarshalJSON() ([]byte, error) {
+	type entry struct {
+		Path    string `json:"path,omitempty"`
+		Pointer string `json:"pointer,omitempty"`
+		Kind    string `json:"kind,omitempty"`
+		Message string `json:"message"`
+	}
+	entries := make([]entry, len(m.Errors))
+	for i, err := range m.Errors {
+		entries[i].Message = err.Error()
+		if path, ok := errorPath(err); ok {
+			entries[i].Path = FormatPath(path)
+			entries[i].Pointer = JSONPointer(path)
+		}
+		for _, kind := range sentinels {
+			if errors.Is(err, kind) {
+				entries[i].Kind = kind.Error()
+				break
+			}
+		}
+	}
+	return json.Marshal(struct {
+		Errors []entry `json:"errors"`
+	}{entries})
+}
+
+// errorPath returns the location err is tied to.
+func errorPath(err error) (cty.Path, bool) {
+	var pathErr *PathError
+	var elemErr *ElementError
+	var branchErr *BranchError
+	var violation Violation
+	switch {
+	case errors.As(err, &pathErr):
+		return pathErr.Path, true
+	case errors.As(err, &elemErr):
+		return elemErr.Path, true
+	case errors.As(err, &branchErr):
+		return branchErr.Path, true
+	case errors.As(err, &violation):
+		return violation.Path, true
+	}
+	return nil, false
+}
+
+// BranchError reports a union selector that failed on one of its inputs.
+type BranchError struct {
+	// Union is the failing union step in JSONPath syntax.
+	Union string
+	// Position is the index of the failing selector within the union.
+	Position int
+	// Path locates the value the selector was applied to.
+	Path cty.Path
+	Err  error
+}
+
+func (e *BranchError) Error() string {
+	return fmt.Sprintf("selector %d of %s at $%s: %s", e.Position, e.Union, PrettyCtyPath(e.Path), e.Err)
+}
+
+func (e *BranchError) Unwrap() error {
+	return e.Err
+}
+
+// evalUnionPartial is evalUnion which records failures instead of aborting.
+// Selectors are applied to each input separately, so a failure only drops
+// the matches of one selector on one value.
+func (j *JSONPath) evalUnionPartial(input []cty.Value, node *UnionNode) []cty.Value {
+	result := []cty.Value{}
+	for _, value := range input {
+		for i, listNode := range node.Nodes {
+			temp, err := j.evalList([]cty.Value{value}, listNode)
+			if err != nil {
+				path, _ := valuePath(value)
+				j.partial = append(j.partial, &BranchError{
+					Union:    formatStep(node),
+					Position: i,
+					Path:     path,
+					Err:      err,
+				})
+				continue
+			}
+			result = append(result, temp...)
+		}
+	}
+	return result
+}
+
+func (j *JSONPath) partialError() error {
+	if len(j.partial) == 0 {
+		return nil
+	}
+	return &MultiPathError{Errors: j.partial}
+}
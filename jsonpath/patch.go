@@ -0,0 +1,305 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ApplyPatch applies an RFC 6902 JSON Patch document to doc and returns the
+// result. All operations are supported; a failing "test" operation aborts
+// with ErrConflict. doc is left untouched on failure. See WithDryRun for
+// previewing the changes; copies show as additions.
+func ApplyPatch(doc cty.Value, patch []byte, opts ...Option) (cty.Value, error) {
+	s := newSettings(opts)
+	var ops []patchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return doc, newError(ErrSyntax, "invalid JSON patch: %s", err)
+	}
+	out := doc
+	changes := []Change{}
+	for i, op := range ops {
+		var err error
+		var change *Change
+		out, change, err = applyOp(out, op)
+		if err != nil {
+			return doc, &PatchError{Index: i, Op: op.Op, Err: err}
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	if s.dryRun != nil {
+		*s.dryRun = changes
+		return doc, nil
+	}
+	return out, nil
+}
+
+// PatchError reports the JSON Patch operation that failed.
+type PatchError struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	Op    ChangeOp
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s): %s", e.Index, e.Op, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// applyOp applies op to doc and describes what it did, unless it was a
+// test.
+func applyOp(doc cty.Value, op patchOp) (cty.Value, *Change, error) {
+	path, err := pointerPath(doc, op.Path, op.Op == OpAdd || op.Op == OpCopy || op.Op == OpMove)
+	if err != nil {
+		return doc, nil, err
+	}
+	value := func() (cty.Value, error) {
+		if op.Value == nil {
+			return cty.NilVal, newError(ErrSyntax, "missing value")
+		}
+		return DecodeJSONStrict(op.Value)
+	}
+	// insert adds v at path, replacing an existing attribute or map key
+	insert := func(doc cty.Value, path cty.Path, v cty.Value) (cty.Value, *Change, error) {
+		change := &Change{Op: OpAdd, Path: path, New: v}
+		if old, err := applyPath(doc, path); err == nil && !isSequence(parentType(doc, path)) {
+			change.Old = old
+		}
+		doc, err := insertAtPath(doc, path, v)
+		return doc, change, err
+	}
+
+	switch op.Op {
+	case OpAdd:
+		v, err := value()
+		if err != nil {
+			return doc, nil, err
+		}
+		return insert(doc, path, v)
+	case OpRemove:
+		old, _ := applyPath(doc, path)
+		doc, err := removeAtPath(doc, path)
+		return doc, &Change{Op: OpRemove, Path: path, Old: old}, err
+	case OpReplace:
+		v, err := value()
+		if err != nil {
+			return doc, nil, err
+		}
+		old, _ := applyPath(doc, path)
+		doc, err := setAtPath(doc, path, v)
+		return doc, &Change{Op: OpReplace, Path: path, Old: old, New: v}, err
+	case OpMove, OpCopy:
+		from, err := pointerPath(doc, op.From, false)
+		if err != nil {
+			return doc, nil, err
+		}
+		v, err := from.Apply(doc)
+		if err != nil {
+			return doc, nil, newPathError(from, ErrNotFound, "%s", err)
+		}
+		if op.Op == OpCopy {
+			return insert(doc, path, v)
+		}
+		if len(path) > len(from) && pathsOverlap(from, path) {
+			return doc, nil, newPathError(from, ErrUnsupported, "can't move a value into itself")
+		}
+		if doc, err = removeAtPath(doc, from); err != nil {
+			return doc, nil, err
+		}
+		// removing may have shifted the target
+		if path, err = pointerPath(doc, op.Path, true); err != nil {
+			return doc, nil, err
+		}
+		doc, err = insertAtPath(doc, path, v)
+		return doc, &Change{Op: OpMove, From: from, Path: path, New: v}, err
+	case OpTest:
+		v, err := value()
+		if err != nil {
+			return doc, nil, err
+		}
+		got, err := path.Apply(doc)
+		if err != nil {
+			return doc, nil, newPathError(path, ErrNotFound, "%s", err)
+		}
+		got, _ = got.UnmarkDeep()
+		if eq := got.Equals(v); !eq.IsKnown() || eq.False() {
+			return doc, nil, newPathError(path, ErrConflict, "test failed")
+		}
+		return doc, nil, nil
+	}
+	return doc, nil, newError(ErrUnsupported, "unknown operation %q", op.Op)
+}
+
+// parentType returns the type of the container holding the last step of
+// path, or cty.NilType.
+func parentType(doc cty.Value, path cty.Path) cty.Type {
+	if len(path) == 0 {
+		return cty.NilType
+	}
+	parent, err := applyPath(doc, path[:len(path)-1])
+	if err != nil {
+		return cty.NilType
+	}
+	return parent.Type()
+}
+
+// pointerPath parses a JSON Pointer into the path it denotes in doc. Array
+// tokens become indexes; with add, "-" denotes the end of an array and the
+// last token may name a missing location.
+func pointerPath(doc cty.Value, pointer string, add bool) (cty.Path, error) {
+	if pointer == "" {
+		return cty.Path{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, newError(ErrSyntax, "invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	path := cty.Path{}
+	cur := doc
+	for i, token := range tokens {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		last := i == len(tokens)-1
+		unmarked, _ := cur.Unmark()
+		if unmarked.IsNull() || !unmarked.IsKnown() {
+			return nil, newPathError(path, ErrNotFound, "%s does not resolve", pointer)
+		}
+		ty := unmarked.Type()
+		switch {
+		case ty.IsObjectType() || ty.IsMapType():
+			path = path.GetAttr(token)
+			if ty.IsMapType() {
+				path[len(path)-1] = cty.IndexStep{Key: cty.StringVal(token)}
+			}
+		case ty.IsListType() || ty.IsTupleType():
+			n := unmarked.LengthInt()
+			idx, err := strconv.Atoi(token)
+			switch {
+			case add && last && token == "-":
+				idx = n
+			case err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")):
+				return nil, newPathError(path, ErrSyntax, "invalid array index %q", token)
+			case idx > n || (idx == n && !(add && last)):
+				return nil, newPathError(path.IndexInt(idx), ErrIndexOutOfBounds, "index %d out of range", idx)
+			}
+			path = path.IndexInt(idx)
+		default:
+			return nil, newPathError(path, ErrTypeMismatch, "can't step into %s", ty.FriendlyName())
+		}
+		if last {
+			break
+		}
+		next, err := path[len(path)-1:].Apply(unmarked)
+		if err != nil {
+			return nil, newPathError(path, ErrNotFound, "%s does not resolve", pointer)
+		}
+		cur = next
+	}
+	return path, nil
+}
+
+// insertAtPath stores v at path: arrays get a new element at the index,
+// shifting the following ones, objects and maps get the key set. Adding at
+// the root replaces the whole document, as RFC 6902 says.
+func insertAtPath(doc cty.Value, path cty.Path, v cty.Value) (cty.Value, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return editParent(doc, path, func(parent cty.Value, step cty.PathStep) (cty.Value, error) {
+		ty := parent.Type()
+		if isSequence(ty) {
+			idx := stepIndex(step)
+			elems := parent.AsValueSlice()
+			elems = append(elems, cty.NilVal)
+			copy(elems[idx+1:], elems[idx:])
+			elems[idx] = v
+			return rebuildSequence(ty, elems), nil
+		}
+		attrs := parent.AsValueMap()
+		if attrs == nil {
+			attrs = map[string]cty.Value{}
+		}
+		attrs[stepKey(step).AsString()] = v
+		return rebuildMapping(ty, attrs), nil
+	})
+}
+
+// removeAtPath drops the attribute, map key or array element at path.
+func removeAtPath(doc cty.Value, path cty.Path) (cty.Value, error) {
+	if len(path) == 0 {
+		return doc, newError(ErrUnsupported, "can't remove the document root")
+	}
+	return editParent(doc, path, func(parent cty.Value, step cty.PathStep) (cty.Value, error) {
+		ty := parent.Type()
+		if isSequence(ty) {
+			idx := stepIndex(step)
+			elems := parent.AsValueSlice()
+			if idx >= len(elems) {
+				return cty.NilVal, newPathError(path, ErrIndexOutOfBounds, "index %d out of range", idx)
+			}
+			return rebuildSequence(ty, append(elems[:idx:idx], elems[idx+1:]...)), nil
+		}
+		attrs := parent.AsValueMap()
+		key := stepKey(step).AsString()
+		if _, ok := attrs[key]; !ok {
+			return cty.NilVal, newPathError(path, ErrNotFound, "no key %q", key)
+		}
+		delete(attrs, key)
+		if ty.IsObjectType() && len(attrs) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		return rebuildMapping(ty, attrs), nil
+	})
+}
+
+// editParent replaces the container holding the last step of path by what
+// edit makes of it.
+func editParent(doc cty.Value, path cty.Path, edit func(parent cty.Value, step cty.PathStep) (cty.Value, error)) (cty.Value, error) {
+	if len(path) == 0 {
+		return doc, newError(ErrUnsupported, "can't edit the parent of the document root")
+	}
+	parentPath := path[:len(path)-1]
+	parent, err := parentPath.Apply(doc)
+	if err != nil {
+		return doc, newPathError(parentPath, ErrNotFound, "%s", err)
+	}
+	parent, marks := parent.Unmark()
+	if parent.IsNull() || !parent.IsKnown() || !(isMapping(parent.Type()) || isSequence(parent.Type())) {
+		return doc, newPathError(parentPath, ErrTypeMismatch, "can't edit inside %s", parent.Type().FriendlyName())
+	}
+	updated, err := edit(parent, path[len(path)-1])
+	if err != nil {
+		return doc, err
+	}
+	return setAtPath(doc, parentPath, updated.WithMarks(marks))
+}
+
+func stepIndex(step cty.PathStep) int {
+	if step, ok := step.(cty.IndexStep); ok && step.Key.Type() == cty.Number {
+		i, _ := step.Key.AsBigFloat().Int64()
+		return int(i)
+	}
+	return -1
+}
+
+// rebuildSequence returns elems as a list when ty is a list type and the
+// elements allow it, and as a tuple otherwise.
+func rebuildSequence(ty cty.Type, elems []cty.Value) cty.Value {
+	if ty.IsListType() {
+		if len(elems) == 0 {
+			return cty.ListValEmpty(ty.ElementType())
+		}
+		if sameElementTypes(elems) {
+			return cty.ListVal(elems)
+		}
+	}
+	return cty.TupleVal(elems)
+}
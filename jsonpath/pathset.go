@@ -0,0 +1,132 @@
+package jsonpath
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// MissingPaths decides what EvalPathSet does with a path that doesn't
+// exist in the document.
+type MissingPaths int
+
+const (
+	// MissingPathsError fails with a *PathError wrapping ErrNotFound or
+	// ErrIndexOutOfBounds.
+	MissingPathsError MissingPaths = iota
+	// MissingPathsSkip leaves the path out of the results, as a query
+	// would.
+	MissingPathsSkip
+	// MissingPathsNull puts a null in its place, so the results line up
+	// with the sorted paths.
+	MissingPathsNull
+)
+
+// EvalPathSet returns the values found at paths in doc, as if they were
+// the matches of a query: in document order (see SortPaths), keeping the
+// marks doc carries, and with attributes and map keys addressed alike.
+// Paths that don't exist are handled as set by WithMissingPaths, failing
+// by default; paths going through a scalar or an unknown value count as
+// missing, while indexing a non-array by number fails with
+// ErrTypeMismatch whatever the policy.
+//
+// It lets code that already holds cty.Paths, e.g. from Terraform plans,
+// share extraction and errors with queries without formatting the paths
+// as expressions.
+func EvalPathSet(doc cty.Value, paths cty.PathSet, opts ...Option) ([]cty.Value, error) {
+	s := newSettings(opts)
+	sorted := paths.List()
+	SortPaths(sorted)
+	vals := make([]cty.Value, 0, len(sorted))
+	for _, path := range sorted {
+		v, err := applyPath(doc, path)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrIndexOutOfBounds) {
+				return nil, err
+			}
+			switch s.missingPaths {
+			case MissingPathsSkip:
+				continue
+			case MissingPathsNull:
+				v = cty.NullVal(cty.DynamicPseudoType)
+			default:
+				return nil, err
+			}
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// SortPaths sorts paths in document order: by index for array elements, by
+// name for members, parents before their children.
+func SortPaths(paths []cty.Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return pathBefore(paths[i], paths[j])
+	})
+}
+
+func pathBefore(a, b cty.Path) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ka, kb := stepKey(a[i]), stepKey(b[i])
+		if ka == cty.NilVal || kb == cty.NilVal {
+			continue
+		}
+		switch {
+		case ka.Type() == cty.Number && kb.Type() == cty.Number:
+			if c := ka.AsBigFloat().Cmp(kb.AsBigFloat()); c != 0 {
+				return c < 0
+			}
+		case ka.Type() == cty.String && kb.Type() == cty.String:
+			if ka.AsString() != kb.AsString() {
+				return ka.AsString() < kb.AsString()
+			}
+		default:
+			// indexes before names, for paths no document can hold both
+			return ka.Type() == cty.Number
+		}
+	}
+	return len(a) < len(b)
+}
+
+// applyPath returns the value at path in doc, keeping the marks of the
+// values traversed.
+func applyPath(doc cty.Value, path cty.Path) (cty.Value, error) {
+	v := doc
+	for i, step := range path {
+		at := path[:i+1]
+		unmarked, _ := v.Unmark()
+		key := stepKey(step)
+		if key == cty.NilVal {
+			return cty.NilVal, newPathError(at, ErrTypeMismatch, "unsupported path step")
+		}
+		ty := unmarked.Type()
+		if key.Type() == cty.Number {
+			if !(ty.IsListType() || ty.IsTupleType()) {
+				return cty.NilVal, newPathError(at, ErrTypeMismatch, "%s is not array and cannot be indexed", ty.FriendlyName())
+			}
+			if unmarked.IsNull() || !unmarked.IsKnown() || !unmarked.HasIndex(key).True() {
+				return cty.NilVal, newPathError(at, ErrIndexOutOfBounds, "index %s out of range", key.GoString())
+			}
+			v = v.Index(key)
+			continue
+		}
+		name := key.AsString()
+		switch {
+		case unmarked.IsNull() || !unmarked.IsKnown():
+		case ty.IsObjectType():
+			if ty.HasAttribute(name) {
+				v = v.GetAttr(name)
+				continue
+			}
+		case ty.IsMapType():
+			if unmarked.HasIndex(key).True() {
+				v = v.Index(key)
+				continue
+			}
+		}
+		return cty.NilVal, newPathError(at, ErrNotFound, "%s is not found", name)
+	}
+	return v, nil
+}
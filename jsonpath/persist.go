@@ -0,0 +1,273 @@
+package jsonpath
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Backend persists the documents of a Store as JSON. Implementations for
+// key-value stores only need to map names to values.
+type Backend interface {
+	// Load returns every persisted document by name.
+	Load() (map[string][]byte, error)
+	// Save stores the JSON encoding of the named document.
+	Save(name string, data []byte) error
+	// Remove deletes the named document. Removing a missing document
+	// isn't an error.
+	Remove(name string) error
+}
+
+// FileBackend persists each document to its own file in dir, named after
+// the document with a .json extension. Files are replaced atomically by
+// writing a temporary file and renaming it.
+func FileBackend(dir string) Backend {
+	return fileBackend{dir: dir}
+}
+
+type fileBackend struct {
+	dir string
+}
+
+func (b fileBackend) path(name string) string {
+	return filepath.Join(b.dir, url.PathEscape(name)+".json")
+}
+
+func (b fileBackend) Load() (map[string][]byte, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string][]byte{}, nil
+		}
+		return nil, err
+	}
+	out := map[string][]byte{}
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(file, ".") || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(file, ".json"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.dir, file))
+		if err != nil {
+			return nil, err
+		}
+		out[name] = data
+	}
+	return out, nil
+}
+
+func (b fileBackend) Save(name string, data []byte) error {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(b.path(name), data)
+}
+
+// writeFileAtomic replaces the file at path with data by writing a
+// temporary file next to it and renaming it.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b fileBackend) Remove(name string) error {
+	err := os.Remove(b.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// OpenStore creates a Store holding the documents persisted in backend.
+// Later changes to the documents, whether through Put, Remove, Set,
+// transactions or Undo, are written back in the background; Flush and
+// Close wait for them.
+func OpenStore(backend Backend) (*Store, error) {
+	saved, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	s := NewStore()
+	for name, data := range saved {
+		v, err := DecodeJSONStrict(data)
+		if err != nil {
+			return nil, newError(ErrSyntax, "document %q: %s", name, err)
+		}
+		s.Put(name, v)
+	}
+	s.writer = &writer{
+		backend: backend,
+		pending: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for name, d := range s.docs {
+		s.watch(name, d)
+	}
+	go s.writeBehind()
+	return s, nil
+}
+
+// writer holds the state of a Store's write-behind persistence.
+type writer struct {
+	backend Backend
+	// names of the documents changed since they were last written
+	mu      sync.Mutex
+	pending map[string]bool
+	err     error
+	// serializes flushes, so a document is never written twice at once
+	flushMu sync.Mutex
+
+	wake   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// watch persists every change of d. Must be called with s.mu held.
+func (s *Store) watch(name string, d *Document) {
+	w := s.writer
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return
+	}
+	cancel, _ := d.Subscribe("$", func([]cty.Value, []cty.Path) {
+		s.changed(name)
+	})
+	s.cancels[name] = cancel
+}
+
+// changed schedules the named document to be written.
+func (s *Store) changed(name string) {
+	w := s.writer
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.pending[name] = true
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Store) writeBehind() {
+	for {
+		select {
+		case <-s.writer.wake:
+			s.flush()
+		case <-s.writer.done:
+			return
+		}
+	}
+}
+
+// flush writes the pending documents as they are now, removing the ones
+// no longer in the store.
+func (s *Store) flush() {
+	w := s.writer
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	names := w.pending
+	w.pending = map[string]bool{}
+	w.mu.Unlock()
+
+	for name := range names {
+		err := s.persist(name)
+		if err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			// try again with the next change
+			w.pending[name] = true
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (s *Store) persist(name string) error {
+	d, ok := s.Document(name)
+	if !ok {
+		return s.writer.backend.Remove(name)
+	}
+	v, _ := d.Value().UnmarkDeep()
+	data, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return newError(ErrUnsupported, "document %q: %s", name, err)
+	}
+	return s.writer.backend.Save(name, data)
+}
+
+// Flush writes the pending changes now and returns the first error met by
+// a write since the previous Flush. It does nothing for a Store without a
+// Backend.
+func (s *Store) Flush() error {
+	w := s.writer
+	if w == nil {
+		return nil
+	}
+	s.flush()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// Close flushes the pending changes and stops writing in the background.
+// Changes made after Close are no longer persisted.
+func (s *Store) Close() error {
+	w := s.writer
+	if w == nil {
+		return nil
+	}
+	s.mu.Lock()
+	for name, cancel := range s.cancels {
+		cancel()
+		delete(s.cancels, name)
+	}
+	s.mu.Unlock()
+	err := s.Flush()
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.done)
+	}
+	w.mu.Unlock()
+	return err
+}
@@ -0,0 +1,244 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/gob"
+	"regexp"
+)
+
+// planVersion identifies the encoding of MarshalBinary. It changes whenever
+// the encoding does, so stale plans are rejected rather than misread.
+const planVersion = 1
+
+// plan is the encoding of a compiled path.
+type plan struct {
+	Version    int
+	Root       *planNode
+	Features   []Feature
+	OutputJSON bool
+}
+
+// planNode encodes any Node. Text holds the string of the node types
+// having one (text, field, identifier, filter operator, function and
+// document names, regex source), Children their nested lists: those of a
+// list or union, a filter's operands, a function's arguments.
+type planNode struct {
+	Type     NodeType
+	Text     string
+	Int      int
+	Float    float64
+	Bool     bool
+	Method   bool
+	Params   [3]ParamsEntry
+	Children []*planNode
+}
+
+// MarshalBinary encodes the compiled form of j, so it can be validated and
+// compiled once and then shipped to other processes, or persisted, and
+// restored with UnmarshalBinary without parsing it again. Opt-in functions
+// enabled at compile time stay enabled; the defaults given to NewPath and
+// the middleware added with Use aren't encoded.
+func (j *JSONPath) MarshalBinary() ([]byte, error) {
+	if j.parser == nil {
+		return nil, newError(ErrUnsupported, "the path wasn't compiled")
+	}
+	root, err := encodeNode(j.parser.Root)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(plan{
+		Version:    planVersion,
+		Root:       root,
+		Features:   j.features,
+		OutputJSON: j.outputJSON,
+	})
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary restores a path encoded by MarshalBinary, failing with
+// ErrUnsupported for encodings of another version of the package or
+// calling functions this one doesn't have.
+func (j *JSONPath) UnmarshalBinary(data []byte) error {
+	var p plan
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+		return newError(ErrSyntax, "invalid compiled path: %s", err)
+	}
+	if p.Version != planVersion {
+		return newError(ErrUnsupported, "compiled path version %d, expected %d", p.Version, planVersion)
+	}
+	node, err := decodeNode(p.Root)
+	if err != nil {
+		return err
+	}
+	root, ok := node.(*ListNode)
+	if !ok {
+		return newError(ErrSyntax, "invalid compiled path: the root is a %s", node.Type())
+	}
+	restored := JSONPath{parser: &Parser{Root: root}, features: p.Features, outputJSON: p.OutputJSON}
+	if err := checkSelectors(restored.steps()); err != nil {
+		return err
+	}
+	if steps := restored.steps(); len(steps) > 0 {
+		restored.doc, _ = steps[0].(*DocNode)
+	}
+	*j = restored
+	return nil
+}
+
+func encodeNode(node Node) (*planNode, error) {
+	out := &planNode{Type: node.Type()}
+	lists := func(lists []*ListNode) error {
+		for _, list := range lists {
+			child, err := encodeNode(list)
+			if err != nil {
+				return err
+			}
+			out.Children = append(out.Children, child)
+		}
+		return nil
+	}
+	var err error
+	switch node := node.(type) {
+	case *ListNode:
+		for _, n := range node.Nodes {
+			child, err := encodeNode(n)
+			if err != nil {
+				return nil, err
+			}
+			out.Children = append(out.Children, child)
+		}
+	case *TextNode:
+		out.Text = node.Text
+	case *FieldNode:
+		out.Text = node.Value
+	case *IdentifierNode:
+		out.Text = node.Name
+	case *ArrayNode:
+		out.Params = node.Params
+	case *FilterNode:
+		out.Text = node.Operator
+		err = lists([]*ListNode{node.Left, node.Right})
+	case *IntNode:
+		out.Int = node.Value
+	case *FloatNode:
+		out.Float = node.Value
+	case *BoolNode:
+		out.Bool = node.Value
+	case *RegexNode:
+		out.Text = node.Regexp.String()
+	case *UnionNode:
+		err = lists(node.Nodes)
+	case *FunctionNode:
+		out.Text = node.Name
+		out.Bool = node.Property
+		out.Method = node.Method
+		err = lists(node.Args)
+	case *DocNode:
+		out.Text = node.Name
+	case *WildcardNode, *RecursiveNode, *RootNode:
+	default:
+		return nil, newError(ErrUnsupported, "can't encode a %s", node.Type())
+	}
+	return out, err
+}
+
+func decodeNode(p *planNode) (Node, error) {
+	if p == nil {
+		return nil, newError(ErrSyntax, "invalid compiled path: missing node")
+	}
+	lists := func() ([]*ListNode, error) {
+		out := make([]*ListNode, len(p.Children))
+		for i, child := range p.Children {
+			node, err := decodeNode(child)
+			if err != nil {
+				return nil, err
+			}
+			list, ok := node.(*ListNode)
+			if !ok {
+				return nil, newError(ErrSyntax, "invalid compiled path: expected a list, got a %s", node.Type())
+			}
+			out[i] = list
+		}
+		return out, nil
+	}
+	switch p.Type {
+	case NodeList:
+		list := newList()
+		for _, child := range p.Children {
+			node, err := decodeNode(child)
+			if err != nil {
+				return nil, err
+			}
+			list.append(node)
+		}
+		return list, nil
+	case NodeText:
+		return newText(p.Text), nil
+	case NodeField:
+		return newField(p.Text), nil
+	case NodeIdentifier:
+		return newIdentifier(p.Text), nil
+	case NodeArray:
+		return newArray(p.Params), nil
+	case NodeFilter:
+		operands, err := lists()
+		if err != nil {
+			return nil, err
+		}
+		if len(operands) != 2 {
+			return nil, newError(ErrSyntax, "invalid compiled path: a filter has %d operands", len(operands))
+		}
+		return newFilter(operands[0], operands[1], p.Text), nil
+	case NodeInt:
+		return newInt(p.Int), nil
+	case NodeFloat:
+		return newFloat(p.Float), nil
+	case NodeBool:
+		return newBool(p.Bool), nil
+	case NodeRegex:
+		re, err := regexp.Compile(p.Text)
+		if err != nil {
+			return nil, newError(ErrSyntax, "invalid compiled path: %s", err)
+		}
+		return newRegex(re), nil
+	case NodeUnion:
+		branches, err := lists()
+		if err != nil {
+			return nil, err
+		}
+		return newUnion(branches), nil
+	case NodeFunction:
+		fn, ok := functions[p.Text]
+		if !ok {
+			return nil, newError(ErrUnsupported, "unknown function %s", p.Text)
+		}
+		args, err := lists()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != fn.params {
+			return nil, newError(ErrSyntax, "invalid compiled path: %s takes %d arguments, got %d", p.Text, fn.params, len(args))
+		}
+		if fn.check != nil {
+			if err := fn.check(args); err != nil {
+				return nil, err
+			}
+		}
+		node := newFunction(p.Text, args)
+		node.Property = p.Bool
+		node.Method = p.Method
+		return node, nil
+	case NodeDoc:
+		return newDoc(p.Text), nil
+	case NodeWildcard:
+		return newWildcard(), nil
+	case NodeRecursive:
+		return newRecursive(), nil
+	case NodeRoot:
+		return newRoot(), nil
+	}
+	return nil, newError(ErrSyntax, "invalid compiled path: unknown node type %d", p.Type)
+}
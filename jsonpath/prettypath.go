@@ -16,7 +16,11 @@ func PrettyCtyPath(path cty.Path) string {
 	for _, step := range path {
 		switch ts := step.(type) {
 		case cty.GetAttrStep:
-			fmt.Fprintf(&buf, ".%s", ts.Name)
+			if isPlainKey(ts.Name) {
+				fmt.Fprintf(&buf, ".%s", ts.Name)
+			} else {
+				fmt.Fprintf(&buf, "[%s]", quoteKey(ts.Name))
+			}
 		case cty.IndexStep:
 			buf.WriteByte('[')
 			key := ts.Key
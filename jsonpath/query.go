@@ -0,0 +1,71 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"reflect"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// Decoding into Go values relies on reflection, which the jsonpath_minimal
+// build tag leaves out.
+
+// Query evaluates jsonPath on doc and decodes every match into a T with
+// gocty, honoring `cty:"..."` struct tags. Matches are first converted to
+// the type gocty implies for T, so JSON tuples decode into slices and
+// attributes the struct doesn't declare are ignored. A match that can't be
+// decoded fails with a *PathError of kind ErrTypeMismatch.
+func Query[T any](doc cty.Value, jsonPath string) ([]T, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	vals, paths, err := p.Eval(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]T, len(vals))
+	for i, v := range vals {
+		if err := decodeMatch(v, paths[i], &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// decodeMatch decodes v, found at path, into the Go value target points
+// to, as Query does.
+func decodeMatch(v cty.Value, path cty.Path, target interface{}) error {
+	v, _ = v.UnmarkDeep()
+	if ty, err := gocty.ImpliedType(target); err == nil {
+		if v, err = convert.Convert(v, ty); err != nil {
+			return newPathError(path, ErrTypeMismatch, "%s", err)
+		}
+	}
+	if err := gocty.FromCtyValue(v, target); err != nil {
+		return newPathError(path, ErrTypeMismatch, "%s", err)
+	}
+	return nil
+}
+
+// Into decodes the match values into the slice target points to, like
+// Query, replacing its contents. A value that can't be decoded fails with
+// a *PathError of kind ErrTypeMismatch.
+func (m MatchList) Into(target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return newError(ErrTypeMismatch, "Into needs a pointer to a slice, got %T", target)
+	}
+	out := reflect.MakeSlice(ptr.Elem().Type(), len(m), len(m))
+	for i, match := range m {
+		if err := decodeMatch(match.Value, match.Path, out.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	ptr.Elem().Set(out)
+	return nil
+}
@@ -0,0 +1,171 @@
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quoting of keys, shared by the parser and String(). Keys are written as
+// `.key` when isPlainKey allows it and as `['key']` otherwise; quoteKey and
+// UnquoteExtend round-trip any string, including invalid UTF-8.
+
+// isPlainKey reports whether key can be written as `.key`.
+func isPlainKey(key string) bool {
+	if key == "" || key == "*" {
+		return false
+	}
+	for _, r := range key {
+		if !isAlphaNumeric(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteKey writes key as a single-quoted string. Backslashes, quotes and
+// unprintable characters are escaped.
+func quoteKey(key string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\x` + strconv.FormatUint(uint64(key[i])>>4, 16) + strconv.FormatUint(uint64(key[i])&0xf, 16))
+		case !unicode.IsPrint(r):
+			q := strconv.QuoteRune(r)
+			b.WriteString(q[1 : len(q)-1])
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// UnquoteExtend is almost same as strconv.Unquote(), but it support parse single quotes as a string
+func UnquoteExtend(s string) (string, error) {
+	n := len(s)
+	if n < 2 {
+		return "", ErrSyntax
+	}
+	quote := s[0]
+	if quote != s[n-1] {
+		return "", ErrSyntax
+	}
+	s = s[1 : n-1]
+
+	if quote != '"' && quote != '\'' {
+		return "", ErrSyntax
+	}
+
+	// Is it trivial?  Avoid allocation.
+	if !contains(s, '\\') && !contains(s, quote) {
+		return s, nil
+	}
+
+	var runeTmp [utf8.UTFMax]byte
+	buf := make([]byte, 0, 3*len(s)/2) // Try to avoid more allocations.
+	for len(s) > 0 {
+		c, multibyte, ss, err := strconv.UnquoteChar(s, quote)
+		if err != nil {
+			return "", err
+		}
+		s = ss
+		if c < utf8.RuneSelf || !multibyte {
+			buf = append(buf, byte(c))
+		} else {
+			n := utf8.EncodeRune(runeTmp[:], c)
+			buf = append(buf, runeTmp[:n]...)
+		}
+	}
+	return string(buf), nil
+}
+
+func contains(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// skipQuoted returns the position just past the string literal starting
+// at s[i], honouring backslash escapes, or -1 if it isn't terminated.
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// quotedString unquotes s if it's exactly one string literal.
+func quotedString(s string) (string, bool) {
+	if s == "" || (s[0] != '\'' && s[0] != '"') || skipQuoted(s, 0) != len(s) {
+		return "", false
+	}
+	unquoted, err := UnquoteExtend(s)
+	return unquoted, err == nil
+}
+
+// splitOutside splits text on sep where it's outside string literals,
+// parentheses and brackets.
+func splitOutside(text string, sep byte) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'' || c == '"':
+			end := skipQuoted(text, i)
+			if end < 0 {
+				return append(parts, text[start:])
+			}
+			i = end - 1
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// closingParen returns the index of the parenthesis closing the one at
+// text[open], skipping string literals and nested parentheses, or -1.
+func closingParen(text string, open int) int {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'' || c == '"':
+			end := skipQuoted(text, i)
+			if end < 0 {
+				return -1
+			}
+			i = end - 1
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
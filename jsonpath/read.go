@@ -0,0 +1,64 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Read returns the single value jsonPath matches in doc. It fails with
+// ErrNotFound when nothing matches and ErrMultipleMatches when several
+// values do.
+func Read(doc cty.Value, jsonPath string) (cty.Value, error) {
+	return getOne(doc, jsonPath)
+}
+
+// ReadString is Read converting the match to a string, so numbers and
+// booleans are accepted too.
+func ReadString(doc cty.Value, jsonPath string) (string, error) {
+	v, err := readAs(doc, jsonPath, cty.String)
+	if err != nil {
+		return "", err
+	}
+	return v.AsString(), nil
+}
+
+// ReadInt is Read converting the match to a whole number, so numeric
+// strings like "3" are accepted too.
+func ReadInt(doc cty.Value, jsonPath string) (int64, error) {
+	v, err := readAs(doc, jsonPath, cty.Number)
+	if err != nil {
+		return 0, err
+	}
+	i, acc := v.AsBigFloat().Int64()
+	if !v.AsBigFloat().IsInt() || acc != 0 {
+		return 0, newError(ErrTypeMismatch, "%s is %s, not a whole number", jsonPath, v.AsBigFloat().Text('g', -1))
+	}
+	return i, nil
+}
+
+// ReadBool is Read converting the match to a bool, so the strings "true"
+// and "false" are accepted too.
+func ReadBool(doc cty.Value, jsonPath string) (bool, error) {
+	v, err := readAs(doc, jsonPath, cty.Bool)
+	if err != nil {
+		return false, err
+	}
+	return v.True(), nil
+}
+
+// readAs reads the single match of jsonPath converted to ty.
+func readAs(doc cty.Value, jsonPath string, ty cty.Type) (cty.Value, error) {
+	v, err := getOne(doc, jsonPath)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	v, _ = v.UnmarkDeep()
+	if v.IsNull() || !v.IsKnown() {
+		return cty.NilVal, newError(ErrTypeMismatch, "%s is null or unknown", jsonPath)
+	}
+	converted, err := convert.Convert(v, ty)
+	if err != nil {
+		return cty.NilVal, newError(ErrTypeMismatch, "%s: %s", jsonPath, err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,111 @@
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// resolveRefs replaces every JSON Reference object in vals by its target.
+func (j *JSONPath) resolveRefs(vals []cty.Value) ([]cty.Value, error) {
+	var out []cty.Value
+	for i, v := range vals {
+		resolved, err := j.resolveRef(v)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil && resolved.RawEquals(v) {
+			continue
+		}
+		if out == nil {
+			out = append(make([]cty.Value, 0, len(vals)), vals[:i]...)
+		}
+		out = append(out, resolved)
+	}
+	if out == nil {
+		return vals, nil
+	}
+	return out, nil
+}
+
+// resolveRef follows v while it is a local JSON Reference, failing on
+// reference cycles and dangling pointers.
+func (j *JSONPath) resolveRef(v cty.Value) (cty.Value, error) {
+	seen := map[string]bool{}
+	for {
+		ref, ok := refPointer(v)
+		if !ok {
+			return v, nil
+		}
+		if seen[ref] {
+			return cty.NilVal, newError(ErrUnsupported, "reference cycle through %s", ref)
+		}
+		seen[ref] = true
+		target, err := resolvePointer(j.root, ref)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		v = target
+	}
+}
+
+// refPointer returns the JSON Pointer of a local reference {"$ref": "#/..."}.
+func refPointer(v cty.Value) (string, bool) {
+	unmarked, _ := v.UnmarkDeep()
+	ty := unmarked.Type()
+	if unmarked.IsNull() || !unmarked.IsKnown() {
+		return "", false
+	}
+	var ref cty.Value
+	switch {
+	case ty.IsObjectType() && len(ty.AttributeTypes()) == 1 && ty.HasAttribute("$ref"):
+		ref = unmarked.GetAttr("$ref")
+	case ty.IsMapType() && unmarked.LengthInt() == 1 && unmarked.HasIndex(cty.StringVal("$ref")).True():
+		ref = unmarked.Index(cty.StringVal("$ref"))
+	default:
+		return "", false
+	}
+	if ref.IsNull() || !ref.IsKnown() || ref.Type() != cty.String || !strings.HasPrefix(ref.AsString(), "#") {
+		return "", false
+	}
+	return ref.AsString(), true
+}
+
+// resolvePointer looks up a URI fragment JSON Pointer like
+// "#/components/schemas/Pet" in root.
+func resolvePointer(root cty.Value, ref string) (cty.Value, error) {
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return root, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return cty.NilVal, newError(ErrSyntax, "invalid JSON pointer %s", ref)
+	}
+	cur := root
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		unmarked, _ := cur.Unmark()
+		ty := unmarked.Type()
+		switch {
+		case unmarked.IsNull() || !unmarked.IsKnown():
+		case ty.IsObjectType():
+			if ty.HasAttribute(token) {
+				cur = unmarked.GetAttr(token)
+				continue
+			}
+		case ty.IsMapType():
+			if key := cty.StringVal(token); unmarked.HasIndex(key).True() {
+				cur = unmarked.Index(key)
+				continue
+			}
+		case ty.IsListType() || ty.IsTupleType():
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < unmarked.LengthInt() {
+				cur = unmarked.Index(cty.NumberIntVal(int64(i)))
+				continue
+			}
+		}
+		return cty.NilVal, newError(ErrNotFound, "%s does not resolve", ref)
+	}
+	return cur, nil
+}
@@ -0,0 +1,95 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// RenameKeys returns a copy of doc where the object attributes and map keys
+// named in renames are renamed, e.g. {"replicaCount": "replicas"} for a
+// schema migration. scope limits the renaming to the values it matches and
+// everything below them; an empty scope stands for the whole document.
+//
+// Renames apply at once, so {"a": "b", "b": "a"} swaps keys, and renaming
+// onto a key that stays is an error matching ErrConflict. Marks stay with
+// the values, wherever their keys move. cty objects don't order their
+// attributes, so there is no order to preserve.
+func RenameKeys(doc cty.Value, renames map[string]string, scope string) (cty.Value, error) {
+	if scope == "" {
+		return renameKeys(doc, renames, cty.Path{})
+	}
+	p, err := NewPath(scope)
+	if err != nil {
+		return doc, err
+	}
+	paths, err := p.writePaths(doc)
+	if err != nil {
+		return doc, err
+	}
+	// the subtrees of outer matches are renamed with them
+	SortPaths(paths)
+	outer := []cty.Path{}
+	for _, path := range paths {
+		if len(outer) > 0 && pathsOverlap(outer[len(outer)-1], path) {
+			continue
+		}
+		outer = append(outer, path)
+	}
+	return replacePathsFunc(doc, outer, func(old cty.Value, path cty.Path) (cty.Value, error) {
+		return renameKeys(old, renames, path)
+	})
+}
+
+// renameKeys renames the keys of v, found at path, and of the values below
+// it.
+func renameKeys(v cty.Value, renames map[string]string, path cty.Path) (cty.Value, error) {
+	unmarked, marks := v.Unmark()
+	if unmarked.IsNull() || !unmarked.IsKnown() {
+		return v, nil
+	}
+	ty := unmarked.Type()
+	switch {
+	case isMapping(ty):
+		attrs := map[string]cty.Value{}
+		for it := unmarked.ElementIterator(); it.Next(); {
+			k, child := it.Element()
+			key := k.AsString()
+			step := cty.PathStep(cty.IndexStep{Key: k})
+			if ty.IsObjectType() {
+				step = cty.GetAttrStep{Name: key}
+			}
+			child, err := renameKeys(child, renames, append(path[:len(path):len(path)], step))
+			if err != nil {
+				return v, err
+			}
+			if to, ok := renames[key]; ok {
+				key = to
+			}
+			if _, ok := attrs[key]; ok {
+				return v, newPathError(path, ErrConflict, "renaming would give two %q keys", key)
+			}
+			attrs[key] = child
+		}
+		return rebuildMapping(ty, attrs).WithMarks(marks), nil
+	case isSequence(ty) || ty.IsSetType():
+		elems := unmarked.AsValueSlice()
+		for i, elem := range elems {
+			// set elements are their own keys
+			step := cty.PathStep(cty.IndexStep{Key: elem})
+			if !ty.IsSetType() {
+				step = cty.IndexStep{Key: cty.NumberIntVal(int64(i))}
+			}
+			var err error
+			if elems[i], err = renameKeys(elem, renames, append(path[:len(path):len(path)], step)); err != nil {
+				return v, err
+			}
+		}
+		if len(elems) == 0 {
+			return v, nil
+		}
+		if ty.IsSetType() && sameElementTypes(elems) {
+			return cty.SetVal(elems).WithMarks(marks), nil
+		}
+		return rebuildSequence(ty, elems).WithMarks(marks), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,241 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ReplaceByPath returns a copy of doc where every location matched by
+// jsonPath holds value. The input document is left untouched. Matches
+// computed from the document, like the parts of $.csv.split(','), aren't
+// locations and fail with ErrUnsupported.
+func ReplaceByPath(doc cty.Value, jsonPath string, value cty.Value) (cty.Value, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return doc, err
+	}
+	paths, err := p.writePaths(doc)
+	if err != nil {
+		return doc, err
+	}
+	return replacePaths(doc, paths, value)
+}
+
+// ReplaceFunc returns a copy of doc where every location matched by jsonPath
+// holds the value fn computes from the old value found there, e.g. to
+// increment every `$..replicas`. Each location is visited once, in match
+// order; an error from fn aborts the replacement.
+func ReplaceFunc(doc cty.Value, jsonPath string, fn func(old cty.Value, path cty.Path) (cty.Value, error)) (cty.Value, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return doc, err
+	}
+	paths, err := p.writePaths(doc)
+	if err != nil {
+		return doc, err
+	}
+	return replacePathsFunc(doc, paths, fn)
+}
+
+func replacePaths(doc cty.Value, paths []cty.Path, value cty.Value) (cty.Value, error) {
+	return replacePathsFunc(doc, paths, func(cty.Value, cty.Path) (cty.Value, error) {
+		return value, nil
+	})
+}
+
+func replacePathsFunc(doc cty.Value, paths []cty.Path, fn func(old cty.Value, path cty.Path) (cty.Value, error)) (cty.Value, error) {
+	orig := doc
+	seen := cty.NewPathSet()
+	for _, path := range paths {
+		if seen.Has(path) {
+			continue
+		}
+		seen.Add(path)
+
+		old, err := path.Apply(doc)
+		if err != nil {
+			return orig, &PathError{Path: path.Copy(), Err: newError(ErrNotFound, "%s", err)}
+		}
+		value, err := fn(old, path.Copy())
+		if err != nil {
+			return orig, &PathError{Path: path.Copy(), Err: err}
+		}
+		doc, err = setAtPath(doc, path, value)
+		if err != nil {
+			return orig, err
+		}
+	}
+	return doc, nil
+}
+
+// setAtPath rebuilds the containers along path so the value found at path
+// becomes newVal. Marks of the rebuilt containers are preserved.
+func setAtPath(val cty.Value, path cty.Path, newVal cty.Value) (cty.Value, error) {
+	return setAtStep(val, path, 0, newVal, false)
+}
+
+// createAtPath is setAtPath which creates missing attributes, map keys and
+// null parents along the way. Arrays can only grow by one element at their
+// end.
+func createAtPath(val cty.Value, path cty.Path, newVal cty.Value) (cty.Value, error) {
+	return setAtStep(val, path, 0, newVal, true)
+}
+
+// setAtStep is setAtPath for the steps of path from i onwards; the full path
+// is kept around for error reporting.
+func setAtStep(val cty.Value, path cty.Path, i int, newVal cty.Value, create bool) (cty.Value, error) {
+	if i == len(path) {
+		return newVal, nil
+	}
+	at := path[:i+1]
+	val, marks := val.Unmark()
+	if create && val.IsNull() {
+		return buildAtStep(path, i, newVal)
+	}
+	if val.IsNull() || !val.IsKnown() {
+		return cty.NilVal, newPathError(at, ErrTypeMismatch, "can't set inside a null or unknown value")
+	}
+	ty := val.Type()
+
+	switch step := path[i].(type) {
+	case cty.GetAttrStep:
+		if ty.IsMapType() {
+			return setAtStep(val.WithMarks(marks), withStep(path, i, cty.IndexStep{Key: cty.StringVal(step.Name)}), i, newVal, create)
+		}
+		if !ty.IsObjectType() {
+			return cty.NilVal, newPathError(at, ErrTypeMismatch, "can't set attribute %q of %s", step.Name, ty.FriendlyName())
+		}
+		attrs := val.AsValueMap()
+		if attrs == nil {
+			attrs = map[string]cty.Value{}
+		}
+		var child cty.Value
+		var err error
+		if ty.HasAttribute(step.Name) {
+			child, err = setAtStep(attrs[step.Name], path, i+1, newVal, create)
+		} else if create {
+			child, err = buildAtStep(path, i+1, newVal)
+		} else {
+			return cty.NilVal, newPathError(at, ErrNotFound, "no attribute %q", step.Name)
+		}
+		if err != nil {
+			return cty.NilVal, err
+		}
+		attrs[step.Name] = child
+		return cty.ObjectVal(attrs).WithMarks(marks), nil
+
+	case cty.IndexStep:
+		switch {
+		case ty.IsObjectType():
+			if !step.Key.Type().Equals(cty.String) {
+				return cty.NilVal, newPathError(at, ErrTypeMismatch, "object attributes must be addressed by name")
+			}
+			return setAtStep(val.WithMarks(marks), withStep(path, i, cty.GetAttrStep{Name: step.Key.AsString()}), i, newVal, create)
+
+		case ty.IsMapType():
+			if !step.Key.Type().Equals(cty.String) {
+				return cty.NilVal, newPathError(at, ErrTypeMismatch, "map keys must be strings")
+			}
+			elems := val.AsValueMap()
+			if elems == nil {
+				elems = map[string]cty.Value{}
+			}
+			key := step.Key.AsString()
+			var child cty.Value
+			var err error
+			if val.HasIndex(step.Key).True() {
+				child, err = setAtStep(elems[key], path, i+1, newVal, create)
+			} else if create {
+				child, err = buildAtStep(path, i+1, newVal)
+			} else {
+				return cty.NilVal, newPathError(at, ErrNotFound, "no map key %s", step.Key.GoString())
+			}
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elems[key] = child
+			if !sameElementTypes(mapValues(elems)) {
+				return cty.NilVal, newPathError(at, ErrTypeMismatch, "new value doesn't match the map element type %s", ty.ElementType().FriendlyName())
+			}
+			return cty.MapVal(elems).WithMarks(marks), nil
+
+		case ty.IsListType() || ty.IsTupleType():
+			if !step.Key.Type().Equals(cty.Number) {
+				return cty.NilVal, newPathError(at, ErrTypeMismatch, "arrays must be indexed by number")
+			}
+			elems := val.AsValueSlice()
+			idx, _ := step.Key.AsBigFloat().Int64()
+			var err error
+			switch {
+			case val.HasIndex(step.Key).True():
+				elems[idx], err = setAtStep(elems[idx], path, i+1, newVal, create)
+			case create && idx == int64(len(elems)):
+				var child cty.Value
+				child, err = buildAtStep(path, i+1, newVal)
+				elems = append(elems, child)
+			default:
+				return cty.NilVal, newPathError(at, ErrIndexOutOfBounds, "index %s out of range", step.Key.GoString())
+			}
+			if err != nil {
+				return cty.NilVal, err
+			}
+			if ty.IsListType() {
+				if !sameElementTypes(elems) {
+					return cty.NilVal, newPathError(at, ErrTypeMismatch, "new value doesn't match the list element type %s", ty.ElementType().FriendlyName())
+				}
+				return cty.ListVal(elems).WithMarks(marks), nil
+			}
+			return cty.TupleVal(elems).WithMarks(marks), nil
+		}
+	}
+	return cty.NilVal, newPathError(at, ErrTypeMismatch, "can't set inside %s", ty.FriendlyName())
+}
+
+// buildAtStep creates the structure the steps of path from i onwards
+// describe, with newVal at the bottom.
+func buildAtStep(path cty.Path, i int, newVal cty.Value) (cty.Value, error) {
+	if i == len(path) {
+		return newVal, nil
+	}
+	child, err := buildAtStep(path, i+1, newVal)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	switch step := path[i].(type) {
+	case cty.GetAttrStep:
+		return cty.ObjectVal(map[string]cty.Value{step.Name: child}), nil
+	case cty.IndexStep:
+		if step.Key.Type().Equals(cty.String) {
+			return cty.ObjectVal(map[string]cty.Value{step.Key.AsString(): child}), nil
+		}
+		if step.Key.Type().Equals(cty.Number) && step.Key.RawEquals(cty.Zero) {
+			return cty.TupleVal([]cty.Value{child}), nil
+		}
+	}
+	return cty.NilVal, newPathError(path[:i+1], ErrIndexOutOfBounds, "can only create arrays starting at index 0")
+}
+
+// withStep returns a copy of path with the step at i replaced.
+func withStep(path cty.Path, i int, step cty.PathStep) cty.Path {
+	out := path.Copy()
+	out[i] = step
+	return out
+}
+
+func mapValues(m map[string]cty.Value) []cty.Value {
+	out := make([]cty.Value, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	return out
+}
+
+// sameElementTypes reports whether vals can form a list or map (cty requires
+// all elements of a collection to share one type).
+func sameElementTypes(vals []cty.Value) bool {
+	for i := 1; i < len(vals); i++ {
+		if !vals[i].Type().Equals(vals[0].Type()) {
+			return false
+		}
+	}
+	return true
+}
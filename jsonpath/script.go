@@ -0,0 +1,149 @@
+package jsonpath
+
+import (
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EvalScript runs a script of expressions separated by semicolons against
+// doc and returns the matches of the last one, e.g.
+//
+//	let imgs = $..image; let latest = imgs[?(@.tag == 'latest')]; latest[*].name
+//
+// `let name = expr` binds the matches of expr to name. A bound name holds
+// the list of its matches, like a JSON array, and can start an expression
+// in place of $; filters refer to it with $doc("name"). The matches of an
+// expression starting with a name keep the paths they were found at in
+// doc. opts are those of NewPath.
+func EvalScript(doc cty.Value, script string, opts ...Option) (MatchList, error) {
+	vars := map[string]MatchList{}
+	lookup := func(name string) (cty.Value, bool) {
+		matches, ok := vars[name]
+		if !ok {
+			return cty.NilVal, false
+		}
+		return matchValues(matches), true
+	}
+	opts = append(opts[:len(opts):len(opts)], WithDocuments(lookup))
+
+	statements := splitStatements(script)
+	var result MatchList
+	for i, statement := range statements {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			if i == len(statements)-1 && i > 0 {
+				// a trailing semicolon
+				break
+			}
+			return nil, newError(ErrSyntax, "statement %d is empty", i+1)
+		}
+		name := ""
+		if rest, ok := strings.CutPrefix(statement, "let "); ok {
+			eq := strings.IndexByte(rest, '=')
+			if eq < 0 || !isScriptName(strings.TrimSpace(rest[:eq])) {
+				return nil, newError(ErrSyntax, "statement %d: expected let <name> = <expression>", i+1)
+			}
+			name, statement = strings.TrimSpace(rest[:eq]), strings.TrimSpace(rest[eq+1:])
+		}
+		matches, err := evalStatement(doc, statement, vars, opts)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			vars[name] = matches
+		}
+		result = matches
+	}
+	return result, nil
+}
+
+// evalStatement evaluates expr against doc or, when it starts with a bound
+// name, against the matches bound to it.
+func evalStatement(doc cty.Value, expr string, vars map[string]MatchList, opts []Option) (MatchList, error) {
+	n := scriptNameLen(expr)
+	if n == 0 {
+		p, err := NewPath(expr, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return p.EvalMatches(doc)
+	}
+	bound, ok := vars[expr[:n]]
+	if !ok {
+		return nil, newError(ErrNotFound, "%s isn't bound", expr[:n])
+	}
+	p, err := NewPath("$"+expr[n:], opts...)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := p.EvalMatches(matchValues(bound))
+	if err != nil {
+		return nil, err
+	}
+	// paths start with the index of a bound match; put its path instead
+	for i, m := range matches {
+		if len(m.Path) == 0 {
+			continue
+		}
+		if at := stepIndex(m.Path[0]); at >= 0 && at < len(bound) {
+			matches[i].Path = append(bound[at].Path.Copy(), m.Path[1:]...)
+		}
+	}
+	return matches, nil
+}
+
+// matchValues returns the values of matches as a tuple.
+func matchValues(matches MatchList) cty.Value {
+	vals := make([]cty.Value, len(matches))
+	for i, m := range matches {
+		vals[i] = m.Value
+	}
+	return cty.TupleVal(vals)
+}
+
+func isScriptName(s string) bool {
+	return s != "" && scriptNameLen(s) == len(s)
+}
+
+// scriptNameLen returns the length of the name starting s, if any.
+func scriptNameLen(s string) int {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || n > 0 && c >= '0' && c <= '9') {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// splitStatements splits script at the semicolons outside brackets,
+// parentheses and quotes.
+func splitStatements(script string) []string {
+	statements := []string{}
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			statements = append(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	return append(statements, script[start:])
+}
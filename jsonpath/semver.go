@@ -0,0 +1,134 @@
+//go:build !jsonpath_minimal
+
+package jsonpath
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func init() {
+	functions["semver_eq"] = semverFunc("semver_eq", func(c int) bool { return c == 0 })
+	functions["semver_gt"] = semverFunc("semver_gt", func(c int) bool { return c > 0 })
+	functions["semver_gte"] = semverFunc("semver_gte", func(c int) bool { return c >= 0 })
+	functions["semver_lt"] = semverFunc("semver_lt", func(c int) bool { return c < 0 })
+	functions["semver_lte"] = semverFunc("semver_lte", func(c int) bool { return c <= 0 })
+	functions["uuid"] = filterFunc{params: 1, impl: isUUID}
+}
+
+var (
+	semverRex = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	uuidRex   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// semver is a parsed semantic version. Build metadata is dropped since it
+// doesn't take part in precedence.
+type semver struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+func parseSemver(s string) (semver, error) {
+	m := semverRex.FindStringSubmatch(s)
+	if m == nil {
+		return semver{}, newError(ErrTypeMismatch, "%q is not a semantic version", s)
+	}
+	var v semver
+	for i := range v.core {
+		n, err := strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return semver{}, newError(ErrTypeMismatch, "%q is not a semantic version", s)
+		}
+		v.core[i] = n
+	}
+	if m[4] != "" {
+		v.prerelease = strings.Split(m[4], ".")
+	}
+	return v, nil
+}
+
+// compareSemver orders versions by semver 2.0 precedence.
+func compareSemver(a, b semver) int {
+	for i := range a.core {
+		switch {
+		case a.core[i] < b.core[i]:
+			return -1
+		case a.core[i] > b.core[i]:
+			return 1
+		}
+	}
+	// a version without pre-release identifiers ranks higher
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		if c := comparePrerelease(a.prerelease[i], b.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a.prerelease) < len(b.prerelease):
+		return -1
+	case len(a.prerelease) > len(b.prerelease):
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares numeric identifiers numerically, others
+// lexically, with numeric ones ranking lower.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// semverFunc builds a filter function comparing two versions, e.g.
+// semver_gte(@.version, '1.4.0').
+func semverFunc(name string, test func(cmp int) bool) filterFunc {
+	return filterFunc{params: 2, impl: func(args []cty.Value) (cty.Value, error) {
+		var versions [2]semver
+		for i, arg := range args {
+			s, err := stringArg(name, arg)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			if versions[i], err = parseSemver(s); err != nil {
+				return cty.NilVal, err
+			}
+		}
+		return cty.BoolVal(test(compareSemver(versions[0], versions[1]))), nil
+	}}
+}
+
+// isUUID implements uuid(s), which tells whether s is a UUID in its
+// canonical textual form.
+func isUUID(args []cty.Value) (cty.Value, error) {
+	v := args[0]
+	if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return cty.False, nil
+	}
+	return cty.BoolVal(uuidRex.MatchString(v.AsString())), nil
+}
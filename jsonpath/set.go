@@ -0,0 +1,149 @@
+package jsonpath
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Set returns a copy of doc with value stored at jsonPath.
+//
+// When jsonPath is a definite location (only fields and non-negative
+// indexes, e.g. `$.spec.containers[0].image`), missing objects and null
+// parents along the way are created. Otherwise every existing match is
+// replaced, like ReplaceByPath. See WithDryRun for previewing the change.
+func Set(doc cty.Value, jsonPath string, value cty.Value, opts ...Option) (cty.Value, error) {
+	s := newSettings(opts)
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return doc, err
+	}
+	if path, ok := p.definitePath(); ok {
+		updated, err := createAtPath(doc, path, value)
+		if err != nil || s.dryRun == nil {
+			return updated, err
+		}
+		*s.dryRun = []Change{createChange(doc, updated, path)}
+		return doc, nil
+	}
+	paths, err := p.writePaths(doc)
+	if err != nil {
+		return doc, err
+	}
+	updated, err := replacePaths(doc, paths, value)
+	if err != nil || s.dryRun == nil {
+		return updated, err
+	}
+	*s.dryRun = replaceChanges(doc, updated, paths)
+	return doc, nil
+}
+
+// CopyByPath grafts the single value srcPath matches in srcDoc into dstDoc
+// at dstPath, creating missing parents, and returns the new destination.
+func CopyByPath(srcDoc cty.Value, srcPath string, dstDoc cty.Value, dstPath string) (cty.Value, error) {
+	value, err := getOne(srcDoc, srcPath)
+	if err != nil {
+		return dstDoc, err
+	}
+	return Set(dstDoc, dstPath, value)
+}
+
+// definitePath returns the location the expression selects if it's made of
+// plain fields and indexes only.
+func (j *JSONPath) definitePath() (cty.Path, bool) {
+	steps := j.steps()
+	path := staticPrefix(steps)
+	return path, len(path) == len(steps)
+}
+
+// getOne evaluates jsonPath and expects exactly one match.
+func getOne(doc cty.Value, jsonPath string) (cty.Value, error) {
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	vals, _, err := p.Eval(doc)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	switch len(vals) {
+	case 0:
+		return cty.NilVal, newError(ErrNotFound, "%s matches nothing", jsonPath)
+	case 1:
+		return vals[0], nil
+	}
+	return cty.NilVal, newError(ErrMultipleMatches, "%s matches %d values, expected one", jsonPath, len(vals))
+}
+
+// Delete returns a copy of doc without the locations jsonPath matches:
+// attributes and map keys are dropped, array elements removed with the
+// following ones shifting down. As with Set, matches computed from the
+// document fail with ErrUnsupported. See WithDryRun for previewing the
+// change.
+func Delete(doc cty.Value, jsonPath string, opts ...Option) (cty.Value, error) {
+	s := newSettings(opts)
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return doc, err
+	}
+	paths, err := p.writePaths(doc)
+	if err != nil {
+		return doc, err
+	}
+	changes := []Change{}
+	updated, err := deletePaths(doc, paths, &changes)
+	if err != nil || s.dryRun == nil {
+		return updated, err
+	}
+	*s.dryRun = changes
+	return doc, nil
+}
+
+// deletePaths removes paths from doc, the last array elements first so
+// earlier removals don't shift the indexes of later ones, and appends the
+// removals to changes.
+func deletePaths(doc cty.Value, paths []cty.Path, changes *[]Change) (cty.Value, error) {
+	sorted := append([]cty.Path(nil), paths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return pathAfter(sorted[i], sorted[j])
+	})
+	orig := doc
+	// parents sort before their children, but not necessarily right
+	// before them
+	removed := []cty.Path{}
+	for _, path := range sorted {
+		if removedWith(removed, path) {
+			// already gone with its parent or a duplicate match
+			continue
+		}
+		removed = append(removed, path)
+		old, _ := applyPath(doc, path)
+		var err error
+		if doc, err = removeAtPath(doc, path); err != nil {
+			return orig, err
+		}
+		*changes = append(*changes, Change{Op: OpRemove, Path: path.Copy(), Old: old})
+	}
+	return doc, nil
+}
+
+// removedWith reports whether path is one of removed or lies under one.
+func removedWith(removed []cty.Path, path cty.Path) bool {
+	for _, r := range removed {
+		if len(r) <= len(path) && pathsOverlap(r, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathAfter orders paths so that higher indexes come first and parents
+// come before their children.
+func pathAfter(a, b cty.Path) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ia, ib := stepIndex(a[i]), stepIndex(b[i]); ia != ib {
+			return ia > ib
+		}
+	}
+	return len(a) < len(b)
+}
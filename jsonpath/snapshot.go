@@ -0,0 +1,134 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SnapshotEntry is a line of a snapshot: a normalized path and the value
+// found there, as DebugString renders it.
+type SnapshotEntry struct {
+	Path, Value string
+}
+
+// Snapshot renders the matches for golden files, one `path: value` line
+// each, sorted by path. Paths are normalized, so map keys print like
+// object attributes (`$.labels.app`), and values print with DebugString,
+// truncated and with their marks listed. ParseSnapshot reads it back and
+// CheckSnapshot compares matches against it.
+func (m MatchList) Snapshot() string {
+	var b strings.Builder
+	for _, e := range m.snapshotEntries() {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+		b.WriteString(e.Value)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (m MatchList) snapshotEntries() []SnapshotEntry {
+	sorted := append(MatchList(nil), m...)
+	sort.Stable(sorted)
+	entries := make([]SnapshotEntry, len(sorted))
+	for i, match := range sorted {
+		entries[i] = SnapshotEntry{Path: snapshotPath(match.Path), Value: DebugString(match.Value)}
+	}
+	return entries
+}
+
+// snapshotPath renders path with string indexes as attributes.
+func snapshotPath(path cty.Path) string {
+	normalized := make(cty.Path, len(path))
+	for i, step := range path {
+		if index, ok := step.(cty.IndexStep); ok && index.Key.Type() == cty.String && index.Key.IsKnown() && !index.Key.IsNull() {
+			step = cty.GetAttrStep{Name: index.Key.AsString()}
+		}
+		normalized[i] = step
+	}
+	return FormatPath(normalized)
+}
+
+// ParseSnapshot reads the entries of a snapshot written by Snapshot. Blank
+// lines are ignored; a line without a path fails with ErrSyntax.
+func ParseSnapshot(text string) ([]SnapshotEntry, error) {
+	entries := []SnapshotEntry{}
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		end := snapshotPathEnd(line)
+		if end < 0 || !strings.HasPrefix(line, "$") {
+			return nil, newError(ErrSyntax, "snapshot line %d: expected `path: value`", n+1)
+		}
+		entries = append(entries, SnapshotEntry{Path: line[:end], Value: line[end+2:]})
+	}
+	return entries, nil
+}
+
+// snapshotPathEnd returns the offset of the ": " ending the path at the
+// start of line, skipping quoted keys, or -1.
+func snapshotPathEnd(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(line[i:], ": "):
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckSnapshot compares the matches with a golden snapshot and returns an
+// error matching ErrConflict that lists the differing lines, or nil.
+func (m MatchList) CheckSnapshot(golden string) error {
+	want, err := ParseSnapshot(golden)
+	if err != nil {
+		return err
+	}
+	got := m.snapshotEntries()
+	diffs := []string{}
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i].Path == got[j].Path:
+			if want[i].Value != got[j].Value {
+				diffs = append(diffs, fmt.Sprintf("%s: want %s, got %s", want[i].Path, want[i].Value, got[j].Value))
+			}
+			i++
+			j++
+		case j == len(got) || (i < len(want) && !snapshotHas(got[j:], want[i].Path)):
+			diffs = append(diffs, fmt.Sprintf("%s: missing, want %s", want[i].Path, want[i].Value))
+			i++
+		default:
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", got[j].Path, got[j].Value))
+			j++
+		}
+	}
+	if len(diffs) > 0 {
+		return newError(ErrConflict, "matches differ from the snapshot:\n%s", strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
+func snapshotHas(entries []SnapshotEntry, path string) bool {
+	for _, e := range entries {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
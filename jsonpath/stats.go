@@ -0,0 +1,173 @@
+package jsonpath
+
+import (
+	"sync"
+)
+
+// Stats collects selector statistics across the evaluations of the paths
+// compiled with it (see CompileOptions.Stats), keyed by expression: the
+// fan-out of every step and the selectivity of filters. Paths compiled
+// later with the same Stats use them to pick their evaluation strategy;
+// so far that decides which filters memoize their outcomes (see
+// EvalOptions.MemoizeFilters): a filter memoizes until it has seen enough
+// elements, then only if equal elements came up often enough to pay for
+// hashing them. Results are the same either way. A Stats is meant to live
+// as long as a server and is safe for concurrent use.
+type Stats struct {
+	mu    sync.Mutex
+	paths map[string]*PathStats
+}
+
+// PathStats holds the statistics of one expression.
+type PathStats struct {
+	// Evaluations counts the evaluations recorded.
+	Evaluations int
+	// Steps has an entry per top-level step, as with Metrics.
+	Steps []StepStats
+}
+
+// StepStats holds the statistics of one step, cumulated across
+// evaluations.
+type StepStats struct {
+	// Step is the step in JSONPath syntax, e.g. `[?(@.a > 1)]`.
+	Step string
+	// Input and Output count the values going into and coming out of the
+	// step.
+	Input, Output int
+	// Tested and Passed count the elements a filter tested and kept.
+	Tested, Passed int
+	// Lookups and Hits count the memoized outcomes a filter looked up and
+	// found.
+	Lookups, Hits int
+}
+
+// FanOut returns the average number of values the step produced per input
+// value, or 0 before any input.
+func (s StepStats) FanOut() float64 {
+	if s.Input == 0 {
+		return 0
+	}
+	return float64(s.Output) / float64(s.Input)
+}
+
+// Selectivity returns the fraction of the elements a filter kept, or 0
+// before any element.
+func (s StepStats) Selectivity() float64 {
+	if s.Tested == 0 {
+		return 0
+	}
+	return float64(s.Passed) / float64(s.Tested)
+}
+
+const (
+	// memoSample is the number of memo lookups a filter makes before its
+	// hit rate decides whether it keeps memoizing.
+	memoSample = 64
+	// memoMinHitRate is the hit rate from which memoizing pays off.
+	memoMinHitRate = 0.25
+)
+
+// NewStats creates an empty Stats.
+func NewStats() *Stats {
+	return &Stats{paths: map[string]*PathStats{}}
+}
+
+// Path returns a copy of the statistics recorded for expr.
+func (s *Stats) Path(expr string) (PathStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps, ok := s.paths[expr]
+	if !ok {
+		return PathStats{}, false
+	}
+	return PathStats{Evaluations: ps.Evaluations, Steps: append([]StepStats(nil), ps.Steps...)}, true
+}
+
+// Reset drops every statistic, e.g. after the shape of the documents
+// changed.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = map[string]*PathStats{}
+}
+
+// adapt installs stats on j, compiled from expr, and chooses the filters
+// to memoize from what was recorded so far.
+func (j *JSONPath) adapt(expr string, stats *Stats) {
+	j.stats, j.statsKey = stats, expr
+	steps := j.steps()
+	j.statIndex = make(map[Node]int, len(steps))
+	for i, node := range steps {
+		j.statIndex[node] = i
+	}
+	recorded, ok := stats.Path(expr)
+	if ok && len(recorded.Steps) != len(steps) {
+		// compiled with other options; the steps don't line up
+		ok = false
+	}
+	j.memoSteps = map[*FilterNode]bool{}
+	for i, node := range steps {
+		filter, isFilter := node.(*FilterNode)
+		if !isFilter {
+			continue
+		}
+		if _, constant := constantFilter(filter); constant {
+			continue
+		}
+		if !ok || recorded.Steps[i].Lookups < memoSample {
+			// still learning
+			j.memoSteps[filter] = true
+			continue
+		}
+		step := recorded.Steps[i]
+		j.memoSteps[filter] = float64(step.Hits)/float64(step.Lookups) >= memoMinHitRate
+	}
+}
+
+// statStep returns the statistics of the evaluation in progress for node,
+// if it is a top-level step and statistics are collected.
+func (j *JSONPath) statStep(node Node) *StepStats {
+	if j.statRun == nil {
+		return nil
+	}
+	i, ok := j.statIndex[node]
+	if !ok {
+		return nil
+	}
+	return &j.statRun[i]
+}
+
+// beginStats starts collecting the statistics of an evaluation and returns
+// the function adding them to j.stats.
+func (j *JSONPath) beginStats() func() {
+	if j.stats == nil {
+		return func() {}
+	}
+	steps := j.steps()
+	j.statRun = make([]StepStats, len(steps))
+	return func() {
+		run := j.statRun
+		j.statRun = nil
+		s := j.stats
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ps, ok := s.paths[j.statsKey]
+		if !ok || len(ps.Steps) != len(run) {
+			ps = &PathStats{Steps: make([]StepStats, len(run))}
+			for i, node := range steps {
+				ps.Steps[i].Step = formatStep(node)
+			}
+			s.paths[j.statsKey] = ps
+		}
+		ps.Evaluations++
+		for i, r := range run {
+			step := &ps.Steps[i]
+			step.Input += r.Input
+			step.Output += r.Output
+			step.Tested += r.Tested
+			step.Passed += r.Passed
+			step.Lookups += r.Lookups
+			step.Hits += r.Hits
+		}
+	}
+}
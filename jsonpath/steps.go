@@ -0,0 +1,150 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// flattenSteps expands the nested ListNodes produced by the parser into the
+// flat sequence of steps they evaluate to. Since evalList applies its nodes
+// one after another, the flat form evaluates identically.
+func flattenSteps(list *ListNode) []Node {
+	out := []Node{}
+	for _, node := range list.Nodes {
+		if inner, ok := node.(*ListNode); ok {
+			out = append(out, flattenSteps(inner)...)
+			continue
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// steps returns the flat step sequence of the parsed expression.
+func (j *JSONPath) steps() []Node {
+	if j.parser == nil {
+		return nil
+	}
+	return flattenSteps(j.parser.Root)
+}
+
+// staticPrefix returns the longest leading run of steps that select a
+// single, statically known location (plain fields and non-negative indexes).
+func staticPrefix(steps []Node) cty.Path {
+	path := cty.Path{}
+	for _, node := range steps {
+		switch node := node.(type) {
+		case *FieldNode:
+			path = path.GetAttr(node.Value)
+		case *ArrayNode:
+			start := node.Params[0]
+			if !start.Known || start.Value < 0 || !node.Params[1].Derived {
+				return path
+			}
+			path = path.IndexInt(start.Value)
+		default:
+			return path
+		}
+	}
+	return path
+}
+
+// pathsOverlap reports whether one path is a prefix of the other, treating
+// an attribute step and a string index step with the same name as equal
+// (objects and maps are addressed the same way in a JSONPath).
+func pathsOverlap(a, b cty.Path) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if !stepsEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func stepsEqual(a, b cty.PathStep) bool {
+	ka, kb := stepKey(a), stepKey(b)
+	if ka == cty.NilVal || kb == cty.NilVal {
+		return false
+	}
+	if !ka.Type().Equals(kb.Type()) {
+		return false
+	}
+	return ka.RawEquals(kb)
+}
+
+func stepKey(step cty.PathStep) cty.Value {
+	switch step := step.(type) {
+	case cty.GetAttrStep:
+		return cty.StringVal(step.Name)
+	case cty.IndexStep:
+		if !step.Key.IsKnown() || step.Key.IsNull() {
+			return cty.NilVal
+		}
+		return step.Key
+	}
+	return cty.NilVal
+}
+
+// pathFromSteps builds a JSONPath evaluating the given flat steps.
+func pathFromSteps(steps []Node) *JSONPath {
+	inner := newList()
+	inner.Nodes = steps
+	root := newList()
+	root.append(inner)
+	return &JSONPath{parser: &Parser{Root: root}}
+}
+
+// ReferencedPrefixes returns the static prefixes of every part of the
+// document the expression can read: the prefix of the path itself and of
+// each filter operand starting with $. A change outside all of them can't
+// alter the result, which makes the prefixes usable for dependency
+// tracking, cache invalidation and access checks.
+func (j *JSONPath) ReferencedPrefixes() []cty.Path {
+	prefixes := []cty.Path{staticPrefix(j.steps())}
+	for _, ref := range rootReferences(j.steps()) {
+		prefixes = appendPrefix(prefixes, staticPrefix(ref))
+	}
+	return prefixes
+}
+
+// rootReferences collects the steps following every $ inside filters.
+func rootReferences(steps []Node) [][]Node {
+	refs := [][]Node{}
+	for _, node := range steps {
+		switch node := node.(type) {
+		case *FilterNode:
+			refs = append(refs, operandReferences(node.Left)...)
+			refs = append(refs, operandReferences(node.Right)...)
+		case *FunctionNode:
+			for _, arg := range node.Args {
+				refs = append(refs, operandReferences(arg)...)
+			}
+		case *UnionNode:
+			for _, branch := range node.Nodes {
+				refs = append(refs, rootReferences(flattenSteps(branch))...)
+			}
+		}
+	}
+	return refs
+}
+
+func operandReferences(operand *ListNode) [][]Node {
+	steps := flattenSteps(operand)
+	refs := rootReferences(steps)
+	if len(steps) > 0 && steps[0].Type() == NodeRoot {
+		refs = append([][]Node{steps[1:]}, refs...)
+	}
+	return refs
+}
+
+func appendPrefix(prefixes []cty.Path, path cty.Path) []cty.Path {
+	for _, p := range prefixes {
+		if len(p) == len(path) && pathsOverlap(p, path) {
+			return prefixes
+		}
+	}
+	return append(prefixes, path)
+}
@@ -0,0 +1,171 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Store holds named Documents, for example one per configuration file, and
+// lets expressions evaluated on one of them refer to the others with
+// $doc("name"):
+//
+//	store.Eval("deployments", `$[?(@.replicas > $doc("limits").replicas)].name`)
+//
+// A Store is safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	docs map[string]*Document
+
+	// persistence, see OpenStore
+	writer  *writer
+	cancels map[string]func()
+}
+
+// NewStore creates an empty Store kept in memory only.
+func NewStore() *Store {
+	return &Store{docs: map[string]*Document{}, cancels: map[string]func(){}}
+}
+
+// Put stores value under name, replacing the whole document if there is
+// one already, and returns the Document.
+func (s *Store) Put(name string, value cty.Value) *Document {
+	s.mu.Lock()
+	d, ok := s.docs[name]
+	if !ok {
+		d = NewDocument(value)
+		s.docs[name] = d
+		s.watch(name, d)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		d.mu.Lock()
+		notify := d.replace(value, []cty.Path{{}})
+		d.mu.Unlock()
+		d.publish(notify, value)
+	} else {
+		s.changed(name)
+	}
+	return d
+}
+
+// Document returns the document stored under name.
+func (s *Store) Document(name string) (*Document, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.docs[name]
+	return d, ok
+}
+
+// Remove drops the document stored under name.
+func (s *Store) Remove(name string) {
+	s.mu.Lock()
+	delete(s.docs, name)
+	if cancel, ok := s.cancels[name]; ok {
+		cancel()
+		delete(s.cancels, name)
+	}
+	s.mu.Unlock()
+	s.changed(name)
+}
+
+// Names returns the names of the stored documents, sorted.
+func (s *Store) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.docs))
+	for name := range s.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot returns the current value of every document.
+func (s *Store) Snapshot() map[string]cty.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]cty.Value, len(s.docs))
+	for name, d := range s.docs {
+		out[name] = d.Value()
+	}
+	return out
+}
+
+// Eval evaluates jsonPath against the document stored under name.
+// $doc("other") references see the other documents as they were when Eval
+// was called.
+func (s *Store) Eval(name, jsonPath string) ([]cty.Value, []cty.Path, error) {
+	snapshot := s.Snapshot()
+	doc, ok := snapshot[name]
+	if !ok {
+		return nil, nil, newError(ErrNotFound, "document %q not found", name)
+	}
+	p, err := NewPath(jsonPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.Eval(doc, WithDocuments(func(name string) (cty.Value, bool) {
+		v, ok := snapshot[name]
+		return v, ok
+	}))
+}
+
+// Export encodes every document as one JSON object keyed by name.
+func (s *Store) Export() ([]byte, error) {
+	out := map[string]json.RawMessage{}
+	for name, v := range s.Snapshot() {
+		v, _ = v.UnmarkDeep()
+		b, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, newError(ErrUnsupported, "document %q: %s", name, err)
+		}
+		out[name] = b
+	}
+	return json.Marshal(out)
+}
+
+// Import Puts every document of data, as written by Export.
+func (s *Store) Import(data []byte) error {
+	var docs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return newError(ErrSyntax, "%s", err)
+	}
+	values := map[string]cty.Value{}
+	for name, raw := range docs {
+		v, err := DecodeJSONStrict(raw)
+		if err != nil {
+			return newError(ErrSyntax, "document %q: %s", name, err)
+		}
+		values[name] = v
+	}
+	for name, v := range values {
+		s.Put(name, v)
+	}
+	return nil
+}
+
+// evalDoc selects the document a DocNode refers to. Its values are marked
+// with paths within that document.
+func (j *JSONPath) evalDoc(node *DocNode) ([]cty.Value, error) {
+	doc, err := j.lookupDoc(node)
+	if err != nil {
+		return nil, err
+	}
+	return []cty.Value{markPaths(doc)}, nil
+}
+
+func (j *JSONPath) lookupDoc(node *DocNode) (cty.Value, error) {
+	if j.opts.Documents == nil {
+		return cty.NilVal, newError(ErrNotFound, "document %q not found: no documents to refer to outside a Store", node.Name)
+	}
+	doc, ok := j.opts.Documents(node.Name)
+	if !ok {
+		return cty.NilVal, newError(ErrNotFound, "document %q not found", node.Name)
+	}
+	return doc, nil
+}
@@ -0,0 +1,72 @@
+package jsonpath
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Stream rebuilds a document from an ordered log of JSON Patch documents,
+// as persisted by event-sourced configuration stores. Every patch is
+// applied atomically: a failing operation, including a "test" whose
+// expectation doesn't hold (ErrConflict), rejects the whole patch and
+// leaves the stream at the previous state. A Stream is not safe for
+// concurrent use.
+type Stream struct {
+	value   cty.Value
+	applied int
+}
+
+// NewStream starts a stream at initial.
+func NewStream(initial cty.Value) *Stream {
+	return &Stream{value: initial}
+}
+
+// Apply applies the next patch of the log. Errors are *SequenceError
+// values.
+func (s *Stream) Apply(patch []byte) error {
+	updated, err := ApplyPatch(s.value, patch)
+	if err != nil {
+		return &SequenceError{Seq: s.applied, Err: err}
+	}
+	s.value = updated
+	s.applied++
+	return nil
+}
+
+// Value returns the state after the patches applied so far.
+func (s *Stream) Value() cty.Value {
+	return s.value
+}
+
+// Len returns the number of patches applied so far.
+func (s *Stream) Len() int {
+	return s.applied
+}
+
+// Replay applies patches to initial in order and returns the final state.
+// It stops at the first failing patch.
+func Replay(initial cty.Value, patches [][]byte) (cty.Value, error) {
+	s := NewStream(initial)
+	for _, patch := range patches {
+		if err := s.Apply(patch); err != nil {
+			return s.Value(), err
+		}
+	}
+	return s.Value(), nil
+}
+
+// SequenceError reports the patch of a log that failed to apply.
+type SequenceError struct {
+	// Seq is the position of the patch in the log.
+	Seq int
+	Err error
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("patch %d: %s", e.Seq, e.Err)
+}
+
+func (e *SequenceError) Unwrap() error {
+	return e.Err
+}
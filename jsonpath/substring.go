@@ -0,0 +1,52 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// evalStringIndex applies an index or a slice to a string, counting runes
+// (see EvalOptions.StringIndexes): an index selects a one-rune string and a
+// slice the substring made of the runes it selects.
+func (j *JSONPath) evalStringIndex(value cty.Value, node *ArrayNode) ([]cty.Value, error) {
+	unmarked, _ := value.Unmark()
+	runes := []rune(unmarked.AsString())
+	indices, err := sliceIndices(node.Params, len(runes), j.opts.OutOfRange)
+	if err != nil {
+		return nil, err
+	}
+	if isSingleIndex(node.Params) && len(indices) == 0 {
+		return []cty.Value{}, nil
+	}
+	selected := make([]rune, len(indices))
+	for i, index := range indices {
+		selected[i] = runes[index]
+	}
+	return []cty.Value{derivedValue(value, cty.StringVal(string(selected)))}, nil
+}
+
+// derivedValue marks v, computed from source, and everything it contains
+// with the marks of source, and as found at the path of source so it keeps
+// a path among the results.
+func derivedValue(source, v cty.Value) cty.Value {
+	marks := derivedMarks(source)
+	v, _ = cty.Transform(v, func(_ cty.Path, value cty.Value) (cty.Value, error) {
+		return value.WithMarks(marks), nil
+	})
+	return v
+}
+
+// derivedMarks returns the marks of a value computed from source: those of
+// source, with its path as a derived one.
+func derivedMarks(source cty.Value) cty.ValueMarks {
+	marks := cty.ValueMarks{}
+	for mark := range source.Marks() {
+		if _, ok := mark.(markPathRef); !ok {
+			marks[mark] = struct{}{}
+		}
+	}
+	if path, ok := valuePath(source); ok {
+		p := path.Copy()
+		marks[markPathRef{path: &p, derived: true}] = struct{}{}
+	}
+	return marks
+}
@@ -0,0 +1,75 @@
+package jsonpath
+
+import (
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// RenderTemplate expands a kubectl-style template such as
+// "name={.metadata.name} ns={.metadata.namespace}" against data. Each
+// brace-delimited expression is replaced by its matches separated by
+// spaces; expressions may omit the leading $. Strings are inserted as is,
+// numbers and bools in their literal form and other values as JSON. An
+// expression without matches renders as the empty string. The range/end
+// blocks of kubectl templates are not supported.
+func RenderTemplate(template string, data cty.Value) (string, error) {
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			out.WriteString(template)
+			return out.String(), nil
+		}
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			return "", newError(ErrSyntax, "unclosed action in template")
+		}
+		out.WriteString(template[:open])
+		expr := strings.TrimSpace(template[open+1 : open+end])
+		if !strings.HasPrefix(expr, "$") {
+			expr = "$" + expr
+		}
+		p, err := NewPath(expr)
+		if err != nil {
+			return "", err
+		}
+		vals, _, err := p.Eval(data)
+		if err != nil {
+			return "", err
+		}
+		for i, v := range vals {
+			if i > 0 {
+				out.WriteByte(' ')
+			}
+			s, err := renderValue(v)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(s)
+		}
+		template = template[open+end+1:]
+	}
+}
+
+func renderValue(v cty.Value) (string, error) {
+	v, _ = v.UnmarkDeep()
+	switch {
+	case v.IsNull():
+		return "null", nil
+	case !v.IsKnown():
+		return "(unknown)", nil
+	case v.Type() == cty.String:
+		return v.AsString(), nil
+	case v.Type() == cty.Number:
+		return v.AsBigFloat().Text('f', -1), nil
+	case v.Type() == cty.Bool:
+		if v.True() {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	b, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+	return string(b), err
+}
@@ -0,0 +1,87 @@
+package jsonpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Span is a unit of work in a distributed trace. It's the subset of an
+// OpenTelemetry trace.Span the package needs, so tracing doesn't make it
+// depend on OpenTelemetry: an adapter converts the attributes with
+// attribute.String and attribute.Int64.
+type Span interface {
+	SetAttributes(attrs ...slog.Attr)
+	RecordError(err error)
+	End()
+}
+
+// StartSpan begins a span named name, typically by calling an OpenTelemetry
+// tracer's Start with the context of the request being served.
+type StartSpan func(name string) Span
+
+// Size classes of the documents reported by Tracing, by estimated size (see
+// EvalOptions.MaxResultBytes).
+const (
+	smallDoc  = 1 << 10
+	mediumDoc = 64 << 10
+)
+
+// Tracing returns middleware (see Use) recording a "jsonpath.eval" span per
+// evaluation of j, with the attributes
+//
+//   - jsonpath.expr_hash: a hash of the expression, stable across processes
+//   - jsonpath.matches: the number of results
+//   - jsonpath.doc_size: "small" (under 1KiB), "medium" (under 64KiB) or "large"
+//
+// and the error, if any. CompileOptions.StartSpan installs it at compile time.
+func (j *JSONPath) Tracing(start StartSpan) Middleware {
+	hash := exprHash(j)
+	return func(next EvalFunc) EvalFunc {
+		return func(data cty.Value, opts EvalOptions) ([]cty.Value, []cty.Path, error) {
+			span := start("jsonpath.eval")
+			defer span.End()
+			vals, paths, err := next(data, opts)
+			span.SetAttributes(
+				slog.String("jsonpath.expr_hash", hash),
+				slog.Int("jsonpath.matches", len(vals)),
+				slog.String("jsonpath.doc_size", docSizeClass(data)),
+			)
+			if err != nil {
+				span.RecordError(err)
+			}
+			return vals, paths, err
+		}
+	}
+}
+
+// traceCompile records a "jsonpath.compile" span for Compile.
+func traceCompile(start StartSpan, j *JSONPath, err error) {
+	span := start("jsonpath.compile")
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	span.SetAttributes(slog.String("jsonpath.expr_hash", exprHash(j)))
+}
+
+// exprHash identifies an expression by the hash of its normalized form, so
+// equivalent spellings share it and the expression itself, which may embed
+// sensitive literals, isn't exported.
+func exprHash(j *JSONPath) string {
+	sum := sha256.Sum256([]byte(j.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func docSizeClass(data cty.Value) string {
+	switch size := estimateSize(data, mediumDoc); {
+	case size < smallDoc:
+		return "small"
+	case size < mediumDoc:
+		return "medium"
+	}
+	return "large"
+}
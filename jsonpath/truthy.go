@@ -0,0 +1,29 @@
+package jsonpath
+
+import "github.com/zclconf/go-cty/cty"
+
+// Truthy is the rule for values used as conditions: true, non-empty
+// strings, non-zero numbers and non-empty collections and objects are
+// true; false, "", 0, empty containers, null and unknown values are false.
+// Filters apply it to literals and function calls standing alone, as in
+// [?(length(@.tags))]; a lone path like [?(@.isbn)] still tests existence.
+func Truthy(v cty.Value) bool {
+	v, _ = v.UnmarkDeep()
+	if v == cty.NilVal || v.IsNull() || !v.IsKnown() {
+		return false
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.Bool:
+		return v.True()
+	case ty == cty.String:
+		return v.AsString() != ""
+	case ty == cty.Number:
+		return v.AsBigFloat().Sign() != 0
+	case ty.IsObjectType():
+		return len(ty.AttributeTypes()) > 0
+	case v.CanIterateElements():
+		return v.LengthInt() > 0
+	}
+	return true
+}
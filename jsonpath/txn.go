@@ -0,0 +1,123 @@
+package jsonpath
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Txn groups edits to a Document that become visible together on Commit.
+// It works on a private copy of the snapshot taken by Begin; a Txn is not
+// safe for concurrent use.
+type Txn struct {
+	doc   *Document
+	base  cty.Value
+	value cty.Value
+	done  bool
+}
+
+// Begin starts a transaction on the current snapshot.
+func (d *Document) Begin() *Txn {
+	base := d.Value()
+	return &Txn{doc: d, base: base, value: base}
+}
+
+// Value returns the snapshot as edited so far.
+func (t *Txn) Value() cty.Value {
+	return t.value
+}
+
+// Set stores value at jsonPath, like the package-level Set.
+func (t *Txn) Set(jsonPath string, value cty.Value) error {
+	return t.apply(func(doc cty.Value) (cty.Value, error) {
+		return Set(doc, jsonPath, value)
+	})
+}
+
+// Delete removes the locations jsonPath matches, like the package-level
+// Delete.
+func (t *Txn) Delete(jsonPath string) error {
+	return t.apply(func(doc cty.Value) (cty.Value, error) {
+		return Delete(doc, jsonPath)
+	})
+}
+
+// Move moves the single value from matches to the location to, creating
+// missing parents like Set. from is removed first, as with a JSON Patch
+// move, so array indexes in to refer to the array without it.
+func (t *Txn) Move(from, to string) error {
+	return t.apply(func(doc cty.Value) (cty.Value, error) {
+		value, err := getOne(doc, from)
+		if err != nil {
+			return doc, err
+		}
+		if doc, err = Delete(doc, from); err != nil {
+			return doc, err
+		}
+		return Set(doc, to, value)
+	})
+}
+
+// Patch applies a JSON Patch document (see ApplyPatch).
+func (t *Txn) Patch(patch []byte) error {
+	return t.apply(func(doc cty.Value) (cty.Value, error) {
+		return ApplyPatch(doc, patch)
+	})
+}
+
+// apply runs one edit. A failed edit leaves the transaction as it was.
+func (t *Txn) apply(edit func(cty.Value) (cty.Value, error)) error {
+	if t.done {
+		return newError(ErrUnsupported, "transaction already finished")
+	}
+	updated, err := edit(t.value)
+	if err != nil {
+		return err
+	}
+	t.value = updated
+	return nil
+}
+
+// Commit makes the edits the document's new snapshot and returns it along
+// with the JSON Patch turning the previous snapshot into it. It fails with
+// ErrConflict, leaving the document untouched, if the document was written
+// since Begin. Subscribers are notified as for Document.Set.
+func (t *Txn) Commit() (cty.Value, []byte, error) {
+	if t.done {
+		return cty.NilVal, nil, newError(ErrUnsupported, "transaction already finished")
+	}
+	changes, err := Diff(t.base, t.value, DiffOptions{})
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+	patch, err := MarshalPatch(changes)
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+	changed := []cty.Path{}
+	for _, c := range changes {
+		changed = append(changed, c.Path)
+		if c.From != nil {
+			changed = append(changed, c.From)
+		}
+	}
+
+	d := t.doc
+	d.mu.Lock()
+	if !d.value.RawEquals(t.base) {
+		d.mu.Unlock()
+		return cty.NilVal, nil, newError(ErrConflict, "document changed since the transaction began")
+	}
+	t.done = true
+	notify := d.replace(t.value, changed)
+	d.mu.Unlock()
+
+	d.publish(notify, t.value)
+	return t.value, patch, nil
+}
+
+// Rollback discards the edits. It's a no-op after Commit.
+func (t *Txn) Rollback() {
+	if !t.done {
+		t.done = true
+		t.value = t.base
+	}
+}
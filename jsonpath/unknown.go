@@ -0,0 +1,32 @@
+package jsonpath
+
+import "github.com/zclconf/go-cty/cty"
+
+// unknown records that value, or the outcome of a filter on it, is unknown
+// (see EvalOptions.Unknowns).
+func (j *JSONPath) unknown(value cty.Value) {
+	if j.opts.Unknowns == nil {
+		return
+	}
+	path, ok := valuePath(value)
+	if !ok {
+		return
+	}
+	for _, seen := range *j.opts.Unknowns {
+		// e.g. looked into by both a recursive descent and the next step
+		if seen.Equals(path) {
+			return
+		}
+	}
+	*j.opts.Unknowns = append(*j.opts.Unknowns, path.Copy())
+}
+
+// unknownContainer records an unknown value a step had to look into,
+// unless its type says it has nothing to look into anyway, like an
+// unknown string.
+func (j *JSONPath) unknownContainer(value cty.Value) {
+	ty := value.Type()
+	if ty == cty.DynamicPseudoType || ty.IsCollectionType() || ty.IsObjectType() || ty.IsTupleType() {
+		j.unknown(value)
+	}
+}
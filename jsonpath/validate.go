@@ -0,0 +1,229 @@
+package jsonpath
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Check inspects a single matched value and returns an error describing why
+// it is invalid, or nil.
+type Check func(v cty.Value) error
+
+// Rule validates every value matched by Path, either with Check or with Expr,
+// a filter predicate over `@` such as `@ >= 1 && @ <= 65535`. Predicates may
+// be joined with && and ||, && binding tighter. Message, when set, replaces
+// the default violation message.
+type Rule struct {
+	Path    string
+	Check   Check
+	Expr    string
+	Message string
+}
+
+// Violation is a value that failed a Rule.
+type Violation struct {
+	Path    cty.Path
+	Value   cty.Value
+	Rule    Rule
+	Message string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("$%s: %s", PrettyCtyPath(v.Path), v.Message)
+}
+
+// Validator checks documents against a fixed set of rules. A Validator is
+// safe for concurrent use.
+type Validator struct {
+	mu    sync.Mutex
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	path      *JSONPath
+	predicate [][]*FilterNode
+}
+
+// NewValidator compiles rules, reporting syntax errors in paths and
+// expressions up front.
+func NewValidator(rules ...Rule) (*Validator, error) {
+	v := &Validator{}
+	for _, rule := range rules {
+		if (rule.Check == nil) == (rule.Expr == "") {
+			return nil, newError(ErrUnsupported, "rule for %s needs exactly one of Check or Expr", rule.Path)
+		}
+		p, err := NewPath(rule.Path)
+		if err != nil {
+			return nil, err
+		}
+		compiled := compiledRule{Rule: rule, path: p}
+		if rule.Expr != "" {
+			compiled.predicate, err = parsePredicate(rule.Expr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		v.rules = append(v.rules, compiled)
+	}
+	return v, nil
+}
+
+// Validate returns every violation found in doc, in rule order. The error is
+// only non-nil when a rule can't be evaluated at all.
+func (v *Validator) Validate(doc cty.Value) ([]Violation, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	violations := []Violation{}
+	for _, rule := range v.rules {
+		vals, paths, err := rule.path.Eval(doc)
+		if err != nil {
+			return violations, err
+		}
+		for i, val := range vals {
+			message, err := rule.check(doc, val)
+			if err != nil {
+				return violations, &PathError{Path: paths[i].Copy(), Err: err}
+			}
+			if message == "" {
+				continue
+			}
+			if rule.Message != "" {
+				message = rule.Message
+			}
+			violations = append(violations, Violation{Path: paths[i], Value: val, Rule: rule.Rule, Message: message})
+		}
+	}
+	return violations, nil
+}
+
+// check returns a violation message, or "" when val passes. Predicates
+// resolve $ against doc.
+func (r *compiledRule) check(doc, val cty.Value) (string, error) {
+	if r.Check != nil {
+		if err := r.Check(val); err != nil {
+			return err.Error(), nil
+		}
+		return "", nil
+	}
+	pass, err := r.path.evalPredicate(doc, val, r.predicate)
+	if err != nil || pass {
+		return "", err
+	}
+	return fmt.Sprintf("does not satisfy %s", r.Expr), nil
+}
+
+// parsePredicate splits expr into a disjunction of conjunctions of filters.
+func parsePredicate(expr string) ([][]*FilterNode, error) {
+	var or [][]*FilterNode
+	for _, alt := range splitPredicate(expr, "||") {
+		var and []*FilterNode
+		for _, term := range splitPredicate(alt, "&&") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				return nil, newError(ErrSyntax, "empty term in %q", expr)
+			}
+			parser, err := Parse("[?(" + term + ")]")
+			if err != nil {
+				return nil, err
+			}
+			steps := flattenSteps(parser.Root)
+			filter, ok := steps[0].(*FilterNode)
+			if len(steps) != 1 || !ok {
+				return nil, newError(ErrSyntax, "%q is not a predicate", term)
+			}
+			and = append(and, filter)
+		}
+		or = append(or, and)
+	}
+	return or, nil
+}
+
+// splitPredicate splits s on sep outside of quoted strings.
+func splitPredicate(s, sep string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func (j *JSONPath) evalPredicate(root, val cty.Value, predicate [][]*FilterNode) (bool, error) {
+	j.root = root
+	defer func() { j.root = cty.NilVal }()
+	for _, and := range predicate {
+		pass := true
+		for _, filter := range and {
+			ok, err := j.filterMatches(val, filter)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				pass = false
+				break
+			}
+		}
+		if pass {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Between checks that a value is a number within [min, max].
+func Between(min, max float64) Check {
+	lo, hi := big.NewFloat(min), big.NewFloat(max)
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		if v.IsNull() || !v.IsKnown() || v.Type() != cty.Number {
+			return fmt.Errorf("must be a number between %v and %v", min, max)
+		}
+		n := v.AsBigFloat()
+		if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+			return fmt.Errorf("%s is not between %v and %v", n.Text('g', -1), min, max)
+		}
+		return nil
+	}
+}
+
+// OneOf checks that a value equals one of allowed.
+func OneOf(allowed ...cty.Value) Check {
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		for _, a := range allowed {
+			if valuesEqual(v, a) {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %d allowed values", len(allowed))
+	}
+}
+
+// Matches checks that a value is a string matching re.
+func Matches(re *regexp.Regexp) Check {
+	return func(v cty.Value) error {
+		v, _ = v.UnmarkDeep()
+		if v.IsNull() || !v.IsKnown() || v.Type() != cty.String || !re.MatchString(v.AsString()) {
+			return fmt.Errorf("must match %s", re)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package jsonpath
+
+import (
+	"errors"
+	"math"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Verify compiles and evaluates expr against doc while checking the
+// invariants the package relies on, and reports the first one broken as an
+// error matching ErrInvariant:
+//
+//   - parsing and evaluation don't panic;
+//   - errors match one of the sentinel errors;
+//   - the canonical form (String) parses back to itself;
+//   - every result path leads back to its value in doc;
+//   - evaluating twice gives the same results;
+//   - results stay within a size budget proportional to doc and expr.
+//
+// Ordinary failures, such as a syntax error or indexing a string, are not
+// invariant violations and give nil. Verify is meant for fuzz tests:
+//
+//	func FuzzQuery(f *testing.F) {
+//		f.Fuzz(func(t *testing.T, expr string) {
+//			if err := jsonpath.Verify(doc, expr); err != nil {
+//				t.Fatal(err)
+//			}
+//		})
+//	}
+func Verify(doc cty.Value, expr string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError(ErrInvariant, "%q panicked: %v", expr, r)
+		}
+	}()
+
+	p, err := NewPath(expr)
+	if err != nil {
+		return checkKind(expr, err)
+	}
+	canonical := p.String()
+	again, err := NewPath(canonical)
+	if err != nil {
+		return newError(ErrInvariant, "canonical form %q of %q doesn't parse: %v", canonical, expr, err)
+	}
+	if again.String() != canonical {
+		return newError(ErrInvariant, "canonical form %q of %q reparses as %q", canonical, expr, again.String())
+	}
+
+	opts := EvalOptions{MaxResultBytes: verifyBudget(doc, p, expr)}
+	vals, paths, err := p.EvalWithOptions(doc, opts)
+	if err != nil {
+		var budget *BudgetError
+		if errors.As(err, &budget) {
+			return newError(ErrInvariant, "%q: %v", expr, err)
+		}
+		return checkKind(expr, err)
+	}
+	if len(vals) != len(paths) {
+		return newError(ErrInvariant, "%q: %d values but %d paths", expr, len(vals), len(paths))
+	}
+
+	unmarked, _ := doc.UnmarkDeep()
+	for i, path := range paths {
+		at, err := path.Apply(unmarked)
+		if err != nil {
+			return newError(ErrInvariant, "%q: path $%s of result %d doesn't apply: %v", expr, PrettyCtyPath(path), i, err)
+		}
+		val, _ := vals[i].UnmarkDeep()
+		if !at.RawEquals(val) {
+			return newError(ErrInvariant, "%q: path $%s of result %d leads to a different value", expr, PrettyCtyPath(path), i)
+		}
+	}
+
+	vals2, paths2, err := p.EvalWithOptions(doc, opts)
+	if err != nil {
+		return newError(ErrInvariant, "%q: second evaluation failed: %v", expr, err)
+	}
+	if len(vals2) != len(vals) {
+		return newError(ErrInvariant, "%q: second evaluation gave %d results instead of %d", expr, len(vals2), len(vals))
+	}
+	for i := range vals {
+		if !vals[i].RawEquals(vals2[i]) || !paths[i].Equals(paths2[i]) {
+			return newError(ErrInvariant, "%q: result %d differs between evaluations", expr, i)
+		}
+	}
+	return nil
+}
+
+var sentinels = []error{ErrSyntax, ErrNotFound, ErrTypeMismatch, ErrIndexOutOfBounds, ErrUnsupported, ErrMultipleMatches, ErrConflict, ErrOverflow, ErrBudgetExceeded}
+
+// checkKind lets errors matching a sentinel through as nil.
+func checkKind(expr string, err error) error {
+	for _, kind := range sentinels {
+		if errors.Is(err, kind) {
+			return nil
+		}
+	}
+	return newError(ErrInvariant, "%q failed with an unclassified error: %v", expr, err)
+}
+
+// verifyBudget bounds the size of the results of p on doc. Every step
+// selects values within doc, so its output is at most the size of doc times
+// the number of ways a value can be reached: once per union branch (bounded
+// by the length of expr) and once per ancestor for every recursive descent.
+func verifyBudget(doc cty.Value, p *JSONPath, expr string) int {
+	size := estimateSize(doc, math.MaxInt32)
+	budget := float64(size) * float64(len(expr)+1)
+	depth := float64(valueDepth(doc) + 1)
+	for _, step := range p.steps() {
+		if _, ok := step.(*RecursiveNode); ok {
+			budget *= depth
+		}
+	}
+	if budget > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(budget)
+}
+
+// valueDepth returns how deeply v nests collections.
+func valueDepth(v cty.Value) int {
+	v, _ = v.Unmark()
+	if v.IsNull() || !v.IsKnown() || !v.CanIterateElements() {
+		return 0
+	}
+	depth := 0
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		if d := valueDepth(elem) + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
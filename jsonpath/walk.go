@@ -0,0 +1,111 @@
+package jsonpath
+
+import (
+	"slices"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// WalkFunc is called by WalkPruned for every value it reaches, with the
+// value's path and the value itself, carrying its own marks and those of
+// its containers. descend says whether to visit the value's children and
+// keep whether to include the value in the result; an error stops the walk.
+type WalkFunc func(path cty.Path, v cty.Value) (descend, keep bool, err error)
+
+// WalkPruned visits doc and the values below it, parents before their
+// children, in the order `..` visits them, and returns the values fn keeps.
+// Returning descend=false prunes a subtree, e.g. to stop at values marked
+// sensitive. Null and unknown values are visited but have no children.
+func WalkPruned(doc cty.Value, fn WalkFunc) (MatchList, error) {
+	matches := MatchList{}
+	err := walkValues(doc, cty.Path{}, func(path cty.Path, v cty.Value) (bool, error) {
+		descend, keep, err := fn(path, v)
+		if keep {
+			matches = append(matches, Match{Value: v, Path: path})
+		}
+		return descend, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// FormatPath renders path as a normalized JSONPath, e.g. `$.spec.ports[0]`.
+// JSONPointer renders it as a JSON Pointer.
+func FormatPath(path cty.Path) string {
+	return "$" + PrettyCtyPath(path)
+}
+
+// walkValues calls visit on value and, while visit asks to descend, on the
+// elements and members below it. Children inherit the marks of their
+// containers, as with cty's own Index and GetAttr. It keeps its own stack
+// of pending values instead of recursing, so adversarially deep documents
+// cost heap rather than goroutine stack.
+func walkValues(value cty.Value, path cty.Path, visit func(cty.Path, cty.Value) (bool, error)) error {
+	type pending struct {
+		path  cty.Path
+		value cty.Value
+	}
+	stack := []pending{{path, value}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		descend, err := visit(top.path, top.value)
+		if err != nil {
+			return err
+		}
+		if !descend {
+			continue
+		}
+		unmarked, marks := top.value.Unmark()
+		// set elements have no path of their own, so sets are leaves
+		if !unmarked.IsKnown() || unmarked.IsNull() || !unmarked.CanIterateElements() || unmarked.Type().IsSetType() {
+			continue
+		}
+		isObject := unmarked.Type().IsObjectType()
+		first := len(stack)
+		for it := unmarked.ElementIterator(); it.Next(); {
+			key, _ := it.Element()
+			step := cty.PathStep(cty.IndexStep{Key: key})
+			if isObject {
+				step = cty.GetAttrStep{Name: key.AsString()}
+			}
+			child := getByIter(unmarked, it).WithMarks(marks)
+			stack = append(stack, pending{append(top.path[:len(top.path):len(top.path)], step), child})
+		}
+		// the first child is visited next, with its subtree, as when
+		// recursing
+		slices.Reverse(stack[first:])
+	}
+	return nil
+}
+
+// checkDepth fails with ErrUnsupported when v holds values nested more than
+// max levels below it.
+func checkDepth(v cty.Value, max int) error {
+	type pending struct {
+		value cty.Value
+		depth int
+	}
+	stack := []pending{{v, 0}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		unmarked, _ := top.value.Unmark()
+		if !unmarked.IsKnown() || unmarked.IsNull() || !unmarked.CanIterateElements() {
+			continue
+		}
+		if top.depth == max {
+			if unmarked.LengthInt() > 0 {
+				return newError(ErrUnsupported, "document is nested deeper than MaxDepth (%d)", max)
+			}
+			continue
+		}
+		for it := unmarked.ElementIterator(); it.Next(); {
+			_, child := it.Element()
+			stack = append(stack, pending{child, top.depth + 1})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EmptyReport tells why an expression matched nothing, see WhyEmpty.
+type EmptyReport struct {
+	// Step is the index of the first step that produced no values, as
+	// numbered by Metrics, and StepText that step in JSONPath syntax.
+	Step     int
+	StepText string
+	// Prefix is the expression before the step, and Input the number of
+	// values it matched.
+	Prefix string
+	Input  int
+	// Reason says what the step found instead.
+	Reason string
+	// Suggestions lists the keys of the input values the step may have
+	// meant to select, closest first: keys differing in case, singular and
+	// plural forms, then keys within a few typos.
+	Suggestions []string
+}
+
+// String formats the report as a message for users.
+func (r *EmptyReport) String() string {
+	values := "values"
+	if r.Input == 1 {
+		values = "value"
+	}
+	msg := fmt.Sprintf("%s matched nothing after %s (%d %s): %s", r.StepText, r.Prefix, r.Input, values, r.Reason)
+	if len(r.Suggestions) > 0 {
+		quoted := make([]string, len(r.Suggestions))
+		for i, s := range r.Suggestions {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		msg += "; did you mean " + strings.Join(quoted, " or ") + "?"
+	}
+	return msg
+}
+
+// WhyEmpty evaluates jsonPath against doc step by step and, if it matches
+// nothing, reports the first step that produced no values along with
+// near-miss keys for it. It returns a nil report when the expression
+// matches something. opts are those of NewPath.
+func WhyEmpty(doc cty.Value, jsonPath string, opts ...Option) (*EmptyReport, error) {
+	p, err := NewPath(jsonPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	steps := p.steps()
+	input := []cty.Value{doc}
+	for i := range steps {
+		prefix := pathFromSteps(steps[:i+1])
+		prefix.defaults, prefix.doc = p.defaults, p.doc
+		vals, _, err := prefix.Eval(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) > 0 {
+			input = vals
+			continue
+		}
+		r := &EmptyReport{
+			Step:     i,
+			StepText: formatStep(steps[i]),
+			Prefix:   pathFromSteps(steps[:i]).String(),
+			Input:    len(input),
+		}
+		r.Reason, r.Suggestions = emptyReason(input, steps[i])
+		return r, nil
+	}
+	return nil, nil
+}
+
+// emptyReason explains why node selected nothing from input.
+func emptyReason(input []cty.Value, node Node) (string, []string) {
+	containers := 0
+	kinds := map[string]bool{}
+	keys := map[string]bool{}
+	for _, v := range input {
+		v, _ = v.UnmarkDeep()
+		ty := v.Type()
+		switch {
+		case v.IsNull():
+			kinds["null"] = true
+		case !v.IsKnown():
+			kinds["unknown"] = true
+		case isMapping(ty):
+			containers++
+			for it := v.ElementIterator(); it.Next(); {
+				k, _ := it.Element()
+				keys[k.AsString()] = true
+			}
+		case isSequence(ty) || ty.IsSetType():
+			containers++
+			if v.LengthInt() == 0 {
+				kinds["empty array"] = true
+			}
+		default:
+			kinds[ty.FriendlyName()] = true
+		}
+	}
+	if containers == 0 {
+		return "the values are " + joinKinds(kinds) + ", not objects or arrays", nil
+	}
+	switch node := node.(type) {
+	case *FieldNode:
+		return fmt.Sprintf("no value has the key %q", node.Value), nearKeys(node.Value, keys)
+	case *FilterNode:
+		return "no element passed the filter", nil
+	case *ArrayNode:
+		return "no array has elements at these indexes", nil
+	}
+	return "nothing to select", nil
+}
+
+func joinKinds(kinds map[string]bool) string {
+	names := make([]string, 0, len(kinds))
+	for k := range kinds {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " and ")
+}
+
+// maxSuggestions bounds the keys nearKeys returns.
+const maxSuggestions = 3
+
+// nearKeys returns the keys that look like a misspelling of name, closest
+// first.
+func nearKeys(name string, keys map[string]bool) []string {
+	type candidate struct {
+		key  string
+		rank int
+	}
+	candidates := []candidate{}
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	for key := range keys {
+		switch d := levenshtein(name, key); {
+		case strings.EqualFold(key, name):
+			candidates = append(candidates, candidate{key, 0})
+		case pluralOf(key, name) || pluralOf(name, key):
+			candidates = append(candidates, candidate{key, 1})
+		case d <= maxDistance:
+			candidates = append(candidates, candidate{key, 1 + d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank < candidates[j].rank
+		}
+		return candidates[i].key < candidates[j].key
+	})
+	out := []string{}
+	for _, c := range candidates {
+		if len(out) == maxSuggestions {
+			break
+		}
+		out = append(out, c.key)
+	}
+	return out
+}
+
+// pluralOf reports whether plural is an English plural of singular, ignoring
+// case.
+func pluralOf(plural, singular string) bool {
+	plural, singular = strings.ToLower(plural), strings.ToLower(singular)
+	if singular == "" {
+		return false
+	}
+	if strings.HasSuffix(singular, "y") && plural == singular[:len(singular)-1]+"ies" {
+		return true
+	}
+	return plural == singular+"s" || plural == singular+"es"
+}
+
+// levenshtein returns the edit distance between a and b, in runes, with
+// swapping two adjacent runes counting as one typo.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
@@ -2,7 +2,12 @@ package peek
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"os"
+	"sort"
 	"testing"
 
 	"github.com/zclconf/go-cty/cty"
@@ -32,8 +37,16 @@ func TestParsing(t *testing.T) {
 			"$.A[::2]":        Tuple(Str("string"), Num(3), False),
 			"$.A[-2:]":        Tuple(False, Nil),
 			"$.A[:-1]":        Tuple(Str("string"), NumFloat(23.3), Num(3), True, False),
+			"$.A[-100:2]":        Tuple(Str("string"), NumFloat(23.3)),
+			"$.A[1:100:2]":       Tuple(NumFloat(23.3), True, Nil),
+			"$.A[2:2]":           Tuple(),
+			"$.A[4:2]":           Tuple(),
+			"$.A[::-1]":          Tuple(Nil, False, True, Num(3), NumFloat(23.3), Str("string")),
+			"$.A[4:1:-2]":        Tuple(False, Num(3)),
+			"$.A[1:4:-1]":        Tuple(),
+			"$.A[:-3:-1]":        Tuple(Nil, False),
 			"$.F.Type[4:5][0,1]": Tuple(Str("string5a"), Str("string5b")),
-			"$.F.Type[4:6][0,1]": Tuple(Str("string5a"), Str("string6a"), Str("string5b"), Str("string6b")),
+			"$.F.Type[4:6][0,1]": Tuple(Str("string5a"), Str("string5b"), Str("string6a"), Str("string6b")),
 			"$.F.Type[4,5][0:2]": Tuple(Str("string5a"), Str("string5b"), Str("string6a"), Str("string6b")),
 			"$.F.Type[4:6]": Tuple(
 				Tuple(
@@ -71,7 +84,7 @@ func TestParsing(t *testing.T) {
 			"$..A[0]":      Tuple(Str("string"), Str("string3")),
 			"$.*.Type[0]":     Tuple(Str("string2a"), Str("string4a")),
 			"$.*.Type[1]":     Tuple(Str("string2b"), Str("string4b")),
-			"$.*.Type[0,1]":   Tuple(Str("string2a"), Str("string4a"), Str("string2b"), Str("string4b")),
+			"$.*.Type[0,1]":   Tuple(Str("string2a"), Str("string2b"), Str("string4a"), Str("string4b")),
 			"$.*.Type[0:2]":   Tuple(Str("string2a"), Str("string2b"), Str("string4a"), Str("string4b")),
 			"$.*.Type[2].C":   Tuple(NumFloat(3.141592)),
 			"$..Type[*].C":    Tuple(NumFloat(3.141592)),
@@ -89,6 +102,190 @@ func TestParsing(t *testing.T) {
 	})
 }
 
+func TestWildcardObjects(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"alice": cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Alice")}),
+		"bob":   cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Bob")}),
+		"teams": cty.MapVal(map[string]cty.Value{
+			"red":  cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Red")}),
+			"blue": cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Blue")}),
+		}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$.*.Name":        Tuple(Str("Alice"), Str("Bob")),
+		"$.teams.*.Name":  Tuple(Str("Blue"), Str("Red")),
+		"$.teams[*].Name": Tuple(Str("Blue"), Str("Red")),
+		"$.*.*.Name":      Tuple(Str("Blue"), Str("Red")),
+	})
+}
+
+func TestRecursiveObjects(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"car": cty.ObjectVal(map[string]cty.Value{
+			"Brand": cty.StringVal("Fiat"),
+			"parts": cty.MapVal(map[string]cty.Value{
+				"engine": cty.ObjectVal(map[string]cty.Value{"Brand": cty.StringVal("Ferrari")}),
+			}),
+			"empty": cty.EmptyObjectVal,
+			"none":  cty.NullVal(cty.List(cty.String)),
+		}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$..Brand":        Tuple(Str("Fiat"), Str("Ferrari")),
+		"$..engine.Brand": Tuple(Str("Ferrari")),
+		"$.car.empty..":   Tuple(Val(cty.EmptyObjectVal)),
+		"$.car.none..":    Tuple(),
+	})
+}
+
+func TestUnionOrder(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{"people": cty.TupleVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Ada"), "Surname": cty.StringVal("Lovelace")}),
+		cty.ObjectVal(map[string]cty.Value{"Name": cty.StringVal("Alan"), "Surname": cty.StringVal("Turing")}),
+	})})
+	// element-major: each input's matches in query order
+	assert(t, Val(doc), map[string]Val{
+		"$.people[*]['Name','Surname']": Tuple(Str("Ada"), Str("Lovelace"), Str("Alan"), Str("Turing")),
+		"$.people[*]['Surname','Name']": Tuple(Str("Lovelace"), Str("Ada"), Str("Turing"), Str("Alan")),
+		"$.people[1,0].Name":            Tuple(Str("Alan"), Str("Ada")),
+	})
+}
+
+func TestUnionLimit(t *testing.T) {
+	level := func(n int64) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"level": cty.NumberIntVal(n)})
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"errors":   cty.TupleVal([]cty.Value{level(1), level(3), level(4), level(5)}),
+		"warnings": cty.TupleVal([]cty.Value{level(3), level(1)}),
+	})
+	for expr, want := range map[string][]string{
+		"$['errors','warnings'][?(@.level > 2)].level": {"$.errors[1].level", "$.errors[2].level", "$.warnings[0].level"},
+		"$['errors','warnings'][*]":                    {"$.errors[0]", "$.errors[1]", "$.warnings[0]", "$.warnings[1]"},
+		"$.errors[*]":                                  {"$.errors[0]", "$.errors[1]", "$.errors[2]", "$.errors[3]"},
+	} {
+		p := jsonpath.MustNewPath(expr, jsonpath.WithUnionLimit(2))
+		_, paths, err := p.Eval(doc)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		got := []string{}
+		for _, path := range paths {
+			got = append(got, jsonpath.FormatPath(path))
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: got %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"a":     cty.TupleVal([]cty.Value{cty.StringVal("x"), cty.StringVal("y"), cty.StringVal("z")}),
+		"empty": cty.EmptyTupleVal,
+	})
+	for _, tc := range []struct {
+		expr string
+		mode jsonpath.OutOfRange
+		want []string
+	}{
+		{"$.a[1]", jsonpath.OutOfRangeEmpty, []string{"y"}},
+		{"$.a[5]", jsonpath.OutOfRangeClamp, []string{"z"}},
+		{"$.a[-5]", jsonpath.OutOfRangeClamp, []string{"x"}},
+		{"$.a[5]", jsonpath.OutOfRangeEmpty, []string{}},
+		{"$.a[4]", jsonpath.OutOfRangeWrap, []string{"y"}},
+		{"$.a[-4]", jsonpath.OutOfRangeWrap, []string{"z"}},
+		{"$.a[2:1]", jsonpath.OutOfRangeClamp, []string{}},
+		{"$.empty[0]", jsonpath.OutOfRangeWrap, []string{}},
+		{"$.empty[0]", jsonpath.OutOfRangeClamp, []string{}},
+	} {
+		p := jsonpath.MustNewPath(tc.expr)
+		vals, _, err := p.Eval(doc, jsonpath.WithOutOfRange(tc.mode))
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		got := []string{}
+		for _, v := range vals {
+			got = append(got, v.AsString())
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s with mode %d: got %v, want %v", tc.expr, tc.mode, got, tc.want)
+		}
+	}
+	for _, expr := range []string{"$.a[5]", "$.a[-4]", "$.empty[0]"} {
+		if _, _, err := jsonpath.MustNewPath(expr).Eval(doc); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+			t.Errorf("%s: expected ErrIndexOutOfBounds by default, got %v", expr, err)
+		}
+	}
+}
+
+func TestIndexKeywords(t *testing.T) {
+	doc := Obj(kvPair("m", Tuple(Num(1), Num(2), Num(3))), kvPair("first", Str("key")))
+	assert(t, doc, map[string]Val{
+		"$.m[first]":      Tuple(Num(1)),
+		"$.m[last]":       Tuple(Num(3)),
+		"$.m.first()":     Tuple(Num(1)),
+		"$.m.last()":      Tuple(Num(3)),
+		"$.m[first,last]": Tuple(Num(1), Num(3)),
+		"$.first":         Tuple(Str("key")),
+	})
+	if got := jsonpath.MustNewPath("$.m.last()[first]").String(); got != "$.m[-1][0]" {
+		t.Errorf("keywords should format as indexes, got %s", got)
+	}
+}
+
+func TestStringIndexes(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"name":  cty.StringVal("héllo wörld"),
+		"names": cty.TupleVal([]cty.Value{cty.StringVal("alpha"), cty.StringVal("beta")}),
+	})
+	for expr, want := range map[string][]string{
+		"$.name[0:3]":      {"hél"},
+		"$.name[0]":        {"h"},
+		"$.name[-1]":       {"d"},
+		"$.name[::-1]":     {"dlröw olléh"},
+		"$.name[20:]":      {""},
+		"$.names[*][0:2]":  {"al", "be"},
+		"$.names[*][0,-1]": {"a", "a", "b", "a"},
+		"$.name[*]":        {},
+	} {
+		p := jsonpath.MustNewPath(expr)
+		vals, paths, err := p.Eval(doc, jsonpath.WithStringIndexes())
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		got := []string{}
+		for _, v := range vals {
+			got = append(got, v.AsString())
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") || len(paths) != len(vals) {
+			t.Errorf("%s: got %q at %v, want %q", expr, got, paths, want)
+		}
+	}
+	vals, paths, err := jsonpath.MustNewPath("$.names[1][1:]").Eval(doc, jsonpath.WithStringIndexes())
+	if err != nil || len(vals) != 1 || !paths[0].Equals(cty.GetAttrPath("names").IndexInt(1)) {
+		t.Errorf("a substring should be found at its string, got %v at %v: %v", vals, paths, err)
+	}
+	// the string path of a substring isn't a place to write it
+	d := jsonpath.NewDocument(doc, jsonpath.WithStringIndexes())
+	for _, expr := range []string{"$.name[1]", "$.names[*][0:2]"} {
+		if err := d.Set(expr, cty.StringVal("x")); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("%s: writing a substring should fail with ErrUnsupported, got %v", expr, err)
+		}
+	}
+	if err := d.Set("$.names[0]", cty.StringVal("gamma")); err != nil {
+		t.Error("whole strings can still be written, got", err)
+	}
+	if _, _, err := jsonpath.MustNewPath("$.name[0]").Eval(doc); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Error("strings can't be indexed by default, got", err)
+	}
+	if _, _, err := jsonpath.MustNewPath("$.name[20]").Eval(doc, jsonpath.WithStringIndexes()); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Error("expected an index out of range, got", err)
+	}
+}
+
 func TestErrors(t *testing.T) {
 	tests := []string{
 		`$["]`,
@@ -140,6 +337,7 @@ func TestSearch(t *testing.T) {
 
 func TestMain(m *testing.M) {
 	carExample.UnmarshalJSON(carBytes)
+	storeExample.UnmarshalJSON(storeBytes)
 	doc2Json, _ := json.Marshal(DemoSample)
 	jType2, _ := ctyjson.ImpliedType(doc2Json)
 	sampleDocJson, _ := ctyjson.Unmarshal(doc2Json, jType2)
@@ -151,6 +349,10 @@ func TestMain(m *testing.M) {
 var carBytes []byte
 var carExample ctyjson.SimpleJSONValue
 
+//go:embed test_fixture_2.json
+var storeBytes []byte
+var storeExample ctyjson.SimpleJSONValue
+
 var DemoSample = map[string]interface{}{
 	"A": []interface{}{
 		"string",
@@ -200,4 +402,734 @@ var DemoSample = map[string]interface{}{
 			},
 		},
 	},
-}
\ No newline at end of file
+}
+func TestSearchE(t *testing.T) {
+	store := Val(storeExample.Value)
+	matches, err := store.SearchE("$.store.book[?(@.price < 10)].title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".store.book[0].title", ".store.book[2].title"}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for i, path := range matches.Paths() {
+		if got := jsonpath.PrettyCtyPath(path); got != want[i] {
+			t.Errorf("match %d: got %s, want %s", i, got, want[i])
+		}
+	}
+	if matches.Values()[1].AsString() != "Moby Dick" {
+		t.Errorf("unexpected value %s", matches.Values()[1])
+	}
+
+	if _, err := store.SearchE("$.store.book[?(@.price < 10"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected ErrSyntax, got %v", err)
+	}
+	if store.Search("$.store.book[?(@.price < 10") != nil {
+		t.Error("Search should return nil on parse errors")
+	}
+
+	years := Val(cty.ObjectVal(map[string]cty.Value{"years": cty.MapVal(map[string]cty.Value{"2023": cty.True})}))
+	if _, err := years.SearchE("$.years[2023]"); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+	matches, err = years.SearchE("$.years[2023]", WithNumericKeys())
+	if err != nil || len(matches) != 1 {
+		t.Errorf("WithNumericKeys: got %v, %v", matches, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	store := Val(storeExample.Value)
+	for template, want := range map[string]string{
+		"bike={.store.bicycle.color} costs {$.store.bicycle.price}": "bike=red costs 19.95",
+		"cheap: {.store.book[?(@.price < 10)].author}":              "cheap: Nigel Rees Herman Melville",
+		"{.store.bicycle}":                                          `{"color":"red","price":19.95}`,
+		"missing={.nope}":                                           "missing=",
+	} {
+		got, err := store.Render(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", template, got, want)
+		}
+	}
+	if _, err := store.Render("name={.store"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected ErrSyntax, got %v", err)
+	}
+}
+
+func TestGrammar(t *testing.T) {
+	var g struct {
+		Version   int
+		EBNF      string
+		Rules     []struct{ Name, Definition string }
+		Operators []string
+		Functions []struct {
+			Name   string
+			Params int
+			OptIn  bool
+		}
+		IndexKeywords []string
+	}
+	out := jsonpath.Grammar()
+	if err := json.Unmarshal(out, &g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Version != jsonpath.GrammarVersion || len(g.Rules) == 0 || g.Rules[0].Name != "query" {
+		t.Errorf("unexpected grammar header %d %v", g.Version, g.Rules)
+	}
+	if !strings.Contains(g.EBNF, `operator = "==" | "!=" | "<"`) {
+		t.Errorf("operators should be listed unescaped in the EBNF:\n%s", g.EBNF)
+	}
+	functions := map[string]int{}
+	for _, fn := range g.Functions {
+		functions[fn.Name] = fn.Params
+		if fn.OptIn != (fn.Name == "env") {
+			t.Errorf("unexpected opt-in flag for %s", fn.Name)
+		}
+	}
+	if functions["split"] != 2 || functions["length"] != 1 {
+		t.Errorf("functions should come from the registry, got %v", functions)
+	}
+	if strings.Join(g.IndexKeywords, ",") != "first,last" {
+		t.Errorf("unexpected index keywords %v", g.IndexKeywords)
+	}
+	if string(jsonpath.Grammar()) != string(out) {
+		t.Error("the grammar should be stable")
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	for expr, expected := range map[string][]jsonpath.Feature{
+		"$.a.b[0]":                   {},
+		"$.a[*]":                     {jsonpath.FeatureWildcard},
+		"$..b[1:3]":                  {jsonpath.FeatureRecursive, jsonpath.FeatureSlice},
+		"$.a[0,1]":                   {jsonpath.FeatureUnion},
+		"$.a[?(@.x > $.limit)]":      {jsonpath.FeatureFilter, jsonpath.FeatureRootReference},
+		"$.a[?(length(@.tags) > 2)]": {jsonpath.FeatureFilter, jsonpath.FeatureFunctions},
+		"$.a[?(@.tags.length > 2)]":  {jsonpath.FeatureFilter, jsonpath.FeatureLengthProperty},
+		"$.labels[/^app/]":           {jsonpath.FeatureRegexKeys},
+		"$.a[?(1 < 2)]":              {jsonpath.FeatureFilter},
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		got := p.Features()
+		if fmt.Sprint(got) != fmt.Sprint(sorted(expected)) {
+			t.Errorf("%s: expected %v, got %v", expr, expected, got)
+		}
+	}
+
+	basic := jsonpath.WithAllowedFeatures(jsonpath.FeatureWildcard)
+	if _, err := jsonpath.NewPath("$.a[*].b", basic); err != nil {
+		t.Error(err)
+	}
+	if _, err := jsonpath.NewPath("$..b", basic); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("expected recursive descent to be rejected, got %v", err)
+	}
+	for _, f := range jsonpath.SupportedFeatures() {
+		if f == jsonpath.FeatureScript || f == jsonpath.FeatureParent {
+			t.Errorf("%s is not supported", f)
+		}
+	}
+}
+
+func sorted(features []jsonpath.Feature) []jsonpath.Feature {
+	sort.Slice(features, func(a, b int) bool { return features[a] < features[b] })
+	return features
+}
+
+func TestLint(t *testing.T) {
+	for expr, codes := range map[string][]string{
+		"$.spec.containers[*].image":                  nil,
+		"$.metadata.labels.app.kubernetes.io/name":    {jsonpath.LintDottedKey},
+		"$.metadata.labels['app.kubernetes.io/name']": nil,
+		"$..*":                      {jsonpath.LintRecursiveWildcard},
+		"$.items[?(@.x)]..[*]":      {jsonpath.LintRecursiveWildcard},
+		"$.a[::0]":                  {jsonpath.LintZeroStep},
+		"$.a[0,1:3:0]":              {jsonpath.LintZeroStep},
+		`$[?(@.x == "a")]['k']`:     {jsonpath.LintMixedQuotes},
+		`$[?(@.x == 'it\'s')]['k']`: nil,
+		"$.a[":                      {jsonpath.LintSyntax},
+	} {
+		warnings := jsonpath.Lint(expr)
+		got := make([]string, len(warnings))
+		for i, w := range warnings {
+			got[i] = w.Code
+		}
+		if fmt.Sprint(got) != fmt.Sprint(append([]string{}, codes...)) {
+			t.Errorf("%s: got %v, want %v", expr, warnings, codes)
+		}
+	}
+}
+
+func TestNumericConversions(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"ids": [9007199254740993, 18446744073709551615, -1, 1.5, "7"], "price": 12345678901234567890.01}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := jsonpath.MustNewPath("$.ids[*]").EvalMatches(doc)
+	if err != nil || len(matches) != 5 {
+		t.Fatal(matches, err)
+	}
+	if i, err := matches[0].AsInt64Exact(); err != nil || i != 9007199254740993 {
+		t.Errorf("got %d, %v", i, err)
+	}
+	if _, err := matches[1].AsInt64Exact(); !errors.Is(err, jsonpath.ErrOverflow) {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+	if u, err := matches[1].AsUint64(); err != nil || u != math.MaxUint64 {
+		t.Errorf("got %d, %v", u, err)
+	}
+	var pathErr *jsonpath.PathError
+	if _, err := matches[2].AsUint64(); !errors.Is(err, jsonpath.ErrOverflow) || !errors.As(err, &pathErr) || !pathErr.Path.Equals(cty.GetAttrPath("ids").IndexInt(2)) {
+		t.Errorf("expected ErrOverflow at $.ids[2], got %v", err)
+	}
+	if _, err := matches[3].AsInt64Exact(); !errors.Is(err, jsonpath.ErrOverflow) {
+		t.Errorf("expected ErrOverflow for a fraction, got %v", err)
+	}
+	if _, err := matches[4].AsInt64Exact(); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch for a string, got %v", err)
+	}
+
+	price := Val(doc.GetAttr("price"))
+	if s, err := price.AsDecimalString(); err != nil || s != "12345678901234567890.01" {
+		t.Errorf("got %q, %v", s, err)
+	}
+	if i, err := Val(cty.NumberIntVal(-42)).AsInt64Exact(); err != nil || i != -42 {
+		t.Errorf("got %d, %v", i, err)
+	}
+	if _, err := price.AsInt64Exact(); !errors.Is(err, jsonpath.ErrOverflow) {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestWalkPruned(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"db":   cty.ObjectVal(map[string]cty.Value{"password": cty.StringVal("hunter2")}).Mark("sensitive"),
+		"name": cty.StringVal("api"),
+		"tags": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	})
+	visited := 0
+	matches, err := jsonpath.WalkPruned(doc, func(path cty.Path, v cty.Value) (bool, bool, error) {
+		visited++
+		if v.HasMark("sensitive") {
+			return false, false, nil
+		}
+		return true, v.Type() == cty.String, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matches.String(); got != "$.name: \"api\"\n$.tags[0]: \"a\"\n$.tags[1]: \"b\"" {
+		t.Errorf("unexpected matches %q", got)
+	}
+	if visited != 6 {
+		t.Errorf("the sensitive subtree should be pruned, visited %d values", visited)
+	}
+
+	all, _ := jsonpath.WalkPruned(doc, func(path cty.Path, v cty.Value) (bool, bool, error) {
+		return true, true, nil
+	})
+	password := all[2]
+	if jsonpath.FormatPath(password.Path) != "$.db.password" || !password.Value.HasMark("sensitive") {
+		t.Errorf("children should inherit the marks of their containers, got %s %#v", jsonpath.FormatPath(password.Path), password.Value)
+	}
+
+	stop := errors.New("stop")
+	if _, err := jsonpath.WalkPruned(doc, func(path cty.Path, v cty.Value) (bool, bool, error) {
+		return true, false, stop
+	}); err != stop {
+		t.Errorf("expected the callback's error, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{"a": cty.NumberIntVal(1), "b": cty.NumberIntVal(2)})
+	p := jsonpath.MustNewPath("$.*")
+
+	var order []string
+	logging := func(name string) jsonpath.Middleware {
+		return func(next jsonpath.EvalFunc) jsonpath.EvalFunc {
+			return func(data cty.Value, opts jsonpath.EvalOptions) ([]cty.Value, []cty.Path, error) {
+				order = append(order, name+" before")
+				vals, paths, err := next(data, opts)
+				order = append(order, fmt.Sprintf("%s after %d", name, len(vals)))
+				return vals, paths, err
+			}
+		}
+	}
+	p.Use(logging("outer"), logging("inner"))
+	if _, err := p.EvalMatches(doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ", "); got != "outer before, inner before, inner after 2, outer after 2" {
+		t.Errorf("unexpected middleware order %s", got)
+	}
+
+	denied := errors.New("denied")
+	p.Use(func(next jsonpath.EvalFunc) jsonpath.EvalFunc {
+		return func(data cty.Value, opts jsonpath.EvalOptions) ([]cty.Value, []cty.Path, error) {
+			if data.Type().HasAttribute("secret") {
+				return nil, nil, denied
+			}
+			return next(data, opts)
+		}
+	})
+	secret := cty.ObjectVal(map[string]cty.Value{"secret": cty.StringVal("x")})
+	if _, _, err := p.Eval(secret); err != denied {
+		t.Errorf("expected the middleware's error, got %v", err)
+	}
+	if vals, _, err := p.Eval(doc); err != nil || len(vals) != 2 {
+		t.Errorf("got %v, %v", vals, err)
+	}
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]string
+	err   error
+	ended bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...slog.Attr) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value.String()
+	}
+}
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	var spans []*recordedSpan
+	start := func(name string) jsonpath.Span {
+		span := &recordedSpan{name: name, attrs: map[string]string{}}
+		spans = append(spans, span)
+		return span
+	}
+
+	p, err := jsonpath.NewPath("$.items[*]", jsonpath.WithTracing(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{"items": cty.TupleVal([]cty.Value{cty.True, cty.False})})
+	if _, _, err := p.Eval(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 || spans[0].name != "jsonpath.compile" || spans[1].name != "jsonpath.eval" {
+		t.Fatalf("expected a compile and an eval span, got %+v", spans)
+	}
+	eval := spans[1]
+	if !eval.ended || eval.attrs["jsonpath.matches"] != "2" || eval.attrs["jsonpath.doc_size"] != "small" {
+		t.Errorf("unexpected eval span %+v", eval)
+	}
+	if hash := eval.attrs["jsonpath.expr_hash"]; len(hash) != 16 || hash != spans[0].attrs["jsonpath.expr_hash"] || strings.Contains(hash, "items") {
+		t.Errorf("unexpected expression hash %q", hash)
+	}
+
+	if _, err := jsonpath.NewPath("$[", jsonpath.WithTracing(start)); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if last := spans[len(spans)-1]; last.name != "jsonpath.compile" || !errors.Is(last.err, jsonpath.ErrSyntax) || !last.ended {
+		t.Errorf("the compile span should record the error, got %+v", last)
+	}
+}
+
+func TestDebugString(t *testing.T) {
+	long := strings.Repeat("é", 40)
+	elems := make([]cty.Value, 25)
+	for i := range elems {
+		elems[i] = cty.NumberIntVal(int64(i))
+	}
+	v := cty.ObjectVal(map[string]cty.Value{
+		"z":     cty.StringVal("secret").Mark("sensitive"),
+		"a":     cty.MapVal(map[string]cty.Value{"y": cty.True, "x": cty.False}),
+		"long":  cty.StringVal(long),
+		"many":  cty.ListVal(elems),
+		"n":     cty.NullVal(cty.Number),
+		"later": cty.UnknownVal(cty.String),
+	})
+	want := `{"a": {"x": false, "y": true}, "later": (unknown), "long": "` + strings.Repeat("é", 32) + `"…(80 bytes), ` +
+		`"many": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, …5 more], "n": null, "z": "secret" (marked sensitive)}`
+	for i := 0; i < 5; i++ {
+		if got := jsonpath.DebugString(v); got != want {
+			t.Fatalf("got  %s\nwant %s", got, want)
+		}
+	}
+
+	matches, _ := jsonpath.MustNewPath("$.a").EvalMatches(v)
+	if got := matches[0].String(); got != `$.a: {"x": false, "y": true}` {
+		t.Errorf("unexpected match %s", got)
+	}
+}
+
+func TestCoversOverlaps(t *testing.T) {
+	for _, c := range []struct {
+		a, b             string
+		covers, overlaps bool
+	}{
+		{"$.spec", "$.spec.replicas", true, true},
+		{"$.spec.replicas", "$.spec", false, true},
+		{"$.spec", "$.status", false, false},
+		{"$", "$.anything[3]", true, true},
+		{"$.spec..*", "$.spec.template.containers[0].image", true, true},
+		{"$..image", "$.spec.template.containers[0].image", true, true},
+		{"$..image", "$.spec.template.containers[0].name", false, true},
+		{"$.items[*]", "$.items[2].name", true, true},
+		{"$.items.*", "$.items['a']", true, true},
+		{"$.items[0:10]", "$.items[3]", true, true},
+		{"$.items[0:10]", "$.items[2:5]", true, true},
+		{"$.items[0:10]", "$.items[12]", false, false},
+		{"$.items[0:10:2]", "$.items[3]", false, false},
+		{"$.items[0:10:2]", "$.items[4]", true, true},
+		{"$.items[-1]", "$.items[-1].name", true, true},
+		{"$.items[-1]", "$.items[0]", false, true},
+		{"$.items[0]", "$.items.name", false, false},
+		{"$['a','b']", "$.b.c", true, true},
+		{"$['a','b']", "$['a','c']", false, true},
+		{"$.labels[/^app/]", "$.labels.appname", true, true},
+		{"$.labels[/^app/]", "$.labels.tier", false, false},
+		{"$..[0]", "$.a.b", false, true},
+		{"$.a..b", "$..b", false, true},
+	} {
+		if got, err := jsonpath.Covers(c.a, c.b); err != nil || got != c.covers {
+			t.Errorf("Covers(%s, %s) = %v, %v", c.a, c.b, got, err)
+		}
+		if got, err := jsonpath.Overlaps(c.a, c.b); err != nil || got != c.overlaps {
+			t.Errorf("Overlaps(%s, %s) = %v, %v", c.a, c.b, got, err)
+		}
+		if got, _ := jsonpath.Overlaps(c.b, c.a); got != c.overlaps {
+			t.Errorf("Overlaps(%s, %s) should be symmetric", c.b, c.a)
+		}
+	}
+
+	if _, err := jsonpath.Covers("$.items[?(@.x)]", "$.items[0]"); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for filters, got %v", err)
+	}
+	if _, err := jsonpath.Overlaps("$.items[", "$"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected ErrSyntax, got %v", err)
+	}
+}
+
+func TestCloneByPath(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"apps": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("a"), "token": cty.StringVal("t1").Mark("sensitive")}),
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("b"), "token": cty.StringVal("t2").Mark("sensitive")}),
+		}),
+	})
+	clones, err := jsonpath.CloneByPath(doc, "$.apps[*]")
+	if err != nil || len(clones) != 2 {
+		t.Fatal(clones, err)
+	}
+	_, pvm := clones[0].Value.UnmarkDeepWithPaths()
+	if len(pvm) != 1 || !pvm[0].Path.Equals(cty.GetAttrPath("token")) || !pvm[0].Marks.Equal(cty.NewValueMarks("sensitive")) {
+		t.Errorf("only the document's marks should be kept, got %#v", pvm)
+	}
+	clones[0].Path[0] = cty.GetAttrStep{Name: "changed"}
+	if again, _ := jsonpath.CloneByPath(doc, "$.apps[*]"); jsonpath.FormatPath(again[0].Path) != "$.apps[0]" {
+		t.Errorf("clones shouldn't share paths, got %s", jsonpath.FormatPath(again[0].Path))
+	}
+
+	stripped, err := jsonpath.CloneByPath(doc, "$.apps[1]", jsonpath.WithoutMarks())
+	if err != nil || len(stripped) != 1 || stripped[0].Value.ContainsMarked() {
+		t.Errorf("WithoutMarks should drop every mark, got %#v, %v", stripped, err)
+	}
+	if got := stripped[0].Value.GetAttr("token"); !got.RawEquals(cty.StringVal("t2")) {
+		t.Errorf("unexpected clone %#v", got)
+	}
+}
+
+func TestEvalPage(t *testing.T) {
+	items := make([]cty.Value, 10)
+	for i := range items {
+		items[i] = cty.ObjectVal(map[string]cty.Value{"n": cty.NumberIntVal(int64(i))})
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{"items": cty.TupleVal(items)})
+
+	page, err := jsonpath.EvalPage(doc, "$.items[*].n", 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		for _, m := range page.Matches {
+			got = append(got, m.String())
+		}
+		if !page.More {
+			break
+		}
+		if page, err = page.NextPage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 10 || got[0] != "$.items[0].n: 0" || got[9] != "$.items[9].n: 9" {
+		t.Errorf("unexpected pages %v", got)
+	}
+	if page.Offset != 9 || page.NextOffset != 10 || len(page.Matches) != 1 {
+		t.Errorf("unexpected last page %+v", page)
+	}
+	if _, err := page.NextPage(); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after the last page, got %v", err)
+	}
+
+	page, err = jsonpath.EvalPage(doc, "$.items[?(@.n > 4)]", 2, 2)
+	if err != nil || len(page.Matches) != 2 || !page.More || !page.Matches[0].Path.Equals(cty.GetAttrPath("items").IndexInt(7)) {
+		t.Errorf("unexpected filtered page %+v, %v", page, err)
+	}
+	if page, err := jsonpath.EvalPage(doc, "$.items[*]", 20, 5); err != nil || len(page.Matches) != 0 || page.More {
+		t.Errorf("a page past the end should be empty, got %+v, %v", page, err)
+	}
+	if _, err := jsonpath.EvalPage(doc, "$.items[*]", -1, 5); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Errorf("expected ErrIndexOutOfBounds, got %v", err)
+	}
+}
+
+func TestExistsMatrix(t *testing.T) {
+	docs := []cty.Value{}
+	for _, src := range []string{
+		`{"name": "web", "limits": {"memory": "1Gi"}, "ports": [80, 443]}`,
+		`{"name": "db", "limits": {"cpu": 2}, "ports": []}`,
+		`{"name": "batch", "limits": null, "ports": "none"}`,
+	} {
+		doc, err := jsonpath.DecodeJSONStrict([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	got, err := jsonpath.ExistsMatrix(docs, []string{"$.limits.memory", "$.limits", "$.ports[?(@ > 100)]", "$.ports[0]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]bool{
+		{true, true, true, true},
+		{false, true, false, false},
+		{false, true, false, false},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("unexpected matrix %v", got)
+	}
+
+	var multi *jsonpath.MultiPathError
+	if _, err := jsonpath.ExistsMatrix(docs, []string{"$.a[", "$.b", "$.c[?(@"}); !errors.As(err, &multi) || len(multi.Errors) != 2 {
+		t.Errorf("expected both bad paths to be reported, got %v", err)
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	a, _ := jsonpath.DecodeJSONStrict([]byte(`{"spec": {"replicas": 2, "ports": [80, 443]}, "status": {"ready": true}}`))
+	b, _ := jsonpath.DecodeJSONStrict([]byte(`{"status": {"ready": true}, "spec": {"replicas": 3, "ports": [80, 443]}}`))
+
+	fa, fb := jsonpath.Fingerprints(a, 1), jsonpath.Fingerprints(b, 1)
+	if len(fa) != 3 {
+		t.Errorf("expected 3 fingerprints down to depth 1, got %v", fa)
+	}
+	changed := []string{}
+	for path, sum := range fa {
+		if fb[path] != sum {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	if fmt.Sprint(changed) != "[$ $.spec]" {
+		t.Errorf("unexpected changed subtrees %v", changed)
+	}
+
+	deep := jsonpath.Fingerprints(a, 5)
+	if _, ok := deep["$.spec.ports[1]"]; !ok || len(deep) != 8 {
+		t.Errorf("unexpected deep fingerprints %v", deep)
+	}
+	if deep["$"] != fa["$"] {
+		t.Error("the depth changed the fingerprint of the document")
+	}
+
+	// the JSON encoding decides, not the cty types or marks
+	list := cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)})
+	tuple := cty.TupleVal([]cty.Value{cty.NumberFloatVal(80), cty.NumberIntVal(443).Mark("sensitive")})
+	if jsonpath.Fingerprints(list, 0)["$"] != jsonpath.Fingerprints(tuple, 0)["$"] {
+		t.Error("equal arrays have different fingerprints")
+	}
+	if jsonpath.Fingerprints(cty.StringVal("1"), 0)["$"] == jsonpath.Fingerprints(cty.NumberIntVal(1), 0)["$"] {
+		t.Error("a string and a number share a fingerprint")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"labels": cty.MapVal(map[string]cty.Value{
+			"app":      cty.StringVal("web"),
+			"a: b":     cty.StringVal("quoted"),
+			"password": cty.StringVal("hunter2").Mark("sensitive"),
+		}),
+		"ports": cty.TupleVal([]cty.Value{cty.NumberIntVal(443), cty.NumberIntVal(80)}),
+	})
+	matches, err := jsonpath.MustNewPath("$['ports', 'labels'].*").EvalMatches(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := `$.labels['a: b']: "quoted"
+$.labels.app: "web"
+$.labels.password: "hunter2" (marked sensitive)
+$.ports[0]: 443
+$.ports[1]: 80
+`
+	if got := matches.Snapshot(); got != golden {
+		t.Errorf("unexpected snapshot:\n%s", got)
+	}
+	entries, err := jsonpath.ParseSnapshot(golden)
+	if err != nil || len(entries) != 5 || entries[0].Path != "$.labels['a: b']" || entries[0].Value != `"quoted"` {
+		t.Errorf("unexpected entries %v, %v", entries, err)
+	}
+	if err := matches.CheckSnapshot(golden); err != nil {
+		t.Error(err)
+	}
+
+	changed := strings.Replace(golden, "443", "8443", 1) + "$.ports[2]: 8080\n"
+	err = matches.CheckSnapshot(changed)
+	if !errors.Is(err, jsonpath.ErrConflict) || !strings.Contains(err.Error(), "$.ports[0]: want 8443, got 443") || !strings.Contains(err.Error(), "$.ports[2]: missing") {
+		t.Errorf("unexpected comparison %v", err)
+	}
+	if _, err := jsonpath.ParseSnapshot("no path here"); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Error("expected ErrSyntax, got", err)
+	}
+}
+
+func TestEvalScript(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{"pods": [
+		{"name": "web", "containers": [{"image": "web", "tag": "latest"}, {"image": "proxy", "tag": "1.2"}]},
+		{"name": "db", "containers": [{"image": "pg", "tag": "latest"}]}
+	], "limits": {"tag": "1.2"}}`))
+
+	matches, err := jsonpath.EvalScript(doc, `let c = $..containers[*]; let latest = c[?(@.tag == 'latest')]; latest[*].image;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matches.String(); got != "$.pods[0].containers[0].image: \"web\"\n$.pods[1].containers[0].image: \"pg\"" {
+		t.Errorf("unexpected matches\n%s", got)
+	}
+
+	matches, err = jsonpath.EvalScript(doc, `let pinned = $.limits.tag; $..containers[?(@.tag == $doc("pinned")[0])].image`)
+	if err != nil || len(matches) != 1 || matches[0].Value.AsString() != "proxy" {
+		t.Errorf("unexpected matches %v, %v", matches, err)
+	}
+
+	for script, kind := range map[string]error{
+		`nope[*]`:             jsonpath.ErrNotFound,
+		`let = $.a`:           jsonpath.ErrSyntax,
+		`let a = $.a;; a`:     jsonpath.ErrSyntax,
+		`let a = $.pods; a[`:  jsonpath.ErrSyntax,
+		`let 1a = $.pods; 1a`: jsonpath.ErrSyntax,
+	} {
+		if _, err := jsonpath.EvalScript(doc, script); !errors.Is(err, kind) {
+			t.Errorf("%s: expected %v, got %v", script, kind, err)
+		}
+	}
+}
+
+func TestWhyEmpty(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"spec": {"containers": [{"name": "app", "Image": "nginx"}], "replicas": 2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		expr, prefix, step string
+		suggestions        []string
+		msg                string
+	}{
+		{"$.spec.container[*].name", "$.spec", ".container", []string{"containers"},
+			`.container matched nothing after $.spec (1 value): no value has the key "container"; did you mean "containers"?`},
+		{"$.spec.containers[*].image", "$.spec.containers[*]", ".image", []string{"Image"}, ""},
+		{"$..nmae", "$..", ".nmae", []string{"name"}, ""},
+		{"$.spec.containers[?(@.name == 'web')]", "$.spec.containers", "[?(@.name == 'web')]", nil,
+			`[?(@.name == 'web')] matched nothing after $.spec.containers (1 value): no element passed the filter`},
+		{"$.spec.replicas.count", "$.spec.replicas", ".count", nil, ""},
+	} {
+		r, err := jsonpath.WhyEmpty(doc, tc.expr)
+		if err != nil || r == nil {
+			t.Fatalf("%s: unexpected report %v, %v", tc.expr, r, err)
+		}
+		if r.Prefix != tc.prefix || r.StepText != tc.step || strings.Join(r.Suggestions, ",") != strings.Join(tc.suggestions, ",") {
+			t.Errorf("%s: unexpected report %+v", tc.expr, r)
+		}
+		if tc.msg != "" && r.String() != tc.msg {
+			t.Errorf("%s: unexpected message %s", tc.expr, r)
+		}
+	}
+	if r, err := jsonpath.WhyEmpty(doc, "$.spec.replicas"); r != nil || err != nil {
+		t.Errorf("expected no report for a matching expression, got %v, %v", r, err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"routes": [
+		{"dst": "0.0.0.0/0", "default": true},
+		{"dst": "10.0.0.0/8", "default": false},
+		{"dst": "10.0.0.0/8", "default": false}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		expr string
+		opts []jsonpath.Option
+		want int
+	}{
+		{"$.routes[?(@.default == true)]", nil, 1},
+		{"$.routes[*].dst", nil, 3},
+		{"$.routes[*].dst", []jsonpath.Option{jsonpath.WithDistinct(jsonpath.EqualOptions{})}, 2},
+		{"$.routes[0].dst", nil, 1},
+		{"$.routes[5].dst", []jsonpath.Option{jsonpath.WithOutOfRange(jsonpath.OutOfRangeEmpty)}, 0},
+		{"$..dst", nil, 3},
+	} {
+		n, err := jsonpath.Count(doc, tc.expr, tc.opts...)
+		if err != nil || n != tc.want {
+			t.Errorf("%s: got %d, %v, want %d", tc.expr, n, err, tc.want)
+		}
+		vals, _, _ := jsonpath.MustNewPath(tc.expr, tc.opts...).Eval(doc)
+		if len(vals) != n {
+			t.Errorf("%s: Count says %d, Eval found %d", tc.expr, n, len(vals))
+		}
+	}
+	if _, err := jsonpath.Count(doc, "$.routes[5].dst"); !errors.Is(err, jsonpath.ErrIndexOutOfBounds) {
+		t.Errorf("expected the error of Eval, got %v", err)
+	}
+}
+
+func TestDeepDocuments(t *testing.T) {
+	nest := func(depth int) cty.Value {
+		v := cty.StringVal("bottom")
+		for i := 0; i < depth; i++ {
+			v = cty.TupleVal([]cty.Value{v})
+		}
+		return v
+	}
+	bomb := nest(10000)
+	for _, expr := range []string{"$..*", "$[0]", "$..[?(@ == 'bottom')]"} {
+		_, _, err := jsonpath.MustNewPath(expr, jsonpath.WithMaxDepth(100)).Eval(bomb)
+		if !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("%s: got %v, want ErrUnsupported", expr, err)
+		}
+	}
+	if _, err := jsonpath.Count(bomb, "$..*", jsonpath.WithMaxDepth(100)); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("Count: got %v, want ErrUnsupported", err)
+	}
+
+	// within the limit, deep documents evaluate without recursing per level
+	deep := nest(300)
+	n, err := jsonpath.Count(deep, "$..*", jsonpath.WithMaxDepth(300))
+	if err != nil || n != 300 {
+		t.Errorf("Count: got %d, %v, want 300", n, err)
+	}
+	seen := 0
+	_, err = jsonpath.WalkPruned(nest(2000), func(path cty.Path, v cty.Value) (bool, bool, error) {
+		seen++
+		return true, false, nil
+	})
+	if err != nil || seen != 2001 {
+		t.Errorf("WalkPruned: visited %d values, %v, want 2001", seen, err)
+	}
+}
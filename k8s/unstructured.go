@@ -0,0 +1,201 @@
+// Package k8s converts between Kubernetes unstructured objects (the
+// map[string]interface{} held by client-go's unstructured.Unstructured) and
+// cty values, and queries them with JSONPath.
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stringMapKeys are the keys whose string-to-string objects become cty maps
+// rather than objects, so labels and annotations can be added or removed
+// without changing the type of the document.
+var stringMapKeys = map[string]bool{
+	"labels":       true,
+	"annotations":  true,
+	"matchLabels":  true,
+	"nodeSelector": true,
+	"data":         true,
+	"stringData":   true,
+}
+
+// FromUnstructured converts an unstructured object to a cty value. Objects
+// become cty objects, except for string maps such as labels and annotations,
+// which become map(string). Arrays become tuples.
+func FromUnstructured(obj map[string]interface{}) (cty.Value, error) {
+	return fromValue(obj, cty.Path{}, "")
+}
+
+func fromValue(v interface{}, path cty.Path, key string) (cty.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case string:
+		return cty.StringVal(v), nil
+	case bool:
+		return cty.BoolVal(v), nil
+	case int:
+		return cty.NumberIntVal(int64(v)), nil
+	case int32:
+		return cty.NumberIntVal(int64(v)), nil
+	case int64:
+		return cty.NumberIntVal(v), nil
+	case float64:
+		return cty.NumberFloatVal(v), nil
+	case json.Number:
+		n, _, err := big.ParseFloat(string(v), 10, 512, big.ToNearestEven)
+		if err != nil {
+			return cty.NilVal, path.NewErrorf("invalid number %q", v)
+		}
+		return cty.NumberVal(n), nil
+	case []interface{}:
+		elems := make([]cty.Value, len(v))
+		for i, elem := range v {
+			var err error
+			if elems[i], err = fromValue(elem, path.IndexInt(i), ""); err != nil {
+				return cty.NilVal, err
+			}
+		}
+		return cty.TupleVal(elems), nil
+	case map[string]interface{}:
+		if stringMapKeys[key] {
+			if m, ok := stringMap(v); ok {
+				return m, nil
+			}
+		}
+		attrs := make(map[string]cty.Value, len(v))
+		for k, elem := range v {
+			var err error
+			if attrs[k], err = fromValue(elem, path.GetAttr(k), k); err != nil {
+				return cty.NilVal, err
+			}
+		}
+		return cty.ObjectVal(attrs), nil
+	}
+	return cty.NilVal, path.NewErrorf("unsupported type %T", v)
+}
+
+func stringMap(obj map[string]interface{}) (cty.Value, bool) {
+	if len(obj) == 0 {
+		return cty.MapValEmpty(cty.String), true
+	}
+	m := make(map[string]cty.Value, len(obj))
+	for k, v := range obj {
+		s, ok := v.(string)
+		if !ok {
+			return cty.NilVal, false
+		}
+		m[k] = cty.StringVal(s)
+	}
+	return cty.MapVal(m), true
+}
+
+// ToUnstructured converts a cty object or map back to an unstructured
+// object. Whole numbers become int64 and others float64, as in client-go.
+func ToUnstructured(v cty.Value) (map[string]interface{}, error) {
+	out, err := toValue(v, cty.Path{})
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := out.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an object", v.Type().FriendlyName())
+	}
+	return obj, nil
+}
+
+func toValue(v cty.Value, path cty.Path) (interface{}, error) {
+	v, _ = v.UnmarkDeep()
+	switch {
+	case !v.IsKnown():
+		return nil, path.NewErrorf("value is unknown")
+	case v.IsNull():
+		return nil, nil
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return v.AsString(), nil
+	case ty == cty.Bool:
+		return v.True(), nil
+	case ty == cty.Number:
+		f := v.AsBigFloat()
+		if i, acc := f.Int64(); acc == big.Exact {
+			return i, nil
+		}
+		n, _ := f.Float64()
+		return n, nil
+	case ty.IsObjectType() || ty.IsMapType():
+		obj := map[string]interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			k, elem := it.Element()
+			var err error
+			if obj[k.AsString()], err = toValue(elem, path.Index(k)); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		arr := []interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			out, err := toValue(elem, path.IndexInt(len(arr)))
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, out)
+		}
+		return arr, nil
+	}
+	return nil, path.NewErrorf("unsupported type %s", ty.FriendlyName())
+}
+
+// NestedByPath evaluates jsonPath against an unstructured object and returns
+// the matches in unstructured form, replacing chains of
+// unstructured.NestedFieldNoCopy calls:
+//
+//	images, err := k8s.NestedByPath(u.Object, "$.spec.template.spec.containers[*].image")
+func NestedByPath(obj map[string]interface{}, jsonPath string) ([]interface{}, error) {
+	p, err := jsonpath.NewPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	vals, _, err := p.Eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(vals))
+	for i, v := range vals {
+		if out[i], err = toValue(v, cty.Path{}); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// SetByPath writes value, given in unstructured form, at jsonPath (see
+// jsonpath.Set) and returns the updated object.
+func SetByPath(obj map[string]interface{}, jsonPath string, value interface{}) (map[string]interface{}, error) {
+	doc, err := FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	v, err := fromValue(value, cty.Path{}, "")
+	if err != nil {
+		return nil, err
+	}
+	doc, err = jsonpath.Set(doc, jsonPath, v)
+	if err != nil {
+		return nil, err
+	}
+	return ToUnstructured(doc)
+}
@@ -0,0 +1,66 @@
+package peek
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clean8s/peekcty/k8s"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func deployment() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "web"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "web:1.2"},
+						map[string]interface{}{"name": "proxy", "image": "envoy:1.28", "ports": []interface{}{int64(8080)}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestUnstructured(t *testing.T) {
+	obj := deployment()
+	doc, err := k8s.FromUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ty := doc.GetAttr("metadata").GetAttr("labels").Type(); !ty.Equals(cty.Map(cty.String)) {
+		t.Errorf("labels should be a map, got %s", ty.FriendlyName())
+	}
+	back, err := k8s.ToUnstructured(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, obj) {
+		t.Errorf("round trip changed the object:\n%#v\n%#v", back, obj)
+	}
+
+	images, err := k8s.NestedByPath(obj, "$.spec.template.spec.containers[*].image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(images, []interface{}{"web:1.2", "envoy:1.28"}) {
+		t.Errorf("unexpected images %#v", images)
+	}
+
+	updated, err := k8s.SetByPath(obj, "$.metadata.labels.tier", "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := updated["metadata"].(map[string]interface{})["labels"]
+	if !reflect.DeepEqual(labels, map[string]interface{}{"app.kubernetes.io/name": "web", "tier": "frontend"}) {
+		t.Errorf("unexpected labels %#v", labels)
+	}
+}
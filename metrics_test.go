@@ -0,0 +1,202 @@
+package peek
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestExplain(t *testing.T) {
+	p, _ := jsonpath.NewPath("$..book[?(@.price < 10)].title")
+	m, err := p.Explain(storeExample.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []string{"..", ".book", "[?(@.price < 10)]", ".title"}
+	if len(m.Steps) != len(steps) {
+		t.Fatalf("expected %d steps, got %+v", len(steps), m.Steps)
+	}
+	for i, step := range m.Steps {
+		if step.Step != steps[i] || step.Calls != 1 {
+			t.Errorf("unexpected step %d: %+v", i, step)
+		}
+	}
+	if m.Steps[2].Input != 1 || m.Steps[2].Output != 2 || m.Steps[3].Output != 2 {
+		t.Errorf("unexpected cardinalities %+v", m.Steps)
+	}
+	table := m.String()
+	if !strings.HasPrefix(table, "STEP") || !strings.Contains(table, "[?(@.price < 10)]") {
+		t.Error("unexpected table", table)
+	}
+
+	// one Metrics shared by two expressions counts the steps of both
+	shared := &jsonpath.Metrics{}
+	books, prices := jsonpath.MustNewPath("$.store.book[*]"), jsonpath.MustNewPath("$..price")
+	for _, p := range []*jsonpath.JSONPath{books, prices, books} {
+		if _, _, err := p.Eval(storeExample.Value, jsonpath.WithMetrics(shared)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(shared.Steps) != 5 {
+		t.Fatalf("expected 5 steps, got %+v", shared.Steps)
+	}
+	for i, calls := range []int{2, 2, 2, 1, 1} {
+		if shared.Steps[i].Calls != calls {
+			t.Errorf("step %d (%s) ran %d times, want %d", i, shared.Steps[i].Step, shared.Steps[i].Calls, calls)
+		}
+	}
+}
+
+func TestPathString(t *testing.T) {
+	for _, expr := range []string{
+		"$.A[0]",
+		"$..C",
+		"$.A[1:4:2]",
+		"$.A[*]",
+		"$.A.*",
+		"$.F.Type[4,5][0:2]",
+		"$.store.book[?(@.isbn)].title",
+		"$.store.book[?(@.category == 'fiction')]",
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != expr {
+			t.Errorf("expected %s, got %s", expr, p.String())
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	p, err := jsonpath.Compile("$.A[9]", jsonpath.CompileOptions{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `msg="jsonpath: parsed"`) {
+		t.Error("missing parse event:", buf.String())
+	}
+	if _, _, err := p.Eval(cty.Value(sampleDoc)); err == nil {
+		t.Fatal("expected an out of bounds error")
+	}
+	for _, expected := range []string{`step=.A in=1 out=1`, `msg="jsonpath: step failed" step=[9] paths=[$.A]`} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("missing %q in log:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	jsonpath.Compile(`$["]`, jsonpath.CompileOptions{Logger: logger})
+	if !strings.Contains(buf.String(), `msg="jsonpath: parse failed"`) {
+		t.Error("missing parse failure event:", buf.String())
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	for expr, want := range map[string]string{
+		"$.store.book[?(1 < 2)].title":      "$.store.book[?(true)].title",
+		"$.store.book[?('a' == 'b')].title": "$.store.book[?(false)].title",
+		"$.store.book[?(@.price < 10)]":     "$.store.book[?(@.price < 10)]",
+	} {
+		p, err := jsonpath.NewPath(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.String(); got != want {
+			t.Errorf("%s: got %s, want %s", expr, got, want)
+		}
+	}
+
+	p, _ := jsonpath.Compile("$.store.book[?(1 < 2)].title", jsonpath.CompileOptions{NoOptimize: true})
+	if got := p.String(); got != "$.store.book[?(1 < 2)].title" {
+		t.Errorf("NoOptimize: got %s", got)
+	}
+
+	assert(t, Val(storeExample.Value), map[string]Val{
+		"$.store.book[?(1 < 2)].author":      Tuple(Str("Nigel Rees"), Str("Evelyn Waugh"), Str("Herman Melville"), Str("J. R. R. Tolkien")),
+		"$.store.book[?('a' == 'b')].author": Tuple(),
+		"$.store.bicycle.color":              Tuple(Str("red")),
+		"$.store.bicycle.color.missing":      Tuple(),
+		"$.store.book[*].author":             Tuple(Str("Nigel Rees"), Str("Evelyn Waugh"), Str("Herman Melville"), Str("J. R. R. Tolkien")),
+	})
+
+	// the attribute steps of a run are looked up together, and still
+	// introspected and reported one by one
+	p, _ = jsonpath.NewPath("$.store.bicycle.color")
+	if got := p.String(); got != "$.store.bicycle.color" {
+		t.Errorf("merged steps: got %s", got)
+	}
+	matches, err := p.EvalMatches(storeExample.Value)
+	if err != nil || len(matches) != 1 || jsonpath.FormatPath(matches[0].Path) != "$.store.bicycle.color" {
+		t.Errorf("unexpected matches %v, %v", matches, err)
+	}
+	m, err := p.Explain(storeExample.Value)
+	if err != nil || len(m.Steps) != 3 {
+		t.Errorf("expected 3 steps, got %+v, %v", m, err)
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"a": cty.MapVal(map[string]cty.Value{"b": cty.ObjectVal(map[string]cty.Value{"c": cty.UnknownVal(cty.Object(map[string]cty.Type{"d": cty.String}))})}),
+	})
+	assert(t, Val(doc), map[string]Val{
+		"$.a.b.c.d": Tuple(Val(cty.UnknownVal(cty.String))),
+		"$.a.x.c.d": Tuple(),
+	})
+}
+
+func TestStats(t *testing.T) {
+	items := func(distinct bool) cty.Value {
+		vals := make([]cty.Value, 100)
+		for i := range vals {
+			kind, n := "a", i%2
+			if n == 1 {
+				kind = "b"
+			}
+			if distinct {
+				n = i
+			}
+			vals[i] = cty.ObjectVal(map[string]cty.Value{"kind": cty.StringVal(kind), "n": cty.NumberIntVal(int64(n))})
+		}
+		return cty.ObjectVal(map[string]cty.Value{"items": cty.TupleVal(vals)})
+	}
+	stats := jsonpath.NewStats()
+	const expr = "$.items[?(@.kind == 'a')]"
+	eval := func(doc cty.Value) jsonpath.StepStats {
+		p, err := jsonpath.NewPath(expr, jsonpath.WithStats(stats))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vals, _, err := p.Eval(doc); err != nil || len(vals) != 50 {
+			t.Fatalf("unexpected results %d, %v", len(vals), err)
+		}
+		ps, _ := stats.Path(expr)
+		return ps.Steps[len(ps.Steps)-1]
+	}
+
+	// repeated elements: the filter keeps memoizing
+	step := eval(items(false))
+	if step.Step != "[?(@.kind == 'a')]" || step.Tested != 100 || step.Passed != 50 || step.Lookups != 100 || step.Hits != 98 {
+		t.Errorf("unexpected filter stats %+v", step)
+	}
+	if step.Selectivity() != 0.5 || step.FanOut() != 50 {
+		t.Errorf("unexpected selectivity %v or fan-out %v", step.Selectivity(), step.FanOut())
+	}
+	if step = eval(items(false)); step.Lookups != 200 {
+		t.Errorf("expected the filter to keep memoizing, got %+v", step)
+	}
+
+	// distinct elements: memoizing doesn't pay off and stops
+	stats.Reset()
+	eval(items(true))
+	if step = eval(items(true)); step.Tested != 200 || step.Lookups != 100 || step.Hits != 0 {
+		t.Errorf("expected the filter to stop memoizing, got %+v", step)
+	}
+	if ps, _ := stats.Path(expr); ps.Evaluations != 2 {
+		t.Errorf("expected 2 evaluations, got %d", ps.Evaluations)
+	}
+}
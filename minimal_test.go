@@ -0,0 +1,43 @@
+//go:build jsonpath_minimal
+
+package peek
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The core API keeps working under the jsonpath_minimal build tag, while the
+// optional filter functions are unknown. Run with -tags jsonpath_minimal.
+func TestMinimalBuild(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"items": [{"name": "a", "ip": "10.0.0.1"}, {"name": "b", "ip": "::1"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(doc), map[string]Val{
+		"$.items[?(@.name == 'b')].ip":    Tuple(Str("::1")),
+		"$.items[?(length(@.ip) > 3)].ip": Tuple(Str("10.0.0.1")),
+		"$.items[*].name":                 Tuple(Str("a"), Str("b")),
+	})
+	updated, err := jsonpath.Set(doc, "$.items[0].name", cty.StringVal("c"))
+	if err != nil || jsonpath.DebugString(updated.GetAttr("items").Index(cty.Zero).GetAttr("name")) != `"c"` {
+		t.Errorf("unexpected Set result %s, %v", jsonpath.DebugString(updated), err)
+	}
+
+	for _, expr := range []string{
+		"$.items[?(is_ip(@.ip))]",
+		"$.items[?(b64decode(@.name) == 'x')]",
+		"$.items[?(semver_gt(@.name, '1.0.0'))]",
+		"$.items[?(uuid(@.name))]",
+	} {
+		if _, err := jsonpath.NewPath(expr); !errors.Is(err, jsonpath.ErrSyntax) {
+			t.Errorf("%s: optional functions should be unknown, got %v", expr, err)
+		}
+	}
+	if _, err := jsonpath.Compile("$.items[?(env('HOME'))]", jsonpath.CompileOptions{EnableFunctions: []string{"env"}}); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("env should be unknown, got %v", err)
+	}
+}
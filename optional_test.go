@@ -0,0 +1,252 @@
+//go:build !jsonpath_minimal
+
+package peek
+
+// Tests of the parts of the package the jsonpath_minimal build tag leaves
+// out, see minimal_test.go.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestQuery(t *testing.T) {
+	type container struct {
+		Name  string   `cty:"name"`
+		Ports []int    `cty:"ports"`
+		Args  []string `cty:"args"`
+	}
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"containers": [
+		{"name": "web", "ports": [80, 443], "args": [], "image": "nginx"},
+		{"name": "sidecar", "ports": [], "args": ["-v"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jsonpath.Query[container](doc, "$.containers[*]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "web" || len(got[0].Ports) != 2 || got[0].Ports[1] != 443 || got[1].Args[0] != "-v" {
+		t.Errorf("unexpected result %+v", got)
+	}
+
+	names, err := jsonpath.Query[string](doc, "$..name")
+	if err != nil || len(names) != 2 || names[1] != "sidecar" {
+		t.Errorf("unexpected names %v, %v", names, err)
+	}
+
+	_, err = jsonpath.Query[int](doc, "$.containers[*].name")
+	var pathErr *jsonpath.PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, jsonpath.ErrTypeMismatch) || jsonpath.PrettyCtyPath(pathErr.Path) != ".containers[0].name" {
+		t.Errorf("expected a type mismatch at the first name, got %v", err)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("PEEK_STAGE", "prod")
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"servers": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"stage": cty.StringVal("dev"), "url": cty.StringVal("http://${PEEK_STAGE}.local/$HOME")}),
+			cty.ObjectVal(map[string]cty.Value{"stage": cty.StringVal("prod"), "url": cty.StringVal("https://${PEEK_UNSET}example.com"), "var": cty.StringVal("PEEK_STAGE")}),
+		}),
+	})
+
+	const expr = `$.servers[?(@.stage == env("PEEK_STAGE"))].url`
+	if _, err := jsonpath.NewPath(expr); !errors.Is(err, jsonpath.ErrUnsupported) {
+		t.Errorf("env must be disabled by default, got %v", err)
+	}
+	p, err := jsonpath.Compile(expr, jsonpath.CompileOptions{EnableFunctions: []string{"env"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals, _, err := p.Eval(doc)
+	if err != nil || len(vals) != 1 || vals[0].AsString() != "https://${PEEK_UNSET}example.com" {
+		t.Errorf("unexpected result %#v, %v", vals, err)
+	}
+
+	// enabled functions also work in nested filters and union branches
+	for expr, want := range map[string]string{
+		`$.servers[?(@.var.env() == 'prod')].stage`:          "prod",
+		`$.servers[0,?(env('PEEK_STAGE') == @.stage)].stage`: "dev prod",
+	} {
+		if _, err := jsonpath.NewPath(expr); !errors.Is(err, jsonpath.ErrUnsupported) {
+			t.Errorf("%s: env must be disabled by default, got %v", expr, err)
+		}
+		p, err := jsonpath.Compile(expr, jsonpath.CompileOptions{EnableFunctions: []string{"env"}})
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		vals, _, err := p.Eval(doc)
+		got := []string{}
+		for _, v := range vals {
+			got = append(got, v.AsString())
+		}
+		if err != nil || strings.Join(got, " ") != want {
+			t.Errorf("%s: got %v, %v, want %s", expr, got, err, want)
+		}
+	}
+
+	expanded := jsonpath.ExpandEnv(doc)
+	assert(t, Val(expanded), map[string]Val{
+		"$.servers[*].url": Tuple(Str("http://prod.local/$HOME"), Str("https://example.com")),
+	})
+}
+
+func TestCodecFunctions(t *testing.T) {
+	secret := cty.ObjectVal(map[string]cty.Value{
+		"data": cty.MapVal(map[string]cty.Value{
+			"user":     cty.StringVal("YWRtaW4="),
+			"password": cty.StringVal("czNjcjN0"),
+		}),
+		"items": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("a b&c"), "blob": cty.StringVal("aGk=")}),
+		}),
+	})
+	assert(t, Val(secret), map[string]Val{
+		`$.items[?(b64decode(@.blob) == 'hi')].name`:       Tuple(Str("a b&c")),
+		`$.items[?(urlquery(@.name) == 'a+b%26c')].blob`:   Tuple(Str("aGk=")),
+		`$.items[?(hex(@.name) == '6120622663')].name`:     Tuple(Str("a b&c")),
+		`$.items[?(b64encode(@.name) == 'YSBiJmM=')].name`: Tuple(Str("a b&c")),
+	})
+
+	decoded, err := jsonpath.ReplaceFunc(secret, "$.data.*", jsonpath.Base64Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, Val(decoded), map[string]Val{
+		"$.data.user":     Tuple(Str("admin")),
+		"$.data.password": Tuple(Str("s3cr3t")),
+	})
+
+	if _, err := jsonpath.ReplaceFunc(secret, "$.items[0].name", jsonpath.Base64Decode); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	item := func(name string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal(name)})
+	}
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"items": cty.TupleVal([]cty.Value{item("item10"), item("Item3"), item("item2"), item("äpfel"), item("zebra")}),
+	})
+	for _, c := range []struct {
+		collation jsonpath.Collation
+		want      Val
+	}{
+		{jsonpath.Collation{}, Tuple(Str("Item3"), Str("item10"), Str("item2"), Str("zebra"), Str("äpfel"))},
+		{jsonpath.Collation{IgnoreCase: true, Natural: true}, Tuple(Str("item2"), Str("Item3"), Str("item10"), Str("zebra"), Str("äpfel"))},
+		{jsonpath.Collation{Locale: "de", Natural: true}, Tuple(Str("äpfel"), Str("item2"), Str("Item3"), Str("item10"), Str("zebra"))},
+	} {
+		sorted, err := jsonpath.SortBy(doc, "$.items", "name", c.collation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert(t, Val(sorted), map[string]Val{"$.items[*].name": c.want})
+	}
+
+	keys := jsonpath.SortedKeys(cty.MapVal(map[string]cty.Value{
+		"node10": cty.True, "node9": cty.True, "Node1": cty.True,
+	}), jsonpath.Collation{IgnoreCase: true, Natural: true})
+	if strings.Join(keys, ",") != "Node1,node9,node10" {
+		t.Errorf("unexpected key order %v", keys)
+	}
+
+	if _, err := jsonpath.SortBy(doc, "$.items", "missing", jsonpath.Collation{}); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	doc := storeExample.Value
+	for _, expr := range []string{
+		"$.store.book[?(@.price < 10)].title",
+		"$..book[-1:]",
+		"$.store.book[0,2].author",
+		"$.store.bicycle[/^c/]",
+		"$.store.book[?(length(@.title) > 20)].title",
+		"$.store.book.reverse()[0].title",
+		"$..*",
+	} {
+		original := jsonpath.MustNewPath(expr)
+		data, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		var restored jsonpath.JSONPath
+		if err := restored.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if restored.String() != original.String() || fmt.Sprint(restored.Features()) != fmt.Sprint(original.Features()) {
+			t.Errorf("%s: restored as %s with %v", expr, restored.String(), restored.Features())
+		}
+		want, wantPaths, _ := original.Eval(cty.Value(doc))
+		got, gotPaths, err := restored.Eval(cty.Value(doc))
+		if err != nil || !cty.TupleVal(got).RawEquals(cty.TupleVal(want)) || strings.Join(prettyPaths(gotPaths), " ") != strings.Join(prettyPaths(wantPaths), " ") {
+			t.Errorf("%s: got %#v at %v, %v", expr, got, prettyPaths(gotPaths), err)
+		}
+	}
+
+	var restored jsonpath.JSONPath
+	if err := restored.UnmarshalBinary([]byte("garbage")); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected ErrSyntax, got %v", err)
+	}
+}
+
+func TestMatchListInto(t *testing.T) {
+	doc := Obj(
+		kvPair("b", Tuple(Num(2), Num(1))),
+		kvPair("a", Obj(kvPair("n", Num(3)))),
+	)
+	var matches jsonpath.MatchList
+	for _, expr := range []string{"$.b[*]", "$.a.n"} {
+		m, err := jsonpath.MustNewPath(expr).EvalMatches(cty.Value(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, m...)
+	}
+	sort.Sort(matches)
+
+	var nums []int
+	if err := matches.Into(&nums); err != nil || fmt.Sprint(nums) != "[3 2 1]" {
+		t.Errorf("got %v, %v", nums, err)
+	}
+	var bools []bool
+	var pathErr *jsonpath.PathError
+	if err := matches.Into(&bools); !errors.As(err, &pathErr) || !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("expected a PathError of kind ErrTypeMismatch, got %v", err)
+	}
+	if err := matches.Into(nums); !errors.Is(err, jsonpath.ErrTypeMismatch) {
+		t.Errorf("Into should need a pointer, got %v", err)
+	}
+}
+
+func TestNetworkFunctions(t *testing.T) {
+	iface := func(name, address string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal(name), "address": cty.StringVal(address)})
+	}
+	ifaces := cty.TupleVal([]cty.Value{
+		iface("eth0", "10.1.2.3"),
+		iface("eth1", "192.168.0.7"),
+		iface("vpc", "10.20.0.0/16"),
+		iface("lo6", "::1"),
+		iface("bad", "localhost"),
+	})
+	assert(t, Val(ifaces), map[string]Val{
+		`$[?(cidr_contains('10.0.0.0/8', @.address))].name`: Tuple(Str("eth0"), Str("vpc")),
+		`$[?(cidr_contains('::/0', @.address))].name`:       Tuple(Str("lo6")),
+		`$[?(is_ip(@.address))].name`:                       Tuple(Str("eth0"), Str("eth1"), Str("lo6")),
+	})
+
+	if _, err := jsonpath.NewPath(`$[?(cidr_contains('10.0.0.0/33', @.address))]`); !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("a malformed literal CIDR must fail to compile, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package peek
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestQuotedKeys(t *testing.T) {
+	keys := []string{
+		"a.b", "it's", `a\`, `\'`, "a]b", "a,b", "a b", "a[0]", `"dq"`, `a'b"c`,
+		"*", "", "$", "@", "..", "(x)", "new\nline", "tab\t", "ünï", "\x00", "\xff\xfe",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []rune("ab.'\"\\[]()*,$@ \n\t?=<>ü\x00")
+	for i := 0; i < 200; i++ {
+		key := make([]rune, rnd.Intn(8))
+		for j := range key {
+			key[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		keys = append(keys, string(key))
+	}
+
+	for _, key := range keys {
+		doc := cty.ObjectVal(map[string]cty.Value{key: cty.True, "other": cty.False})
+		for _, path := range []cty.Path{cty.GetAttrPath(key), cty.IndexPath(cty.StringVal(key))} {
+			expr := "$" + jsonpath.PrettyCtyPath(path)
+			p, err := jsonpath.NewPath(expr)
+			if err != nil {
+				t.Errorf("%q: %s doesn't parse: %s", key, expr, err)
+				continue
+			}
+			vals, _, err := p.Eval(doc)
+			if err != nil || len(vals) != 1 || !vals[0].RawEquals(cty.True) {
+				t.Errorf("%q: %s selects %#v, %v", key, expr, vals, err)
+			}
+			// String() quotes keys the same way
+			if again, err := jsonpath.NewPath(p.String()); err != nil || again.String() != p.String() {
+				t.Errorf("%q: %s doesn't round-trip: %v", key, p.String(), err)
+			}
+		}
+	}
+
+	doc := cty.ObjectVal(map[string]cty.Value{"a.b": cty.NumberIntVal(1), "it's": cty.NumberIntVal(2), "x": cty.NumberIntVal(3)})
+	assert(t, Val(doc), map[string]Val{
+		`$['a.b']`:       Tuple(Num(1)),
+		`$["a.b"]`:       Tuple(Num(1)),
+		`$['it\'s']`:     Tuple(Num(2)),
+		`$["it's", 'x']`: Tuple(Num(2), Num(3)),
+	})
+	assert(t, Tuple(Str("it's"), Str(`a\`), Str("x")), map[string]Val{
+		`$[?(@ == 'it\'s')]`: Tuple(Str("it's")),
+		`$[?(@ == 'a\\')]`:   Tuple(Str(`a\`)),
+	})
+}
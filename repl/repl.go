@@ -0,0 +1,247 @@
+// Package repl is the core of an interactive JSONPath session over a
+// document, for CLIs and notebooks to embed: it parses and runs command
+// lines and leaves reading input and printing output to its host.
+//
+// A line is either a query, such as `$.spec.containers[*].image`, or one of
+// the commands:
+//
+//	set <path> = <JSON value>   store a value, like jsonpath.Set
+//	del <path>                  delete the matches, like jsonpath.Delete
+//	explain <path>              time the steps of a query
+//	let <name> = <path>         bind the matches to a name
+//	vars                        list the bound names
+//
+// Queries and bindings refer to bound names with $doc("name"). A name is
+// bound to the single match of its path, or to a tuple of the matches.
+package repl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Session holds the document and the bindings of a session. It's not safe
+// for concurrent use.
+type Session struct {
+	doc  cty.Value
+	vars map[string]cty.Value
+}
+
+// New starts a session over doc.
+func New(doc cty.Value) *Session {
+	return &Session{doc: doc, vars: map[string]cty.Value{}}
+}
+
+// Value returns the document as edited so far.
+func (s *Session) Value() cty.Value {
+	return s.doc
+}
+
+// Output is the result of a line. Only the fields of its command are set.
+type Output struct {
+	// Command is the command run, "query" for a query and "" for a blank
+	// line.
+	Command string
+	// Matches are the results of a query, or of the path of a let.
+	Matches jsonpath.MatchList
+	// Changes are the edits made by set and del.
+	Changes []jsonpath.Change
+	// Metrics are the step statistics of explain.
+	Metrics *jsonpath.Metrics
+	// Vars are the names listed by vars, sorted.
+	Vars []string
+}
+
+// String renders the output for a terminal.
+func (o Output) String() string {
+	switch o.Command {
+	case "query", "let":
+		if len(o.Matches) == 0 {
+			return "(no matches)"
+		}
+		return o.Matches.String()
+	case "set", "del":
+		if len(o.Changes) == 0 {
+			return "(no changes)"
+		}
+		lines := make([]string, len(o.Changes))
+		for i, c := range o.Changes {
+			lines[i] = formatChange(c)
+		}
+		return strings.Join(lines, "\n")
+	case "explain":
+		return strings.TrimSuffix(o.Metrics.String(), "\n")
+	case "vars":
+		return strings.Join(o.Vars, "\n")
+	}
+	return ""
+}
+
+func formatChange(c jsonpath.Change) string {
+	path := jsonpath.FormatPath(c.Path)
+	switch c.Op {
+	case jsonpath.OpAdd:
+		return fmt.Sprintf("+ %s: %s", path, jsonpath.DebugString(c.New))
+	case jsonpath.OpRemove:
+		return fmt.Sprintf("- %s: %s", path, jsonpath.DebugString(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", path, jsonpath.DebugString(c.Old), jsonpath.DebugString(c.New))
+}
+
+// Execute runs a line. Errors of the engine are returned as they are, so
+// they match the sentinel errors of jsonpath; a failed line leaves the
+// session unchanged.
+func (s *Session) Execute(line string) (Output, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return Output{}, nil
+	}
+	command, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		command, rest = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch command {
+	case "set":
+		return s.set(rest)
+	case "del":
+		return s.del(rest)
+	case "explain":
+		p, err := s.compile(rest)
+		if err != nil {
+			return Output{}, err
+		}
+		m, err := p.Explain(s.doc)
+		if err != nil {
+			return Output{}, err
+		}
+		return Output{Command: "explain", Metrics: m}, nil
+	case "let":
+		return s.let(rest)
+	case "vars":
+		names := make([]string, 0, len(s.vars))
+		for name := range s.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Output{Command: "vars", Vars: names}, nil
+	}
+	matches, err := s.query(line)
+	if err != nil {
+		return Output{}, err
+	}
+	return Output{Command: "query", Matches: matches}, nil
+}
+
+func (s *Session) compile(expr string) (*jsonpath.JSONPath, error) {
+	if expr == "" {
+		return nil, syntaxError("missing path")
+	}
+	return jsonpath.NewPath(expr, jsonpath.WithDocuments(func(name string) (cty.Value, bool) {
+		v, ok := s.vars[name]
+		return v, ok
+	}))
+}
+
+func (s *Session) query(expr string) (jsonpath.MatchList, error) {
+	p, err := s.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.EvalMatches(s.doc)
+}
+
+func (s *Session) set(args string) (Output, error) {
+	expr, value, ok := splitAssignment(args)
+	if !ok {
+		return Output{}, syntaxError("expected set <path> = <JSON value>")
+	}
+	v, err := jsonpath.DecodeJSONStrict([]byte(value))
+	if err != nil {
+		return Output{}, syntaxError("invalid value: " + err.Error())
+	}
+	var changes []jsonpath.Change
+	if _, err := jsonpath.Set(s.doc, expr, v, jsonpath.WithDryRun(&changes)); err != nil {
+		return Output{}, err
+	}
+	updated, err := jsonpath.Set(s.doc, expr, v)
+	if err != nil {
+		return Output{}, err
+	}
+	s.doc = updated
+	return Output{Command: "set", Changes: changes}, nil
+}
+
+func (s *Session) del(expr string) (Output, error) {
+	if expr == "" {
+		return Output{}, syntaxError("expected del <path>")
+	}
+	var changes []jsonpath.Change
+	if _, err := jsonpath.Delete(s.doc, expr, jsonpath.WithDryRun(&changes)); err != nil {
+		return Output{}, err
+	}
+	updated, err := jsonpath.Delete(s.doc, expr)
+	if err != nil {
+		return Output{}, err
+	}
+	s.doc = updated
+	return Output{Command: "del", Changes: changes}, nil
+}
+
+func (s *Session) let(args string) (Output, error) {
+	name, expr, ok := splitAssignment(args)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return Output{}, syntaxError("expected let <name> = <path>")
+	}
+	matches, err := s.query(expr)
+	if err != nil {
+		return Output{}, err
+	}
+	if len(matches) == 1 {
+		s.vars[name] = matches[0].Value
+	} else {
+		vals := make([]cty.Value, len(matches))
+		for i, m := range matches {
+			vals[i] = m.Value
+		}
+		s.vars[name] = cty.TupleVal(vals)
+	}
+	return Output{Command: "let", Matches: matches}, nil
+}
+
+func syntaxError(msg string) error {
+	return &jsonpath.Error{Kind: jsonpath.ErrSyntax, Msg: msg}
+}
+
+// splitAssignment splits `left = right` at the first = outside brackets,
+// parentheses and quotes that isn't part of a comparison operator.
+func splitAssignment(s string) (left, right string, ok bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(' || c == '{':
+			depth++
+		case c == ']' || c == ')' || c == '}':
+			depth--
+		case c == '=' && depth == 0:
+			if i+1 < len(s) && s[i+1] == '=' || i > 0 && strings.IndexByte("=!<>", s[i-1]) >= 0 {
+				continue
+			}
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,50 @@
+package peek
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/clean8s/peekcty/repl"
+)
+
+func TestREPL(t *testing.T) {
+	doc, _ := jsonpath.DecodeJSONStrict([]byte(`{"limits": {"size": 2}, "pods": [{"name": "a", "size": 1}, {"name": "b", "size": 3}]}`))
+	s := repl.New(doc)
+	run := func(line, want string) {
+		t.Helper()
+		out, err := s.Execute(line)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if out.String() != want {
+			t.Errorf("%s: unexpected output\n%s", line, out)
+		}
+	}
+
+	run(`$.pods[*].name`, "$.pods[0].name: \"a\"\n$.pods[1].name: \"b\"")
+	run(`let max = $.limits.size`, "$.limits.size: 2")
+	run(`$.pods[?(@.size > $doc("max"))].name`, `$.pods[1].name: "b"`)
+	run(`set $.pods[?(@.size == 1)].size = 5`, "~ $.pods[0].size: 1 -> 5")
+	run(`set $.limits.cpu = "500m"`, `+ $.limits.cpu: "500m"`)
+	run(`del $.pods[1]`, `- $.pods[1]: {"name": "b", "size": 3}`)
+	run(`$.nope`, "(no matches)")
+	run(`vars`, "max")
+	run(``, "")
+
+	out, err := s.Execute(`explain $.pods[*].name`)
+	if err != nil || out.Metrics == nil || !strings.HasPrefix(out.String(), "STEP") {
+		t.Errorf("unexpected explain %v, %v", out, err)
+	}
+
+	before := s.Value()
+	for _, line := range []string{`set $.a`, `set $.a = {`, `del`, `let = $.a`, `$.a[`} {
+		if _, err := s.Execute(line); !errors.Is(err, jsonpath.ErrSyntax) {
+			t.Errorf("%s: expected ErrSyntax, got %v", line, err)
+		}
+	}
+	if !s.Value().RawEquals(before) {
+		t.Error("failed lines changed the document")
+	}
+}
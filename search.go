@@ -0,0 +1,84 @@
+package peek
+
+import (
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Match is a value found by SearchE together with its location.
+type Match struct {
+	Path  cty.Path
+	Value Val
+}
+
+// Matches holds the results of SearchE in document order.
+type Matches []Match
+
+// Values returns just the matched values.
+func (m Matches) Values() []Val {
+	vals := make([]Val, len(m))
+	for i, match := range m {
+		vals[i] = match.Value
+	}
+	return vals
+}
+
+// Paths returns just the locations of the matches.
+func (m Matches) Paths() []cty.Path {
+	paths := make([]cty.Path, len(m))
+	for i, match := range m {
+		paths[i] = match.Path
+	}
+	return paths
+}
+
+// EvalOption tweaks how SearchE evaluates its path.
+type EvalOption func(*jsonpath.EvalOptions)
+
+// WithNumericKeys lets `[2023]` select the key "2023" of objects and maps.
+func WithNumericKeys() EvalOption {
+	return func(o *jsonpath.EvalOptions) { o.NumericKeys = true }
+}
+
+// WithPartialResults keeps the matches of union selectors that didn't fail.
+func WithPartialResults() EvalOption {
+	return func(o *jsonpath.EvalOptions) { o.PartialResults = true }
+}
+
+// WithMaxResultBytes caps the estimated size of intermediate and final
+// results.
+func WithMaxResultBytes(n int) EvalOption {
+	return func(o *jsonpath.EvalOptions) { o.MaxResultBytes = n }
+}
+
+// WithMetrics collects per-step timings and cardinalities into m.
+func WithMetrics(m *jsonpath.Metrics) EvalOption {
+	return func(o *jsonpath.EvalOptions) { o.Metrics = m }
+}
+
+// SearchE evaluates path against v and returns the matches with their
+// locations. Unlike Search, parse and evaluation errors are reported; with
+// WithPartialResults the matches found so far come back along with the
+// error.
+func (v Val) SearchE(path string, opts ...EvalOption) (Matches, error) {
+	p, err := jsonpath.NewPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var evalOpts jsonpath.EvalOptions
+	for _, opt := range opts {
+		opt(&evalOpts)
+	}
+	vals, paths, err := p.EvalWithOptions(cty.Value(v), evalOpts)
+	matches := make(Matches, len(vals))
+	for i := range vals {
+		matches[i] = Match{Path: paths[i], Value: Val(vals[i])}
+	}
+	return matches, err
+}
+
+// Render expands a kubectl-style template like "name={.metadata.name}"
+// against v (see jsonpath.RenderTemplate).
+func (v Val) Render(template string) (string, error) {
+	return jsonpath.RenderTemplate(template, cty.Value(v))
+}
@@ -0,0 +1,160 @@
+// Package tfbridge queries the JSON representation of Terraform state and
+// plans (`terraform show -json`) by resource address.
+package tfbridge
+
+import (
+	"strings"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Sensitive marks the values Terraform reports as sensitive, the same way
+// Terraform marks them internally.
+const Sensitive = Mark("sensitive")
+
+// Mark is the type of the marks applied by this package.
+type Mark string
+
+// State is a loaded Terraform state or plan.
+type State struct {
+	// Doc is the whole JSON document.
+	Doc       cty.Value
+	resources []Resource
+}
+
+// Resource is a single resource instance of a state or plan.
+type Resource struct {
+	Address string
+	Type    string
+	Name    string
+	// Values holds the attributes of the instance, with the ones listed in
+	// sensitive_values marked Sensitive.
+	Values cty.Value
+}
+
+// Load reads the output of `terraform show -json`, either of a state or of a
+// plan. For plans, the planned values are used.
+func Load(data []byte) (*State, error) {
+	var doc ctyjson.SimpleJSONValue
+	if err := doc.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	s := &State{Doc: doc.Value}
+	for _, root := range []string{"$.values.root_module", "$.planned_values.root_module"} {
+		p, err := jsonpath.NewPath(root)
+		if err != nil {
+			return nil, err
+		}
+		modules, _, err := p.Eval(doc.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range modules {
+			s.addModule(module)
+		}
+		if len(modules) > 0 {
+			break
+		}
+	}
+	return s, nil
+}
+
+func (s *State) addModule(module cty.Value) {
+	for _, res := range attrElements(module, "resources") {
+		r := Resource{
+			Address: stringAttr(res, "address"),
+			Type:    stringAttr(res, "type"),
+			Name:    stringAttr(res, "name"),
+			Values:  cty.EmptyObjectVal,
+		}
+		if values, ok := attr(res, "values"); ok {
+			r.Values = values
+			if sensitive, ok := attr(res, "sensitive_values"); ok {
+				r.Values = markSensitive(values, sensitive)
+			}
+		}
+		s.resources = append(s.resources, r)
+	}
+	for _, child := range attrElements(module, "child_modules") {
+		s.addModule(child)
+	}
+}
+
+// Resources returns the instances at address. An address without an index
+// key, like aws_instance.web, also matches every instance of a counted or
+// for_each resource (aws_instance.web[0], aws_instance.web["a"]).
+func (s *State) Resources(address string) Resources {
+	out := Resources{}
+	for _, r := range s.resources {
+		if r.Address == address || strings.HasPrefix(r.Address, address+"[") {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Resources is a list of resource instances.
+type Resources []Resource
+
+// Attr evaluates a path relative to the values of every instance, e.g.
+// "ami", "tags.Name" or "$.ebs_block_device[*].volume_size", and returns
+// all matches in instance order.
+func (rs Resources) Attr(path string) ([]cty.Value, error) {
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	p, err := jsonpath.NewPath(path)
+	if err != nil {
+		return nil, err
+	}
+	out := []cty.Value{}
+	for _, r := range rs {
+		vals, _, err := p.Eval(r.Values)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vals...)
+	}
+	return out, nil
+}
+
+// markSensitive marks every value of values whose counterpart in the
+// sensitive_values structure is true.
+func markSensitive(values, sensitive cty.Value) cty.Value {
+	marked, _ := cty.Transform(values, func(path cty.Path, v cty.Value) (cty.Value, error) {
+		if len(path) == 0 {
+			return v, nil
+		}
+		flag, err := path.Apply(sensitive)
+		if err != nil || flag.IsNull() || flag.Type() != cty.Bool || flag.False() {
+			return v, nil
+		}
+		return v.Mark(Sensitive), nil
+	})
+	return marked
+}
+
+func attr(v cty.Value, name string) (cty.Value, bool) {
+	if v.IsNull() || !v.Type().IsObjectType() || !v.Type().HasAttribute(name) {
+		return cty.NilVal, false
+	}
+	a := v.GetAttr(name)
+	return a, !a.IsNull()
+}
+
+func stringAttr(v cty.Value, name string) string {
+	if a, ok := attr(v, name); ok && a.Type() == cty.String {
+		return a.AsString()
+	}
+	return ""
+}
+
+func attrElements(v cty.Value, name string) []cty.Value {
+	a, ok := attr(v, name)
+	if !ok || !a.CanIterateElements() {
+		return nil
+	}
+	return a.AsValueSlice()
+}
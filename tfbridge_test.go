@@ -0,0 +1,65 @@
+package peek
+
+import (
+	"testing"
+
+	"github.com/clean8s/peekcty/tfbridge"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const tfState = `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_instance.web[0]", "type": "aws_instance", "name": "web", "index": 0,
+         "values": {"ami": "ami-1", "tags": {"Name": "web-0"}, "password": "hunter2"},
+         "sensitive_values": {"tags": {}, "password": true}},
+        {"address": "aws_instance.web[1]", "type": "aws_instance", "name": "web", "index": 1,
+         "values": {"ami": "ami-2", "tags": {"Name": "web-1"}, "password": "hunter3"},
+         "sensitive_values": {"tags": {}, "password": true}},
+        {"address": "aws_instance.webhook", "type": "aws_instance", "name": "webhook",
+         "values": {"ami": "ami-3"}, "sensitive_values": {}}
+      ],
+      "child_modules": [
+        {"address": "module.db", "resources": [
+          {"address": "module.db.aws_db_instance.main", "type": "aws_db_instance", "name": "main",
+           "values": {"engine": "postgres"}, "sensitive_values": {}}
+        ]}
+      ]
+    }
+  }
+}`
+
+func TestTerraformState(t *testing.T) {
+	state, err := tfbridge.Load([]byte(tfState))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amis, err := state.Resources("aws_instance.web").Attr("ami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amis) != 2 || amis[0].AsString() != "ami-1" || amis[1].AsString() != "ami-2" {
+		t.Errorf("unexpected amis %#v", amis)
+	}
+
+	names, _ := state.Resources("aws_instance.web[1]").Attr("tags.Name")
+	if len(names) != 1 || names[0].AsString() != "web-1" {
+		t.Errorf("unexpected names %#v", names)
+	}
+
+	passwords, _ := state.Resources("aws_instance.web").Attr("password")
+	if len(passwords) != 2 || !passwords[0].HasMark(tfbridge.Sensitive) {
+		t.Errorf("password should be marked sensitive: %#v", passwords)
+	}
+	if amis[0].HasMark(tfbridge.Sensitive) {
+		t.Error("ami shouldn't be marked sensitive")
+	}
+
+	engines, _ := state.Resources("module.db.aws_db_instance.main").Attr("engine")
+	if len(engines) != 1 || !engines[0].RawEquals(cty.StringVal("postgres")) {
+		t.Errorf("unexpected engines %#v", engines)
+	}
+}
@@ -238,6 +238,24 @@ func (v Val) AsInt64() int64 {
 	return ret
 }
 
+// AsInt64Exact is AsInt64 failing with jsonpath.ErrOverflow, rather than
+// truncating, for numbers that aren't integers or don't fit an int64.
+func (v Val) AsInt64Exact() (int64, error) {
+	return jsonpath.Match{Value: v.CtyValue()}.AsInt64Exact()
+}
+
+// AsUint64 returns the number as a uint64, failing with
+// jsonpath.ErrOverflow for numbers that aren't integers or don't fit.
+func (v Val) AsUint64() (uint64, error) {
+	return jsonpath.Match{Value: v.CtyValue()}.AsUint64()
+}
+
+// AsDecimalString returns the number in plain decimal notation, without
+// loss of precision.
+func (v Val) AsDecimalString() (string, error) {
+	return jsonpath.Match{Value: v.CtyValue()}.AsDecimalString()
+}
+
 func (v Val) AsFloat() float64 {
 	ret, _ := v.AsBigFloat().Float64()
 	return ret
@@ -250,6 +268,9 @@ func (v Val) AsBigFloat() *big.Float {
 	return v.CtyValue().AsBigFloat()
 }
 
+// AsBool returns the value of a bool, and false for any other type. Truthy
+// is the lenient form, accepting non-empty strings, non-zero numbers and so
+// on.
 func (v Val) AsBool() bool {
 	if !v.Is(BoolType) {
 		return false
@@ -257,6 +278,11 @@ func (v Val) AsBool() bool {
 	return v.CtyValue().True()
 }
 
+// Truthy applies jsonpath.Truthy, the rule filters use for conditions.
+func (v Val) Truthy() bool {
+	return jsonpath.Truthy(v.CtyValue())
+}
+
 type Child struct { Key Val; Value Val; KeyRepresentsPosition bool }
 type Children []Child
 
@@ -298,6 +324,8 @@ func (kv Children) TryStringMap() map[string]Val {
 	return ret
 }
 
+// Search returns the values matched by jsonPath, or nil if it doesn't parse
+// or fails to evaluate. Use SearchE to tell those cases apart.
 func (v Val) Search(jsonPath string) []Val {
 	p, err := jsonpath.NewPath(jsonPath)
 	if err != nil {
@@ -311,7 +339,7 @@ func (v Val) Len() int {
 }
 
 func (v Val) MarshalJSON() ([]byte, error) {
-	s := json.SimpleJSONValue{cty.Value(v)}
+	s := json.SimpleJSONValue{Value: cty.Value(v)}
 	return s.MarshalJSON()
 }
 
@@ -0,0 +1,100 @@
+package peek
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestValidator(t *testing.T) {
+	doc := cty.ObjectVal(map[string]cty.Value{
+		"ports": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80), "protocol": cty.StringVal("TCP")}),
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(70000), "protocol": cty.StringVal("SCTP")}),
+		}),
+		"name": cty.StringVal("Web"),
+	})
+
+	v, err := jsonpath.NewValidator(
+		jsonpath.Rule{Path: "$..port", Check: jsonpath.Between(1, 65535)},
+		jsonpath.Rule{Path: "$..port", Expr: "@ >= 1 && @ <= 65535"},
+		jsonpath.Rule{Path: "$.ports[*].protocol", Expr: "@ == 'TCP' || @ == 'UDP'", Message: "unsupported protocol"},
+		jsonpath.Rule{Path: "$.name", Check: jsonpath.Matches(regexp.MustCompile(`^[a-z]+$`))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := v.Validate(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"$.ports[1].port: 70000 is not between 1 and 65535",
+		"$.ports[1].port: does not satisfy @ >= 1 && @ <= 65535",
+		"$.ports[1].protocol: unsupported protocol",
+		"$.name: must match ^[a-z]+$",
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("got %d violations, want %d: %v", len(violations), len(want), violations)
+	}
+	for i, violation := range violations {
+		if violation.Error() != want[i] {
+			t.Errorf("violation %d: got %q, want %q", i, violation.Error(), want[i])
+		}
+	}
+
+	_, err = jsonpath.NewValidator(jsonpath.Rule{Path: "$.a", Expr: "@ > 1 && "})
+	if !errors.Is(err, jsonpath.ErrSyntax) {
+		t.Errorf("expected ErrSyntax, got %v", err)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{
+		"replicas": 1,
+		"name": "web-frontend",
+		"containers": [
+			{"name": "app", "image": "nginx:1.25"},
+			{"name": "sidecar", "image": "envoy"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pass := range []struct {
+		path  string
+		check jsonpath.Check
+	}{
+		{"$.replicas", jsonpath.Eq(cty.NumberIntVal(1))},
+		{"$.replicas", jsonpath.Lte(3)},
+		{"$.name", jsonpath.MatchesRegex(`^web-`)},
+		{"$.containers", jsonpath.LenBetween(1, 2)},
+		{"$.containers[*].name", jsonpath.LenBetween(3, 10)},
+	} {
+		if err := jsonpath.Assert(doc, pass.path, pass.check); err != nil {
+			t.Errorf("%s: unexpected failure %v", pass.path, err)
+		}
+	}
+
+	err = jsonpath.Assert(doc, "$.replicas", jsonpath.Gte(2), jsonpath.Eq(cty.NumberIntVal(1)))
+	var multi *jsonpath.MultiPathError
+	if !errors.As(err, &multi) || len(multi.Errors) != 1 || multi.Error() != "1 errors occurred: $.replicas: 1 is not >= 2" {
+		t.Errorf("unexpected failures %v", err)
+	}
+
+	err = jsonpath.Assert(doc, "$.containers", jsonpath.Each(jsonpath.Each(jsonpath.MatchesRegex(`^[a-z]+$`))))
+	var violation jsonpath.Violation
+	if !errors.As(err, &multi) || len(multi.Errors) != 1 || !errors.As(multi.Errors[0], &violation) {
+		t.Fatalf("unexpected failures %v", err)
+	}
+	if !violation.Path.Equals(cty.GetAttrPath("containers").IndexInt(0).GetAttr("image")) || violation.Value.AsString() != "nginx:1.25" {
+		t.Errorf("unexpected violation %+v", violation)
+	}
+
+	if err := jsonpath.Assert(doc, "$.spec.replicas", jsonpath.Gte(1)); !errors.Is(err, jsonpath.ErrNotFound) {
+		t.Errorf("expected a missing value to fail, got %v", err)
+	}
+}
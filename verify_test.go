@@ -0,0 +1,85 @@
+package peek
+
+import (
+	"testing"
+
+	"github.com/clean8s/peekcty/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var verifyExprs = []string{
+	"$", "$.a", "$..a", "$.*", "$[*]", "$..*", "$.a[0]", "$.a[-1]", "$.a[1:3]", "$.a[::-1]",
+	"$.a[0,1]", "$.a[?(@.b > 1)]", "$..[?(@.b)]", "$.a[?(length(@) > 1)]", "$['a','b']",
+	"$.a[/^b/]", "$..a[0:2:0]", "$[0]", "$.a.length", "$..b..c", "$.a[?(@.b == true)]",
+	"$..b[?(false)]", "$.a[0,?(@.b)]", "$..-",
+}
+
+func verifyDoc() cty.Value {
+	doc, err := jsonpath.DecodeJSONStrict([]byte(`{"a": [{"b": 2, "c": [1, 2]}, {"b": "x"}, 3, null, []], "b": {"c": {"b": true}}}`))
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+func TestVerify(t *testing.T) {
+	doc := verifyDoc()
+	for _, expr := range verifyExprs {
+		if err := jsonpath.Verify(doc, expr); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	for _, expr := range verifyExprs {
+		f.Add(expr)
+	}
+	doc := verifyDoc()
+	f.Fuzz(func(t *testing.T, expr string) {
+		if err := jsonpath.Verify(doc, expr); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestGenerateValue(t *testing.T) {
+	schema := cty.ObjectWithOptionalAttrs(map[string]cty.Type{
+		"name":   cty.String,
+		"ports":  cty.List(cty.Number),
+		"labels": cty.Map(cty.String),
+		"tags":   cty.Set(cty.String),
+		"pair":   cty.Tuple([]cty.Type{cty.Bool, cty.DynamicPseudoType}),
+		"extra":  cty.DynamicPseudoType,
+		"nested": cty.List(cty.Object(map[string]cty.Type{"x": cty.DynamicPseudoType})),
+	}, []string{"extra"})
+	opts := jsonpath.GenerateOptions{MaxElements: 3, Nulls: true}
+	for seed := int64(0); seed < 200; seed++ {
+		doc := jsonpath.GenerateValue(schema, seed, opts)
+		if !doc.RawEquals(jsonpath.GenerateValue(schema, seed, opts)) {
+			t.Fatalf("seed %d: values differ", seed)
+		}
+		if !doc.IsNull() {
+			if errs := doc.Type().TestConformance(cty.Object(schema.AttributeTypes())); len(errs) > 0 {
+				t.Fatalf("seed %d: %#v doesn't conform: %v", seed, doc, errs)
+			}
+			if ports := doc.GetAttr("ports"); !ports.IsNull() && ports.LengthInt() > 3 {
+				t.Errorf("seed %d: %d ports", seed, ports.LengthInt())
+			}
+		}
+		for _, expr := range verifyExprs {
+			if err := jsonpath.Verify(doc, expr); err != nil {
+				t.Fatalf("seed %d: %s", seed, err)
+			}
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		doc := jsonpath.GenerateValue(cty.DynamicPseudoType, seed, jsonpath.GenerateOptions{})
+		for _, expr := range verifyExprs {
+			if err := jsonpath.Verify(doc, expr); err != nil {
+				t.Fatalf("seed %d: %s", seed, err)
+			}
+		}
+	}
+}